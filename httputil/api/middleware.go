@@ -4,17 +4,18 @@ import (
 	"net/http"
 	"time"
 
-	"github.com/puppetlabs/leg/logging"
 	"github.com/puppetlabs/leg/request"
 )
 
+// RequestMiddleware attaches a request to the context of each HTTP request. The
+// request continues the trace propagated by the W3C trace context headers, if
+// present, and its identifier and trace IDs are added to the logging context.
 func RequestMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ri := request.New()
+		ri := RequestFromHeaders(r.Header)
 
 		ctx := r.Context()
 		ctx = request.NewContext(ctx, ri)
-		ctx = logging.NewContext(ctx, "request", ri.Identifier)
 
 		r = r.WithContext(ctx)
 		next.ServeHTTP(w, r)
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/puppetlabs/leg/request"
+)
+
+// RequestFromHeaders creates a request using the W3C trace context and baggage
+// headers of an incoming HTTP request. If the headers do not contain a valid
+// trace parent, the returned request starts a new trace. Invalid trace state or
+// baggage is discarded.
+func RequestFromHeaders(h http.Header) *request.Request {
+	baggage, err := request.ParseBaggage(strings.Join(h.Values(request.BaggageHeader), ","))
+	if err != nil {
+		baggage = nil
+	}
+
+	// A request with more than one traceparent header is invalid.
+	tps := h.Values(request.TraceParentHeader)
+	if len(tps) != 1 {
+		ri := request.New()
+		ri.Baggage = baggage
+		return ri
+	}
+
+	tp, err := request.ParseTraceParent(tps[0])
+	if err != nil {
+		ri := request.New()
+		ri.Baggage = baggage
+		return ri
+	}
+
+	ts, err := request.ParseTraceState(strings.Join(h.Values(request.TraceStateHeader), ","))
+	if err != nil {
+		ts = nil
+	}
+
+	return request.NewRemoteChild(tp, ts, baggage)
+}
+
+// SetTraceHeaders sets the W3C trace context and baggage headers for an
+// outgoing HTTP request using the request attached to the given context, if
+// any.
+func SetTraceHeaders(ctx context.Context, h http.Header) {
+	ri, ok := request.FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	h.Set(request.TraceParentHeader, ri.TraceParent().String())
+
+	if len(ri.TraceState) > 0 {
+		h.Set(request.TraceStateHeader, ri.TraceState.String())
+	} else {
+		h.Del(request.TraceStateHeader)
+	}
+
+	if len(ri.Baggage) > 0 {
+		h.Set(request.BaggageHeader, ri.Baggage.String())
+	} else {
+		h.Del(request.BaggageHeader)
+	}
+}
+
+type traceTransport struct {
+	delegate http.RoundTripper
+}
+
+func (tt *traceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if _, ok := request.FromContext(r.Context()); ok {
+		// Round trippers must not modify the request.
+		r = r.Clone(r.Context())
+		SetTraceHeaders(r.Context(), r.Header)
+	}
+
+	return tt.delegate.RoundTrip(r)
+}
+
+// NewTraceTransport returns an HTTP round tripper that propagates the trace of
+// the request attached to the context of each outgoing HTTP request using
+// SetTraceHeaders. If the delegate is nil, http.DefaultTransport is used.
+func NewTraceTransport(delegate http.RoundTripper) http.RoundTripper {
+	if delegate == nil {
+		delegate = http.DefaultTransport
+	}
+
+	return &traceTransport{delegate: delegate}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/puppetlabs/leg/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMiddlewareTraceContext(t *testing.T) {
+	var ri *request.Request
+	handler := RequestMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		ri, ok = request.FromContext(r.Context())
+		require.True(t, ok)
+	}))
+
+	req, err := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	require.NoError(t, err)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Add("tracestate", "rojo=00f067aa0ba902b7")
+	req.Header.Add("tracestate", "congo=t61rcWkgMzE")
+	req.Header.Set("baggage", "userId=alice, serverNode=DF%2028;prop=1")
+
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, ri)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", ri.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", ri.ParentSpanID.String())
+	assert.True(t, ri.SpanID.IsValid())
+	assert.NotEqual(t, ri.ParentSpanID, ri.SpanID)
+	assert.True(t, ri.TraceFlags.IsSampled())
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", ri.TraceState.String())
+	assert.Equal(t, request.Baggage{"userId": "alice", "serverNode": "DF 28"}, ri.Baggage)
+
+	// The trace continues to outgoing requests from this span.
+	out := make(http.Header)
+	SetTraceHeaders(request.NewContext(req.Context(), ri), out)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+ri.SpanID.String()+"-01", out.Get("traceparent"))
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", out.Get("tracestate"))
+	assert.Equal(t, "serverNode=DF%2028,userId=alice", out.Get("baggage"))
+}
+
+func TestRequestFromHeadersInvalid(t *testing.T) {
+	tests := []struct {
+		Name        string
+		TraceParent []string
+	}{
+		{Name: "missing"},
+		{Name: "short", TraceParent: []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"}},
+		{Name: "uppercase", TraceParent: []string{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"}},
+		{Name: "zero trace ID", TraceParent: []string{"00-00000000000000000000000000000000-00f067aa0ba902b7-01"}},
+		{Name: "zero span ID", TraceParent: []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"}},
+		{Name: "forbidden version", TraceParent: []string{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}},
+		{Name: "trailing data for version 00", TraceParent: []string{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"}},
+		{Name: "duplicate", TraceParent: []string{
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			h := make(http.Header)
+			for _, tp := range test.TraceParent {
+				h.Add("traceparent", tp)
+			}
+			h.Set("baggage", "a=b")
+
+			ri := RequestFromHeaders(h)
+			assert.True(t, ri.TraceID.IsValid())
+			assert.NotEqual(t, "4bf92f3577b34da6a3ce929d0e0e4736", ri.TraceID.String())
+			assert.False(t, ri.ParentSpanID.IsValid())
+			assert.Equal(t, request.Baggage{"a": "b"}, ri.Baggage)
+		})
+	}
+}
+
+func TestRequestFromHeadersFutureVersion(t *testing.T) {
+	h := make(http.Header)
+	h.Set("traceparent", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	h.Set("tracestate", "invalid key=value")
+
+	ri := RequestFromHeaders(h)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", ri.TraceID.String())
+	assert.False(t, ri.TraceFlags.IsSampled())
+	assert.Empty(t, ri.TraceState)
+}
+
+func TestTraceTransport(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer srv.Close()
+
+	ri := request.New()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	req = req.WithContext(request.NewContext(req.Context(), ri))
+
+	resp, err := (&http.Client{Transport: NewTraceTransport(nil)}).Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, ri.TraceParent().String(), got.Get("traceparent"))
+	assert.Empty(t, req.Header.Get("traceparent"), "original request modified")
+}
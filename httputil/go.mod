@@ -13,3 +13,8 @@ require (
 	github.com/stretchr/testify v1.6.1
 	golang.org/x/text v0.3.4
 )
+
+replace (
+	github.com/puppetlabs/leg/logging => ../logging
+	github.com/puppetlabs/leg/request => ../request
+)
@@ -0,0 +1,190 @@
+// Package leaderlease provides a leader lease backed by a Kubernetes Lease
+// object in the coordination.k8s.io API group.
+//
+// A Lease conforms to the LeaderLease interface of the Leg scheduler package,
+// so it can be used with a leader election descriptor to run scheduled work on
+// a single replica of an application.
+package leaderlease
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LeaseOptions contains fields that configure a lease.
+type LeaseOptions struct {
+	// Clock is the clock used to record and compare renewal times. If not
+	// specified, the system clock is used.
+	Clock clock.Clock
+}
+
+// LeaseOption is a setter for one or more lease options.
+type LeaseOption interface {
+	// ApplyToLeaseOptions configures the specified lease options for this
+	// option.
+	ApplyToLeaseOptions(target *LeaseOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *LeaseOptions) ApplyOptions(opts []LeaseOption) {
+	for _, opt := range opts {
+		opt.ApplyToLeaseOptions(o)
+	}
+}
+
+// LeaseOptionFunc allows a function to be used as a lease option.
+type LeaseOptionFunc func(target *LeaseOptions)
+
+var _ LeaseOption = LeaseOptionFunc(nil)
+
+// ApplyToLeaseOptions configures the specified lease options by calling this
+// function.
+func (lof LeaseOptionFunc) ApplyToLeaseOptions(target *LeaseOptions) {
+	lof(target)
+}
+
+// WithClock changes the clock to the specified one.
+func WithClock(c clock.Clock) LeaseOption {
+	return LeaseOptionFunc(func(target *LeaseOptions) {
+		target.Clock = c
+	})
+}
+
+// Lease is a handle to a Kubernetes Lease object used as a leader lease.
+//
+// The holder identity, lease duration, and renew time of the object are
+// managed using the same conventions as the client-go leader election package.
+// Concurrent updates are detected using the resource version of the object.
+type Lease struct {
+	cl       client.Client
+	key      client.ObjectKey
+	identity string
+	clock    clock.Clock
+}
+
+func (l *Lease) expired(obj *coordinationv1.Lease, now time.Time) bool {
+	if obj.Spec.RenewTime == nil || obj.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+
+	d := time.Duration(*obj.Spec.LeaseDurationSeconds) * time.Second
+	return !obj.Spec.RenewTime.Add(d).After(now)
+}
+
+// TryAcquireOrRenew acquires the lease for the identity of this handle if no
+// other identity holds it, or renews it if this identity already holds it. It
+// returns true if this identity holds the lease for the given duration, which
+// is rounded up to the nearest second.
+func (l *Lease) TryAcquireOrRenew(ctx context.Context, duration time.Duration) (bool, error) {
+	now := l.clock.Now()
+	renewTime := metav1.NewMicroTime(now)
+	durationSeconds := int32(math.Ceil(duration.Seconds()))
+
+	obj := &coordinationv1.Lease{}
+	if err := l.cl.Get(ctx, l.key, obj); k8serrors.IsNotFound(err) {
+		obj = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: l.key.Namespace,
+				Name:      l.key.Name,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &renewTime,
+				RenewTime:            &renewTime,
+			},
+		}
+
+		if err := l.cl.Create(ctx, obj); k8serrors.IsAlreadyExists(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var holder string
+	if obj.Spec.HolderIdentity != nil {
+		holder = *obj.Spec.HolderIdentity
+	}
+
+	if holder != l.identity {
+		if holder != "" && !l.expired(obj, now) {
+			return false, nil
+		}
+
+		var transitions int32
+		if obj.Spec.LeaseTransitions != nil {
+			transitions = *obj.Spec.LeaseTransitions
+		}
+		transitions++
+
+		obj.Spec.HolderIdentity = &l.identity
+		obj.Spec.AcquireTime = &renewTime
+		obj.Spec.LeaseTransitions = &transitions
+	}
+
+	obj.Spec.LeaseDurationSeconds = &durationSeconds
+	obj.Spec.RenewTime = &renewTime
+
+	if err := l.cl.Update(ctx, obj); k8serrors.IsConflict(err) {
+		// Another process updated the lease since we retrieved it.
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Release clears the holder of the lease if the identity of this handle holds
+// it.
+func (l *Lease) Release(ctx context.Context) error {
+	obj := &coordinationv1.Lease{}
+	if err := l.cl.Get(ctx, l.key, obj); k8serrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if obj.Spec.HolderIdentity == nil || *obj.Spec.HolderIdentity != l.identity {
+		return nil
+	}
+
+	obj.Spec.HolderIdentity = nil
+	obj.Spec.AcquireTime = nil
+	obj.Spec.RenewTime = nil
+
+	if err := l.cl.Update(ctx, obj); err != nil && !k8serrors.IsConflict(err) {
+		return err
+	}
+
+	return nil
+}
+
+// NewLease creates a new handle to the Lease object with the given key. The
+// identity must be unique to the current process, such as a pod name. The
+// object is created when the lease is first acquired.
+func NewLease(cl client.Client, key client.ObjectKey, identity string, opts ...LeaseOption) *Lease {
+	o := &LeaseOptions{
+		Clock: clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	return &Lease{
+		cl:       cl,
+		key:      key,
+		identity: identity,
+		clock:    o.Clock,
+	}
+}
@@ -0,0 +1,79 @@
+package leaderlease_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/k8sutil/pkg/app/leaderlease"
+	"github.com/puppetlabs/leg/k8sutil/pkg/test/controller/fake"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+
+	cl := fake.NewClient()
+	key := client.ObjectKey{Namespace: "default", Name: "test"}
+
+	fc := testclock.NewFakeClock(time.Now())
+	a := leaderlease.NewLease(cl, key, "a", leaderlease.WithClock(k8sext.NewClock(fc)))
+	b := leaderlease.NewLease(cl, key, "b", leaderlease.WithClock(k8sext.NewClock(fc)))
+
+	held, err := a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	obj := &coordinationv1.Lease{}
+	require.NoError(t, cl.Get(ctx, key, obj))
+	require.NotNil(t, obj.Spec.HolderIdentity)
+	assert.Equal(t, "a", *obj.Spec.HolderIdentity)
+	require.NotNil(t, obj.Spec.LeaseDurationSeconds)
+	assert.Equal(t, int32(10), *obj.Spec.LeaseDurationSeconds)
+
+	held, err = b.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// Renewal extends the lease.
+	fc.Step(5 * time.Second)
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	fc.Step(5 * time.Second)
+	held, err = b.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// Once the lease expires, another process can take it over.
+	fc.Step(5 * time.Second)
+	held, err = b.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	require.NoError(t, cl.Get(ctx, key, obj))
+	require.NotNil(t, obj.Spec.LeaseTransitions)
+	assert.Equal(t, int32(1), *obj.Spec.LeaseTransitions)
+
+	// Releasing a lease we don't hold does nothing.
+	require.NoError(t, a.Release(ctx))
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// Once released, the lease can be acquired immediately.
+	require.NoError(t, b.Release(ctx))
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+}
@@ -8,17 +8,36 @@ const (
 	argsContextKey contextKey = iota
 )
 
+// NewContext returns a context with the given arguments added to the
+// arguments of any loggers built using it. If an argument with the same key is
+// already present in the context, it is replaced.
 func NewContext(ctx context.Context, args ...interface{}) context.Context {
 	args = normalize(args)
 
-	next, ok := ctx.Value(argsContextKey).([]interface{})
-	if ok {
-		next = append([]interface{}{}, next...)
-		next = append(next, args...)
-	} else {
-		next = args
+	prev, ok := ctx.Value(argsContextKey).([]interface{})
+	if !ok {
+		return context.WithValue(ctx, argsContextKey, args)
 	}
 
+	keys := make(map[string]struct{}, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		if k, ok := args[i].(string); ok {
+			keys[k] = struct{}{}
+		}
+	}
+
+	next := make([]interface{}, 0, len(prev)+len(args))
+	for i := 0; i+1 < len(prev); i += 2 {
+		if k, ok := prev[i].(string); ok {
+			if _, found := keys[k]; found {
+				continue
+			}
+		}
+
+		next = append(next, prev[i], prev[i+1])
+	}
+	next = append(next, args...)
+
 	return context.WithValue(ctx, argsContextKey, next)
 }
 
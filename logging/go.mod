@@ -3,7 +3,10 @@ module github.com/puppetlabs/leg/logging
 go 1.14
 
 require (
-	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/go-stack/stack v1.8.0
 	github.com/inconshreveable/log15 v0.0.0-20201112154412-8562bdadbbac
 	github.com/mattn/go-colorable v0.1.8 // indirect
+	github.com/puppetlabs/leg/timeutil v0.4.2
+	github.com/stretchr/testify v1.6.1
+	k8s.io/apimachinery v0.20.1
 )
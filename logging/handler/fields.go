@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/inconshreveable/log15"
+)
+
+// Field names used by the structured formatters. Context keys that conflict
+// with these names are written with ConflictPrefix prepended.
+const (
+	TimeKey    = "time"
+	LevelKey   = "level"
+	MessageKey = "message"
+	PackageKey = "package"
+	StackKey   = "stack"
+
+	ConflictPrefix = "ctx_"
+)
+
+func levelName(lvl log15.Lvl) string {
+	switch lvl {
+	case log15.LvlDebug:
+		return "debug"
+	case log15.LvlInfo:
+		return "info"
+	case log15.LvlWarn:
+		return "warn"
+	case log15.LvlError:
+		return "error"
+	case log15.LvlCrit:
+		return "crit"
+	default:
+		return fmt.Sprintf("level(%d)", int(lvl))
+	}
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// recordFields returns the fields of a record in a stable order: the time,
+// level, message, and package first, followed by the remaining context keys in
+// the order they were added. If a context key appears more than once, the last
+// value wins but the key keeps its original position.
+func recordFields(r *log15.Record) []field {
+	fields := []field{
+		{key: TimeKey, value: r.Time},
+		{key: LevelKey, value: levelName(r.Lvl)},
+		{key: MessageKey, value: r.Msg},
+	}
+
+	var pkg interface{}
+	var ctx []field
+	indices := make(map[string]int)
+
+	for i := 0; i+1 < len(r.Ctx); i += 2 {
+		k := fmt.Sprintf("%v", r.Ctx[i])
+		v := r.Ctx[i+1]
+
+		switch k {
+		case PackageKey:
+			pkg = v
+			continue
+		case TimeKey, LevelKey, MessageKey:
+			k = ConflictPrefix + k
+		}
+
+		if idx, ok := indices[k]; ok {
+			ctx[idx].value = v
+			continue
+		}
+
+		indices[k] = len(ctx)
+		ctx = append(ctx, field{key: k, value: v})
+	}
+
+	if pkg != nil {
+		fields = append(fields, field{key: PackageKey, value: pkg})
+	}
+
+	return append(fields, ctx...)
+}
+
+// structuredValue converts a context value to a value that can be represented
+// by a structured formatter. Errors become their messages, call stacks become
+// a list of frames, and maps keyed by strings (including logging.Ctx) become
+// maps with converted values.
+func structuredValue(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case nil:
+		return nil
+	case time.Time:
+		return vt.Format(time.RFC3339Nano)
+	case time.Duration:
+		return vt.String()
+	case stack.CallStack:
+		frames := make([]string, len(vt))
+		for i, call := range vt {
+			frames[i] = fmt.Sprintf("%+v", call)
+		}
+		return frames
+	case stack.Call:
+		return fmt.Sprintf("%+v", vt)
+	case error:
+		return vt.Error()
+	case json.Marshaler:
+		return vt
+	case encoding.TextMarshaler:
+		return vt
+	case fmt.Stringer:
+		return vt.String()
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		m := make(map[string]interface{}, rv.Len())
+		for _, k := range rv.MapKeys() {
+			m[k.String()] = structuredValue(rv.MapIndex(k).Interface())
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			break
+		}
+
+		s := make([]interface{}, rv.Len())
+		for i := range s {
+			s[i] = structuredValue(rv.Index(i).Interface())
+		}
+		return s
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+
+	return v
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,22 @@
+package handler
+
+import (
+	"strings"
+
+	"github.com/inconshreveable/log15"
+)
+
+// FormatterNamed returns the formatter with the given case-insensitive name,
+// which must be one of "standard", "json", or "logfmt".
+func FormatterNamed(name string) (log15.Format, bool) {
+	switch strings.ToLower(name) {
+	case "standard":
+		return StandardFormatter, true
+	case "json":
+		return JSONFormatter, true
+	case "logfmt":
+		return LogfmtFormatter, true
+	default:
+		return nil, false
+	}
+}
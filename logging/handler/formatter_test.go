@@ -0,0 +1,133 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/inconshreveable/log15"
+	"github.com/puppetlabs/leg/logging/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var formatterTestTime = time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC)
+
+type formatterTest struct {
+	Name           string
+	Lvl            log15.Lvl
+	Msg            string
+	Ctx            []interface{}
+	ExpectedJSON   string
+	ExpectedLogfmt string
+}
+
+func (tt formatterTest) record() *log15.Record {
+	return &log15.Record{
+		Time: formatterTestTime,
+		Lvl:  tt.Lvl,
+		Msg:  tt.Msg,
+		Ctx:  tt.Ctx,
+	}
+}
+
+func formatterTests() []formatterTest {
+	call := stack.Caller(0)
+	cs := stack.CallStack{call, call}
+
+	return []formatterTest{
+		{
+			Name:           "Message only",
+			Lvl:            log15.LvlInfo,
+			Msg:            "hello",
+			ExpectedJSON:   `{"time":"2021-03-04T05:06:07.000000008Z","level":"info","message":"hello"}`,
+			ExpectedLogfmt: `time=2021-03-04T05:06:07.000000008Z level=info message=hello`,
+		},
+		{
+			Name:           "Package and context",
+			Lvl:            log15.LvlDebug,
+			Msg:            "request handled",
+			Ctx:            []interface{}{"status", 200, "package", "leg/logging", "path", "/healthz", "took", 1500 * time.Millisecond},
+			ExpectedJSON:   `{"time":"2021-03-04T05:06:07.000000008Z","level":"debug","message":"request handled","package":"leg/logging","status":200,"path":"/healthz","took":"1.5s"}`,
+			ExpectedLogfmt: `time=2021-03-04T05:06:07.000000008Z level=debug message="request handled" package=leg/logging status=200 path=/healthz took=1.5s`,
+		},
+		{
+			Name:           "Conflicting and repeated keys",
+			Lvl:            log15.LvlWarn,
+			Msg:            "conflict",
+			Ctx:            []interface{}{"message", "shadowed", "a", 1, "level", "x", "a", 2},
+			ExpectedJSON:   `{"time":"2021-03-04T05:06:07.000000008Z","level":"warn","message":"conflict","ctx_message":"shadowed","a":2,"ctx_level":"x"}`,
+			ExpectedLogfmt: `time=2021-03-04T05:06:07.000000008Z level=warn message=conflict ctx_message=shadowed a=2 ctx_level=x`,
+		},
+		{
+			Name:           "Escaping",
+			Lvl:            log15.LvlError,
+			Msg:            "quote \" backslash \\ newline \n",
+			Ctx:            []interface{}{"key with=space", "a=b", "empty", "", "tab", "\t", "nil", nil, "", "blank"},
+			ExpectedJSON:   `{"time":"2021-03-04T05:06:07.000000008Z","level":"error","message":"quote \" backslash \\ newline \n","key with=space":"a=b","empty":"","tab":"\t","nil":null,"":"blank"}`,
+			ExpectedLogfmt: `time=2021-03-04T05:06:07.000000008Z level=error message="quote \" backslash \\ newline \n" key_with_space="a=b" empty="" tab="\t" nil=nil _=blank`,
+		},
+		{
+			Name:           "Errors and nested maps",
+			Lvl:            log15.LvlCrit,
+			Msg:            "failed",
+			Ctx:            []interface{}{"error", errors.New("boom"), "ctx", map[string]interface{}{"b": 2, "a": map[string]interface{}{"c": "d e"}}},
+			ExpectedJSON:   `{"time":"2021-03-04T05:06:07.000000008Z","level":"crit","message":"failed","error":"boom","ctx":{"a":{"c":"d e"},"b":2}}`,
+			ExpectedLogfmt: `time=2021-03-04T05:06:07.000000008Z level=crit message=failed error=boom ctx.a.c="d e" ctx.b=2`,
+		},
+		{
+			Name:           "Caller and stack",
+			Lvl:            log15.LvlInfo,
+			Msg:            "trace",
+			Ctx:            []interface{}{"caller", call, "stack", cs},
+			ExpectedJSON:   fmt.Sprintf(`{"time":"2021-03-04T05:06:07.000000008Z","level":"info","message":"trace","caller":%q,"stack":[%q,%q]}`, fmt.Sprintf("%+v", call), fmt.Sprintf("%+v", call), fmt.Sprintf("%+v", call)),
+			ExpectedLogfmt: fmt.Sprintf(`time=2021-03-04T05:06:07.000000008Z level=info message=trace caller=%s stack="[%+v %+v]"`, fmt.Sprintf("%+v", call), call, call),
+		},
+	}
+}
+
+func TestJSONFormatter(t *testing.T) {
+	for _, test := range formatterTests() {
+		t.Run(test.Name, func(t *testing.T) {
+			b := handler.JSONFormatter.Format(test.record())
+			assert.Equal(t, test.ExpectedJSON+"\n", string(b))
+			assert.True(t, json.Valid(b))
+		})
+	}
+}
+
+func TestLogfmtFormatter(t *testing.T) {
+	for _, test := range formatterTests() {
+		t.Run(test.Name, func(t *testing.T) {
+			assert.Equal(t, test.ExpectedLogfmt+"\n", string(handler.LogfmtFormatter.Format(test.record())))
+		})
+	}
+}
+
+func TestFormatterNamed(t *testing.T) {
+	r := &log15.Record{Time: formatterTestTime, Lvl: log15.LvlInfo, Msg: "hello"}
+
+	tests := []struct {
+		Name     string
+		Expected log15.Format
+	}{
+		{Name: "standard", Expected: handler.StandardFormatter},
+		{Name: "json", Expected: handler.JSONFormatter},
+		{Name: "JSON", Expected: handler.JSONFormatter},
+		{Name: "logfmt", Expected: handler.LogfmtFormatter},
+		{Name: "LogFmt", Expected: handler.LogfmtFormatter},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			formatter, ok := handler.FormatterNamed(test.Name)
+			require.True(t, ok)
+			assert.Equal(t, string(test.Expected.Format(r)), string(formatter.Format(r)))
+		})
+	}
+
+	_, ok := handler.FormatterNamed("xml")
+	assert.False(t, ok)
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/inconshreveable/log15"
+)
+
+func marshalJSONValue(v interface{}) []byte {
+	b, err := json.Marshal(structuredValue(v))
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	return b
+}
+
+func formatJSONLogRecord(r *log15.Record) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+
+	for i, f := range recordFields(r) {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, _ := json.Marshal(f.key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(marshalJSONValue(f.value))
+	}
+
+	buf.WriteString("}\n")
+
+	return buf.Bytes()
+}
+
+var (
+	// JSONFormatter writes each record as a single-line JSON object. The time,
+	// level, message, and package are written first using the TimeKey,
+	// LevelKey, MessageKey, and PackageKey field names, followed by the
+	// remaining context keys.
+	//
+	// Errors are written as their messages, call stacks from Logger.Stack() as
+	// arrays of frames, and nested logging.Ctx maps as nested objects.
+	JSONFormatter = log15.FormatFunc(formatJSONLogRecord)
+)
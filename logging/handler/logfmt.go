@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/go-stack/stack"
+	"github.com/inconshreveable/log15"
+)
+
+func logfmtKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || !unicode.IsPrint(r) {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+func logfmtString(v interface{}) string {
+	switch vt := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return vt
+	case encoding.TextMarshaler:
+		if b, err := vt.MarshalText(); err == nil {
+			return string(b)
+		}
+	case json.Marshaler:
+		if b, err := vt.MarshalJSON(); err == nil {
+			return string(b)
+		}
+	}
+
+	return fmt.Sprintf("%+v", v)
+}
+
+func logfmtQuote(s string) string {
+	if s == "" {
+		return `""`
+	}
+
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+
+	return s
+}
+
+func writeLogfmtField(buf *bytes.Buffer, k string, v interface{}) {
+	var s string
+
+	switch vt := v.(type) {
+	case stack.CallStack:
+		s = fmt.Sprintf("%+v", vt)
+	default:
+		sv := structuredValue(v)
+
+		// Nested maps are flattened using dotted keys.
+		if m, ok := sv.(map[string]interface{}); ok {
+			for _, mk := range sortedKeys(m) {
+				writeLogfmtField(buf, k+"."+mk, m[mk])
+			}
+			return
+		}
+
+		s = logfmtString(sv)
+	}
+
+	if buf.Len() > 0 {
+		buf.WriteByte(' ')
+	}
+
+	buf.WriteString(logfmtKey(k))
+	buf.WriteByte('=')
+	buf.WriteString(logfmtQuote(s))
+}
+
+func formatLogfmtLogRecord(r *log15.Record) []byte {
+	buf := &bytes.Buffer{}
+
+	for _, f := range recordFields(r) {
+		writeLogfmtField(buf, f.key, f.value)
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+var (
+	// LogfmtFormatter writes each record as a single line of logfmt-style
+	// key=value pairs. It uses the same field names and ordering as
+	// JSONFormatter.
+	//
+	// Errors are written as their messages and call stacks from Logger.Stack()
+	// as a bracketed list of frames. Nested logging.Ctx maps are flattened
+	// using dotted keys, so that, for example, Ctx{"a": Ctx{"b": 1}} is
+	// written as a.b=1.
+	LogfmtFormatter = log15.FormatFunc(formatLogfmtLogRecord)
+)
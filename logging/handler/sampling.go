@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+// SamplingOptions contains fields that configure a sampling handler.
+type SamplingOptions struct {
+	// Window is the period over which records with the same message and level
+	// are counted. At the end of each window, a summary record is written for
+	// any records that were suppressed during it.
+	Window time.Duration
+
+	// First is the number of records with the same message and level that are
+	// written in each window before sampling begins.
+	First int
+
+	// Thereafter causes every Mth record after the first N in a window to be
+	// written. If zero, all records after the first N in a window are
+	// suppressed.
+	Thereafter int
+
+	// Limit is the maximum number of records with the same message and level
+	// that are written in each window, regardless of sampling. If zero, there
+	// is no limit.
+	Limit int
+
+	// Clock is the clock used to measure windows.
+	Clock clock.Clock
+}
+
+// SamplingOption is a setter for one or more sampling handler options.
+type SamplingOption interface {
+	// ApplyToSamplingOptions configures the specified sampling handler options
+	// for this option.
+	ApplyToSamplingOptions(target *SamplingOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *SamplingOptions) ApplyOptions(opts []SamplingOption) {
+	for _, opt := range opts {
+		opt.ApplyToSamplingOptions(o)
+	}
+}
+
+// SamplingOptionFunc allows a function to be used as a sampling handler
+// option.
+type SamplingOptionFunc func(target *SamplingOptions)
+
+var _ SamplingOption = SamplingOptionFunc(nil)
+
+// ApplyToSamplingOptions configures the specified sampling handler options by
+// calling this function.
+func (sof SamplingOptionFunc) ApplyToSamplingOptions(target *SamplingOptions) {
+	sof(target)
+}
+
+// SamplingWithWindow changes the period over which records are counted.
+func SamplingWithWindow(d time.Duration) SamplingOption {
+	return SamplingOptionFunc(func(target *SamplingOptions) {
+		target.Window = d
+	})
+}
+
+// SamplingWithFirstThereafter changes the sampling policy to write the first n
+// records in each window followed by every mth record.
+func SamplingWithFirstThereafter(n, m int) SamplingOption {
+	return SamplingOptionFunc(func(target *SamplingOptions) {
+		target.First = n
+		target.Thereafter = m
+	})
+}
+
+// SamplingWithLimit changes the maximum number of records written in each
+// window.
+func SamplingWithLimit(n int) SamplingOption {
+	return SamplingOptionFunc(func(target *SamplingOptions) {
+		target.Limit = n
+	})
+}
+
+// SamplingWithClock changes the clock used to measure windows.
+func SamplingWithClock(c clock.Clock) SamplingOption {
+	return SamplingOptionFunc(func(target *SamplingOptions) {
+		target.Clock = c
+	})
+}
+
+type samplingKey struct {
+	lvl log15.Lvl
+	msg string
+}
+
+type samplingWindow struct {
+	end        time.Time
+	timer      clock.Timer
+	seen       int
+	written    int
+	suppressed int
+	last       *log15.Record
+}
+
+// SamplingHandler is a handler that limits the number of records with the same
+// message and level written to a delegate handler.
+//
+// Within each window, the first records are written, then records are sampled,
+// and finally records beyond the limit are dropped. Records that are not
+// written are collapsed into a single summary record at the end of the window
+// with the message "message repeated N times: <message>", the context of the
+// last suppressed record, and a "repeated" context key containing N.
+type SamplingHandler struct {
+	delegate   log15.Handler
+	window     time.Duration
+	first      int
+	thereafter int
+	limit      int
+	clock      clock.Clock
+
+	mut     sync.Mutex
+	windows map[samplingKey]*samplingWindow
+}
+
+var _ log15.Handler = &SamplingHandler{}
+
+func (sh *SamplingHandler) allow(sw *samplingWindow) bool {
+	sw.seen++
+
+	if sw.seen > sh.first {
+		if sh.thereafter <= 0 || (sw.seen-sh.first)%sh.thereafter != 0 {
+			return false
+		}
+	}
+
+	if sh.limit > 0 && sw.written >= sh.limit {
+		return false
+	}
+
+	sw.written++
+	return true
+}
+
+// end removes the window for the given key if it is still current and returns
+// a summary record for it, if any records were suppressed. Callers must hold
+// the handler mutex.
+func (sh *SamplingHandler) end(key samplingKey, sw *samplingWindow) *log15.Record {
+	if sh.windows[key] != sw {
+		return nil
+	}
+
+	delete(sh.windows, key)
+	sw.timer.Stop()
+
+	if sw.suppressed == 0 {
+		return nil
+	}
+
+	summary := *sw.last
+	summary.Time = sh.clock.Now()
+	summary.Msg = fmt.Sprintf("message repeated %d times: %s", sw.suppressed, sw.last.Msg)
+	summary.Ctx = append(append([]interface{}{}, sw.last.Ctx...), "repeated", sw.suppressed)
+	return &summary
+}
+
+func (sh *SamplingHandler) expire(key samplingKey, sw *samplingWindow) {
+	sh.mut.Lock()
+	summary := sh.end(key, sw)
+	sh.mut.Unlock()
+
+	if summary != nil {
+		_ = sh.delegate.Log(summary)
+	}
+}
+
+// Log writes the given record to the delegate handler if the sampling policy
+// allows it.
+func (sh *SamplingHandler) Log(r *log15.Record) error {
+	key := samplingKey{lvl: r.Lvl, msg: r.Msg}
+	now := sh.clock.Now()
+
+	sh.mut.Lock()
+
+	// The timer for an expired window may not have fired yet, in which case we
+	// end the window now so that this record starts a new one.
+	sw, found := sh.windows[key]
+	var summary *log15.Record
+	if found && !now.Before(sw.end) {
+		summary = sh.end(key, sw)
+		found = false
+	}
+
+	if !found {
+		sw = &samplingWindow{end: now.Add(sh.window)}
+		sw.timer = clock.AfterFunc(sh.clock, sh.window, func() { sh.expire(key, sw) })
+		sh.windows[key] = sw
+	}
+
+	allowed := sh.allow(sw)
+	if !allowed {
+		sw.suppressed++
+		sw.last = r
+	}
+
+	sh.mut.Unlock()
+
+	if summary != nil {
+		_ = sh.delegate.Log(summary)
+	}
+
+	if !allowed {
+		return nil
+	}
+
+	return sh.delegate.Log(r)
+}
+
+// Flush immediately ends every window, writing summaries for any suppressed
+// records. It should be called before the process exits.
+func (sh *SamplingHandler) Flush() {
+	var summaries []*log15.Record
+
+	sh.mut.Lock()
+	for key, sw := range sh.windows {
+		if summary := sh.end(key, sw); summary != nil {
+			summaries = append(summaries, summary)
+		}
+	}
+	sh.mut.Unlock()
+
+	for _, summary := range summaries {
+		_ = sh.delegate.Log(summary)
+	}
+}
+
+// NewSamplingHandler creates a new handler that samples and rate limits
+// records with the same message and level before writing them to the given
+// delegate.
+//
+// By default, the first 100 records with the same message and level in each
+// one-second window are written, followed by every 100th record.
+func NewSamplingHandler(delegate log15.Handler, opts ...SamplingOption) *SamplingHandler {
+	o := &SamplingOptions{
+		Window:     time.Second,
+		First:      100,
+		Thereafter: 100,
+		Clock:      clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	return &SamplingHandler{
+		delegate:   delegate,
+		window:     o.Window,
+		first:      o.First,
+		thereafter: o.Thereafter,
+		limit:      o.Limit,
+		clock:      o.Clock,
+		windows:    make(map[samplingKey]*samplingWindow),
+	}
+}
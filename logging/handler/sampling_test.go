@@ -0,0 +1,135 @@
+package handler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/puppetlabs/leg/logging/handler"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+type recordingHandler struct {
+	records chan *log15.Record
+}
+
+func (rh *recordingHandler) Log(r *log15.Record) error {
+	rh.records <- r
+	return nil
+}
+
+func (rh *recordingHandler) receive(t *testing.T) *log15.Record {
+	select {
+	case r := <-rh.records:
+		return r
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no record written")
+		return nil
+	}
+}
+
+func (rh *recordingHandler) requireEmpty(t *testing.T) {
+	select {
+	case r := <-rh.records:
+		require.Fail(t, "unexpected record written", "message: %s", r.Msg)
+	default:
+	}
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{records: make(chan *log15.Record, 100)}
+}
+
+func log(t *testing.T, h log15.Handler, lvl log15.Lvl, msg string, ctx ...interface{}) {
+	require.NoError(t, h.Log(&log15.Record{Time: time.Now(), Lvl: lvl, Msg: msg, Ctx: ctx}))
+}
+
+func TestSamplingHandlerFirstThereafter(t *testing.T) {
+	fc := testclock.NewFakeClock(time.Now())
+	rh := newRecordingHandler()
+
+	h := handler.NewSamplingHandler(rh,
+		handler.SamplingWithWindow(time.Second),
+		handler.SamplingWithFirstThereafter(2, 3),
+		handler.SamplingWithClock(k8sext.NewClock(fc)),
+	)
+
+	for i := 1; i <= 10; i++ {
+		log(t, h, log15.LvlError, "boom", "i", i)
+	}
+
+	// Records 1 and 2 are written, then every third record.
+	for _, i := range []int{1, 2, 5, 8} {
+		r := rh.receive(t)
+		assert.Equal(t, "boom", r.Msg)
+		assert.Equal(t, []interface{}{"i", i}, r.Ctx)
+	}
+	rh.requireEmpty(t)
+
+	fc.Step(time.Second)
+
+	summary := rh.receive(t)
+	assert.Equal(t, log15.LvlError, summary.Lvl)
+	assert.Equal(t, "message repeated 6 times: boom", summary.Msg)
+	assert.Equal(t, []interface{}{"i", 10, "repeated", 6}, summary.Ctx)
+
+	// A new window starts from the beginning.
+	log(t, h, log15.LvlError, "boom", "i", 11)
+	assert.Equal(t, []interface{}{"i", 11}, rh.receive(t).Ctx)
+}
+
+func TestSamplingHandlerLimit(t *testing.T) {
+	fc := testclock.NewFakeClock(time.Now())
+	rh := newRecordingHandler()
+
+	h := handler.NewSamplingHandler(rh,
+		handler.SamplingWithFirstThereafter(100, 0),
+		handler.SamplingWithLimit(3),
+		handler.SamplingWithClock(k8sext.NewClock(fc)),
+	)
+
+	for i := 0; i < 5; i++ {
+		log(t, h, log15.LvlWarn, "slow down")
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "slow down", rh.receive(t).Msg)
+	}
+	rh.requireEmpty(t)
+
+	h.Flush()
+	assert.Equal(t, "message repeated 2 times: slow down", rh.receive(t).Msg)
+
+	// Flushing twice has no effect.
+	h.Flush()
+	rh.requireEmpty(t)
+}
+
+func TestSamplingHandlerKeys(t *testing.T) {
+	fc := testclock.NewFakeClock(time.Now())
+	rh := newRecordingHandler()
+
+	h := handler.NewSamplingHandler(rh,
+		handler.SamplingWithFirstThereafter(1, 0),
+		handler.SamplingWithClock(k8sext.NewClock(fc)),
+	)
+
+	log(t, h, log15.LvlInfo, "a")
+	log(t, h, log15.LvlInfo, "a")
+	log(t, h, log15.LvlWarn, "a")
+	log(t, h, log15.LvlInfo, "b")
+
+	assert.Equal(t, log15.LvlInfo, rh.receive(t).Lvl)
+	assert.Equal(t, log15.LvlWarn, rh.receive(t).Lvl)
+	assert.Equal(t, "b", rh.receive(t).Msg)
+	rh.requireEmpty(t)
+
+	// Only the window with suppressed records produces a summary.
+	fc.Step(time.Second)
+	assert.Equal(t, "message repeated 1 times: a", rh.receive(t).Msg)
+
+	time.Sleep(50 * time.Millisecond)
+	rh.requireEmpty(t)
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/go-stack/stack"
 	"github.com/inconshreveable/log15"
 )
 
@@ -51,7 +52,11 @@ func formatStandardLogRecord(r *log15.Record) []byte {
 		case "request":
 			ident = fmt.Sprintf("[%v]", v)
 		default:
-			ctx = append(ctx, fmt.Sprintf("%v=%v", k, v))
+			if cs, ok := v.(stack.CallStack); ok {
+				ctx = append(ctx, fmt.Sprintf("%v=%+v", k, cs))
+			} else {
+				ctx = append(ctx, fmt.Sprintf("%v=%v", k, v))
+			}
 		}
 	}
 
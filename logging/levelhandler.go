@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+const maxLevelHandlerRequestSize = 64 * 1024
+
+// NewLevelHandler returns an HTTP handler that exposes the levels of the root
+// logger. It is intended to be mounted on an administrative port.
+//
+// A GET request responds with the current levels in the format accepted by
+// ParseLevels. A PUT request replaces the levels with the specification in the
+// request body and responds with the new levels. For example:
+//
+//	curl -X PUT --data 'relspec/pkg/evaluate=debug,*=info' http://localhost:8081/log-levels
+func NewLevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut:
+			b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxLevelHandlerRequestSize))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			levels, err := ParseLevels(string(b))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			SetLevels(levels)
+
+			Builder().At("leg", "logging").With(r.Context()).Build().Info("log levels changed", "levels", levels.String())
+		default:
+			w.Header().Set("Allow", fmt.Sprintf("%s, %s, %s", http.MethodGet, http.MethodHead, http.MethodPut))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = fmt.Fprintln(w, CurrentLevels().String())
+	})
+}
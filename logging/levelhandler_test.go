@@ -0,0 +1,62 @@
+package logging_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/puppetlabs/leg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevelHandler(t *testing.T) {
+	withRecordingHandler(t, func(rh *recordingHandler) {
+		levels, err := logging.ParseLevels("a=warn,*=info")
+		require.NoError(t, err)
+		logging.SetLevels(levels)
+
+		h := logging.NewLevelHandler()
+
+		t.Run("Get", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/log-levels", nil))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, "a=warn,*=info\n", w.Body.String())
+		})
+
+		t.Run("Put", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/log-levels", strings.NewReader("b/c=debug,*=error")))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, "b/c=debug,*=error\n", w.Body.String())
+
+			current := logging.CurrentLevels()
+			assert.Equal(t, log15.LvlError, current.Default)
+			assert.Equal(t, map[string]log15.Lvl{"b/c": log15.LvlDebug}, current.Packages)
+		})
+
+		t.Run("Put invalid", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/log-levels", strings.NewReader("b=loud")))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), `invalid level "loud"`)
+			assert.Equal(t, "b/c=debug,*=error", logging.CurrentLevels().String())
+		})
+
+		t.Run("Method not allowed", func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/log-levels", strings.NewReader("*=debug")))
+
+			assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+			assert.Equal(t, "GET, HEAD, PUT", w.Header().Get("Allow"))
+			assert.Equal(t, "b/c=debug,*=error", logging.CurrentLevels().String())
+		})
+	})
+}
@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/inconshreveable/log15"
+)
+
+// LevelEnvVar is the name of an environment variable that configures the
+// level of the default handler. It may be set to any specification accepted by
+// ParseLevels.
+const LevelEnvVar = "LEG_LOG_LEVEL"
+
+// Levels configures the minimum level of records to log for each package.
+//
+// Package names are the names passed to At(...), joined with "/". Levels are
+// hierarchical: a level configured for a package also applies to each of its
+// subpackages that do not have their own level. Records from packages without
+// a configured level, or that have no package, use the default level.
+type Levels struct {
+	// Default is the level used when no package level applies.
+	Default log15.Lvl
+
+	// Packages maps package names to levels.
+	Packages map[string]log15.Lvl
+}
+
+// For returns the level that applies to the given package.
+func (l *Levels) For(pkg string) log15.Lvl {
+	for pkg != "" {
+		if lvl, ok := l.Packages[pkg]; ok {
+			return lvl
+		}
+
+		idx := strings.LastIndexByte(pkg, '/')
+		if idx < 0 {
+			break
+		}
+		pkg = pkg[:idx]
+	}
+
+	return l.Default
+}
+
+// String returns the specification of these levels in the format accepted by
+// ParseLevels.
+func (l *Levels) String() string {
+	pkgs := make([]string, 0, len(l.Packages))
+	for pkg := range l.Packages {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+
+	entries := make([]string, 0, len(pkgs)+1)
+	for _, pkg := range pkgs {
+		entries = append(entries, fmt.Sprintf("%s=%s", pkg, levelName(l.Packages[pkg])))
+	}
+	entries = append(entries, fmt.Sprintf("*=%s", levelName(l.Default)))
+
+	return strings.Join(entries, ",")
+}
+
+func (l *Levels) clone() *Levels {
+	next := &Levels{
+		Default:  l.Default,
+		Packages: make(map[string]log15.Lvl, len(l.Packages)),
+	}
+	for pkg, lvl := range l.Packages {
+		next.Packages[pkg] = lvl
+	}
+	return next
+}
+
+func levelName(lvl log15.Lvl) string {
+	switch lvl {
+	case log15.LvlDebug:
+		return "debug"
+	case log15.LvlInfo:
+		return "info"
+	case log15.LvlWarn:
+		return "warn"
+	case log15.LvlError:
+		return "error"
+	case log15.LvlCrit:
+		return "crit"
+	default:
+		return fmt.Sprintf("%d", int(lvl))
+	}
+}
+
+// ParseLevels parses a comma-separated list of levels, such as
+// "relspec/pkg/evaluate=debug,*=info". Each entry is a package name and level
+// separated by "=". The package name "*", or an entry with only a level, sets
+// the default level. A package name may end in "/*", which is equivalent to
+// the package name itself.
+//
+// Levels not configured by the specification use the default level of
+// log15.LvlDebug.
+func ParseLevels(spec string) (*Levels, error) {
+	l := &Levels{
+		Default:  log15.LvlDebug,
+		Packages: make(map[string]log15.Lvl),
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		pkg, name := "*", entry
+		if idx := strings.LastIndexByte(entry, '='); idx >= 0 {
+			pkg, name = strings.TrimSpace(entry[:idx]), strings.TrimSpace(entry[idx+1:])
+		}
+
+		lvl, err := log15.LvlFromString(strings.ToLower(name))
+		if err != nil {
+			return nil, fmt.Errorf("logging: invalid level %q for package %q", name, pkg)
+		}
+
+		pkg = strings.TrimSuffix(strings.TrimSuffix(pkg, "*"), "/")
+		if pkg == "" {
+			l.Default = lvl
+		} else {
+			l.Packages[pkg] = lvl
+		}
+	}
+
+	return l, nil
+}
+
+var (
+	rootLevels    atomic.Value // *Levels
+	rootLevelsMut sync.Mutex
+)
+
+func loadLevels() *Levels {
+	return rootLevels.Load().(*Levels)
+}
+
+// CurrentLevels returns a copy of the levels used by the root logger.
+func CurrentLevels() *Levels {
+	return loadLevels().clone()
+}
+
+// SetLevels replaces the levels used by the root logger. It is safe to call
+// while other goroutines are logging.
+func SetLevels(in *Levels) {
+	rootLevelsMut.Lock()
+	defer rootLevelsMut.Unlock()
+
+	rootLevels.Store(in.clone())
+}
+
+// SetPackageLevel changes the level of a single package used by the root
+// logger, leaving the levels of other packages unchanged.
+func SetPackageLevel(pkg string, lvl log15.Lvl) {
+	rootLevelsMut.Lock()
+	defer rootLevelsMut.Unlock()
+
+	next := loadLevels().clone()
+	next.Packages[pkg] = lvl
+	rootLevels.Store(next)
+}
+
+// levelFilterHandler discards records below the level configured for their
+// package in the root levels.
+func levelFilterHandler(h log15.Handler) log15.Handler {
+	return log15.FilterHandler(func(r *log15.Record) bool {
+		return r.Lvl <= loadLevels().For(argsPackage(r.Ctx))
+	}, h)
+}
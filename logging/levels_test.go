@@ -0,0 +1,179 @@
+package logging_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/puppetlabs/leg/logging"
+	"github.com/puppetlabs/leg/logging/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingHandler struct {
+	mut     sync.Mutex
+	records []*log15.Record
+}
+
+func (rh *recordingHandler) Log(r *log15.Record) error {
+	rh.mut.Lock()
+	defer rh.mut.Unlock()
+
+	rh.records = append(rh.records, r)
+	return nil
+}
+
+func (rh *recordingHandler) take() []*log15.Record {
+	rh.mut.Lock()
+	defer rh.mut.Unlock()
+
+	records := rh.records
+	rh.records = nil
+	return records
+}
+
+func (rh *recordingHandler) messages() []string {
+	var msgs []string
+	for _, r := range rh.take() {
+		msgs = append(msgs, r.Msg)
+	}
+	return msgs
+}
+
+// withRecordingHandler replaces the root handler and levels for the duration
+// of fn.
+func withRecordingHandler(t *testing.T, fn func(rh *recordingHandler)) {
+	levels := logging.CurrentLevels()
+	defer logging.SetLevels(levels)
+	defer logging.SetFormatter(handler.StandardFormatter)
+
+	rh := &recordingHandler{}
+	logging.SetHandler(rh)
+
+	fn(rh)
+}
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		Name          string
+		Spec          string
+		Expected      *logging.Levels
+		ExpectedError string
+	}{
+		{
+			Name:     "Empty",
+			Spec:     "",
+			Expected: &logging.Levels{Default: log15.LvlDebug, Packages: map[string]log15.Lvl{}},
+		},
+		{
+			Name:     "Default only",
+			Spec:     "info",
+			Expected: &logging.Levels{Default: log15.LvlInfo, Packages: map[string]log15.Lvl{}},
+		},
+		{
+			Name: "Packages and default",
+			Spec: "relspec/pkg/evaluate=debug,*=warn",
+			Expected: &logging.Levels{
+				Default:  log15.LvlWarn,
+				Packages: map[string]log15.Lvl{"relspec/pkg/evaluate": log15.LvlDebug},
+			},
+		},
+		{
+			Name: "Wildcard suffix, whitespace, and case",
+			Spec: " a/* = ERROR , b=Crit,, =info ",
+			Expected: &logging.Levels{
+				Default:  log15.LvlInfo,
+				Packages: map[string]log15.Lvl{"a": log15.LvlError, "b": log15.LvlCrit},
+			},
+		},
+		{
+			Name:          "Invalid package level",
+			Spec:          "a=loud,*=info",
+			ExpectedError: `logging: invalid level "loud" for package "a"`,
+		},
+		{
+			Name:          "Invalid default level",
+			Spec:          "a=info,verbose",
+			ExpectedError: `logging: invalid level "verbose" for package "*"`,
+		},
+		{
+			Name:          "Missing level",
+			Spec:          "a=",
+			ExpectedError: `logging: invalid level "" for package "a"`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			levels, err := logging.ParseLevels(test.Spec)
+			if test.ExpectedError != "" {
+				assert.EqualError(t, err, test.ExpectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, levels)
+		})
+	}
+}
+
+func TestLevelsFor(t *testing.T) {
+	levels, err := logging.ParseLevels("a=warn,a/b=debug,*=info")
+	require.NoError(t, err)
+
+	assert.Equal(t, log15.LvlInfo, levels.For(""))
+	assert.Equal(t, log15.LvlInfo, levels.For("other"))
+	assert.Equal(t, log15.LvlWarn, levels.For("a"))
+	assert.Equal(t, log15.LvlWarn, levels.For("a/c"))
+	assert.Equal(t, log15.LvlDebug, levels.For("a/b"))
+	assert.Equal(t, log15.LvlDebug, levels.For("a/b/c"))
+	assert.Equal(t, log15.LvlInfo, levels.For("ab"))
+
+	assert.Equal(t, "a=warn,a/b=debug,*=info", levels.String())
+}
+
+func TestLevelFilter(t *testing.T) {
+	withRecordingHandler(t, func(rh *recordingHandler) {
+		levels, err := logging.ParseLevels("a=warn,a/b=debug,*=info")
+		require.NoError(t, err)
+		logging.SetLevels(levels)
+
+		logging.Builder().At("a").Build().Info("a info")
+		logging.Builder().At("a").Build().Warn("a warn")
+		logging.Builder().At("a", "b", "c").Build().Debug("a/b/c debug")
+		logging.Builder().At("other").Build().Debug("other debug")
+		logging.Builder().At("other").Build().Info("other info")
+		logging.Builder().Build().Debug("root debug")
+		logging.Builder().Build().Info("root info")
+
+		// The last package set on a logger determines its level.
+		logging.Builder().At("other").Build().At("a", "b").Debug("rescoped debug")
+
+		assert.Equal(t, []string{"a warn", "a/b/c debug", "other info", "root info", "rescoped debug"}, rh.messages())
+
+		logging.SetPackageLevel("other", log15.LvlDebug)
+		logging.Builder().At("other").Build().Debug("other debug")
+		logging.Builder().At("a").Build().Info("a info")
+		assert.Equal(t, []string{"other debug"}, rh.messages())
+	})
+}
+
+func TestSetLevelOnlyChangesDefault(t *testing.T) {
+	withRecordingHandler(t, func(rh *recordingHandler) {
+		levels, err := logging.ParseLevels("a=debug,b=error,*=info")
+		require.NoError(t, err)
+		logging.SetLevels(levels)
+
+		logging.SetLevel(log15.LvlWarn)
+
+		current := logging.CurrentLevels()
+		assert.Equal(t, log15.LvlWarn, current.Default)
+		assert.Equal(t, map[string]log15.Lvl{"a": log15.LvlDebug, "b": log15.LvlError}, current.Packages)
+
+		logging.Builder().At("a").Build().Debug("a debug")
+		logging.Builder().At("b").Build().Warn("b warn")
+		logging.Builder().Build().Info("root info")
+		logging.Builder().Build().Warn("root warn")
+		assert.Equal(t, []string{"a debug", "root warn"}, rh.messages())
+	})
+}
@@ -2,39 +2,92 @@ package logging
 
 import (
 	"os"
+	"sync"
 
 	"github.com/inconshreveable/log15"
 	"github.com/puppetlabs/leg/logging/handler"
 )
 
+// FormatEnvVar is the name of an environment variable that selects the
+// formatter used by the default handler. It may be set to any name accepted by
+// handler.FormatterNamed.
+const FormatEnvVar = "LEG_LOG_FORMAT"
+
 var (
 	rootFormatter = handler.StandardFormatter
 	rootHandler   = log15.StreamHandler(os.Stdout, rootFormatter)
-	rootLevel     = log15.LvlDebug
+	rootMut       sync.Mutex
 
-	rootLogger log15.Logger
+	// rootLogger is never replaced; instead, its handler is atomically swapped
+	// so that loggers derived from it observe changes immediately.
+	rootLogger = log15.New()
 )
 
 func init() {
+	rootLevels.Store(&Levels{
+		Default:  log15.LvlDebug,
+		Packages: make(map[string]log15.Lvl),
+	})
+
+	var warnings []Ctx
+
+	if name := os.Getenv(FormatEnvVar); name != "" {
+		if formatter, ok := handler.FormatterNamed(name); ok {
+			rootFormatter = formatter
+			rootHandler = log15.StreamHandler(os.Stdout, rootFormatter)
+		} else {
+			warnings = append(warnings, Ctx{"env": FormatEnvVar, "value": name})
+		}
+	}
+
+	if spec := os.Getenv(LevelEnvVar); spec != "" {
+		if levels, err := ParseLevels(spec); err == nil {
+			rootLevels.Store(levels)
+		} else {
+			warnings = append(warnings, Ctx{"env": LevelEnvVar, "value": spec, "error": err})
+		}
+	}
+
 	setLogger()
+
+	for _, warning := range warnings {
+		rootLogger.New("package", "leg/logging").Warn("ignoring invalid logging configuration", warning.toArray()...)
+	}
 }
 
+// setLogger swaps the handler of the root logger. Callers other than init must
+// hold rootMut.
 func setLogger() {
-	handler := rootHandler
-	handler = log15.LvlFilterHandler(rootLevel, handler)
-
-	logger := log15.New()
-	logger.SetHandler(handler)
-
-	rootLogger = logger
+	rootLogger.SetHandler(levelFilterHandler(rootHandler))
 }
 
 func SetHandler(in log15.Handler) {
+	rootMut.Lock()
+	defer rootMut.Unlock()
+
 	rootHandler = in
 	setLogger()
 }
 
-func SetLevel(in log15.Lvl) {
-	rootLevel = in
+// SetFormatter replaces the root handler with one that writes records to
+// standard output using the given formatter, such as handler.JSONFormatter or
+// handler.LogfmtFormatter.
+func SetFormatter(in log15.Format) {
+	rootMut.Lock()
+	defer rootMut.Unlock()
+
+	rootFormatter = in
+	rootHandler = log15.StreamHandler(os.Stdout, rootFormatter)
 	setLogger()
 }
+
+// SetLevel changes the default level of the root logger. Levels configured for
+// individual packages are unchanged.
+func SetLevel(in log15.Lvl) {
+	rootLevelsMut.Lock()
+	defer rootLevelsMut.Unlock()
+
+	next := loadLevels().clone()
+	next.Default = in
+	rootLevels.Store(next)
+}
@@ -0,0 +1,111 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/puppetlabs/leg/logging"
+	"github.com/puppetlabs/leg/logging/handler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const subprocessEnvVar = "LEG_LOGGING_TEST_SUBPROCESS"
+
+// captureStdout redirects standard output to a temporary file while fn runs
+// and returns what was written to it.
+func captureStdout(t *testing.T, fn func()) string {
+	f, err := ioutil.TempFile("", "logging-")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stdout := os.Stdout
+	os.Stdout = f
+	defer func() { os.Stdout = stdout }()
+
+	fn()
+
+	b, err := ioutil.ReadFile(f.Name())
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestSetFormatter(t *testing.T) {
+	defer logging.SetFormatter(handler.StandardFormatter)
+
+	out := captureStdout(t, func() {
+		logging.SetFormatter(handler.JSONFormatter)
+		logging.Builder().At("leg", "test").Build().Info("hello", "a", 1)
+	})
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(out), &record))
+	assert.Equal(t, "info", record["level"])
+	assert.Equal(t, "hello", record["message"])
+	assert.Equal(t, "leg/test", record["package"])
+	assert.Equal(t, float64(1), record["a"])
+
+	out = captureStdout(t, func() {
+		logging.SetFormatter(handler.LogfmtFormatter)
+		logging.Builder().At("leg", "test").Build().Warn("hello again", "b", "c d")
+	})
+	assert.Regexp(t, `^time=\S+ level=warn message="hello again" package=leg/test b="c d"\n$`, out)
+}
+
+func TestFormatEnvVarSubprocess(t *testing.T) {
+	if os.Getenv(subprocessEnvVar) == "" {
+		t.Skip("only run as a subprocess of TestFormatEnvVar")
+	}
+
+	logging.Builder().At("leg", "test").Build().Info("hello", "a", 1)
+}
+
+func TestFormatEnvVar(t *testing.T) {
+	run := func(t *testing.T, format string) []string {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestFormatEnvVarSubprocess$")
+		cmd.Env = append(os.Environ(), subprocessEnvVar+"=1", logging.FormatEnvVar+"="+format)
+
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		require.NoError(t, cmd.Run())
+
+		var lines []string
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			if strings.Contains(line, "leg/") {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		lines := run(t, "json")
+		require.Len(t, lines, 1)
+
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &record))
+		assert.Equal(t, "hello", record["message"])
+		assert.Equal(t, "leg/test", record["package"])
+	})
+
+	t.Run("Logfmt", func(t *testing.T) {
+		lines := run(t, "LOGFMT")
+		require.Len(t, lines, 1)
+		assert.Regexp(t, `^time=\S+ level=info message=hello package=leg/test a=1$`, lines[0])
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		lines := run(t, "xml")
+		require.Len(t, lines, 2)
+		assert.Contains(t, lines[0], "ignoring invalid logging configuration")
+		assert.Contains(t, lines[0], "env="+logging.FormatEnvVar)
+		assert.Contains(t, lines[0], "value=xml")
+		assert.Contains(t, lines[1], "hello")
+	})
+}
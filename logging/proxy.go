@@ -3,9 +3,23 @@ package logging
 import (
 	"context"
 
+	"github.com/go-stack/stack"
 	"github.com/inconshreveable/log15"
 )
 
+// stackHandler adds the call stack of each record to its context. Unlike
+// log15.CallerStackHandler, it keeps the stack as a stack.CallStack so that
+// formatters can decide how to represent it.
+func stackHandler(h log15.Handler) log15.Handler {
+	return log15.FuncHandler(func(r *log15.Record) error {
+		s := stack.Trace().TrimBelow(r.Call).TrimRuntime()
+		if len(s) > 0 {
+			r.Ctx = append(r.Ctx, "stack", s)
+		}
+		return h.Log(r)
+	})
+}
+
 type proxy struct {
 	delegate log15.Logger
 }
@@ -24,7 +38,7 @@ func (p proxy) At(names ...string) Logger {
 
 func (p proxy) Stack() Logger {
 	delegate := p.delegate.New()
-	delegate.SetHandler(log15.CallerStackHandler("%+v", delegate.GetHandler()))
+	delegate.SetHandler(stackHandler(delegate.GetHandler()))
 	return &proxy{delegate: delegate}
 }
 
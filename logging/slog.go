@@ -0,0 +1,294 @@
+//go:build go1.21
+// +build go1.21
+
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"time"
+
+	"github.com/go-stack/stack"
+	"github.com/inconshreveable/log15"
+)
+
+// LevelCrit is the slog level corresponding to log15.LvlCrit.
+const LevelCrit = slog.LevelError + 4
+
+func levelFromSlog(level slog.Level) log15.Lvl {
+	switch {
+	case level >= LevelCrit:
+		return log15.LvlCrit
+	case level >= slog.LevelError:
+		return log15.LvlError
+	case level >= slog.LevelWarn:
+		return log15.LvlWarn
+	case level >= slog.LevelInfo:
+		return log15.LvlInfo
+	default:
+		return log15.LvlDebug
+	}
+}
+
+func levelToSlog(lvl log15.Lvl) slog.Level {
+	switch lvl {
+	case log15.LvlCrit:
+		return LevelCrit
+	case log15.LvlError:
+		return slog.LevelError
+	case log15.LvlWarn:
+		return slog.LevelWarn
+	case log15.LvlInfo:
+		return slog.LevelInfo
+	default:
+		return slog.LevelDebug
+	}
+}
+
+// appendSlogAttr appends the key and value of the given attribute to args.
+// Groups are flattened using dotted keys.
+func appendSlogAttr(args []interface{}, prefix string, attr slog.Attr) []interface{} {
+	v := attr.Value.Resolve()
+
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return args
+		}
+
+		// Groups without a key are inlined.
+		if attr.Key != "" {
+			prefix += attr.Key + "."
+		}
+
+		for _, ga := range attrs {
+			args = appendSlogAttr(args, prefix, ga)
+		}
+		return args
+	}
+
+	if attr.Equal(slog.Attr{}) {
+		return args
+	}
+
+	return append(args, prefix+attr.Key, v.Any())
+}
+
+// slogCall returns the call in the stack of the current goroutine with the
+// given program counter. The stack package cannot create a call from a program
+// counter directly, so a record handled on a different goroutine than the one
+// that created it has no call.
+func slogCall(pc uintptr) stack.Call {
+	if pc == 0 {
+		return stack.Call{}
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	for _, call := range stack.Trace() {
+		if call.Frame().PC == frame.PC {
+			return call
+		}
+	}
+
+	return stack.Call{}
+}
+
+type slogHandler struct {
+	args   []interface{}
+	prefix string
+}
+
+var _ slog.Handler = &slogHandler{}
+
+func (sh *slogHandler) contextArgs(ctx context.Context) []interface{} {
+	if ctx == nil {
+		return nil
+	}
+
+	return contextArgs(ctx)
+}
+
+func (sh *slogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	pkg := argsPackage(sh.contextArgs(ctx))
+	if pkg == "" {
+		pkg = argsPackage(sh.args)
+	}
+
+	return levelFromSlog(level) <= loadLevels().For(pkg)
+}
+
+func (sh *slogHandler) Handle(ctx context.Context, r slog.Record) error {
+	args := append([]interface{}{}, sh.args...)
+	args = append(args, sh.contextArgs(ctx)...)
+	r.Attrs(func(attr slog.Attr) bool {
+		args = appendSlogAttr(args, sh.prefix, attr)
+		return true
+	})
+
+	t := r.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	return rootLogger.GetHandler().Log(&log15.Record{
+		Time: t,
+		Lvl:  levelFromSlog(r.Level),
+		Msg:  r.Message,
+		Ctx:  args,
+		Call: slogCall(r.PC),
+		KeyNames: log15.RecordKeyNames{
+			Time: "t",
+			Msg:  "msg",
+			Lvl:  "lvl",
+		},
+	})
+}
+
+func (sh *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	args := append([]interface{}{}, sh.args...)
+	for _, attr := range attrs {
+		args = appendSlogAttr(args, sh.prefix, attr)
+	}
+
+	return &slogHandler{args: args, prefix: sh.prefix}
+}
+
+func (sh *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return sh
+	}
+
+	return &slogHandler{args: sh.args, prefix: sh.prefix + name + "."}
+}
+
+// NewSlogHandler returns a slog.Handler that forwards records to the root
+// logger of this package, so that they use the same handler and per-package
+// levels as every other Leg logger.
+//
+// The given names are used as the package of each record, as if they had been
+// passed to At(...). Arguments attached to the context using NewContext are
+// added to each record. Attributes in groups are flattened using dotted keys.
+func NewSlogHandler(names ...string) slog.Handler {
+	var args []interface{}
+	if len(names) > 0 {
+		args = normalize(packageArgs(names))
+	}
+
+	return &slogHandler{args: args}
+}
+
+// slogArgs converts log15-style key-value pairs to slog attributes. Nested
+// logging.Ctx maps become groups.
+func slogArgs(ctx []interface{}) []interface{} {
+	ctx = normalize(ctx)
+
+	args := make([]interface{}, 0, len(ctx))
+	for i := 0; i < len(ctx); i += 2 {
+		if i+1 == len(ctx) {
+			args = append(args, ctx[i])
+			break
+		}
+
+		k := fmt.Sprintf("%v", ctx[i])
+		switch v := ctx[i+1].(type) {
+		case Ctx:
+			args = append(args, slog.Group(k, slogArgs(v.toArray())...))
+		case log15.Ctx:
+			args = append(args, slog.Group(k, slogArgs(Ctx(v).toArray())...))
+		default:
+			args = append(args, slog.Any(k, v))
+		}
+	}
+	return args
+}
+
+type slogLogger struct {
+	delegate slog.Handler
+	stack    bool
+}
+
+var _ Logger = &slogLogger{}
+
+func (sl *slogLogger) Let(args ...interface{}) Logger {
+	if len(args) == 0 {
+		return sl
+	}
+
+	// A record converts the arguments to attributes using the same rules as
+	// slog.Logger, including for malformed pairs.
+	r := slog.NewRecord(time.Time{}, slog.LevelInfo, "", 0)
+	r.Add(slogArgs(args)...)
+
+	var attrs []slog.Attr
+	r.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+
+	return &slogLogger{delegate: sl.delegate.WithAttrs(attrs), stack: sl.stack}
+}
+
+func (sl *slogLogger) With(ctx context.Context) Logger {
+	return sl.Let(contextArgs(ctx)...)
+}
+
+func (sl *slogLogger) At(names ...string) Logger {
+	return sl.Let(packageArgs(names)...)
+}
+
+func (sl *slogLogger) Stack() Logger {
+	return &slogLogger{delegate: sl.delegate, stack: true}
+}
+
+func (sl *slogLogger) log(lvl log15.Lvl, msg string, args []interface{}) {
+	ctx := context.Background()
+
+	level := levelToSlog(lvl)
+	if !sl.delegate.Enabled(ctx, level) {
+		return
+	}
+
+	// Skip runtime.Callers, this function, and the exported logging method.
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+
+	r := slog.NewRecord(time.Now(), level, msg, pcs[0])
+	r.Add(slogArgs(args)...)
+
+	if sl.stack {
+		if s := stack.Trace().TrimBelow(stack.Caller(2)).TrimRuntime(); len(s) > 0 {
+			r.AddAttrs(slog.String("stack", fmt.Sprintf("%+v", s)))
+		}
+	}
+
+	_ = sl.delegate.Handle(ctx, r)
+}
+
+func (sl *slogLogger) Debug(msg string, ctx ...interface{}) {
+	sl.log(log15.LvlDebug, msg, ctx)
+}
+
+func (sl *slogLogger) Info(msg string, ctx ...interface{}) {
+	sl.log(log15.LvlInfo, msg, ctx)
+}
+
+func (sl *slogLogger) Warn(msg string, ctx ...interface{}) {
+	sl.log(log15.LvlWarn, msg, ctx)
+}
+
+func (sl *slogLogger) Error(msg string, ctx ...interface{}) {
+	sl.log(log15.LvlError, msg, ctx)
+}
+
+func (sl *slogLogger) Crit(msg string, ctx ...interface{}) {
+	sl.log(log15.LvlCrit, msg, ctx)
+}
+
+// NewSlogLogger returns a Logger that writes to the given slog.Handler. Levels
+// are mapped to their slog equivalents, with log15.LvlCrit mapped to
+// LevelCrit, and nested logging.Ctx maps become slog groups.
+func NewSlogLogger(h slog.Handler) Logger {
+	return &slogLogger{delegate: h}
+}
@@ -0,0 +1,144 @@
+//go:build go1.21
+// +build go1.21
+
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/puppetlabs/leg/logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlogHandlerLevels(t *testing.T) {
+	withRecordingHandler(t, func(rh *recordingHandler) {
+		logging.SetLevel(log15.LvlDebug)
+
+		logger := slog.New(logging.NewSlogHandler("leg", "test"))
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Warn("warn")
+		logger.Error("error")
+		logger.Log(context.Background(), logging.LevelCrit, "crit")
+		logger.Log(context.Background(), slog.LevelDebug-4, "trace")
+		logger.Log(context.Background(), slog.LevelInfo+2, "notice")
+
+		var lvls []log15.Lvl
+		for _, r := range rh.take() {
+			lvls = append(lvls, r.Lvl)
+		}
+		assert.Equal(t, []log15.Lvl{
+			log15.LvlDebug,
+			log15.LvlInfo,
+			log15.LvlWarn,
+			log15.LvlError,
+			log15.LvlCrit,
+			log15.LvlDebug,
+			log15.LvlInfo,
+		}, lvls)
+
+		logging.SetPackageLevel("leg/test", log15.LvlWarn)
+		assert.False(t, logger.Enabled(context.Background(), slog.LevelInfo))
+		assert.True(t, logger.Enabled(context.Background(), slog.LevelWarn))
+
+		logger.Info("info")
+		logger.Warn("warn")
+		slog.New(logging.NewSlogHandler("leg", "other")).Info("other info")
+		assert.Equal(t, []string{"warn", "other info"}, rh.messages())
+	})
+}
+
+func TestSlogHandlerAttrs(t *testing.T) {
+	withRecordingHandler(t, func(rh *recordingHandler) {
+		logging.SetLevel(log15.LvlDebug)
+
+		logger := slog.New(logging.NewSlogHandler("leg", "test")).
+			With("a", 1).
+			WithGroup("g").
+			With("b", 2)
+		logger.Info("hello",
+			"c", 3,
+			slog.Group("h", "d", 4),
+			slog.Group("", "e", 5),
+			slog.Group("empty"),
+		)
+
+		records := rh.take()
+		require.Len(t, records, 1)
+		assert.Equal(t, "hello", records[0].Msg)
+		assert.Equal(t, []interface{}{
+			"package", "leg/test",
+			"a", int64(1),
+			"g.b", int64(2),
+			"g.c", int64(3),
+			"g.h.d", int64(4),
+			"g.e", int64(5),
+		}, records[0].Ctx)
+	})
+}
+
+func TestSlogHandlerContext(t *testing.T) {
+	withRecordingHandler(t, func(rh *recordingHandler) {
+		logging.SetLevel(log15.LvlDebug)
+
+		ctx := logging.NewContext(context.Background(), "request", "abc")
+		slog.New(logging.NewSlogHandler("leg", "test")).InfoContext(ctx, "hello")
+
+		records := rh.take()
+		require.Len(t, records, 1)
+		assert.Equal(t, []interface{}{"package", "leg/test", "request", "abc"}, records[0].Ctx)
+	})
+}
+
+func TestSlogHandlerCaller(t *testing.T) {
+	withRecordingHandler(t, func(rh *recordingHandler) {
+		logging.SetLevel(log15.LvlDebug)
+
+		logger := slog.New(logging.NewSlogHandler())
+
+		_, _, line, _ := runtime.Caller(0)
+		logger.Info("hello")
+
+		records := rh.take()
+		require.Len(t, records, 1)
+
+		frame := records[0].Call.Frame()
+		assert.True(t, strings.HasSuffix(frame.Function, "TestSlogHandlerCaller.func1"), "unexpected function %q", frame.Function)
+		assert.Equal(t, line+1, frame.Line)
+	})
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := logging.NewSlogLogger(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	logger.At("leg", "test").Let("a", 1).Crit("hello", "ctx", logging.Ctx{"b": 2})
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		delete(record, "time")
+		records = append(records, record)
+	}
+
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "ERROR+4", "msg": "hello", "package": "leg/test", "a": float64(1), "ctx": map[string]interface{}{"b": float64(2)}},
+		{"level": "DEBUG", "msg": "debug"},
+		{"level": "INFO", "msg": "info"},
+		{"level": "WARN", "msg": "warn"},
+		{"level": "ERROR", "msg": "error"},
+	}, records)
+}
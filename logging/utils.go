@@ -1,9 +1,23 @@
 package logging
 
-import "strings"
+import (
+	"fmt"
+	"strings"
+)
 
 func packageArgs(names []string) []interface{} {
 	return []interface{}{
 		Ctx{"package": strings.Join(names, "/")},
 	}
 }
+
+// argsPackage returns the last package name set in the given context
+// arguments.
+func argsPackage(args []interface{}) (pkg string) {
+	for i := 0; i+1 < len(args); i += 2 {
+		if k, ok := args[i].(string); ok && k == "package" {
+			pkg = fmt.Sprintf("%v", args[i+1])
+		}
+	}
+	return
+}
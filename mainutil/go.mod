@@ -6,4 +6,5 @@ require (
 	github.com/puppetlabs/errawr-go/v2 v2.2.0
 	github.com/puppetlabs/leg/lifecycle v0.2.0
 	github.com/puppetlabs/leg/logging v0.1.0
+	github.com/stretchr/testify v1.6.1
 )
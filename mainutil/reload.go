@@ -0,0 +1,259 @@
+package mainutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ReloadFunc is a callback invoked when the configuration of the current
+// process should be reloaded.
+type ReloadFunc func(ctx context.Context) error
+
+// RestartOnReload adapts a restart function, such as the one returned by the
+// scheduler package's NewRestartableDescriptor, to a reload callback so that a
+// scheduler lifecycle picks up new configuration when the process reloads.
+func RestartOnReload(restart func()) ReloadFunc {
+	return func(ctx context.Context) error {
+		restart()
+		return nil
+	}
+}
+
+// Reloader is a registry of reload callbacks.
+//
+// Reloads are serialized: a reload triggered while another is in progress
+// waits for it to finish. Callbacks run in the order they were registered, and
+// a reload stops at the first callback that returns an error. Callbacks that
+// already ran are not rolled back, so register callbacks that others depend
+// on, such as a ReloadableConfig, first.
+type Reloader struct {
+	fnsMut sync.RWMutex
+	fns    []ReloadFunc
+
+	reloadMut sync.Mutex
+}
+
+// Register adds the given callbacks to this registry.
+func (r *Reloader) Register(fns ...ReloadFunc) {
+	r.fnsMut.Lock()
+	defer r.fnsMut.Unlock()
+
+	r.fns = append(r.fns, fns...)
+}
+
+// Reload runs each registered callback in order. Any error is logged as well
+// as returned.
+func (r *Reloader) Reload(ctx context.Context) error {
+	r.reloadMut.Lock()
+	defer r.reloadMut.Unlock()
+
+	r.fnsMut.RLock()
+	fns := append([]ReloadFunc{}, r.fns...)
+	r.fnsMut.RUnlock()
+
+	for _, fn := range fns {
+		if err := fn(ctx); err != nil {
+			log(ctx).Error("reload failed", "error", err)
+			return err
+		}
+	}
+
+	log(ctx).Info("reload complete")
+	return nil
+}
+
+// OnSignal returns a function suitable for use with TrapAndWait that reloads
+// the process every time it receives SIGHUP.
+func (r *Reloader) OnSignal() CancelableFunc {
+	return func(ctx context.Context) error {
+		sigch := make(chan os.Signal, 1)
+		signal.Notify(sigch, syscall.SIGHUP)
+		defer signal.Stop(sigch)
+
+		for {
+			select {
+			case <-sigch:
+				log(ctx).Info("received SIGHUP, reloading")
+				_ = r.Reload(ctx)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// FileWatchOptions contains fields that configure a file watch.
+type FileWatchOptions struct {
+	// PollInterval is how often the file is checked for changes.
+	PollInterval time.Duration
+}
+
+// FileWatchOption is a setter for one or more file watch options.
+type FileWatchOption interface {
+	// ApplyToFileWatchOptions configures the specified file watch options for
+	// this option.
+	ApplyToFileWatchOptions(target *FileWatchOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *FileWatchOptions) ApplyOptions(opts []FileWatchOption) {
+	for _, opt := range opts {
+		opt.ApplyToFileWatchOptions(o)
+	}
+}
+
+// FileWatchOptionFunc allows a function to be used as a file watch option.
+type FileWatchOptionFunc func(target *FileWatchOptions)
+
+var _ FileWatchOption = FileWatchOptionFunc(nil)
+
+// ApplyToFileWatchOptions configures the specified file watch options by
+// calling this function.
+func (fwof FileWatchOptionFunc) ApplyToFileWatchOptions(target *FileWatchOptions) {
+	fwof(target)
+}
+
+// FileWatchWithPollInterval changes how often the file is checked for changes.
+func FileWatchWithPollInterval(d time.Duration) FileWatchOption {
+	return FileWatchOptionFunc(func(target *FileWatchOptions) {
+		target.PollInterval = d
+	})
+}
+
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func (fs fileState) changedFrom(prev fileState) bool {
+	return fs.exists != prev.exists || fs.size != prev.size || !fs.modTime.Equal(prev.modTime)
+}
+
+func statFile(path string) (fileState, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fileState{}, nil
+	} else if err != nil {
+		return fileState{}, err
+	}
+
+	return fileState{
+		exists:  true,
+		size:    fi.Size(),
+		modTime: fi.ModTime(),
+	}, nil
+}
+
+// OnFileChange returns a function suitable for use with TrapAndWait that
+// reloads the process every time the file at the given path changes.
+//
+// The file is polled for changes to its size and modification time. Symbolic
+// links are followed, so files mounted from a Kubernetes ConfigMap or Secret
+// are detected when they are updated. A reload is not triggered when the file
+// is removed, only when it is subsequently recreated.
+func (r *Reloader) OnFileChange(path string, opts ...FileWatchOption) CancelableFunc {
+	o := &FileWatchOptions{
+		PollInterval: 5 * time.Second,
+	}
+	o.ApplyOptions(opts)
+
+	return func(ctx context.Context) error {
+		prev, err := statFile(path)
+		if err != nil {
+			log(ctx).Warn("failed to check watched file", "path", path, "error", err)
+		}
+
+		ticker := time.NewTicker(o.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				cur, err := statFile(path)
+				if err != nil {
+					log(ctx).Warn("failed to check watched file", "path", path, "error", err)
+					continue
+				}
+
+				if cur.exists && cur.changedFrom(prev) {
+					log(ctx).Info("watched file changed, reloading", "path", path)
+					_ = r.Reload(ctx)
+				}
+
+				prev = cur
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
+
+// NewReloader creates a new reload registry with the given callbacks.
+func NewReloader(fns ...ReloadFunc) *Reloader {
+	return &Reloader{
+		fns: append([]ReloadFunc{}, fns...),
+	}
+}
+
+// ConfigLoader reads configuration for the current process.
+type ConfigLoader func(ctx context.Context) (interface{}, error)
+
+// ErrNoConfigLoader is returned when reloading a ReloadableConfig that was not
+// created with NewReloadableConfig.
+var ErrNoConfigLoader = errors.New("reloadable configuration has no loader")
+
+// ReloadableConfig holds the most recently loaded configuration for the
+// current process. If loading new configuration fails, the previous
+// configuration is kept.
+type ReloadableConfig struct {
+	loader ConfigLoader
+	value  atomic.Value
+}
+
+type reloadableConfigValue struct {
+	config interface{}
+}
+
+// Get returns the current configuration, or nil if no configuration has been
+// loaded.
+func (rc *ReloadableConfig) Get() interface{} {
+	v, _ := rc.value.Load().(reloadableConfigValue)
+	return v.config
+}
+
+// Reload loads new configuration. If the loader returns an error, the current
+// configuration is unchanged. This method can be registered with a Reloader.
+func (rc *ReloadableConfig) Reload(ctx context.Context) error {
+	if rc.loader == nil {
+		return ErrNoConfigLoader
+	}
+
+	config, err := rc.loader(ctx)
+	if err != nil {
+		return err
+	}
+
+	rc.value.Store(reloadableConfigValue{config: config})
+	return nil
+}
+
+// NewReloadableConfig creates a new reloadable configuration using the given
+// loader. The configuration is loaded immediately, and this function returns
+// an error if it cannot be loaded.
+func NewReloadableConfig(ctx context.Context, loader ConfigLoader) (*ReloadableConfig, error) {
+	rc := &ReloadableConfig{
+		loader: loader,
+	}
+	if err := rc.Reload(ctx); err != nil {
+		return nil, err
+	}
+
+	return rc, nil
+}
@@ -0,0 +1,189 @@
+package mainutil_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/mainutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloaderOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var calls []string
+	record := func(name string, err error) mainutil.ReloadFunc {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+
+	r := mainutil.NewReloader(record("a", nil), record("b", nil))
+	r.Register(record("c", nil))
+
+	require.NoError(t, r.Reload(ctx))
+	assert.Equal(t, []string{"a", "b", "c"}, calls)
+
+	calls = nil
+	failure := errors.New("boom")
+
+	r = mainutil.NewReloader(record("a", nil), record("b", failure), record("c", nil))
+	assert.Equal(t, failure, r.Reload(ctx))
+	assert.Equal(t, []string{"a", "b"}, calls)
+}
+
+func TestReloadableConfig(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	failure := errors.New("boom")
+
+	var next interface{} = "v1"
+	rc, err := mainutil.NewReloadableConfig(ctx, func(ctx context.Context) (interface{}, error) {
+		if err, ok := next.(error); ok {
+			return nil, err
+		}
+
+		return next, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "v1", rc.Get())
+
+	next = "v2"
+	require.NoError(t, rc.Reload(ctx))
+	assert.Equal(t, "v2", rc.Get())
+
+	next = failure
+	assert.Equal(t, failure, rc.Reload(ctx))
+	assert.Equal(t, "v2", rc.Get())
+}
+
+func TestReloadableConfigInitialLoadError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	failure := errors.New("boom")
+
+	_, err := mainutil.NewReloadableConfig(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, failure
+	})
+	assert.Equal(t, failure, err)
+}
+
+func TestReloadableConfigZeroValue(t *testing.T) {
+	var rc mainutil.ReloadableConfig
+	assert.Nil(t, rc.Get())
+	assert.Equal(t, mainutil.ErrNoConfigLoader, rc.Reload(context.Background()))
+	assert.Nil(t, rc.Get())
+}
+
+func TestReloaderOnSignal(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Keep SIGHUP from terminating the test binary if it arrives before the
+	// reloader subscribes to it.
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, syscall.SIGHUP)
+	defer signal.Stop(sigch)
+
+	reloaded := make(chan struct{}, 1)
+	r := mainutil.NewReloader(func(ctx context.Context) error {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+
+	sctx, scancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.OnSignal()(sctx)
+	}()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for found := false; !found; {
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+		select {
+		case <-reloaded:
+			found = true
+		case <-ticker.C:
+		case <-ctx.Done():
+			require.Fail(t, "reload not triggered by SIGHUP")
+		}
+	}
+
+	scancel()
+	assert.NoError(t, <-done)
+}
+
+func TestReloaderOnFileChange(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir, err := ioutil.TempDir("", "mainutil-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config")
+	require.NoError(t, ioutil.WriteFile(path, []byte("a"), 0600))
+
+	reloaded := make(chan struct{}, 10)
+	r := mainutil.NewReloader(func(ctx context.Context) error {
+		reloaded <- struct{}{}
+		return nil
+	})
+
+	sctx, scancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- r.OnFileChange(path, mainutil.FileWatchWithPollInterval(5*time.Millisecond))(sctx)
+	}()
+
+	select {
+	case <-reloaded:
+		assert.Fail(t, "reload triggered without a change")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("ab"), 0600))
+
+	select {
+	case <-reloaded:
+	case <-ctx.Done():
+		require.Fail(t, "reload not triggered by file change")
+	}
+
+	require.NoError(t, os.Remove(path))
+
+	select {
+	case <-reloaded:
+		assert.Fail(t, "reload triggered by file removal")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("abc"), 0600))
+
+	select {
+	case <-reloaded:
+	case <-ctx.Done():
+		require.Fail(t, "reload not triggered by file recreation")
+	}
+
+	scancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,97 @@
+package request
+
+import (
+	"errors"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidBaggage is returned when a baggage header value cannot be parsed.
+var ErrInvalidBaggage = errors.New("request: invalid baggage")
+
+// Baggage is a set of application-defined key-value pairs propagated with a
+// distributed trace using the W3C baggage header.
+type Baggage map[string]string
+
+// String formats this baggage as a baggage header value. Members are sorted by
+// key, and values are percent-encoded.
+func (b Baggage) String() string {
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	members := make([]string, len(keys))
+	for i, k := range keys {
+		members[i] = k + "=" + url.PathEscape(b[k])
+	}
+	return strings.Join(members, ",")
+}
+
+func (b Baggage) clone() Baggage {
+	if b == nil {
+		return nil
+	}
+
+	next := make(Baggage, len(b))
+	for k, v := range b {
+		next[k] = v
+	}
+	return next
+}
+
+func validBaggageKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	// Keys are RFC 7230 tokens.
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", r):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseBaggage parses a W3C baggage header value. Properties of each member
+// are discarded. If a key appears more than once, the last value is used.
+func ParseBaggage(s string) (Baggage, error) {
+	b := make(Baggage)
+
+	for _, member := range strings.Split(s, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		if idx := strings.IndexByte(member, ';'); idx >= 0 {
+			member = member[:idx]
+		}
+
+		idx := strings.IndexByte(member, '=')
+		if idx < 0 {
+			return nil, ErrInvalidBaggage
+		}
+
+		key := strings.TrimSpace(member[:idx])
+		if !validBaggageKey(key) {
+			return nil, ErrInvalidBaggage
+		}
+
+		value, err := url.PathUnescape(strings.TrimSpace(member[idx+1:]))
+		if err != nil {
+			return nil, ErrInvalidBaggage
+		}
+
+		b[key] = value
+	}
+
+	return b, nil
+}
@@ -0,0 +1,99 @@
+package request_test
+
+import (
+	"testing"
+
+	"github.com/puppetlabs/leg/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBaggage(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Value    string
+		Expected request.Baggage
+		Valid    bool
+	}{
+		{
+			Name:     "Empty",
+			Value:    "",
+			Expected: request.Baggage{},
+			Valid:    true,
+		},
+		{
+			Name:  "Multiple members",
+			Value: "userId=alice,serverNode=DF%2028,isProduction=false",
+			Expected: request.Baggage{
+				"userId":       "alice",
+				"serverNode":   "DF 28",
+				"isProduction": "false",
+			},
+			Valid: true,
+		},
+		{
+			Name:  "Whitespace and empty members",
+			Value: " a = 1 ,, b=2\t",
+			Expected: request.Baggage{
+				"a": "1",
+				"b": "2",
+			},
+			Valid: true,
+		},
+		{
+			Name:  "Properties are discarded",
+			Value: "a=1;ttl=10;secret,b=2",
+			Expected: request.Baggage{
+				"a": "1",
+				"b": "2",
+			},
+			Valid: true,
+		},
+		{
+			Name:  "Last duplicate wins",
+			Value: "a=1,a=2",
+			Expected: request.Baggage{
+				"a": "2",
+			},
+			Valid: true,
+		},
+		{
+			Name:  "Empty value",
+			Value: "a=",
+			Expected: request.Baggage{
+				"a": "",
+			},
+			Valid: true,
+		},
+		{Name: "Missing value separator", Value: "a"},
+		{Name: "Empty key", Value: "=1"},
+		{Name: "Invalid key", Value: "a b=1"},
+		{Name: "Invalid percent-encoding", Value: "a=%zz"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			b, err := request.ParseBaggage(test.Value)
+			if !test.Valid {
+				assert.Equal(t, request.ErrInvalidBaggage, err)
+				assert.Nil(t, b)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, b)
+		})
+	}
+}
+
+func TestBaggageString(t *testing.T) {
+	b := request.Baggage{
+		"serverNode": "DF 28",
+		"userId":     "alice",
+		"path":       "a/b,c",
+	}
+	assert.Equal(t, "path=a%2Fb%2Cc,serverNode=DF%2028,userId=alice", b.String())
+
+	parsed, err := request.ParseBaggage(b.String())
+	require.NoError(t, err)
+	assert.Equal(t, b, parsed)
+}
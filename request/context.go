@@ -1,6 +1,10 @@
 package request
 
-import "context"
+import (
+	"context"
+
+	"github.com/puppetlabs/leg/logging"
+)
 
 type contextKey int
 
@@ -8,8 +12,22 @@ const (
 	requestContextKey contextKey = iota
 )
 
+// NewContext attaches the given request to a context. The identifier of the
+// request and its trace and span IDs are also added to the logging context
+// arguments, so that loggers built using the returned context include them.
 func NewContext(ctx context.Context, req *Request) context.Context {
-	return context.WithValue(ctx, requestContextKey, req)
+	args := []interface{}{
+		"request", req.Identifier,
+		"trace_id", req.TraceID.String(),
+		"span_id", req.SpanID.String(),
+	}
+	if req.ParentSpanID.IsValid() {
+		args = append(args, "parent_span_id", req.ParentSpanID.String())
+	}
+
+	ctx = context.WithValue(ctx, requestContextKey, req)
+	ctx = logging.NewContext(ctx, args...)
+	return ctx
 }
 
 func FromContext(ctx context.Context) (req *Request, ok bool) {
@@ -2,4 +2,10 @@ module github.com/puppetlabs/leg/request
 
 go 1.14
 
-require github.com/google/uuid v1.0.0
+require (
+	github.com/google/uuid v1.1.2
+	github.com/puppetlabs/leg/logging v0.1.0
+	github.com/stretchr/testify v1.6.1
+)
+
+replace github.com/puppetlabs/leg/logging => ../logging
@@ -2,12 +2,82 @@ package request
 
 import "github.com/google/uuid"
 
+// Request identifies a unit of work, such as an HTTP request or a scheduled
+// process, and its position in a distributed trace.
+//
+// Each request is a span of a trace. A request created by New starts a new
+// trace, while a request created by NewChild or NewRemoteChild continues the
+// trace of its parent.
 type Request struct {
+	// Identifier is a unique identifier for this request.
 	Identifier string
+
+	// TraceID identifies the trace this request belongs to.
+	TraceID TraceID
+
+	// SpanID identifies this request within its trace.
+	SpanID SpanID
+
+	// ParentSpanID identifies the span that caused this request. It is not
+	// valid if this request started a new trace.
+	ParentSpanID SpanID
+
+	// TraceFlags are the options of the trace, propagated to children.
+	TraceFlags TraceFlags
+
+	// TraceState contains vendor-specific trace information, propagated to
+	// children.
+	TraceState TraceState
+
+	// Baggage contains application-defined values, propagated to children.
+	Baggage Baggage
+}
+
+// TraceParent returns the trace parent to propagate to operations caused by
+// this request.
+func (r *Request) TraceParent() TraceParent {
+	return TraceParent{
+		TraceID: r.TraceID,
+		SpanID:  r.SpanID,
+		Flags:   r.TraceFlags,
+	}
 }
 
+// New creates a request that starts a new sampled trace.
 func New() *Request {
 	return &Request{
 		Identifier: uuid.New().String(),
+		TraceID:    newTraceID(),
+		SpanID:     newSpanID(),
+		TraceFlags: TraceFlagsSampled,
+	}
+}
+
+// NewChild creates a request for a new span of the trace of the given parent
+// request.
+func NewChild(parent *Request) *Request {
+	return &Request{
+		Identifier:   uuid.New().String(),
+		TraceID:      parent.TraceID,
+		SpanID:       newSpanID(),
+		ParentSpanID: parent.SpanID,
+		TraceFlags:   parent.TraceFlags,
+		TraceState:   append(TraceState(nil), parent.TraceState...),
+		Baggage:      parent.Baggage.clone(),
+	}
+}
+
+// NewRemoteChild creates a request for a new span of a trace propagated from
+// another process, such as by the traceparent, tracestate, and baggage headers
+// of an HTTP request.
+func NewRemoteChild(parent TraceParent, state TraceState, baggage Baggage) *Request {
+	return &Request{
+		Identifier:   uuid.New().String(),
+		TraceID:      parent.TraceID,
+		SpanID:       newSpanID(),
+		ParentSpanID: parent.SpanID,
+		TraceFlags:   parent.Flags,
+		TraceState:   append(TraceState(nil), state...),
+		Baggage:      baggage.clone(),
 	}
 }
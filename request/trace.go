@@ -0,0 +1,246 @@
+package request
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Header names defined by the W3C Trace Context and Baggage specifications.
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+	BaggageHeader     = "baggage"
+)
+
+var (
+	// ErrInvalidTraceParent is returned when a traceparent header value cannot
+	// be parsed.
+	ErrInvalidTraceParent = errors.New("request: invalid traceparent")
+
+	// ErrInvalidTraceState is returned when a tracestate header value cannot be
+	// parsed.
+	ErrInvalidTraceState = errors.New("request: invalid tracestate")
+)
+
+// TraceID is the identifier of a distributed trace.
+type TraceID [16]byte
+
+// IsValid returns true if this trace ID is not all zeros.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID is the identifier of a single operation within a distributed trace.
+type SpanID [8]byte
+
+// IsValid returns true if this span ID is not all zeros.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return
+}
+
+// TraceFlags are the options of a distributed trace.
+type TraceFlags byte
+
+const (
+	// TraceFlagsSampled indicates that the caller may have recorded trace
+	// data.
+	TraceFlagsSampled TraceFlags = 0x01
+)
+
+// IsSampled returns true if the sampled flag is set.
+func (f TraceFlags) IsSampled() bool {
+	return f&TraceFlagsSampled != 0
+}
+
+// TraceParent is the value of a W3C traceparent header.
+type TraceParent struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   TraceFlags
+}
+
+// String formats this trace parent as a version 00 traceparent header value.
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tp.TraceID, tp.SpanID, byte(tp.Flags))
+}
+
+func decodeLowerHex(dst []byte, src string) bool {
+	if strings.ToLower(src) != src {
+		return false
+	}
+
+	n, err := hex.Decode(dst, []byte(src))
+	return err == nil && n == len(dst)
+}
+
+// ParseTraceParent parses a W3C traceparent header value. Values with a
+// version newer than 00 are parsed according to the version 00 format, as the
+// specification requires.
+func ParseTraceParent(s string) (tp TraceParent, err error) {
+	s = strings.TrimSpace(s)
+
+	// version-traceid-parentid-flags: 2+1+32+1+16+1+2.
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return TraceParent{}, ErrInvalidTraceParent
+	}
+
+	var version [1]byte
+	if !decodeLowerHex(version[:], s[:2]) || version[0] == 0xff {
+		return TraceParent{}, ErrInvalidTraceParent
+	}
+
+	if len(s) > 55 && (version[0] == 0 || s[55] != '-') {
+		return TraceParent{}, ErrInvalidTraceParent
+	}
+
+	var flags [1]byte
+	if !decodeLowerHex(tp.TraceID[:], s[3:35]) ||
+		!decodeLowerHex(tp.SpanID[:], s[36:52]) ||
+		!decodeLowerHex(flags[:], s[53:55]) ||
+		!tp.TraceID.IsValid() || !tp.SpanID.IsValid() {
+		return TraceParent{}, ErrInvalidTraceParent
+	}
+
+	tp.Flags = TraceFlags(flags[0])
+	return
+}
+
+// TraceStateMember is a single vendor-specific entry of a W3C tracestate
+// header.
+type TraceStateMember struct {
+	Key   string
+	Value string
+}
+
+// TraceState is the value of a W3C tracestate header. Members are ordered from
+// most to least recently updated.
+type TraceState []TraceStateMember
+
+// maxTraceStateMembers is the maximum number of members allowed by the
+// specification.
+const maxTraceStateMembers = 32
+
+// Get returns the value of the member with the given key.
+func (ts TraceState) Get(key string) (string, bool) {
+	for _, m := range ts {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return "", false
+}
+
+// Insert returns a copy of this trace state with the given member added to
+// the front, replacing any existing member with the same key.
+func (ts TraceState) Insert(key, value string) TraceState {
+	next := TraceState{{Key: key, Value: value}}
+	for _, m := range ts {
+		if m.Key != key && len(next) < maxTraceStateMembers {
+			next = append(next, m)
+		}
+	}
+	return next
+}
+
+// String formats this trace state as a tracestate header value.
+func (ts TraceState) String() string {
+	members := make([]string, len(ts))
+	for i, m := range ts {
+		members[i] = m.Key + "=" + m.Value
+	}
+	return strings.Join(members, ",")
+}
+
+func validTraceStateKey(key string) bool {
+	if key == "" || len(key) > 256 {
+		return false
+	}
+
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '_', r == '-', r == '*', r == '/', r == '@':
+		default:
+			return false
+		}
+	}
+
+	return key[0] >= 'a' && key[0] <= 'z' || key[0] >= '0' && key[0] <= '9'
+}
+
+func validTraceStateValue(value string) bool {
+	if value == "" || len(value) > 256 || value[len(value)-1] == ' ' {
+		return false
+	}
+
+	for _, r := range value {
+		if r < 0x20 || r > 0x7e || r == ',' || r == '=' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseTraceState parses a W3C tracestate header value. Empty members are
+// ignored. If the same key appears more than once or the value has more than
+// 32 members, the value is invalid.
+func ParseTraceState(s string) (TraceState, error) {
+	var ts TraceState
+	seen := make(map[string]struct{})
+
+	for _, member := range strings.Split(s, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+
+		idx := strings.IndexByte(member, '=')
+		if idx < 0 {
+			return nil, ErrInvalidTraceState
+		}
+
+		key, value := member[:idx], member[idx+1:]
+		if !validTraceStateKey(key) || !validTraceStateValue(value) {
+			return nil, ErrInvalidTraceState
+		}
+
+		if _, found := seen[key]; found {
+			return nil, ErrInvalidTraceState
+		}
+		seen[key] = struct{}{}
+
+		ts = append(ts, TraceStateMember{Key: key, Value: value})
+	}
+
+	if len(ts) > maxTraceStateMembers {
+		return nil, ErrInvalidTraceState
+	}
+
+	return ts, nil
+}
@@ -0,0 +1,185 @@
+package request_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/puppetlabs/leg/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	expected := request.TraceParent{
+		TraceID: request.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:  request.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		Flags:   request.TraceFlagsSampled,
+	}
+
+	tests := []struct {
+		Name     string
+		Value    string
+		Expected request.TraceParent
+		Valid    bool
+	}{
+		{
+			Name:     "Sampled",
+			Value:    "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			Expected: expected,
+			Valid:    true,
+		},
+		{
+			Name:  "Not sampled",
+			Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			Expected: request.TraceParent{
+				TraceID: expected.TraceID,
+				SpanID:  expected.SpanID,
+			},
+			Valid: true,
+		},
+		{
+			Name:     "Surrounding whitespace",
+			Value:    " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\t",
+			Expected: expected,
+			Valid:    true,
+		},
+		{
+			Name:     "Future version",
+			Value:    "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			Expected: expected,
+			Valid:    true,
+		},
+		{
+			Name:     "Future version with additional fields",
+			Value:    "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds",
+			Expected: expected,
+			Valid:    true,
+		},
+		{Name: "Empty", Value: ""},
+		{Name: "Truncated", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0"},
+		{Name: "Version 00 with additional fields", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"},
+		{Name: "Future version without separator", Value: "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01extra"},
+		{Name: "Forbidden version", Value: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{Name: "Uppercase", Value: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01"},
+		{Name: "Invalid hex", Value: "00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01"},
+		{Name: "Wrong separator", Value: "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{Name: "Zero trace ID", Value: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{Name: "Zero span ID", Value: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			tp, err := request.ParseTraceParent(test.Value)
+			if !test.Valid {
+				assert.Equal(t, request.ErrInvalidTraceParent, err)
+				assert.Equal(t, request.TraceParent{}, tp)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, tp)
+		})
+	}
+}
+
+func TestTraceParentString(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	tp, err := request.ParseTraceParent(value)
+	require.NoError(t, err)
+	assert.Equal(t, value, tp.String())
+}
+
+func TestParseTraceState(t *testing.T) {
+	var tooMany []string
+	for i := 0; i < 33; i++ {
+		tooMany = append(tooMany, "k"+strings.Repeat("x", i)+"=v")
+	}
+
+	tests := []struct {
+		Name     string
+		Value    string
+		Expected request.TraceState
+		Valid    bool
+	}{
+		{
+			Name:  "Empty",
+			Value: "",
+			Valid: true,
+		},
+		{
+			Name:  "Single member",
+			Value: "congo=t61rcWkgMzE",
+			Expected: request.TraceState{
+				{Key: "congo", Value: "t61rcWkgMzE"},
+			},
+			Valid: true,
+		},
+		{
+			Name:  "Multiple members with whitespace and empty members",
+			Value: " rojo=00f067aa0ba902b7 ,, congo=t61rcWkgMzE,\t",
+			Expected: request.TraceState{
+				{Key: "rojo", Value: "00f067aa0ba902b7"},
+				{Key: "congo", Value: "t61rcWkgMzE"},
+			},
+			Valid: true,
+		},
+		{
+			Name:  "Multi-tenant key",
+			Value: "tenant@vendor=a b",
+			Expected: request.TraceState{
+				{Key: "tenant@vendor", Value: "a b"},
+			},
+			Valid: true,
+		},
+		{
+			Name:  "Maximum members",
+			Value: strings.Join(tooMany[:32], ","),
+			Expected: func() (ts request.TraceState) {
+				for i := 0; i < 32; i++ {
+					ts = append(ts, request.TraceStateMember{Key: "k" + strings.Repeat("x", i), Value: "v"})
+				}
+				return
+			}(),
+			Valid: true,
+		},
+		{Name: "Too many members", Value: strings.Join(tooMany, ",")},
+		{Name: "Missing value separator", Value: "congo"},
+		{Name: "Empty value", Value: "congo="},
+		{Name: "Uppercase key", Value: "Congo=t61rcWkgMzE"},
+		{Name: "Key starting with symbol", Value: "@congo=t61rcWkgMzE"},
+		{Name: "Value containing equals", Value: "congo=a=b"},
+		{Name: "Value too long", Value: "congo=" + strings.Repeat("v", 257)},
+		{Name: "Value with control character", Value: "congo=a\x01b"},
+		{Name: "Key too long", Value: strings.Repeat("k", 257) + "=v"},
+		{Name: "Duplicate key", Value: "congo=a,rojo=b,congo=c"},
+	}
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			ts, err := request.ParseTraceState(test.Value)
+			if !test.Valid {
+				assert.Equal(t, request.ErrInvalidTraceState, err)
+				assert.Nil(t, ts)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.Expected, ts)
+		})
+	}
+}
+
+func TestTraceStateInsert(t *testing.T) {
+	ts, err := request.ParseTraceState("rojo=00f067aa0ba902b7,congo=t61rcWkgMzE")
+	require.NoError(t, err)
+
+	next := ts.Insert("congo", "ucfJifl5GOE")
+	assert.Equal(t, "congo=ucfJifl5GOE,rojo=00f067aa0ba902b7", next.String())
+	assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", ts.String())
+
+	value, ok := next.Get("congo")
+	assert.True(t, ok)
+	assert.Equal(t, "ucfJifl5GOE", value)
+
+	_, ok = next.Get("missing")
+	assert.False(t, ok)
+}
@@ -44,6 +44,7 @@ type AdhocDescriptor struct {
 }
 
 var _ Descriptor = &AdhocDescriptor{}
+var _ QueueLener = &AdhocDescriptor{}
 
 func (ad *AdhocDescriptor) runOnce(ctx context.Context) (*adhocProcess, bool) {
 	ad.cond.L.Lock()
@@ -69,6 +70,14 @@ func (ad *AdhocDescriptor) runOnce(ctx context.Context) (*adhocProcess, bool) {
 	return next, true
 }
 
+// QueueLen returns the number of work items in this descriptor's queue.
+func (ad *AdhocDescriptor) QueueLen() int {
+	ad.cond.L.Lock()
+	defer ad.cond.L.Unlock()
+
+	return len(ad.queue)
+}
+
 // Run executes this descriptor with the given process channel.
 func (ad *AdhocDescriptor) Run(ctx context.Context, pc chan<- Process) error {
 	doneCh := make(chan struct{})
@@ -110,10 +119,7 @@ type AdhocSubmitter struct {
 // QueueLen returns the number of work items in the descriptor's queue. These
 // items have not yet been submitted to the scheduler for processing.
 func (as *AdhocSubmitter) QueueLen() int {
-	as.target.cond.L.Lock()
-	defer as.target.cond.L.Unlock()
-
-	return len(as.target.queue)
+	return as.target.QueueLen()
 }
 
 // Submit adds a new work item to the descriptor's queue.
@@ -0,0 +1,177 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+// MissedRunPolicy determines what a calendar-based descriptor does when one or
+// more scheduled runs of its process pass before it is able to emit them, for
+// example, because the scheduler's workers were busy or the system was
+// suspended.
+type MissedRunPolicy int
+
+const (
+	// MissedRunPolicySkip ignores missed runs. The process next runs at the
+	// first scheduled time after the descriptor catches up.
+	MissedRunPolicySkip MissedRunPolicy = iota
+
+	// MissedRunPolicyRunOnce runs the process once as soon as possible if any
+	// runs were missed, regardless of how many were missed.
+	MissedRunPolicyRunOnce
+
+	// MissedRunPolicyCatchUp runs the process once for every missed run, as
+	// quickly as the scheduler accepts them.
+	MissedRunPolicyCatchUp
+)
+
+// CalendarDescriptorOptions contains fields that configure descriptors that
+// run a process at calendar-based times, such as CronDescriptor and
+// RecurringIntervalDescriptor.
+type CalendarDescriptorOptions struct {
+	// MissedRunPolicy determines how runs that are missed are handled. If not
+	// specified, MissedRunPolicySkip is used.
+	MissedRunPolicy MissedRunPolicy
+
+	// Location is the time zone used to interpret a cron expression that does
+	// not specify its own. If not specified, time.Local is used. It has no
+	// effect on recurring intervals, which always specify their own time zone.
+	Location *time.Location
+
+	// Clock is the clock used to determine the current time and to wait for
+	// the next run. If not specified, the system clock is used.
+	Clock clock.Clock
+}
+
+// CalendarDescriptorOption is a setter for one or more calendar descriptor
+// options.
+type CalendarDescriptorOption interface {
+	// ApplyToCalendarDescriptorOptions configures the specified calendar
+	// descriptor options for this option.
+	ApplyToCalendarDescriptorOptions(target *CalendarDescriptorOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *CalendarDescriptorOptions) ApplyOptions(opts []CalendarDescriptorOption) {
+	for _, opt := range opts {
+		opt.ApplyToCalendarDescriptorOptions(o)
+	}
+}
+
+// CalendarDescriptorOptionFunc allows a function to be used as a calendar
+// descriptor option.
+type CalendarDescriptorOptionFunc func(target *CalendarDescriptorOptions)
+
+var _ CalendarDescriptorOption = CalendarDescriptorOptionFunc(nil)
+
+// ApplyToCalendarDescriptorOptions configures the specified calendar
+// descriptor options by calling this function.
+func (cdof CalendarDescriptorOptionFunc) ApplyToCalendarDescriptorOptions(target *CalendarDescriptorOptions) {
+	cdof(target)
+}
+
+// CalendarDescriptorWithMissedRunPolicy changes the handling of missed runs to
+// the specified policy.
+func CalendarDescriptorWithMissedRunPolicy(policy MissedRunPolicy) CalendarDescriptorOption {
+	return CalendarDescriptorOptionFunc(func(target *CalendarDescriptorOptions) {
+		target.MissedRunPolicy = policy
+	})
+}
+
+// CalendarDescriptorWithLocation changes the default time zone of cron
+// expressions to the specified one.
+func CalendarDescriptorWithLocation(loc *time.Location) CalendarDescriptorOption {
+	return CalendarDescriptorOptionFunc(func(target *CalendarDescriptorOptions) {
+		target.Location = loc
+	})
+}
+
+// CalendarDescriptorWithClock changes the clock to the specified one.
+func CalendarDescriptorWithClock(c clock.Clock) CalendarDescriptorOption {
+	return CalendarDescriptorOptionFunc(func(target *CalendarDescriptorOptions) {
+		target.Clock = c
+	})
+}
+
+func newCalendarDescriptorOptions(opts []CalendarDescriptorOption) *CalendarDescriptorOptions {
+	o := &CalendarDescriptorOptions{
+		Location: time.Local,
+		Clock:    clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+	return o
+}
+
+// calendar emits a process at each of the times produced by a schedule.
+type calendar struct {
+	next    func(after time.Time) (time.Time, bool)
+	process Process
+	policy  MissedRunPolicy
+	clock   clock.Clock
+}
+
+func (c *calendar) wait(ctx context.Context, until time.Time) bool {
+	d := until.Sub(c.clock.Now())
+	if d <= 0 {
+		return true
+	}
+
+	t := c.clock.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C():
+		return true
+	}
+}
+
+func (c *calendar) emit(ctx context.Context, pc chan<- Process) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case pc <- c.process:
+		return true
+	}
+}
+
+func (c *calendar) run(ctx context.Context, pc chan<- Process) error {
+	last := c.clock.Now()
+	for {
+		due, ok := c.next(last)
+		if !ok {
+			return nil
+		}
+
+		// The timer may fire early if the clock changes, so we keep waiting
+		// until the scheduled time has actually passed.
+		for c.clock.Now().Before(due) {
+			if !c.wait(ctx, due) {
+				return nil
+			}
+		}
+
+		if !c.emit(ctx, pc) {
+			return nil
+		}
+
+		switch c.policy {
+		case MissedRunPolicyCatchUp:
+			last = due
+		case MissedRunPolicyRunOnce:
+			now := c.clock.Now()
+			if missed, ok := c.next(due); ok && !missed.After(now) {
+				if !c.emit(ctx, pc) {
+					return nil
+				}
+				now = c.clock.Now()
+			}
+			last = now
+		default:
+			last = c.clock.Now()
+		}
+	}
+}
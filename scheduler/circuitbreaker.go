@@ -0,0 +1,540 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/leg/errmap/pkg/errmark"
+	"github.com/puppetlabs/leg/timeutil/pkg/backoff"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+// ErrCircuitOpen is returned by a process guarded by a circuit breaker when
+// the circuit breaker does not permit it to run. It is marked transient.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// DefaultCircuitBreakerCoolDownFactory is an exponential backoff starting at 1
+// second with a factor of 2 and a 1 minute cap.
+var DefaultCircuitBreakerCoolDownFactory = backoff.Build(
+	backoff.Exponential(time.Second, 2.0),
+	backoff.MaxBound(time.Minute),
+)
+
+// CircuitBreakerState is the state of a circuit breaker.
+type CircuitBreakerState int
+
+const (
+	// CircuitBreakerStateClosed permits processes to run normally.
+	CircuitBreakerStateClosed CircuitBreakerState = iota
+
+	// CircuitBreakerStateOpen rejects processes until a cool-down period
+	// elapses.
+	CircuitBreakerStateOpen
+
+	// CircuitBreakerStateHalfOpen permits a limited number of trial processes
+	// to run to determine whether the circuit breaker should close again.
+	CircuitBreakerStateHalfOpen
+)
+
+func (s CircuitBreakerState) String() string {
+	switch s {
+	case CircuitBreakerStateClosed:
+		return "closed"
+	case CircuitBreakerStateOpen:
+		return "open"
+	case CircuitBreakerStateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerEventHandler is an optional interface for a
+// SchedulerEventHandler to be notified of circuit breaker state changes.
+type CircuitBreakerEventHandler interface {
+	// OnCircuitBreakerStateChange is fired when a circuit breaker changes
+	// state.
+	OnCircuitBreakerStateChange(from, to CircuitBreakerState)
+}
+
+// CircuitBreakerOptions contains fields that configure a circuit breaker.
+type CircuitBreakerOptions struct {
+	// FailureRatio is the ratio of failed processes to all processes within
+	// a window at or above which the circuit breaker opens. If not specified,
+	// 0.5 is used.
+	FailureRatio float64
+
+	// MinProcesses is the minimum number of processes that must finish within
+	// a window before the circuit breaker considers opening. If not specified,
+	// 10 is used.
+	MinProcesses int
+
+	// Window is the period over which process results are counted. The counts
+	// reset at the start of each window. If not specified, 1 minute is used.
+	Window time.Duration
+
+	// HalfOpenProcesses is the number of trial processes that must succeed
+	// while the circuit breaker is half-open for it to close. If not
+	// specified, 1 is used.
+	HalfOpenProcesses int
+
+	// CoolDownFactory determines how long the circuit breaker stays open
+	// before permitting trial processes. Each time the circuit breaker opens
+	// without closing in between, the next backoff duration is used. If not
+	// specified, DefaultCircuitBreakerCoolDownFactory is used.
+	CoolDownFactory *backoff.Factory
+
+	// FailureRule determines which errors returned by a process count as
+	// failures. Errors that do not match the rule count as successes. If not
+	// specified, all errors count as failures except those marked as user
+	// errors by the errmark package.
+	FailureRule errmark.Rule
+
+	// EventHandlers are notified when the circuit breaker changes state if
+	// they implement CircuitBreakerEventHandler.
+	EventHandlers []SchedulerEventHandler
+
+	// Clock is the clock used to measure windows and cool-down periods. If not
+	// specified, the system clock is used.
+	Clock clock.Clock
+}
+
+// CircuitBreakerOption is a setter for one or more circuit breaker options.
+type CircuitBreakerOption interface {
+	// ApplyToCircuitBreakerOptions configures the specified circuit breaker
+	// options for this option.
+	ApplyToCircuitBreakerOptions(target *CircuitBreakerOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *CircuitBreakerOptions) ApplyOptions(opts []CircuitBreakerOption) {
+	for _, opt := range opts {
+		opt.ApplyToCircuitBreakerOptions(o)
+	}
+}
+
+// CircuitBreakerOptionFunc allows a function to be used as a circuit breaker
+// option.
+type CircuitBreakerOptionFunc func(target *CircuitBreakerOptions)
+
+var _ CircuitBreakerOption = CircuitBreakerOptionFunc(nil)
+
+// ApplyToCircuitBreakerOptions configures the specified circuit breaker
+// options by calling this function.
+func (cbof CircuitBreakerOptionFunc) ApplyToCircuitBreakerOptions(target *CircuitBreakerOptions) {
+	cbof(target)
+}
+
+// CircuitBreakerWithFailureRatio changes the failure ratio at which the
+// circuit breaker opens and the minimum number of processes needed within a
+// window to consider it.
+func CircuitBreakerWithFailureRatio(ratio float64, minProcesses int) CircuitBreakerOption {
+	return CircuitBreakerOptionFunc(func(target *CircuitBreakerOptions) {
+		target.FailureRatio = ratio
+		target.MinProcesses = minProcesses
+	})
+}
+
+// CircuitBreakerWithWindow changes the period over which process results are
+// counted.
+func CircuitBreakerWithWindow(window time.Duration) CircuitBreakerOption {
+	return CircuitBreakerOptionFunc(func(target *CircuitBreakerOptions) {
+		target.Window = window
+	})
+}
+
+// CircuitBreakerWithHalfOpenProcesses changes the number of trial processes
+// that must succeed to close the circuit breaker.
+func CircuitBreakerWithHalfOpenProcesses(n int) CircuitBreakerOption {
+	return CircuitBreakerOptionFunc(func(target *CircuitBreakerOptions) {
+		target.HalfOpenProcesses = n
+	})
+}
+
+// CircuitBreakerWithCoolDownFactory changes the cool-down backoff algorithm to
+// the specified one.
+func CircuitBreakerWithCoolDownFactory(bf *backoff.Factory) CircuitBreakerOption {
+	return CircuitBreakerOptionFunc(func(target *CircuitBreakerOptions) {
+		target.CoolDownFactory = bf
+	})
+}
+
+// CircuitBreakerWithFailureRule changes the rule that determines which errors
+// count as failures. For example, errmark.RuleMarkedTransient causes only
+// transient errors to count.
+func CircuitBreakerWithFailureRule(rule errmark.Rule) CircuitBreakerOption {
+	return CircuitBreakerOptionFunc(func(target *CircuitBreakerOptions) {
+		target.FailureRule = rule
+	})
+}
+
+// CircuitBreakerWithEventHandler adds an event handler to the list of event
+// handlers to notify of state changes.
+func CircuitBreakerWithEventHandler(handler SchedulerEventHandler) CircuitBreakerOption {
+	return CircuitBreakerOptionFunc(func(target *CircuitBreakerOptions) {
+		target.EventHandlers = append(target.EventHandlers, handler)
+	})
+}
+
+// CircuitBreakerWithClock changes the clock to the specified one.
+func CircuitBreakerWithClock(c clock.Clock) CircuitBreakerOption {
+	return CircuitBreakerOptionFunc(func(target *CircuitBreakerOptions) {
+		target.Clock = c
+	})
+}
+
+type circuitBreakerTransition struct {
+	from, to CircuitBreakerState
+}
+
+// CircuitBreaker tracks the results of processes and stops them from running
+// when too many of them fail, giving a failing downstream system time to
+// recover.
+//
+// A circuit breaker starts closed. When the ratio of failed processes within a
+// window reaches the configured threshold, it opens, and processes are
+// rejected with ErrCircuitOpen. After a cool-down period, it becomes
+// half-open and permits a limited number of trial processes. If they all
+// succeed, the circuit breaker closes; if any of them fail, it opens again
+// with a longer cool-down.
+//
+// Use NewCircuitBreakerProcess or NewCircuitBreakerDescriptor to guard
+// processes with a circuit breaker. A single circuit breaker may guard many
+// processes.
+type CircuitBreaker struct {
+	failureRatio      float64
+	minProcesses      int
+	window            time.Duration
+	halfOpenProcesses int
+	coolDownFactory   *backoff.Factory
+	failureRule       errmark.Rule
+	eventHandlers     []SchedulerEventHandler
+	clock             clock.Clock
+
+	mut     sync.Mutex
+	state   CircuitBreakerState
+	changed chan struct{}
+
+	// generation increments every time the state changes so that results
+	// from processes permitted in a prior state can be ignored.
+	generation uint64
+
+	windowStart time.Time
+	successes   int
+	failures    int
+
+	inFlight  int
+	succeeded int
+
+	coolDown  *backoff.Backoff
+	openUntil time.Time
+
+	pending []circuitBreakerTransition
+}
+
+// unlock releases the lock and fires any pending state change events.
+func (cb *CircuitBreaker) unlock() {
+	pending := cb.pending
+	cb.pending = nil
+	cb.mut.Unlock()
+
+	for _, t := range pending {
+		for _, eh := range cb.eventHandlers {
+			if cbeh, ok := eh.(CircuitBreakerEventHandler); ok {
+				cbeh.OnCircuitBreakerStateChange(t.from, t.to)
+			}
+		}
+	}
+}
+
+func (cb *CircuitBreaker) transition(to CircuitBreakerState, now time.Time) {
+	from := cb.state
+
+	cb.state = to
+	cb.generation++
+	cb.windowStart = now
+	cb.successes, cb.failures = 0, 0
+	cb.inFlight, cb.succeeded = 0, 0
+
+	close(cb.changed)
+	cb.changed = make(chan struct{})
+
+	cb.pending = append(cb.pending, circuitBreakerTransition{from: from, to: to})
+}
+
+func (cb *CircuitBreaker) trip(now time.Time) {
+	// If the backoff gives up, we just move to half-open immediately.
+	d, err := cb.coolDown.Next(context.Background())
+	if err != nil {
+		d = 0
+	}
+
+	log(context.Background()).Warn("circuit breaker opened", "cool-down", d)
+
+	cb.openUntil = now.Add(d)
+	cb.transition(CircuitBreakerStateOpen, now)
+}
+
+func (cb *CircuitBreaker) reset(now time.Time) error {
+	coolDown, err := cb.coolDownFactory.New()
+	if err != nil {
+		return err
+	}
+
+	cb.coolDown = coolDown
+	cb.transition(CircuitBreakerStateClosed, now)
+	return nil
+}
+
+// update moves the circuit breaker from open to half-open if its cool-down
+// period has elapsed. The caller must hold the lock.
+func (cb *CircuitBreaker) update(now time.Time) {
+	if cb.state == CircuitBreakerStateOpen && !now.Before(cb.openUntil) {
+		cb.transition(CircuitBreakerStateHalfOpen, now)
+	}
+}
+
+// permitted returns true if a process may run in the current state. The caller
+// must hold the lock.
+func (cb *CircuitBreaker) permitted() bool {
+	switch cb.state {
+	case CircuitBreakerStateClosed:
+		return true
+	case CircuitBreakerStateHalfOpen:
+		return cb.inFlight+cb.succeeded < cb.halfOpenProcesses
+	default:
+		return false
+	}
+}
+
+// State returns the current state of this circuit breaker.
+func (cb *CircuitBreaker) State() CircuitBreakerState {
+	cb.mut.Lock()
+	defer cb.unlock()
+
+	cb.update(cb.clock.Now())
+	return cb.state
+}
+
+func (cb *CircuitBreaker) allow() (uint64, bool) {
+	cb.mut.Lock()
+	defer cb.unlock()
+
+	cb.update(cb.clock.Now())
+	if !cb.permitted() {
+		return 0, false
+	}
+
+	if cb.state == CircuitBreakerStateHalfOpen {
+		cb.inFlight++
+	}
+	return cb.generation, true
+}
+
+func (cb *CircuitBreaker) record(generation uint64, err error) {
+	cb.mut.Lock()
+	defer cb.unlock()
+
+	if generation != cb.generation {
+		return
+	}
+
+	now := cb.clock.Now()
+	failed := err != nil && cb.failureRule.Matches(err)
+
+	switch cb.state {
+	case CircuitBreakerStateClosed:
+		if now.Sub(cb.windowStart) >= cb.window {
+			cb.windowStart = now
+			cb.successes, cb.failures = 0, 0
+		}
+
+		if failed {
+			cb.failures++
+		} else {
+			cb.successes++
+		}
+
+		total := cb.successes + cb.failures
+		if total >= cb.minProcesses && float64(cb.failures)/float64(total) >= cb.failureRatio {
+			cb.trip(now)
+		}
+	case CircuitBreakerStateHalfOpen:
+		cb.inFlight--
+
+		if failed {
+			cb.trip(now)
+		} else if cb.succeeded++; cb.succeeded >= cb.halfOpenProcesses {
+			if err := cb.reset(now); err != nil {
+				// We couldn't create a new backoff, so we'll just keep using
+				// the current one.
+				cb.transition(CircuitBreakerStateClosed, now)
+			}
+		}
+	}
+}
+
+// wait blocks until this circuit breaker permits a process to run or the
+// context is done.
+func (cb *CircuitBreaker) wait(ctx context.Context) error {
+	for {
+		cb.mut.Lock()
+
+		now := cb.clock.Now()
+		cb.update(now)
+
+		if cb.permitted() {
+			cb.unlock()
+			return nil
+		}
+
+		changed := cb.changed
+
+		var d time.Duration
+		if cb.state == CircuitBreakerStateOpen {
+			d = cb.openUntil.Sub(now)
+		}
+
+		cb.unlock()
+
+		if err := cb.sleep(ctx, changed, d); err != nil {
+			return err
+		}
+	}
+}
+
+// sleep blocks until the given channel is closed, the given duration elapses
+// (if positive), or the context is done.
+func (cb *CircuitBreaker) sleep(ctx context.Context, changed <-chan struct{}, d time.Duration) error {
+	var tc <-chan time.Time
+	if d > 0 {
+		t := cb.clock.NewTimer(d)
+		defer t.Stop()
+
+		tc = t.C()
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-changed:
+	case <-tc:
+	}
+	return nil
+}
+
+// NewCircuitBreaker creates a new circuit breaker in the closed state.
+func NewCircuitBreaker(opts ...CircuitBreakerOption) (*CircuitBreaker, error) {
+	o := &CircuitBreakerOptions{
+		FailureRatio:      0.5,
+		MinProcesses:      10,
+		Window:            time.Minute,
+		HalfOpenProcesses: 1,
+		CoolDownFactory:   DefaultCircuitBreakerCoolDownFactory,
+		FailureRule:       errmark.RuleNot(errmark.RuleMarkedUser),
+		Clock:             clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	coolDown, err := o.CoolDownFactory.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CircuitBreaker{
+		failureRatio:      o.FailureRatio,
+		minProcesses:      o.MinProcesses,
+		window:            o.Window,
+		halfOpenProcesses: o.HalfOpenProcesses,
+		coolDownFactory:   o.CoolDownFactory,
+		failureRule:       o.FailureRule,
+		eventHandlers:     o.EventHandlers,
+		clock:             o.Clock,
+		state:             CircuitBreakerStateClosed,
+		changed:           make(chan struct{}),
+		windowStart:       o.Clock.Now(),
+		coolDown:          coolDown,
+	}, nil
+}
+
+type circuitBreakerProcess struct {
+	delegate Process
+	breaker  *CircuitBreaker
+}
+
+var _ Process = &circuitBreakerProcess{}
+
+func (cbp *circuitBreakerProcess) Description() string {
+	return cbp.delegate.Description()
+}
+
+func (cbp *circuitBreakerProcess) Run(ctx context.Context) error {
+	generation, ok := cbp.breaker.allow()
+	if !ok {
+		return errmark.MarkTransient(ErrCircuitOpen)
+	}
+
+	err := cbp.delegate.Run(ctx)
+	cbp.breaker.record(generation, err)
+	return err
+}
+
+// NewCircuitBreakerProcess wraps the given process so that it only runs if the
+// given circuit breaker permits it, and so that its result is recorded by the
+// circuit breaker. If the circuit breaker does not permit the process to run,
+// it returns ErrCircuitOpen instead.
+func NewCircuitBreakerProcess(p Process, cb *CircuitBreaker) Process {
+	return &circuitBreakerProcess{
+		delegate: p,
+		breaker:  cb,
+	}
+}
+
+// CircuitBreakerDescriptor guards each process emitted by a delegate
+// descriptor with a circuit breaker using NewCircuitBreakerProcess.
+//
+// While the circuit breaker is open, the descriptor holds processes emitted by
+// its delegate instead of forwarding them to the scheduler, so the delegate
+// blocks until the circuit breaker permits processes to run again.
+type CircuitBreakerDescriptor struct {
+	delegate Descriptor
+	breaker  *CircuitBreaker
+}
+
+var _ Descriptor = &CircuitBreakerDescriptor{}
+
+// Run runs the delegate descriptor, forwarding its processes to the given
+// channel. It terminates when the delegate terminates.
+func (cbd *CircuitBreakerDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	ch := make(chan Process)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+		errCh <- cbd.delegate.Run(ctx, ch)
+	}()
+
+	for p := range ch {
+		if err := cbd.breaker.wait(ctx); err != nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case pc <- NewCircuitBreakerProcess(p, cbd.breaker):
+		}
+	}
+
+	return <-errCh
+}
+
+// NewCircuitBreakerDescriptor creates a new descriptor that guards the
+// processes of the given descriptor with the given circuit breaker.
+func NewCircuitBreakerDescriptor(delegate Descriptor, cb *CircuitBreaker) *CircuitBreakerDescriptor {
+	return &CircuitBreakerDescriptor{
+		delegate: delegate,
+		breaker:  cb,
+	}
+}
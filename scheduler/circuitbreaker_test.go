@@ -0,0 +1,238 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/errmap/pkg/errmark"
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/timeutil/pkg/backoff"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+var (
+	errCircuitBreakerTest = errors.New("boom")
+
+	failingProcess = scheduler.ProcessFunc(func(ctx context.Context) error { return errCircuitBreakerTest })
+)
+
+type stateRecorder struct {
+	mut         sync.Mutex
+	transitions [][2]scheduler.CircuitBreakerState
+}
+
+func (sr *stateRecorder) handler() scheduler.SchedulerEventHandler {
+	return &scheduler.SchedulerEventHandlerFuncs{
+		OnCircuitBreakerStateChangeFunc: func(from, to scheduler.CircuitBreakerState) {
+			sr.mut.Lock()
+			defer sr.mut.Unlock()
+
+			sr.transitions = append(sr.transitions, [2]scheduler.CircuitBreakerState{from, to})
+		},
+	}
+}
+
+func (sr *stateRecorder) get() [][2]scheduler.CircuitBreakerState {
+	sr.mut.Lock()
+	defer sr.mut.Unlock()
+
+	return append([][2]scheduler.CircuitBreakerState{}, sr.transitions...)
+}
+
+func newTestCircuitBreaker(t *testing.T, fc *testclock.FakeClock, opts ...scheduler.CircuitBreakerOption) *scheduler.CircuitBreaker {
+	cb, err := scheduler.NewCircuitBreaker(append([]scheduler.CircuitBreakerOption{
+		scheduler.CircuitBreakerWithFailureRatio(0.5, 4),
+		scheduler.CircuitBreakerWithCoolDownFactory(backoff.Build(backoff.Exponential(time.Second, 2))),
+		scheduler.CircuitBreakerWithClock(k8sext.NewClock(fc)),
+	}, opts...)...)
+	require.NoError(t, err)
+	return cb
+}
+
+func TestCircuitBreakerStates(t *testing.T) {
+	ctx := context.Background()
+
+	fc := testclock.NewFakeClock(time.Now())
+	sr := &stateRecorder{}
+	cb := newTestCircuitBreaker(t, fc, scheduler.CircuitBreakerWithEventHandler(sr.handler()))
+
+	succeed := scheduler.NewCircuitBreakerProcess(noopProcess, cb)
+	fail := scheduler.NewCircuitBreakerProcess(failingProcess, cb)
+
+	// Not enough processes have run to consider the ratio.
+	assert.NoError(t, succeed.Run(ctx))
+	assert.Equal(t, errCircuitBreakerTest, fail.Run(ctx))
+	assert.Equal(t, errCircuitBreakerTest, fail.Run(ctx))
+	assert.Equal(t, scheduler.CircuitBreakerStateClosed, cb.State())
+
+	// Now 3 out of 4 processes have failed.
+	assert.Equal(t, errCircuitBreakerTest, fail.Run(ctx))
+	assert.Equal(t, scheduler.CircuitBreakerStateOpen, cb.State())
+
+	err := succeed.Run(ctx)
+	assert.True(t, errors.Is(err, scheduler.ErrCircuitOpen))
+	assert.True(t, errmark.MarkedTransient(err))
+
+	// After the cool-down, a trial process fails and the circuit breaker
+	// opens again for longer.
+	fc.Step(time.Second)
+	assert.Equal(t, scheduler.CircuitBreakerStateHalfOpen, cb.State())
+	assert.Equal(t, errCircuitBreakerTest, fail.Run(ctx))
+	assert.Equal(t, scheduler.CircuitBreakerStateOpen, cb.State())
+
+	fc.Step(time.Second)
+	assert.Equal(t, scheduler.CircuitBreakerStateOpen, cb.State())
+
+	// Now a trial process succeeds and the circuit breaker closes.
+	fc.Step(time.Second)
+	assert.Equal(t, scheduler.CircuitBreakerStateHalfOpen, cb.State())
+	assert.NoError(t, succeed.Run(ctx))
+	assert.Equal(t, scheduler.CircuitBreakerStateClosed, cb.State())
+
+	assert.Equal(t, [][2]scheduler.CircuitBreakerState{
+		{scheduler.CircuitBreakerStateClosed, scheduler.CircuitBreakerStateOpen},
+		{scheduler.CircuitBreakerStateOpen, scheduler.CircuitBreakerStateHalfOpen},
+		{scheduler.CircuitBreakerStateHalfOpen, scheduler.CircuitBreakerStateOpen},
+		{scheduler.CircuitBreakerStateOpen, scheduler.CircuitBreakerStateHalfOpen},
+		{scheduler.CircuitBreakerStateHalfOpen, scheduler.CircuitBreakerStateClosed},
+	}, sr.get())
+
+	// The cool-down resets once the circuit breaker closes.
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, errCircuitBreakerTest, fail.Run(ctx))
+	}
+	assert.Equal(t, scheduler.CircuitBreakerStateOpen, cb.State())
+
+	fc.Step(time.Second)
+	assert.Equal(t, scheduler.CircuitBreakerStateHalfOpen, cb.State())
+}
+
+func TestCircuitBreakerHalfOpenProcesses(t *testing.T) {
+	ctx := context.Background()
+
+	fc := testclock.NewFakeClock(time.Now())
+	cb := newTestCircuitBreaker(t, fc, scheduler.CircuitBreakerWithFailureRatio(1, 1))
+
+	assert.Error(t, scheduler.NewCircuitBreakerProcess(failingProcess, cb).Run(ctx))
+	fc.Step(time.Second)
+
+	// Only one trial process is permitted to run at a time.
+	running := make(chan struct{})
+	release := make(chan struct{})
+	trial := scheduler.NewCircuitBreakerProcess(scheduler.ProcessFunc(func(ctx context.Context) error {
+		close(running)
+		<-release
+		return nil
+	}), cb)
+
+	ch := make(chan error, 1)
+	go func() {
+		ch <- trial.Run(ctx)
+	}()
+	<-running
+
+	assert.True(t, errors.Is(scheduler.NewCircuitBreakerProcess(noopProcess, cb).Run(ctx), scheduler.ErrCircuitOpen))
+
+	close(release)
+	require.NoError(t, <-ch)
+	assert.Equal(t, scheduler.CircuitBreakerStateClosed, cb.State())
+}
+
+func TestCircuitBreakerFailureRule(t *testing.T) {
+	ctx := context.Background()
+
+	fc := testclock.NewFakeClock(time.Now())
+	cb := newTestCircuitBreaker(t, fc)
+
+	// User errors do not count against the circuit breaker by default.
+	userFail := scheduler.NewCircuitBreakerProcess(scheduler.ProcessFunc(func(ctx context.Context) error {
+		return errmark.MarkUser(errCircuitBreakerTest)
+	}), cb)
+	for i := 0; i < 10; i++ {
+		assert.Error(t, userFail.Run(ctx))
+	}
+	assert.Equal(t, scheduler.CircuitBreakerStateClosed, cb.State())
+
+	// Only transient errors count.
+	cb = newTestCircuitBreaker(t, fc, scheduler.CircuitBreakerWithFailureRule(errmark.RuleMarkedTransient))
+
+	fail := scheduler.NewCircuitBreakerProcess(failingProcess, cb)
+	for i := 0; i < 10; i++ {
+		assert.Error(t, fail.Run(ctx))
+	}
+	assert.Equal(t, scheduler.CircuitBreakerStateClosed, cb.State())
+
+	transientFail := scheduler.NewCircuitBreakerProcess(scheduler.ProcessFunc(func(ctx context.Context) error {
+		return errmark.MarkTransient(errCircuitBreakerTest)
+	}), cb)
+	for i := 0; i < 10; i++ {
+		assert.Error(t, transientFail.Run(ctx))
+	}
+	assert.Equal(t, scheduler.CircuitBreakerStateOpen, cb.State())
+}
+
+func TestCircuitBreakerWindow(t *testing.T) {
+	ctx := context.Background()
+
+	fc := testclock.NewFakeClock(time.Now())
+	cb := newTestCircuitBreaker(t, fc, scheduler.CircuitBreakerWithWindow(time.Minute))
+
+	fail := scheduler.NewCircuitBreakerProcess(failingProcess, cb)
+	for i := 0; i < 3; i++ {
+		assert.Error(t, fail.Run(ctx))
+	}
+
+	// The failures are forgotten in the next window.
+	fc.Step(time.Minute)
+	for i := 0; i < 3; i++ {
+		assert.Error(t, fail.Run(ctx))
+	}
+	assert.Equal(t, scheduler.CircuitBreakerStateClosed, cb.State())
+}
+
+func TestCircuitBreakerDescriptor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+	cb := newTestCircuitBreaker(t, fc, scheduler.CircuitBreakerWithFailureRatio(1, 1))
+
+	assert.Error(t, scheduler.NewCircuitBreakerProcess(failingProcess, cb).Run(ctx))
+	require.Equal(t, scheduler.CircuitBreakerStateOpen, cb.State())
+
+	ad, as := scheduler.NewAdhocDescriptor()
+
+	slc := scheduler.NewSegment(1, []scheduler.Descriptor{
+		scheduler.NewCircuitBreakerDescriptor(ad, cb),
+	}).Start(scheduler.LifecycleStartOptions{})
+	defer func() {
+		assert.NoError(t, scheduler.CloseWaitContext(ctx, slc))
+	}()
+
+	ch := as.Submit(noopProcess)
+
+	// The descriptor holds the process until the cool-down elapses.
+	waitForTimer(t, fc)
+	select {
+	case err := <-ch:
+		require.Fail(t, "process ran while circuit breaker was open", "error: %+v", err)
+	default:
+	}
+
+	fc.Step(time.Second)
+
+	select {
+	case err := <-ch:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		require.Fail(t, "process did not run")
+	}
+
+	assert.Equal(t, scheduler.CircuitBreakerStateClosed, cb.State())
+}
@@ -0,0 +1,327 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCronExpression is returned when a cron expression cannot be
+// parsed.
+var ErrInvalidCronExpression = errors.New("invalid cron expression")
+
+var (
+	cronMonthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	cronDayOfWeekNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+)
+
+// cronField is a set of the values permitted by a field of a cron expression.
+type cronField uint64
+
+func (cf cronField) has(n int) bool {
+	return cf&(1<<uint(n)) != 0
+}
+
+func parseCronValue(s string, names map[string]int) (int, error) {
+	if n, found := names[strings.ToUpper(s)]; found {
+		return n, nil
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q is not a number", ErrInvalidCronExpression, s)
+	}
+	return n, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges, and steps,
+// returning the set of permitted values and whether the field is unrestricted.
+func parseCronField(s string, min, max int, names map[string]int) (cronField, bool, error) {
+	var field cronField
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, false, fmt.Errorf("%w: invalid step in %q", ErrInvalidCronExpression, item)
+			}
+			rng, step = item[:i], n
+		}
+
+		var start, end int
+		switch {
+		case rng == "*" || rng == "?":
+			start, end = min, max
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+
+			var err error
+			if start, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, false, err
+			}
+			if end, err = parseCronValue(bounds[1], names); err != nil {
+				return 0, false, err
+			}
+		default:
+			var err error
+			if start, err = parseCronValue(rng, names); err != nil {
+				return 0, false, err
+			}
+
+			// A single value with a step, like "5/15", extends to the end of
+			// the range.
+			end = start
+			if strings.Contains(item, "/") {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, false, fmt.Errorf("%w: %q is out of range %d-%d", ErrInvalidCronExpression, item, min, max)
+		}
+
+		for n := start; n <= end; n += step {
+			field |= 1 << uint(n)
+		}
+	}
+
+	return field, strings.HasPrefix(s, "*") || strings.HasPrefix(s, "?"), nil
+}
+
+// CronSchedule is a parsed cron expression.
+//
+// Expressions have either five fields (minute, hour, day of month, month, and
+// day of week) or six fields, in which case the first field specifies the
+// second. Each field may be "*", a value, a range ("1-5"), a step ("*/15",
+// "0-30/10", or "5/15"), or a comma-separated list of these. Months and days
+// of the week may also be given by their three-letter English names, and
+// Sunday may be given as either 0 or 7. As in most cron implementations, if
+// both the day of the month and the day of the week are restricted, a time
+// matches if either of them matches.
+//
+// The macros @yearly, @annually, @monthly, @weekly, @daily, @midnight, and
+// @hourly are also supported. An expression may be prefixed by "CRON_TZ=<zone>"
+// or "TZ=<zone>" to interpret it in the given IANA time zone. Times that do not
+// exist in the time zone because of a daylight saving time transition never
+// match.
+type CronSchedule struct {
+	expr string
+
+	second, minute, hour, dayOfMonth, month, dayOfWeek cronField
+	dayOfMonthAny, dayOfWeekAny                        bool
+
+	location *time.Location
+}
+
+// cronDate returns the start of the given hour in the given location. If the
+// local time does not exist because of a daylight saving time transition,
+// time.Date may normalize it to a time before the transition, so we advance it
+// to the first hour that does exist.
+func cronDate(year int, month time.Month, day, hour int, loc *time.Location) time.Time {
+	want := time.Date(year, month, day, hour, 0, 0, 0, time.UTC)
+
+	t := time.Date(year, month, day, hour, 0, 0, 0, loc)
+	for time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, time.UTC).Before(want) {
+		t = t.Add(time.Hour)
+	}
+	return t
+}
+
+func (cs *CronSchedule) dayMatches(t time.Time) bool {
+	dom, dow := cs.dayOfMonth.has(t.Day()), cs.dayOfWeek.has(int(t.Weekday()))
+	if cs.dayOfMonthAny || cs.dayOfWeekAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time after the given time that matches this schedule.
+// If no time within the following five years matches, such as for an
+// expression that specifies February 30, it sets its second return value to
+// false.
+func (cs *CronSchedule) Next(after time.Time) (time.Time, bool) {
+	loc := cs.location
+	t := after.In(loc).Truncate(time.Second).Add(time.Second)
+
+	limit := t.Year() + 5
+
+wrap:
+	for t.Year() <= limit {
+		for !cs.month.has(int(t.Month())) {
+			t = cronDate(t.Year(), t.Month()+1, 1, 0, loc)
+			if t.Month() == time.January {
+				continue wrap
+			}
+		}
+
+		for !cs.dayMatches(t) {
+			month := t.Month()
+			t = cronDate(t.Year(), month, t.Day()+1, 0, loc)
+			if t.Month() != month {
+				continue wrap
+			}
+		}
+
+		for !cs.hour.has(t.Hour()) {
+			day := t.Day()
+			t = cronDate(t.Year(), t.Month(), day, t.Hour()+1, loc)
+			if t.Day() != day {
+				continue wrap
+			}
+		}
+
+		for !cs.minute.has(t.Minute()) {
+			t = t.Truncate(time.Minute).Add(time.Minute)
+			if t.Minute() == 0 {
+				continue wrap
+			}
+		}
+
+		for !cs.second.has(t.Second()) {
+			t = t.Add(time.Second)
+			if t.Second() == 0 {
+				continue wrap
+			}
+		}
+
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+func (cs *CronSchedule) String() string {
+	return cs.expr
+}
+
+// ParseCronSchedule parses the given cron expression. If the expression does
+// not specify a time zone, it is interpreted in the given location.
+func ParseCronSchedule(expr string, loc *time.Location) (*CronSchedule, error) {
+	cs := &CronSchedule{
+		expr:     expr,
+		location: loc,
+	}
+
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		i := strings.IndexAny(spec, " \t")
+		if i < 0 {
+			return nil, fmt.Errorf("%w: %q has no fields", ErrInvalidCronExpression, expr)
+		}
+
+		name := spec[strings.Index(spec, "=")+1 : i]
+		zone, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: unknown time zone %q: %+v", ErrInvalidCronExpression, name, err)
+		}
+		cs.location, spec = zone, strings.TrimSpace(spec[i:])
+	}
+	if cs.location == nil {
+		cs.location = time.Local
+	}
+
+	if macro, found := cronMacros[spec]; found {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("%w: expected 5 or 6 fields in %q, got %d", ErrInvalidCronExpression, expr, len(fields))
+	}
+
+	var err error
+	if cs.second, _, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if cs.minute, _, err = parseCronField(fields[1], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if cs.hour, _, err = parseCronField(fields[2], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if cs.dayOfMonth, cs.dayOfMonthAny, err = parseCronField(fields[3], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if cs.month, _, err = parseCronField(fields[4], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if cs.dayOfWeek, cs.dayOfWeekAny, err = parseCronField(fields[5], 0, 7, cronDayOfWeekNames); err != nil {
+		return nil, err
+	}
+
+	// Sunday may be specified as 7.
+	if cs.dayOfWeek.has(7) {
+		cs.dayOfWeek |= 1
+	}
+
+	return cs, nil
+}
+
+// CronDescriptor schedules a process to run at the times specified by a cron
+// expression.
+//
+// Unlike IntervalDescriptor, the schedule is independent of how long the
+// process takes to run. If the scheduler does not accept the process by the
+// time of its next run, the missed run is handled according to the
+// descriptor's MissedRunPolicy.
+type CronDescriptor struct {
+	schedule *CronSchedule
+	calendar *calendar
+}
+
+var _ Descriptor = &CronDescriptor{}
+
+// Schedule returns the parsed cron expression of this descriptor.
+func (cd *CronDescriptor) Schedule() *CronSchedule {
+	return cd.schedule
+}
+
+// Run starts scheduling this descriptor's process to the given channel. It
+// terminates when the context terminates or when the cron expression has no
+// further matching times.
+func (cd *CronDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	return cd.calendar.run(ctx, pc)
+}
+
+// NewCronDescriptor creates a new descriptor that runs the given process at
+// the times specified by the given cron expression. See CronSchedule for the
+// supported syntax.
+func NewCronDescriptor(expr string, process Process, opts ...CalendarDescriptorOption) (*CronDescriptor, error) {
+	o := newCalendarDescriptorOptions(opts)
+
+	schedule, err := ParseCronSchedule(expr, o.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CronDescriptor{
+		schedule: schedule,
+		calendar: &calendar{
+			next:    schedule.Next,
+			process: process,
+			policy:  o.MissedRunPolicy,
+			clock:   o.Clock,
+		},
+	}, nil
+}
@@ -0,0 +1,266 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/puppetlabs/leg/timeutil/pkg/iso8601"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tests := []struct {
+		Expression string
+		From       string
+		Expected   []string
+	}{
+		{
+			Expression: "*/15 * * * *",
+			From:       "2021-03-01T10:07:30Z",
+			Expected:   []string{"2021-03-01T10:15:00Z", "2021-03-01T10:30:00Z", "2021-03-01T10:45:00Z", "2021-03-01T11:00:00Z"},
+		},
+		{
+			Expression: "30 */20 9-10 * * *",
+			From:       "2021-03-01T09:00:30Z",
+			Expected:   []string{"2021-03-01T09:20:30Z", "2021-03-01T09:40:30Z", "2021-03-01T10:00:30Z", "2021-03-01T10:20:30Z", "2021-03-01T10:40:30Z", "2021-03-02T09:00:30Z"},
+		},
+		{
+			Expression: "0 9 * * MON-FRI",
+			From:       "2021-03-05T09:00:00Z",
+			Expected:   []string{"2021-03-08T09:00:00Z", "2021-03-09T09:00:00Z"},
+		},
+		{
+			Expression: "0 0 * * 7",
+			From:       "2021-03-01T00:00:00Z",
+			Expected:   []string{"2021-03-07T00:00:00Z", "2021-03-14T00:00:00Z"},
+		},
+		{
+			Expression: "0 0 13 * FRI",
+			From:       "2021-08-01T00:00:00Z",
+			Expected:   []string{"2021-08-06T00:00:00Z", "2021-08-13T00:00:00Z", "2021-08-20T00:00:00Z"},
+		},
+		{
+			Expression: "0 0 31 * *",
+			From:       "2021-01-31T00:00:00Z",
+			Expected:   []string{"2021-03-31T00:00:00Z", "2021-05-31T00:00:00Z"},
+		},
+		{
+			Expression: "0 0 29 feb *",
+			From:       "2021-01-01T00:00:00Z",
+			Expected:   []string{"2024-02-29T00:00:00Z", "2028-02-29T00:00:00Z"},
+		},
+		{
+			Expression: "@hourly",
+			From:       "2021-12-31T23:59:59Z",
+			Expected:   []string{"2022-01-01T00:00:00Z", "2022-01-01T01:00:00Z"},
+		},
+		{
+			Expression: "@weekly",
+			From:       "2021-03-01T00:00:00Z",
+			Expected:   []string{"2021-03-07T00:00:00Z"},
+		},
+		{
+			Expression: "CRON_TZ=America/New_York 30 2 * * *",
+			From:       "2021-03-13T00:00:00Z",
+			// 02:30 does not exist on the day daylight saving time begins.
+			Expected: []string{"2021-03-13T07:30:00Z", "2021-03-15T06:30:00Z", "2021-03-16T06:30:00Z"},
+		},
+		{
+			Expression: "TZ=UTC 0 12 * * *",
+			From:       "2021-03-01T00:00:00Z",
+			Expected:   []string{"2021-03-01T12:00:00Z"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.Expression, func(t *testing.T) {
+			cs, err := scheduler.ParseCronSchedule(test.Expression, time.UTC)
+			require.NoError(t, err)
+
+			from, err := time.Parse(time.RFC3339, test.From)
+			require.NoError(t, err)
+
+			for _, s := range test.Expected {
+				expected, err := time.Parse(time.RFC3339, s)
+				require.NoError(t, err)
+
+				next, ok := cs.Next(from)
+				require.True(t, ok)
+				assert.True(t, expected.Equal(next), "expected %s, got %s", expected, next)
+				from = next
+			}
+		})
+	}
+
+	t.Run("Location", func(t *testing.T) {
+		cs, err := scheduler.ParseCronSchedule("0 9 * * *", newYork)
+		require.NoError(t, err)
+
+		next, ok := cs.Next(time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC))
+		require.True(t, ok)
+		assert.True(t, time.Date(2021, 7, 1, 13, 0, 0, 0, time.UTC).Equal(next), "got %s", next)
+	})
+
+	t.Run("Never", func(t *testing.T) {
+		cs, err := scheduler.ParseCronSchedule("0 0 30 2 *", time.UTC)
+		require.NoError(t, err)
+
+		_, ok := cs.Next(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+		assert.False(t, ok)
+	})
+}
+
+func TestCronScheduleParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"* * * FOO *",
+		"CRON_TZ=Nowhere/Unknown * * * * *",
+		"CRON_TZ=UTC",
+	} {
+		_, err := scheduler.ParseCronSchedule(expr, time.UTC)
+		assert.True(t, errors.Is(err, scheduler.ErrInvalidCronExpression), "expression %q: %+v", expr, err)
+	}
+}
+
+// runCalendarDescriptor runs the given descriptor with a fake clock. It returns
+// the process channel and a function to advance the clock after the descriptor
+// begins waiting for its next run.
+func runCalendarDescriptor(t *testing.T, fc *testclock.FakeClock, d scheduler.Descriptor) (<-chan scheduler.Process, func(d time.Duration)) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pc := make(chan scheduler.Process)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx, pc)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	return pc, func(d time.Duration) {
+		waitForTimer(t, fc)
+		fc.Step(d)
+	}
+}
+
+func waitForTimer(t *testing.T, fc *testclock.FakeClock) {
+	require.Eventually(t, fc.HasWaiters, 5*time.Second, time.Millisecond)
+}
+
+func receive(t *testing.T, pc <-chan scheduler.Process, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-pc:
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timed out waiting for process")
+		}
+	}
+}
+
+func TestCronDescriptorMissedRunPolicy(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Policy   scheduler.MissedRunPolicy
+		Expected int
+	}{
+		{Name: "Skip", Policy: scheduler.MissedRunPolicySkip, Expected: 1},
+		{Name: "Run once", Policy: scheduler.MissedRunPolicyRunOnce, Expected: 2},
+		{Name: "Catch up", Policy: scheduler.MissedRunPolicyCatchUp, Expected: 4},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			fc := testclock.NewFakeClock(time.Date(2021, 3, 1, 10, 0, 30, 0, time.UTC))
+
+			d, err := scheduler.NewCronDescriptor(
+				"* * * * *",
+				scheduler.ProcessFunc(func(ctx context.Context) error { return nil }),
+				scheduler.CalendarDescriptorWithMissedRunPolicy(test.Policy),
+				scheduler.CalendarDescriptorWithClock(k8sext.NewClock(fc)),
+			)
+			require.NoError(t, err)
+
+			pc, step := runCalendarDescriptor(t, fc, d)
+
+			// The first run is due at 10:01:00. We don't accept it until the
+			// runs at 10:02, 10:03, and 10:04 have passed as well.
+			step(30 * time.Second)
+			require.Eventually(t, func() bool { return !fc.HasWaiters() }, 5*time.Second, time.Millisecond)
+			fc.Step(3 * time.Minute)
+
+			receive(t, pc, test.Expected)
+
+			// The descriptor now waits for the run at 10:05.
+			waitForTimer(t, fc)
+			select {
+			case <-pc:
+				require.Fail(t, "unexpected process")
+			default:
+			}
+
+			step(time.Minute)
+			receive(t, pc, 1)
+		})
+	}
+}
+
+func TestRecurringIntervalDescriptor(t *testing.T) {
+	ri, err := iso8601.ParseRecurringInterval("R3/2021-03-01T10:00:00Z/PT1H")
+	require.NoError(t, err)
+
+	fc := testclock.NewFakeClock(time.Date(2021, 3, 1, 9, 30, 0, 0, time.UTC))
+
+	d := scheduler.NewRecurringIntervalDescriptor(
+		ri,
+		scheduler.ProcessFunc(func(ctx context.Context) error { return nil }),
+		scheduler.CalendarDescriptorWithClock(k8sext.NewClock(fc)),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	pc := make(chan scheduler.Process)
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Run(ctx, pc)
+	}()
+
+	expected := []time.Time{
+		time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for _, at := range expected {
+		waitForTimer(t, fc)
+		fc.SetTime(at)
+		receive(t, pc, 1)
+	}
+
+	// After the third repetition, the descriptor terminates.
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-ctx.Done():
+		require.Fail(t, "descriptor did not terminate")
+	}
+}
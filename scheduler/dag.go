@@ -0,0 +1,363 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/puppetlabs/leg/graph"
+	"github.com/puppetlabs/leg/graph/algo"
+)
+
+// DAGVertexTypeError is returned when constructing a DAG descriptor from a
+// graph that contains a vertex that is not a process.
+type DAGVertexTypeError struct {
+	Vertex graph.Vertex
+}
+
+func (e *DAGVertexTypeError) Error() string {
+	return fmt.Sprintf("DAG vertex %v (%T) is not a process", e.Vertex, e.Vertex)
+}
+
+// DAGCycleError is returned when constructing a DAG descriptor from a graph
+// that contains cycles. Each cycle is reported in path order; the last process
+// of each cycle depends on the first.
+type DAGCycleError struct {
+	Cycles [][]Process
+}
+
+func (e *DAGCycleError) Error() string {
+	descs := make([]string, len(e.Cycles))
+	for i, cycle := range e.Cycles {
+		var sb strings.Builder
+		for _, p := range cycle {
+			sb.WriteString(p.Description())
+			sb.WriteString(" -> ")
+		}
+		sb.WriteString(cycle[0].Description())
+
+		descs[i] = sb.String()
+	}
+
+	return fmt.Sprintf("DAG contains %d cycle(s): %s", len(e.Cycles), strings.Join(descs, "; "))
+}
+
+// DAGDependencyError is the error recorded for a process that was skipped
+// because one of its dependencies did not succeed.
+type DAGDependencyError struct {
+	Dependency Process
+}
+
+func (e *DAGDependencyError) Error() string {
+	return fmt.Sprintf("dependency %s did not succeed", e.Dependency.Description())
+}
+
+// DAGVertexStatus is the execution status of a single process in a DAG.
+type DAGVertexStatus int
+
+const (
+	// DAGVertexPending indicates that the process has not yet run.
+	DAGVertexPending DAGVertexStatus = iota
+
+	// DAGVertexRunning indicates that the process has been emitted to the
+	// scheduler but has not finished.
+	DAGVertexRunning
+
+	// DAGVertexSucceeded indicates that the process finished without error.
+	DAGVertexSucceeded
+
+	// DAGVertexFailed indicates that the process returned an error or
+	// panicked.
+	DAGVertexFailed
+
+	// DAGVertexSkipped indicates that the process will never run because one
+	// of its direct or transitive dependencies failed.
+	DAGVertexSkipped
+)
+
+func (s DAGVertexStatus) String() string {
+	switch s {
+	case DAGVertexPending:
+		return "pending"
+	case DAGVertexRunning:
+		return "running"
+	case DAGVertexSucceeded:
+		return "succeeded"
+	case DAGVertexFailed:
+		return "failed"
+	case DAGVertexSkipped:
+		return "skipped"
+	default:
+		return fmt.Sprintf("DAGVertexStatus(%d)", int(s))
+	}
+}
+
+// DAGVertexResult is the result of a single process in a DAG.
+type DAGVertexResult struct {
+	// Status is the execution status of the process.
+	Status DAGVertexStatus
+
+	// Err is the error returned by the process if it failed, or a
+	// *DAGDependencyError identifying the failed dependency if it was skipped.
+	Err error
+}
+
+// DAGDescriptorOptions contains fields that configure a DAG descriptor.
+type DAGDescriptorOptions struct {
+	// MaxConcurrency is the maximum number of processes from the graph that
+	// the descriptor allows to run at once. If zero, the number of concurrent
+	// processes is only limited by the scheduler running the descriptor.
+	MaxConcurrency int
+}
+
+// DAGDescriptorOption is a setter for one or more DAG descriptor options.
+type DAGDescriptorOption interface {
+	// ApplyToDAGDescriptorOptions configures the specified DAG descriptor
+	// options for this option.
+	ApplyToDAGDescriptorOptions(target *DAGDescriptorOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *DAGDescriptorOptions) ApplyOptions(opts []DAGDescriptorOption) {
+	for _, opt := range opts {
+		opt.ApplyToDAGDescriptorOptions(o)
+	}
+}
+
+// DAGDescriptorOptionFunc allows a function to be used as a DAG descriptor
+// option.
+type DAGDescriptorOptionFunc func(target *DAGDescriptorOptions)
+
+var _ DAGDescriptorOption = DAGDescriptorOptionFunc(nil)
+
+// ApplyToDAGDescriptorOptions configures the specified DAG descriptor options
+// by calling this function.
+func (ddof DAGDescriptorOptionFunc) ApplyToDAGDescriptorOptions(target *DAGDescriptorOptions) {
+	ddof(target)
+}
+
+// DAGDescriptorWithMaxConcurrency changes the maximum number of processes that
+// may run at once.
+func DAGDescriptorWithMaxConcurrency(n int) DAGDescriptorOption {
+	return DAGDescriptorOptionFunc(func(target *DAGDescriptorOptions) {
+		target.MaxConcurrency = n
+	})
+}
+
+type dagVertexOutcome struct {
+	vertex Process
+	err    error
+}
+
+// dagProcess reports the outcome of a process in a DAG to the descriptor run
+// that emitted it.
+type dagProcess struct {
+	ch       chan<- dagVertexOutcome
+	delegate Process
+}
+
+var _ Process = &dagProcess{}
+
+func (dp *dagProcess) Description() string {
+	return dp.delegate.Description()
+}
+
+func (dp *dagProcess) Run(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = coercePanic(r)
+
+			// Re-panic after we capture the error.
+			defer panic(r)
+		}
+
+		dp.ch <- dagVertexOutcome{vertex: dp.delegate, err: err}
+	}()
+
+	return dp.delegate.Run(ctx)
+}
+
+// DAGDescriptor runs the processes of a directed acyclic graph in dependency
+// order. An edge from one process to another means that the target process
+// depends on the source process and may only run after it succeeds.
+//
+// Processes whose dependencies have all succeeded are emitted concurrently, up
+// to the configured maximum concurrency. If a process fails, every process that
+// depends on it, directly or transitively, is skipped. The descriptor
+// terminates once every process has either finished or been skipped.
+//
+// The descriptor may be run more than once; each run executes the entire graph
+// again.
+type DAGDescriptor struct {
+	g              graph.DirectedGraph
+	maxConcurrency int
+
+	mut     sync.RWMutex
+	results map[Process]DAGVertexResult
+}
+
+var _ Descriptor = &DAGDescriptor{}
+
+func (dd *DAGDescriptor) setResult(p Process, r DAGVertexResult) {
+	dd.mut.Lock()
+	defer dd.mut.Unlock()
+
+	dd.results[p] = r
+}
+
+func (dd *DAGDescriptor) successors(p Process) (succs []Process) {
+	edges, _ := dd.g.OutgoingEdgesOf(p)
+	_ = edges.ForEach(func(edge graph.Edge) error {
+		target, _ := dd.g.TargetVertexOf(edge)
+		succs = append(succs, target.(Process))
+		return nil
+	})
+	return
+}
+
+// skip marks every pending process that depends on the given failed process
+// as skipped and returns the number of processes affected.
+func (dd *DAGDescriptor) skip(failed Process) int {
+	dd.mut.Lock()
+	defer dd.mut.Unlock()
+
+	n := 0
+
+	stack := []Process{failed}
+	for len(stack) > 0 {
+		p := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		for _, succ := range dd.successors(p) {
+			if dd.results[succ].Status != DAGVertexPending {
+				continue
+			}
+
+			dd.results[succ] = DAGVertexResult{
+				Status: DAGVertexSkipped,
+				Err:    &DAGDependencyError{Dependency: p},
+			}
+			n++
+
+			stack = append(stack, succ)
+		}
+	}
+
+	return n
+}
+
+// Results returns the result of each process in the graph for the current or
+// most recent run of this descriptor. Processes that have not yet finished
+// have the pending or running status.
+func (dd *DAGDescriptor) Results() map[Process]DAGVertexResult {
+	dd.mut.RLock()
+	defer dd.mut.RUnlock()
+
+	results := make(map[Process]DAGVertexResult, len(dd.results))
+	for p, r := range dd.results {
+		results[p] = r
+	}
+	return results
+}
+
+// Run emits each process of the graph once all of its dependencies have
+// succeeded and returns when no more processes can run.
+func (dd *DAGDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	indegrees := make(map[Process]uint)
+	var ready []Process
+
+	dd.mut.Lock()
+	dd.results = make(map[Process]DAGVertexResult, dd.g.Vertices().Count())
+	_ = dd.g.Vertices().ForEach(func(vertex graph.Vertex) error {
+		p := vertex.(Process)
+		dd.results[p] = DAGVertexResult{Status: DAGVertexPending}
+
+		indegree, _ := dd.g.InDegreeOf(p)
+		if indegree == 0 {
+			ready = append(ready, p)
+		} else {
+			indegrees[p] = indegree
+		}
+
+		return nil
+	})
+	dd.mut.Unlock()
+
+	// Each process reports exactly once, so this channel never blocks a
+	// process, even after this run returns.
+	outcomes := make(chan dagVertexOutcome, len(dd.results))
+
+	remaining := len(dd.results)
+	running := 0
+
+	for remaining > 0 {
+		var next chan<- Process
+		var p Process
+		if len(ready) > 0 && (dd.maxConcurrency <= 0 || running < dd.maxConcurrency) {
+			next, p = pc, &dagProcess{ch: outcomes, delegate: ready[0]}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case next <- p:
+			dd.setResult(ready[0], DAGVertexResult{Status: DAGVertexRunning})
+
+			ready = ready[1:]
+			running++
+		case outcome := <-outcomes:
+			running--
+			remaining--
+
+			if outcome.err != nil {
+				dd.setResult(outcome.vertex, DAGVertexResult{Status: DAGVertexFailed, Err: outcome.err})
+				remaining -= dd.skip(outcome.vertex)
+				continue
+			}
+
+			dd.setResult(outcome.vertex, DAGVertexResult{Status: DAGVertexSucceeded})
+
+			for _, succ := range dd.successors(outcome.vertex) {
+				indegrees[succ]--
+				if indegrees[succ] == 0 {
+					delete(indegrees, succ)
+					ready = append(ready, succ)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// NewDAGDescriptor creates a new descriptor that runs the processes in the
+// given graph in dependency order. Every vertex of the graph must be a process.
+//
+// If the graph contains cycles, this function returns a *DAGCycleError
+// describing each of them.
+func NewDAGDescriptor(g graph.DirectedGraph, opts ...DAGDescriptorOption) (*DAGDescriptor, error) {
+	o := &DAGDescriptorOptions{}
+	o.ApplyOptions(opts)
+
+	if err := g.Vertices().ForEach(func(vertex graph.Vertex) error {
+		if _, ok := vertex.(Process); !ok {
+			return &DAGVertexTypeError{Vertex: vertex}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var cycles [][]Process
+	algo.TiernanSimpleCyclesOf(g).CyclesInto(&cycles)
+	if len(cycles) > 0 {
+		return nil, &DAGCycleError{Cycles: cycles}
+	}
+
+	return &DAGDescriptor{
+		g:              g,
+		maxConcurrency: o.MaxConcurrency,
+	}, nil
+}
@@ -0,0 +1,216 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/graph"
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dagOrderRecorder records the order in which processes in a DAG finish.
+type dagOrderRecorder struct {
+	mut   sync.Mutex
+	order []string
+}
+
+func (dor *dagOrderRecorder) process(name string, err error) scheduler.Process {
+	return scheduler.DescribeProcessFunc(name, func(ctx context.Context) error {
+		dor.mut.Lock()
+		defer dor.mut.Unlock()
+
+		dor.order = append(dor.order, name)
+		return err
+	})
+}
+
+func (dor *dagOrderRecorder) indexOf(name string) int {
+	dor.mut.Lock()
+	defer dor.mut.Unlock()
+
+	for i, candidate := range dor.order {
+		if candidate == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func runDAGDescriptor(t *testing.T, dd *scheduler.DAGDescriptor, concurrency int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	slc := scheduler.
+		NewSegment(concurrency, []scheduler.Descriptor{dd}).
+		WithErrorBehavior(scheduler.ErrorBehaviorDrop).
+		Start(scheduler.LifecycleStartOptions{})
+	defer slc.Close()
+
+	require.NoError(t, scheduler.WaitContext(ctx, slc))
+}
+
+func TestDAGDescriptorOrder(t *testing.T) {
+	var rec dagOrderRecorder
+
+	a := rec.process("a", nil)
+	b := rec.process("b", nil)
+	c := rec.process("c", nil)
+	d := rec.process("d", nil)
+
+	g := graph.NewSimpleDirectedGraph()
+	for _, p := range []scheduler.Process{a, b, c, d} {
+		g.AddVertex(p)
+	}
+	require.NoError(t, g.Connect(a, b))
+	require.NoError(t, g.Connect(a, c))
+	require.NoError(t, g.Connect(b, d))
+	require.NoError(t, g.Connect(c, d))
+
+	dd, err := scheduler.NewDAGDescriptor(g)
+	require.NoError(t, err)
+
+	runDAGDescriptor(t, dd, 4)
+
+	assert.Equal(t, 0, rec.indexOf("a"))
+	assert.Equal(t, 3, rec.indexOf("d"))
+
+	results := dd.Results()
+	require.Len(t, results, 4)
+	for _, p := range []scheduler.Process{a, b, c, d} {
+		assert.Equal(t, scheduler.DAGVertexResult{Status: scheduler.DAGVertexSucceeded}, results[p], p.Description())
+	}
+}
+
+func TestDAGDescriptorFailureSkipsDependents(t *testing.T) {
+	var rec dagOrderRecorder
+
+	errBoom := errors.New("boom")
+
+	a := rec.process("a", nil)
+	b := rec.process("b", errBoom)
+	c := rec.process("c", nil)
+	d := rec.process("d", nil)
+	e := rec.process("e", nil)
+
+	// a -> b -> c -> d, a -> d, and e is independent.
+	g := graph.NewSimpleDirectedGraph()
+	for _, p := range []scheduler.Process{a, b, c, d, e} {
+		g.AddVertex(p)
+	}
+	require.NoError(t, g.Connect(a, b))
+	require.NoError(t, g.Connect(b, c))
+	require.NoError(t, g.Connect(c, d))
+	require.NoError(t, g.Connect(a, d))
+
+	dd, err := scheduler.NewDAGDescriptor(g)
+	require.NoError(t, err)
+
+	runDAGDescriptor(t, dd, 2)
+
+	assert.Equal(t, -1, rec.indexOf("c"))
+	assert.Equal(t, -1, rec.indexOf("d"))
+
+	results := dd.Results()
+	assert.Equal(t, scheduler.DAGVertexSucceeded, results[a].Status)
+	assert.Equal(t, scheduler.DAGVertexSucceeded, results[e].Status)
+	assert.Equal(t, scheduler.DAGVertexResult{Status: scheduler.DAGVertexFailed, Err: errBoom}, results[b])
+
+	assert.Equal(t, scheduler.DAGVertexSkipped, results[c].Status)
+	assert.Equal(t, &scheduler.DAGDependencyError{Dependency: b}, results[c].Err)
+
+	assert.Equal(t, scheduler.DAGVertexSkipped, results[d].Status)
+	assert.Equal(t, &scheduler.DAGDependencyError{Dependency: c}, results[d].Err)
+}
+
+func TestDAGDescriptorMaxConcurrency(t *testing.T) {
+	var running, peak int32
+
+	g := graph.NewSimpleDirectedGraph()
+	for i := 0; i < 10; i++ {
+		g.AddVertex(scheduler.DescribeProcessFunc("p", func(ctx context.Context) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			for {
+				cur := atomic.LoadInt32(&peak)
+				if n <= cur || atomic.CompareAndSwapInt32(&peak, cur, n) {
+					break
+				}
+			}
+
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}))
+	}
+
+	dd, err := scheduler.NewDAGDescriptor(g, scheduler.DAGDescriptorWithMaxConcurrency(2))
+	require.NoError(t, err)
+
+	runDAGDescriptor(t, dd, 10)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+	for _, r := range dd.Results() {
+		assert.Equal(t, scheduler.DAGVertexSucceeded, r.Status)
+	}
+}
+
+func TestDAGDescriptorPanic(t *testing.T) {
+	var rec dagOrderRecorder
+
+	a := scheduler.DescribeProcessFunc("a", func(ctx context.Context) error {
+		panic("boom")
+	})
+	b := rec.process("b", nil)
+
+	g := graph.NewSimpleDirectedGraph()
+	g.AddVertex(a)
+	g.AddVertex(b)
+	require.NoError(t, g.Connect(a, b))
+
+	dd, err := scheduler.NewDAGDescriptor(g)
+	require.NoError(t, err)
+
+	runDAGDescriptor(t, dd, 1)
+
+	results := dd.Results()
+	assert.Equal(t, scheduler.DAGVertexFailed, results[a].Status)
+	assert.IsType(t, &scheduler.PanicError{}, results[a].Err)
+	assert.Equal(t, scheduler.DAGVertexSkipped, results[b].Status)
+}
+
+func TestDAGDescriptorCycles(t *testing.T) {
+	var rec dagOrderRecorder
+
+	a := rec.process("a", nil)
+	b := rec.process("b", nil)
+	c := rec.process("c", nil)
+
+	g := graph.NewSimpleDirectedGraphWithFeatures(graph.DeterministicIteration)
+	g.AddVertex(a)
+	g.AddVertex(b)
+	g.AddVertex(c)
+	require.NoError(t, g.Connect(a, b))
+	require.NoError(t, g.Connect(b, c))
+	require.NoError(t, g.Connect(c, a))
+
+	_, err := scheduler.NewDAGDescriptor(g)
+
+	var cerr *scheduler.DAGCycleError
+	require.True(t, errors.As(err, &cerr))
+	assert.Equal(t, [][]scheduler.Process{{a, b, c}}, cerr.Cycles)
+	assert.Equal(t, "DAG contains 1 cycle(s): a -> b -> c -> a", cerr.Error())
+}
+
+func TestDAGDescriptorVertexType(t *testing.T) {
+	g := graph.NewSimpleDirectedGraph()
+	g.AddVertex("not a process")
+
+	_, err := scheduler.NewDAGDescriptor(g)
+	assert.Equal(t, &scheduler.DAGVertexTypeError{Vertex: "not a process"}, err)
+}
@@ -0,0 +1,170 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+const (
+	// DefaultShutdownDrainTimeout is the time to allow running processes to
+	// finish before they are asked to terminate. 30 seconds is the GKE
+	// preemption time, so we leave some room for processes to respond to the
+	// termination request and for other components to shut down.
+	DefaultShutdownDrainTimeout = 20 * time.Second
+)
+
+// Drainer is implemented by started lifecycles that can stop scheduling new
+// work without interrupting work that is already running. The started
+// lifecycles returned by Segment and Parent implement this interface.
+type Drainer interface {
+	// Drain terminates descriptors so that they stop emitting processes, but
+	// allows processes that are already running to finish. The lifecycle
+	// terminates when all of its processes finish.
+	Drain()
+}
+
+// drainManySchedulable cancels the context of its delegate when a channel
+// closes.
+type drainManySchedulable struct {
+	delegate ManySchedulable
+	draining <-chan struct{}
+}
+
+func (dms *drainManySchedulable) Len() int {
+	return dms.delegate.Len()
+}
+
+func (dms *drainManySchedulable) Run(ctx context.Context, i int, er ErrorReporter) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-dms.draining:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	dms.delegate.Run(ctx, i, er)
+}
+
+// DrainWaitContext drains the given lifecycle if it implements Drainer and
+// then waits for it to terminate. If the lifecycle does not implement Drainer,
+// it is closed instead.
+func DrainWaitContext(ctx context.Context, lc StartedLifecycle) error {
+	if drainer, ok := lc.(Drainer); ok {
+		drainer.Drain()
+	} else {
+		lc.Close()
+	}
+
+	return WaitContext(ctx, lc)
+}
+
+// ShutdownReport describes the outcome of shutting down a lifecycle using
+// ShutdownContext.
+type ShutdownReport struct {
+	// Drained is true if all of the processes of the lifecycle finished before
+	// the drain timeout.
+	Drained bool
+
+	// Running are the processes that were still running when the drain timeout
+	// elapsed and the lifecycle was closed.
+	Running []ProcessSnapshot
+}
+
+// ShutdownOptions contains fields that configure the shutdown of a lifecycle.
+type ShutdownOptions struct {
+	// DrainTimeout is the time to allow running processes to finish after the
+	// lifecycle is drained. If not specified, DefaultShutdownDrainTimeout is
+	// used.
+	DrainTimeout time.Duration
+
+	// Clock is the clock used to measure the drain timeout. If not specified,
+	// the system clock is used.
+	Clock clock.Clock
+}
+
+// ShutdownOption is a setter for one or more shutdown options.
+type ShutdownOption interface {
+	// ApplyToShutdownOptions configures the specified shutdown options for
+	// this option.
+	ApplyToShutdownOptions(target *ShutdownOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *ShutdownOptions) ApplyOptions(opts []ShutdownOption) {
+	for _, opt := range opts {
+		opt.ApplyToShutdownOptions(o)
+	}
+}
+
+// ShutdownOptionFunc allows a function to be used as a shutdown option.
+type ShutdownOptionFunc func(target *ShutdownOptions)
+
+var _ ShutdownOption = ShutdownOptionFunc(nil)
+
+// ApplyToShutdownOptions configures the specified shutdown options by calling
+// this function.
+func (sof ShutdownOptionFunc) ApplyToShutdownOptions(target *ShutdownOptions) {
+	sof(target)
+}
+
+// ShutdownWithDrainTimeout changes the time to allow running processes to
+// finish.
+func ShutdownWithDrainTimeout(timeout time.Duration) ShutdownOption {
+	return ShutdownOptionFunc(func(target *ShutdownOptions) {
+		target.DrainTimeout = timeout
+	})
+}
+
+// ShutdownWithClock changes the clock to the specified one.
+func ShutdownWithClock(c clock.Clock) ShutdownOption {
+	return ShutdownOptionFunc(func(target *ShutdownOptions) {
+		target.Clock = c
+	})
+}
+
+// ShutdownContext terminates the given lifecycle in two phases.
+//
+// First, the lifecycle is drained: its descriptors stop emitting processes and
+// running processes are allowed to finish within the drain timeout. Then, if
+// any processes are still running, the lifecycle is closed, asking them to
+// terminate, and this function waits for it to shut down. The returned report
+// lists the processes that were still running when the lifecycle was closed.
+//
+// If the lifecycle does not implement Drainer, the drain phase is skipped. If
+// the context is done during the drain phase, the lifecycle is closed
+// immediately. In either case, the context error is returned if the lifecycle
+// does not terminate before the context is done.
+func ShutdownContext(ctx context.Context, lc StartedLifecycle, opts ...ShutdownOption) (*ShutdownReport, error) {
+	o := &ShutdownOptions{
+		DrainTimeout: DefaultShutdownDrainTimeout,
+		Clock:        clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	if drainer, ok := lc.(Drainer); ok {
+		drainer.Drain()
+
+		t := o.Clock.NewTimer(o.DrainTimeout)
+		defer t.Stop()
+
+		select {
+		case <-lc.Done():
+			return &ShutdownReport{Drained: true, Running: []ProcessSnapshot{}}, nil
+		case <-t.C():
+		case <-ctx.Done():
+		}
+	}
+
+	report := &ShutdownReport{Running: SnapshotOf(lc).Processes}
+	for _, ps := range report.Running {
+		log(ctx).Warn("process still running at shutdown deadline; terminating", "description", ps.Description, "request", ps.Request, "started-at", ps.StartedAt)
+	}
+
+	return report, CloseWaitContext(ctx, lc)
+}
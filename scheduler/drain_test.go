@@ -0,0 +1,162 @@
+package scheduler_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+func TestSegmentDrain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var runs int32
+	running := make(chan struct{}, 1)
+	release := make(chan struct{})
+
+	p := scheduler.ProcessFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		running <- struct{}{}
+
+		select {
+		case <-release:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	slc := scheduler.
+		NewParent(scheduler.NewSegment(1, []scheduler.Descriptor{scheduler.NewRepeatingDescriptor(p)})).
+		Start(scheduler.LifecycleStartOptions{})
+	defer slc.Close()
+
+	select {
+	case <-running:
+	case <-ctx.Done():
+		require.Fail(t, "process did not start")
+	}
+
+	slc.(scheduler.Drainer).Drain()
+
+	// The running process is not interrupted, so the lifecycle stays up.
+	select {
+	case <-slc.Done():
+		require.Fail(t, "lifecycle terminated before process finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	require.NoError(t, scheduler.WaitContext(ctx, slc))
+	assert.Empty(t, slc.Errs())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
+
+func TestShutdownContextDrained(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	running := make(chan struct{})
+	release := make(chan struct{})
+
+	ad, as := scheduler.NewAdhocDescriptor()
+	slc := scheduler.NewSegment(1, []scheduler.Descriptor{ad}).Start(scheduler.LifecycleStartOptions{})
+	defer slc.Close()
+
+	ch := as.Submit(scheduler.ProcessFunc(func(ctx context.Context) error {
+		close(running)
+		<-release
+		return ctx.Err()
+	}))
+	<-running
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+
+	report, err := scheduler.ShutdownContext(ctx, slc)
+	require.NoError(t, err)
+	assert.True(t, report.Drained)
+	assert.Empty(t, report.Running)
+
+	require.NoError(t, <-ch)
+}
+
+func TestShutdownContextDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+
+	running := make(chan struct{})
+
+	slc := scheduler.
+		NewParent(scheduler.NewSegment(1, []scheduler.Descriptor{
+			scheduler.NewImmediateDescriptor(scheduler.DescribeProcessFunc("stuck", func(ctx context.Context) error {
+				close(running)
+				<-ctx.Done()
+				return nil
+			})),
+		})).
+		Start(scheduler.LifecycleStartOptions{})
+	defer slc.Close()
+
+	<-running
+
+	type result struct {
+		report *scheduler.ShutdownReport
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		report, err := scheduler.ShutdownContext(ctx, slc,
+			scheduler.ShutdownWithDrainTimeout(5*time.Second),
+			scheduler.ShutdownWithClock(k8sext.NewClock(fc)),
+		)
+		ch <- result{report: report, err: err}
+	}()
+
+	waitForTimer(t, fc)
+	fc.Step(5 * time.Second)
+
+	var r result
+	select {
+	case r = <-ch:
+	case <-ctx.Done():
+		require.Fail(t, "shutdown did not complete")
+	}
+
+	require.NoError(t, r.err)
+	assert.False(t, r.report.Drained)
+	require.Len(t, r.report.Running, 1)
+	assert.Equal(t, "stuck", r.report.Running[0].Description)
+
+	select {
+	case <-slc.Done():
+	default:
+		require.Fail(t, "lifecycle did not terminate")
+	}
+}
+
+func TestDrainWaitContextNotDrainer(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	slc := scheduler.NewScheduler(scheduler.OneSchedulable(scheduler.SchedulableFunc(func(ctx context.Context, er scheduler.ErrorReporter) {
+		<-ctx.Done()
+	}))).Start(scheduler.LifecycleStartOptions{})
+
+	_, ok := slc.(scheduler.Drainer)
+	require.False(t, ok)
+
+	require.NoError(t, scheduler.DrainWaitContext(ctx, slc))
+}
@@ -4,10 +4,23 @@ go 1.14
 
 require (
 	github.com/certifi/gocertifi v0.0.0-20200922220541-2c3bb06c6054 // indirect
+	github.com/google/uuid v1.1.2
+	github.com/mattn/go-sqlite3 v1.14.8
+	github.com/puppetlabs/leg/datastructure v0.1.0
+	github.com/puppetlabs/leg/errmap v0.1.0
+	github.com/puppetlabs/leg/graph v0.1.1
 	github.com/puppetlabs/leg/instrumentation v0.1.4
 	github.com/puppetlabs/leg/logging v0.1.0
 	github.com/puppetlabs/leg/request v0.1.0
-	github.com/puppetlabs/leg/timeutil v0.4.1
+	github.com/puppetlabs/leg/sqlutil v0.1.2
+	github.com/puppetlabs/leg/timeutil v0.4.2
 	github.com/stretchr/testify v1.6.1
 	k8s.io/apimachinery v0.20.1
 )
+
+replace (
+	github.com/puppetlabs/leg/logging => ../logging
+	github.com/puppetlabs/leg/request => ../request
+	github.com/puppetlabs/leg/sqlutil => ../sqlutil
+)
+
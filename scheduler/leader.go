@@ -0,0 +1,502 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/leg/sqlutil"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+// LeaderLease is a lock shared by many processes, of which at most one may
+// hold it at a time. Implementations identify the current process using their
+// own configuration.
+//
+// This package provides SQLLeaderLease. The github.com/puppetlabs/leg/k8sutil
+// module provides an implementation that uses a Kubernetes Lease object.
+type LeaderLease interface {
+	// TryAcquireOrRenew acquires the lease for the current process if no other
+	// process holds it, or extends the lease if the current process already
+	// holds it. If it returns true, the current process holds the lease for
+	// the given duration.
+	TryAcquireOrRenew(ctx context.Context, duration time.Duration) (bool, error)
+
+	// Release gives up the lease if the current process holds it so that
+	// another process can acquire it without waiting for it to expire.
+	Release(ctx context.Context) error
+}
+
+// LeaderElectionDescriptorOptions contains fields that configure a leader
+// election descriptor.
+type LeaderElectionDescriptorOptions struct {
+	// LeaseDuration is the time other processes must wait after the last
+	// renewal of the lease before they can acquire it. If not specified, 15
+	// seconds is used.
+	LeaseDuration time.Duration
+
+	// RenewDeadline is the time the leader keeps trying to renew the lease
+	// after the last successful renewal before it gives up leadership. It must
+	// be less than the lease duration. If not specified, 10 seconds is used.
+	RenewDeadline time.Duration
+
+	// RetryPeriod is the time to wait between attempts to acquire or renew the
+	// lease. If not specified, 2 seconds is used.
+	RetryPeriod time.Duration
+
+	// Clock is the clock used to measure the renew deadline and retry period.
+	// If not specified, the system clock is used.
+	Clock clock.Clock
+}
+
+// LeaderElectionDescriptorOption is a setter for one or more leader election
+// descriptor options.
+type LeaderElectionDescriptorOption interface {
+	// ApplyToLeaderElectionDescriptorOptions configures the specified leader
+	// election descriptor options for this option.
+	ApplyToLeaderElectionDescriptorOptions(target *LeaderElectionDescriptorOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *LeaderElectionDescriptorOptions) ApplyOptions(opts []LeaderElectionDescriptorOption) {
+	for _, opt := range opts {
+		opt.ApplyToLeaderElectionDescriptorOptions(o)
+	}
+}
+
+// LeaderElectionDescriptorOptionFunc allows a function to be used as a leader
+// election descriptor option.
+type LeaderElectionDescriptorOptionFunc func(target *LeaderElectionDescriptorOptions)
+
+var _ LeaderElectionDescriptorOption = LeaderElectionDescriptorOptionFunc(nil)
+
+// ApplyToLeaderElectionDescriptorOptions configures the specified leader
+// election descriptor options by calling this function.
+func (ledof LeaderElectionDescriptorOptionFunc) ApplyToLeaderElectionDescriptorOptions(target *LeaderElectionDescriptorOptions) {
+	ledof(target)
+}
+
+// LeaderElectionDescriptorWithLeaseDuration changes the lease duration.
+func LeaderElectionDescriptorWithLeaseDuration(d time.Duration) LeaderElectionDescriptorOption {
+	return LeaderElectionDescriptorOptionFunc(func(target *LeaderElectionDescriptorOptions) {
+		target.LeaseDuration = d
+	})
+}
+
+// LeaderElectionDescriptorWithRenewDeadline changes the renew deadline.
+func LeaderElectionDescriptorWithRenewDeadline(d time.Duration) LeaderElectionDescriptorOption {
+	return LeaderElectionDescriptorOptionFunc(func(target *LeaderElectionDescriptorOptions) {
+		target.RenewDeadline = d
+	})
+}
+
+// LeaderElectionDescriptorWithRetryPeriod changes the retry period.
+func LeaderElectionDescriptorWithRetryPeriod(d time.Duration) LeaderElectionDescriptorOption {
+	return LeaderElectionDescriptorOptionFunc(func(target *LeaderElectionDescriptorOptions) {
+		target.RetryPeriod = d
+	})
+}
+
+// LeaderElectionDescriptorWithClock changes the clock to the specified one.
+func LeaderElectionDescriptorWithClock(c clock.Clock) LeaderElectionDescriptorOption {
+	return LeaderElectionDescriptorOptionFunc(func(target *LeaderElectionDescriptorOptions) {
+		target.Clock = c
+	})
+}
+
+// LeaderElectionDescriptor runs a delegate descriptor only while the current
+// process holds a leader lease. It is useful for work that must only run on a
+// single replica of an application, like an interval descriptor that performs
+// cleanup.
+//
+// When the current process acquires the lease, the delegate starts. If the
+// current process fails to renew the lease before the renew deadline or
+// another process takes over the lease, the context of the delegate and the
+// contexts of any processes it emitted are canceled. Once the delegate
+// terminates, the descriptor tries to acquire the lease again.
+//
+// If the delegate terminates on its own, the descriptor keeps renewing the
+// lease until the processes it emitted finish. When the context of the
+// descriptor is done, the contexts of the processes are canceled instead. In
+// either case, the lease is released once the processes finish so another
+// process can take over immediately.
+type LeaderElectionDescriptor struct {
+	delegate      Descriptor
+	lease         LeaderLease
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+	clock         clock.Clock
+}
+
+var _ Descriptor = &LeaderElectionDescriptor{}
+
+func (led *LeaderElectionDescriptor) sleep(ctx context.Context, d time.Duration) bool {
+	t := led.clock.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C():
+		return true
+	}
+}
+
+// leaderProcess is a process emitted during a term of leadership. Its context
+// is canceled when the term ends, and it reports when it finishes so that the
+// lease is held until then.
+type leaderProcess struct {
+	contextBoundProcess
+	done func()
+}
+
+var _ Process = &leaderProcess{}
+
+func (lp *leaderProcess) Run(ctx context.Context) error {
+	defer lp.done()
+	return lp.contextBoundProcess.Run(ctx)
+}
+
+// awaitProcesses waits for the processes of a term of leadership to finish
+// after the term is canceled. A scheduler may accept a process but never run
+// it, so it gives up once the current process may no longer hold the lease.
+func (led *LeaderElectionDescriptor) awaitProcesses(finished <-chan struct{}, renewedAt time.Time) {
+	t := led.clock.NewTimer(led.renewDeadline - led.clock.Since(renewedAt))
+	defer t.Stop()
+
+	select {
+	case <-finished:
+	case <-t.C():
+	}
+}
+
+func (led *LeaderElectionDescriptor) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), led.renewDeadline)
+	defer cancel()
+
+	if err := led.lease.Release(ctx); err != nil {
+		log(ctx).Warn("failed to release leader lease", "error", err)
+	}
+}
+
+// campaign blocks until the current process acquires the lease. It returns
+// false if the context is done first.
+func (led *LeaderElectionDescriptor) campaign(ctx context.Context) bool {
+	for {
+		held, err := led.lease.TryAcquireOrRenew(ctx, led.leaseDuration)
+		if err != nil && ctx.Err() == nil {
+			log(ctx).Warn("failed to acquire leader lease", "error", err)
+		} else if held {
+			log(ctx).Info("acquired leader lease")
+			return true
+		}
+
+		if !led.sleep(ctx, led.retryPeriod) {
+			return false
+		}
+	}
+}
+
+// lead runs the delegate while the current process holds the lease. It returns
+// true if the descriptor should terminate, or false if leadership was lost and
+// the descriptor should campaign again.
+func (led *LeaderElectionDescriptor) lead(ctx context.Context, pc chan<- Process) (bool, error) {
+	renewedAt := led.clock.Now()
+
+	term, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan Process)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+		errCh <- led.delegate.Run(term, ch)
+	}()
+
+	// Forward processes, binding each one to this term of leadership.
+	var running sync.WaitGroup
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+
+		for p := range ch {
+			running.Add(1)
+
+			lp := &leaderProcess{
+				contextBoundProcess: contextBoundProcess{ctx: term, delegate: p},
+				done:                running.Done,
+			}
+
+			select {
+			case <-term.Done():
+				running.Done()
+			case pc <- lp:
+			}
+		}
+	}()
+
+	// The term is finished once the delegate has terminated and all of the
+	// processes it emitted have finished.
+	finished := make(chan struct{})
+	go func() {
+		<-forwarded
+		running.Wait()
+		close(finished)
+	}()
+
+	for {
+		t := led.clock.NewTimer(led.retryPeriod)
+
+		select {
+		case <-finished:
+			t.Stop()
+
+			led.release()
+			return true, <-errCh
+		case <-ctx.Done():
+			t.Stop()
+
+			cancel()
+			<-forwarded
+			led.awaitProcesses(finished, renewedAt)
+
+			led.release()
+			return true, <-errCh
+		case <-t.C():
+		}
+
+		held, err := led.lease.TryAcquireOrRenew(ctx, led.leaseDuration)
+		if err != nil {
+			if ctx.Err() != nil {
+				continue
+			}
+
+			log(ctx).Warn("failed to renew leader lease", "error", err)
+			if led.clock.Since(renewedAt) < led.renewDeadline {
+				continue
+			}
+		} else if held {
+			renewedAt = led.clock.Now()
+			continue
+		}
+
+		log(ctx).Warn("lost leader lease; stopping delegate descriptor")
+
+		cancel()
+		<-forwarded
+
+		if err := <-errCh; err != nil {
+			log(ctx).Warn("delegate descriptor ended with error after losing leader lease", "error", err)
+		}
+
+		return false, nil
+	}
+}
+
+// Run campaigns for the lease and runs the delegate descriptor while the
+// current process holds it. It terminates when the context is done or the
+// delegate terminates on its own and the processes it emitted finish.
+func (led *LeaderElectionDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	for {
+		if !led.campaign(ctx) {
+			return nil
+		}
+
+		if done, err := led.lead(ctx, pc); done {
+			return err
+		}
+	}
+}
+
+// NewLeaderElectionDescriptor creates a new descriptor that runs the given
+// delegate descriptor only while the current process holds the given lease.
+func NewLeaderElectionDescriptor(delegate Descriptor, lease LeaderLease, opts ...LeaderElectionDescriptorOption) *LeaderElectionDescriptor {
+	o := &LeaderElectionDescriptorOptions{
+		LeaseDuration: 15 * time.Second,
+		RenewDeadline: 10 * time.Second,
+		RetryPeriod:   2 * time.Second,
+		Clock:         clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	return &LeaderElectionDescriptor{
+		delegate:      delegate,
+		lease:         lease,
+		leaseDuration: o.LeaseDuration,
+		renewDeadline: o.RenewDeadline,
+		retryPeriod:   o.RetryPeriod,
+		clock:         o.Clock,
+	}
+}
+
+// SQLLeaderLeaseOptions contains fields that configure a SQL leader lease.
+type SQLLeaderLeaseOptions struct {
+	// Table is the name of the table that stores leases. If not specified,
+	// "scheduler_leases" is used. It is interpolated directly into queries, so
+	// it must not come from untrusted input.
+	Table string
+
+	// PlaceholderFunc formats bind parameters for the database driver. If not
+	// specified, SQLPlaceholderQuestion is used.
+	PlaceholderFunc SQLPlaceholderFunc
+
+	// Clock is the clock used to compute lease expiration. If not specified,
+	// the system clock is used.
+	Clock clock.Clock
+}
+
+// SQLLeaderLeaseOption is a setter for one or more SQL leader lease options.
+type SQLLeaderLeaseOption interface {
+	// ApplyToSQLLeaderLeaseOptions configures the specified SQL leader lease
+	// options for this option.
+	ApplyToSQLLeaderLeaseOptions(target *SQLLeaderLeaseOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *SQLLeaderLeaseOptions) ApplyOptions(opts []SQLLeaderLeaseOption) {
+	for _, opt := range opts {
+		opt.ApplyToSQLLeaderLeaseOptions(o)
+	}
+}
+
+// SQLLeaderLeaseOptionFunc allows a function to be used as a SQL leader lease
+// option.
+type SQLLeaderLeaseOptionFunc func(target *SQLLeaderLeaseOptions)
+
+var _ SQLLeaderLeaseOption = SQLLeaderLeaseOptionFunc(nil)
+
+// ApplyToSQLLeaderLeaseOptions configures the specified SQL leader lease
+// options by calling this function.
+func (sllof SQLLeaderLeaseOptionFunc) ApplyToSQLLeaderLeaseOptions(target *SQLLeaderLeaseOptions) {
+	sllof(target)
+}
+
+// SQLLeaderLeaseWithTable changes the name of the table that stores leases.
+func SQLLeaderLeaseWithTable(table string) SQLLeaderLeaseOption {
+	return SQLLeaderLeaseOptionFunc(func(target *SQLLeaderLeaseOptions) {
+		target.Table = table
+	})
+}
+
+// SQLLeaderLeaseWithPlaceholderFunc changes the bind parameter format to the
+// specified one.
+func SQLLeaderLeaseWithPlaceholderFunc(fn SQLPlaceholderFunc) SQLLeaderLeaseOption {
+	return SQLLeaderLeaseOptionFunc(func(target *SQLLeaderLeaseOptions) {
+		target.PlaceholderFunc = fn
+	})
+}
+
+// SQLLeaderLeaseWithClock changes the clock to the specified one.
+func SQLLeaderLeaseWithClock(c clock.Clock) SQLLeaderLeaseOption {
+	return SQLLeaderLeaseOptionFunc(func(target *SQLLeaderLeaseOptions) {
+		target.Clock = c
+	})
+}
+
+// SQLLeaderLease is a leader lease stored as a row in a database table. The
+// row records the current holder and the time the lease expires, so unlike a
+// session lock, it does not require a dedicated database connection.
+//
+// The table must have the following columns:
+//
+//	CREATE TABLE scheduler_leases (
+//	  name VARCHAR(255) PRIMARY KEY,
+//	  holder VARCHAR(255) NOT NULL,
+//	  expires_at BIGINT NOT NULL
+//	);
+//
+// Times are stored as nanoseconds since the Unix epoch, so the clocks of the
+// processes sharing a lease should be reasonably synchronized.
+type SQLLeaderLease struct {
+	db              *sql.DB
+	name            string
+	identity        string
+	table           string
+	placeholderFunc SQLPlaceholderFunc
+	clock           clock.Clock
+}
+
+var _ LeaderLease = &SQLLeaderLease{}
+
+func (sll *SQLLeaderLease) query(query string) string {
+	return formatSQLQuery(query, sll.table, sll.placeholderFunc)
+}
+
+// TryAcquireOrRenew acquires or renews the lease for the identity of this
+// lease.
+func (sll *SQLLeaderLease) TryAcquireOrRenew(ctx context.Context, duration time.Duration) (held bool, err error) {
+	err = sqlutil.WithTx(ctx, sll.db, func(ctx context.Context, tx *sql.Tx) error {
+		now := sll.clock.Now()
+
+		r, err := tx.ExecContext(ctx, sll.query(`
+			UPDATE {table}
+			SET holder = ?, expires_at = ?
+			WHERE name = ? AND (holder = ? OR expires_at <= ?)
+		`), sll.identity, now.Add(duration).UnixNano(), sll.name, sll.identity, now.UnixNano())
+		if err != nil {
+			return err
+		}
+
+		if n, err := r.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			held = true
+			return nil
+		}
+
+		var count int
+		if err := tx.QueryRowContext(ctx, sll.query(`SELECT COUNT(*) FROM {table} WHERE name = ?`), sll.name).Scan(&count); err != nil {
+			return err
+		} else if count > 0 {
+			// Another process holds the lease.
+			return nil
+		}
+
+		if _, err := tx.ExecContext(ctx, sll.query(`
+			INSERT INTO {table} (name, holder, expires_at)
+			VALUES (?, ?, ?)
+		`), sll.name, sll.identity, now.Add(duration).UnixNano()); err != nil {
+			return err
+		}
+
+		held = true
+		return nil
+	})
+	return
+}
+
+// Release releases the lease if the identity of this lease holds it.
+func (sll *SQLLeaderLease) Release(ctx context.Context) error {
+	return sqlutil.WithTx(ctx, sll.db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, sll.query(`
+			UPDATE {table}
+			SET holder = '', expires_at = 0
+			WHERE name = ? AND holder = ?
+		`), sll.name, sll.identity)
+		return err
+	})
+}
+
+// NewSQLLeaderLease creates a new handle to the lease with the given name
+// stored in the given database. The identity must be unique to the current
+// process, such as a host name or pod name.
+func NewSQLLeaderLease(db *sql.DB, name, identity string, opts ...SQLLeaderLeaseOption) *SQLLeaderLease {
+	o := &SQLLeaderLeaseOptions{
+		Table:           "scheduler_leases",
+		PlaceholderFunc: SQLPlaceholderQuestion,
+		Clock:           clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	return &SQLLeaderLease{
+		db:              db,
+		name:            name,
+		identity:        identity,
+		table:           o.Table,
+		placeholderFunc: o.PlaceholderFunc,
+		clock:           o.Clock,
+	}
+}
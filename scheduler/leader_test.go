@@ -0,0 +1,323 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+type leaseResult struct {
+	held bool
+	err  error
+}
+
+// scriptedLeaderLease returns the results sent to it in order.
+type scriptedLeaderLease struct {
+	results  chan leaseResult
+	releases int32
+}
+
+func (sll *scriptedLeaderLease) TryAcquireOrRenew(ctx context.Context, duration time.Duration) (bool, error) {
+	select {
+	case r := <-sll.results:
+		return r.held, r.err
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+func (sll *scriptedLeaderLease) Release(ctx context.Context) error {
+	atomic.AddInt32(&sll.releases, 1)
+	return nil
+}
+
+func (sll *scriptedLeaderLease) respond(t *testing.T, r leaseResult) {
+	select {
+	case sll.results <- r:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "lease was not requested")
+	}
+}
+
+// termDescriptor emits a process for each term of leadership that blocks
+// until its context is done.
+type termDescriptor struct {
+	terms    chan struct{}
+	started  chan struct{}
+	canceled chan struct{}
+}
+
+func (td *termDescriptor) Run(ctx context.Context, pc chan<- scheduler.Process) error {
+	td.terms <- struct{}{}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case pc <- scheduler.ProcessFunc(func(ctx context.Context) error {
+		td.started <- struct{}{}
+		<-ctx.Done()
+		td.canceled <- struct{}{}
+		return nil
+	}):
+	}
+
+	<-ctx.Done()
+	return nil
+}
+
+func newTermDescriptor() *termDescriptor {
+	return &termDescriptor{
+		terms:    make(chan struct{}, 10),
+		started:  make(chan struct{}, 10),
+		canceled: make(chan struct{}, 10),
+	}
+}
+
+func requireSignal(t *testing.T, ch <-chan struct{}, msg string) {
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, msg)
+	}
+}
+
+func runLeaderElectionDescriptor(t *testing.T, ctx context.Context, d scheduler.Descriptor) <-chan error {
+	pc := make(chan scheduler.Process)
+	errCh := make(chan error, 1)
+
+	go func() {
+		errCh <- d.Run(ctx, pc)
+	}()
+
+	go func() {
+		for p := range pc {
+			go func(p scheduler.Process) { _ = p.Run(context.Background()) }(p)
+		}
+	}()
+
+	t.Cleanup(func() { close(pc) })
+	return errCh
+}
+
+func TestLeaderElectionDescriptorHandover(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+	lease := &scriptedLeaderLease{results: make(chan leaseResult)}
+	td := newTermDescriptor()
+
+	errCh := runLeaderElectionDescriptor(t, ctx, scheduler.NewLeaderElectionDescriptor(td, lease,
+		scheduler.LeaderElectionDescriptorWithRetryPeriod(time.Second),
+		scheduler.LeaderElectionDescriptorWithClock(k8sext.NewClock(fc)),
+	))
+
+	lease.respond(t, leaseResult{held: true})
+	requireSignal(t, td.terms, "delegate did not start")
+	requireSignal(t, td.started, "process did not start")
+
+	// Renew once, then lose the lease to another process.
+	waitForTimer(t, fc)
+	fc.Step(time.Second)
+	lease.respond(t, leaseResult{held: true})
+
+	waitForTimer(t, fc)
+	fc.Step(time.Second)
+	lease.respond(t, leaseResult{held: false})
+	requireSignal(t, td.canceled, "process was not canceled after losing lease")
+
+	// Campaign again until we get the lease back.
+	lease.respond(t, leaseResult{held: false})
+	waitForTimer(t, fc)
+	fc.Step(time.Second)
+	lease.respond(t, leaseResult{held: true})
+	requireSignal(t, td.terms, "delegate did not restart")
+	requireSignal(t, td.started, "process did not restart")
+
+	cancel()
+	require.NoError(t, <-errCh)
+	requireSignal(t, td.canceled, "process was not canceled after shutdown")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lease.releases))
+}
+
+func TestLeaderElectionDescriptorRenewDeadline(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+	lease := &scriptedLeaderLease{results: make(chan leaseResult)}
+	td := newTermDescriptor()
+
+	runLeaderElectionDescriptor(t, ctx, scheduler.NewLeaderElectionDescriptor(td, lease,
+		scheduler.LeaderElectionDescriptorWithRenewDeadline(3*time.Second),
+		scheduler.LeaderElectionDescriptorWithRetryPeriod(time.Second),
+		scheduler.LeaderElectionDescriptorWithClock(k8sext.NewClock(fc)),
+	))
+
+	lease.respond(t, leaseResult{held: true})
+	requireSignal(t, td.terms, "delegate did not start")
+	requireSignal(t, td.started, "process did not start")
+
+	// Errors are tolerated until the renew deadline.
+	for i := 0; i < 2; i++ {
+		waitForTimer(t, fc)
+		fc.Step(time.Second)
+		lease.respond(t, leaseResult{err: errors.New("unavailable")})
+	}
+
+	select {
+	case <-td.canceled:
+		require.Fail(t, "process canceled before renew deadline")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	waitForTimer(t, fc)
+	fc.Step(time.Second)
+	lease.respond(t, leaseResult{err: errors.New("unavailable")})
+	requireSignal(t, td.canceled, "process was not canceled after renew deadline")
+}
+
+func TestLeaderElectionDescriptorDelegateDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lease := &scriptedLeaderLease{results: make(chan leaseResult, 1)}
+	lease.results <- leaseResult{held: true}
+
+	errBoom := errors.New("boom")
+	d := scheduler.NewLeaderElectionDescriptor(scheduler.DescriptorFunc(func(ctx context.Context, pc chan<- scheduler.Process) error {
+		return errBoom
+	}), lease)
+
+	assert.Equal(t, errBoom, d.Run(ctx, make(chan scheduler.Process)))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lease.releases))
+}
+
+// heldLeaderLease is always held by the current process.
+type heldLeaderLease struct {
+	renewals int32
+	releases int32
+}
+
+func (hll *heldLeaderLease) TryAcquireOrRenew(ctx context.Context, duration time.Duration) (bool, error) {
+	atomic.AddInt32(&hll.renewals, 1)
+	return true, nil
+}
+
+func (hll *heldLeaderLease) Release(ctx context.Context) error {
+	atomic.AddInt32(&hll.releases, 1)
+	return nil
+}
+
+func TestLeaderElectionDescriptorDelegateDoneWithRunningProcess(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lease := &heldLeaderLease{}
+
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	p := scheduler.ProcessFunc(func(ctx context.Context) error {
+		close(started)
+
+		select {
+		case <-finish:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+
+	lc := scheduler.NewSegment(1, []scheduler.Descriptor{
+		scheduler.NewLeaderElectionDescriptor(scheduler.NewImmediateDescriptor(p), lease,
+			scheduler.LeaderElectionDescriptorWithRetryPeriod(time.Millisecond),
+		),
+	}).Start(scheduler.LifecycleStartOptions{})
+	defer lc.Close()
+
+	requireSignal(t, started, "process did not start")
+
+	// The delegate has terminated, but the lease is renewed and held while its
+	// process runs.
+	renewals := atomic.LoadInt32(&lease.renewals)
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt32(&lease.renewals) > renewals+2
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&lease.releases))
+
+	close(finish)
+	require.NoError(t, scheduler.WaitContext(ctx, lc))
+	assert.Empty(t, lc.Errs())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lease.releases))
+}
+
+func TestSQLLeaderLease(t *testing.T) {
+	ctx := context.Background()
+
+	db := newSQLQueueTestDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE scheduler_leases (
+			name VARCHAR(255) PRIMARY KEY,
+			holder VARCHAR(255) NOT NULL,
+			expires_at BIGINT NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	fc := testclock.NewFakeClock(time.Now())
+	a := scheduler.NewSQLLeaderLease(db, "test", "a", scheduler.SQLLeaderLeaseWithClock(k8sext.NewClock(fc)))
+	b := scheduler.NewSQLLeaderLease(db, "test", "b", scheduler.SQLLeaderLeaseWithClock(k8sext.NewClock(fc)))
+	other := scheduler.NewSQLLeaderLease(db, "other", "b", scheduler.SQLLeaderLeaseWithClock(k8sext.NewClock(fc)))
+
+	held, err := a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = b.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	held, err = other.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	// Renewal extends the lease.
+	fc.Step(5 * time.Second)
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	fc.Step(5 * time.Second)
+	held, err = b.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// Once the lease expires, another process can take it over.
+	fc.Step(5 * time.Second)
+	held, err = b.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	// Releasing a lease we don't hold does nothing.
+	require.NoError(t, a.Release(ctx))
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	require.NoError(t, b.Release(ctx))
+	held, err = a.TryAcquireOrRenew(ctx, 10*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+}
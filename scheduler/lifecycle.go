@@ -25,6 +25,10 @@ type StartedLifecycle interface {
 type LifecycleStartOptions struct {
 	// Capturer is the error capturer for this lifecycle.
 	Capturer trackers.Capturer
+
+	// ProcessEventHandler is notified when processes run by this lifecycle
+	// start and finish.
+	ProcessEventHandler ProcessEventHandler
 }
 
 // Lifecycle represents a partially or fully configured scheduler instance.
@@ -38,8 +42,15 @@ type Lifecycle interface {
 
 // SchedulableLifecycle adapts a lifecycle to the Schedulable interface.
 func SchedulableLifecycle(l Lifecycle, opts LifecycleStartOptions) Schedulable {
+	return schedulableLifecycle(l, opts, nil)
+}
+
+func schedulableLifecycle(l Lifecycle, opts LifecycleStartOptions, set *startedLifecycleSet) Schedulable {
 	return SchedulableFunc(func(ctx context.Context, er ErrorReporter) {
 		sl := l.Start(opts)
+		if set != nil {
+			set.add(sl)
+		}
 
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"github.com/puppetlabs/leg/instrumentation/metrics"
+	"github.com/puppetlabs/leg/instrumentation/metrics/collectors"
+)
+
+const (
+	// MetricProcessesStarted is the name of the counter of processes that
+	// have started running.
+	MetricProcessesStarted = "scheduler_processes_started"
+
+	// MetricProcessesFinished is the name of the counter of processes that
+	// have finished running. It has a "status" label that is either
+	// "completed" or "failed".
+	MetricProcessesFinished = "scheduler_processes_finished"
+)
+
+// MetricsProcessEventHandler is a process event handler that publishes the
+// number of processes started, completed, and failed using the
+// instrumentation metrics package.
+//
+// Processes that are running at any given time are the difference between
+// the started and finished counters. To inspect the running processes
+// themselves, use NewSnapshotHandler.
+type MetricsProcessEventHandler struct {
+	started   collectors.Counter
+	completed collectors.Counter
+	failed    collectors.Counter
+}
+
+var _ ProcessEventHandler = &MetricsProcessEventHandler{}
+
+// OnProcessStart increments the started counter.
+func (mpeh *MetricsProcessEventHandler) OnProcessStart(ps ProcessSnapshot) {
+	mpeh.started.Inc()
+}
+
+// OnProcessDone increments the finished counter with the status of the
+// process.
+func (mpeh *MetricsProcessEventHandler) OnProcessDone(ps ProcessSnapshot, err error) {
+	if err != nil {
+		mpeh.failed.Inc()
+	} else {
+		mpeh.completed.Inc()
+	}
+}
+
+// NewMetricsProcessEventHandler registers the process counters with the given
+// metrics namespace and returns a process event handler that updates them.
+func NewMetricsProcessEventHandler(m *metrics.Metrics) (*MetricsProcessEventHandler, error) {
+	if err := m.RegisterCounter(MetricProcessesStarted, collectors.CounterOptions{
+		Description: "a count of scheduler processes started",
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := m.RegisterCounter(MetricProcessesFinished, collectors.CounterOptions{
+		Description: "a count of scheduler processes finished",
+		Labels:      []string{"status"},
+	}); err != nil {
+		return nil, err
+	}
+
+	return &MetricsProcessEventHandler{
+		started:   m.MustCounter(MetricProcessesStarted),
+		completed: m.MustCounter(MetricProcessesFinished, metrics.NewLabel("status", "completed")),
+		failed:    m.MustCounter(MetricProcessesFinished, metrics.NewLabel("status", "failed")),
+	}, nil
+}
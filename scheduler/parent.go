@@ -1,6 +1,24 @@
 package scheduler
 
+type startedParent struct {
+	StartedLifecycle
+	children *startedLifecycleSet
+}
+
+var _ Snapshotter = &startedParent{}
+var _ Drainer = &startedParent{}
+
+func (sp *startedParent) Snapshot() *Snapshot {
+	return sp.children.Snapshot()
+}
+
+func (sp *startedParent) Drain() {
+	sp.children.drain()
+}
+
 // Parent is a lifecycle that aggregates other lifecycles.
+//
+// Draining a parent drains each of its delegate lifecycles that support it.
 type Parent struct {
 	delegates     []Lifecycle
 	errorBehavior ErrorBehavior
@@ -19,12 +37,17 @@ func (p *Parent) WithErrorBehavior(errorBehavior ErrorBehavior) *Parent {
 // parallel and waits for them to terminate according to the specified error
 // behavior.
 func (p *Parent) Start(opts LifecycleStartOptions) StartedLifecycle {
+	children := &startedLifecycleSet{}
+
 	sd := make(ManySchedulableSlice, len(p.delegates))
 	for i, d := range p.delegates {
-		sd[i] = SchedulableLifecycle(d, opts)
+		sd[i] = schedulableLifecycle(d, opts, children)
 	}
 
-	return NewScheduler(sd).WithErrorBehavior(p.errorBehavior).Start(opts)
+	return &startedParent{
+		StartedLifecycle: NewScheduler(sd).WithErrorBehavior(p.errorBehavior).Start(opts),
+		children:         children,
+	}
 }
 
 // NewParent creates a new parent lifecycle comprised of the given delegate
@@ -0,0 +1,502 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/leg/datastructure"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+// ErrQueueFull is sent to the channel of a submission that is rejected or
+// evicted because the queue of a priority adhoc descriptor is full.
+var ErrQueueFull = errors.New("queue is full")
+
+// RejectionPolicy determines which submission a priority adhoc descriptor
+// discards when its queue is full.
+type RejectionPolicy int
+
+const (
+	// RejectionPolicyRejectNew discards the new submission.
+	RejectionPolicyRejectNew RejectionPolicy = iota
+
+	// RejectionPolicyEvictLowest discards the queued submission with the
+	// lowest effective priority to make room for the new submission, unless
+	// the new submission's priority is not higher, in which case the new
+	// submission is discarded.
+	RejectionPolicyEvictLowest
+)
+
+// PriorityAdhocDescriptorOptions contains fields that configure a priority
+// adhoc descriptor.
+type PriorityAdhocDescriptorOptions struct {
+	// MaxQueueLen is the maximum number of submissions that may be queued. If
+	// not positive, the queue is unbounded.
+	MaxQueueLen int
+
+	// RejectionPolicy determines how a submission is handled when the queue
+	// is full. If not specified, RejectionPolicyRejectNew is used.
+	RejectionPolicy RejectionPolicy
+
+	// AgingRate is the amount the priority of a queued submission increases
+	// for every second it waits. It prevents low-priority submissions from
+	// waiting indefinitely while higher-priority work continues to arrive. If
+	// not specified, priorities do not change.
+	AgingRate float64
+
+	// Clock is the clock used to age submissions and to enforce their
+	// deadlines. If not specified, the system clock is used.
+	Clock clock.Clock
+}
+
+// PriorityAdhocDescriptorOption is a setter for one or more priority adhoc
+// descriptor options.
+type PriorityAdhocDescriptorOption interface {
+	// ApplyToPriorityAdhocDescriptorOptions configures the specified priority
+	// adhoc descriptor options for this option.
+	ApplyToPriorityAdhocDescriptorOptions(target *PriorityAdhocDescriptorOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *PriorityAdhocDescriptorOptions) ApplyOptions(opts []PriorityAdhocDescriptorOption) {
+	for _, opt := range opts {
+		opt.ApplyToPriorityAdhocDescriptorOptions(o)
+	}
+}
+
+// PriorityAdhocDescriptorOptionFunc allows a function to be used as a priority
+// adhoc descriptor option.
+type PriorityAdhocDescriptorOptionFunc func(target *PriorityAdhocDescriptorOptions)
+
+var _ PriorityAdhocDescriptorOption = PriorityAdhocDescriptorOptionFunc(nil)
+
+// ApplyToPriorityAdhocDescriptorOptions configures the specified priority
+// adhoc descriptor options by calling this function.
+func (padof PriorityAdhocDescriptorOptionFunc) ApplyToPriorityAdhocDescriptorOptions(target *PriorityAdhocDescriptorOptions) {
+	padof(target)
+}
+
+// PriorityAdhocDescriptorWithMaxQueueLen bounds the queue to the specified
+// number of submissions, discarding submissions according to the specified
+// policy when it is full.
+func PriorityAdhocDescriptorWithMaxQueueLen(n int, policy RejectionPolicy) PriorityAdhocDescriptorOption {
+	return PriorityAdhocDescriptorOptionFunc(func(target *PriorityAdhocDescriptorOptions) {
+		target.MaxQueueLen = n
+		target.RejectionPolicy = policy
+	})
+}
+
+// PriorityAdhocDescriptorWithAgingRate changes the amount the priority of a
+// queued submission increases every second to the specified rate.
+func PriorityAdhocDescriptorWithAgingRate(rate float64) PriorityAdhocDescriptorOption {
+	return PriorityAdhocDescriptorOptionFunc(func(target *PriorityAdhocDescriptorOptions) {
+		target.AgingRate = rate
+	})
+}
+
+// PriorityAdhocDescriptorWithClock changes the clock to the specified one.
+func PriorityAdhocDescriptorWithClock(c clock.Clock) PriorityAdhocDescriptorOption {
+	return PriorityAdhocDescriptorOptionFunc(func(target *PriorityAdhocDescriptorOptions) {
+		target.Clock = c
+	})
+}
+
+// PrioritySubmitOptions contains fields that configure a single submission to
+// a priority adhoc descriptor.
+type PrioritySubmitOptions struct {
+	// Priority is the initial priority of the submission. Submissions with
+	// higher priorities are scheduled first.
+	Priority float64
+
+	// Deadline is the time by which the submission must be scheduled. If the
+	// deadline passes while the submission is queued, it is removed from the
+	// queue and context.DeadlineExceeded is sent to its channel.
+	Deadline time.Time
+
+	// Context allows the submission to be canceled. If the context is done
+	// while the submission is queued, it is removed from the queue and the
+	// context error is sent to its channel. If the context is done while the
+	// process is running, the context of the process is canceled.
+	Context context.Context
+}
+
+// PrioritySubmitOption is a setter for one or more priority submit options.
+type PrioritySubmitOption interface {
+	// ApplyToPrioritySubmitOptions configures the specified priority submit
+	// options for this option.
+	ApplyToPrioritySubmitOptions(target *PrioritySubmitOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *PrioritySubmitOptions) ApplyOptions(opts []PrioritySubmitOption) {
+	for _, opt := range opts {
+		opt.ApplyToPrioritySubmitOptions(o)
+	}
+}
+
+// PrioritySubmitOptionFunc allows a function to be used as a priority submit
+// option.
+type PrioritySubmitOptionFunc func(target *PrioritySubmitOptions)
+
+var _ PrioritySubmitOption = PrioritySubmitOptionFunc(nil)
+
+// ApplyToPrioritySubmitOptions configures the specified priority submit
+// options by calling this function.
+func (psof PrioritySubmitOptionFunc) ApplyToPrioritySubmitOptions(target *PrioritySubmitOptions) {
+	psof(target)
+}
+
+// PrioritySubmitWithPriority changes the priority of the submission to the
+// specified one.
+func PrioritySubmitWithPriority(priority float64) PrioritySubmitOption {
+	return PrioritySubmitOptionFunc(func(target *PrioritySubmitOptions) {
+		target.Priority = priority
+	})
+}
+
+// PrioritySubmitWithDeadline changes the time by which the submission must be
+// scheduled to the specified one.
+func PrioritySubmitWithDeadline(deadline time.Time) PrioritySubmitOption {
+	return PrioritySubmitOptionFunc(func(target *PrioritySubmitOptions) {
+		target.Deadline = deadline
+	})
+}
+
+// PrioritySubmitWithContext allows the submission to be canceled using the
+// specified context.
+func PrioritySubmitWithContext(ctx context.Context) PrioritySubmitOption {
+	return PrioritySubmitOptionFunc(func(target *PrioritySubmitOptions) {
+		target.Context = ctx
+	})
+}
+
+// contextBoundProcess cancels the context of a process when another context is
+// done.
+type contextBoundProcess struct {
+	ctx      context.Context
+	delegate Process
+}
+
+var _ Process = &contextBoundProcess{}
+
+func (cbp *contextBoundProcess) Description() string {
+	return cbp.delegate.Description()
+}
+
+func (cbp *contextBoundProcess) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-cbp.ctx.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return cbp.delegate.Run(ctx)
+}
+
+// priorityAdhocItem is a submission to a priority adhoc descriptor.
+type priorityAdhocItem struct {
+	process *adhocProcess
+
+	// key is the priority of the item in the queue. It accounts for aging.
+	key float64
+
+	deadline time.Time
+	ctx      context.Context
+
+	timer clock.Timer
+	done  chan struct{}
+}
+
+// expired returns the error to send to the submitter if the item's deadline
+// has passed or its context is done.
+func (pai *priorityAdhocItem) expired(now time.Time) error {
+	if !pai.deadline.IsZero() && !pai.deadline.After(now) {
+		return context.DeadlineExceeded
+	}
+	if pai.ctx != nil {
+		return pai.ctx.Err()
+	}
+	return nil
+}
+
+// finish releases the resources used to monitor a queued item once it leaves
+// the queue for good.
+func (pai *priorityAdhocItem) finish() {
+	if pai.timer != nil {
+		pai.timer.Stop()
+	}
+	close(pai.done)
+}
+
+// PriorityAdhocDescriptor is a descriptor that allows external access to
+// submit work to be scheduled in priority order. It is paired with a
+// PriorityAdhocSubmitter, which should be provided to external clients to
+// receive the work.
+//
+// The order of submissions with the same effective priority is not specified.
+type PriorityAdhocDescriptor struct {
+	maxQueueLen     int
+	rejectionPolicy RejectionPolicy
+	agingRate       float64
+	clock           clock.Clock
+	epoch           time.Time
+
+	cond  *sync.Cond
+	queue *datastructure.PriorityQueue
+
+	// queued contains the items that are still waiting to be scheduled. Items
+	// removed from the queue because they were canceled remain in the
+	// priority queue until they are polled, so this set is authoritative.
+	queued map[*priorityAdhocItem]struct{}
+}
+
+var _ Descriptor = &PriorityAdhocDescriptor{}
+var _ QueueLener = &PriorityAdhocDescriptor{}
+
+// key computes the queue priority of a submission made at the given time.
+//
+// An aged priority is priority + rate * (now - submitted). The term rate * now
+// is the same for every item in the queue, so we can order items by priority -
+// rate * submitted without ever having to update them.
+func (pad *PriorityAdhocDescriptor) key(priority float64, submitted time.Time) float64 {
+	return priority - pad.agingRate*submitted.Sub(pad.epoch).Seconds()
+}
+
+// dequeue removes an item from the set of queued items. The caller must hold
+// the lock.
+func (pad *PriorityAdhocDescriptor) dequeue(item *priorityAdhocItem) bool {
+	if _, found := pad.queued[item]; !found {
+		return false
+	}
+
+	delete(pad.queued, item)
+	if len(pad.queued) == 0 {
+		// Drop any canceled items that are still in the priority queue.
+		pad.queue.Clear()
+	}
+
+	return true
+}
+
+// discard removes a queued item without running it, notifying the submitter
+// of the given error. The caller must hold the lock.
+func (pad *PriorityAdhocDescriptor) discard(item *priorityAdhocItem, err error) {
+	if pad.dequeue(item) {
+		item.finish()
+		item.process.ch <- err
+	}
+}
+
+func (pad *PriorityAdhocDescriptor) discardWithLock(item *priorityAdhocItem, err error) {
+	pad.cond.L.Lock()
+	defer pad.cond.L.Unlock()
+
+	pad.discard(item, err)
+}
+
+func (pad *PriorityAdhocDescriptor) lowest() *priorityAdhocItem {
+	var lowest *priorityAdhocItem
+	for item := range pad.queued {
+		if lowest == nil || item.key < lowest.key {
+			lowest = item
+		}
+	}
+	return lowest
+}
+
+func (pad *PriorityAdhocDescriptor) enqueue(item *priorityAdhocItem) {
+	pad.queued[item] = struct{}{}
+	pad.queue.Add(item, item.key)
+	pad.cond.Signal()
+}
+
+func (pad *PriorityAdhocDescriptor) runOnce(ctx context.Context) (*priorityAdhocItem, bool) {
+	pad.cond.L.Lock()
+	defer pad.cond.L.Unlock()
+
+	for {
+		for len(pad.queued) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, false
+			default:
+			}
+
+			pad.cond.Wait()
+		}
+
+		var next *priorityAdhocItem
+		for pad.queue.PollInto(&next) {
+			if pad.dequeue(next) {
+				return next, true
+			}
+		}
+	}
+}
+
+// QueueLen returns the number of work items in this descriptor's queue.
+func (pad *PriorityAdhocDescriptor) QueueLen() int {
+	pad.cond.L.Lock()
+	defer pad.cond.L.Unlock()
+
+	return len(pad.queued)
+}
+
+// Run executes this descriptor with the given process channel.
+func (pad *PriorityAdhocDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	go func() {
+		select {
+		case <-doneCh:
+		case <-ctx.Done():
+			// As with AdhocDescriptor, we don't know which waiter belongs to
+			// this context, so we have to wake all of them.
+			pad.cond.L.Lock()
+			defer pad.cond.L.Unlock()
+
+			pad.cond.Broadcast()
+		}
+	}()
+
+	for {
+		item, ok := pad.runOnce(ctx)
+		if !ok {
+			break
+		}
+
+		select {
+		case pc <- item.process:
+			item.finish()
+		case <-ctx.Done():
+			// Put the item back so another descriptor run can pick it up,
+			// unless it expired while we were trying to schedule it.
+			pad.cond.L.Lock()
+			if err := item.expired(pad.clock.Now()); err != nil {
+				item.finish()
+				item.process.ch <- err
+			} else {
+				pad.enqueue(item)
+			}
+			pad.cond.L.Unlock()
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// PriorityAdhocSubmitter is used to submit work to a priority adhoc
+// descriptor.
+type PriorityAdhocSubmitter struct {
+	target *PriorityAdhocDescriptor
+}
+
+// QueueLen returns the number of work items in the descriptor's queue. These
+// items have not yet been submitted to the scheduler for processing.
+func (pas *PriorityAdhocSubmitter) QueueLen() int {
+	return pas.target.QueueLen()
+}
+
+// Submit adds a new work item to the descriptor's queue. The result of the
+// process, or the reason it was discarded without running, is sent to the
+// returned channel.
+func (pas *PriorityAdhocSubmitter) Submit(p Process, opts ...PrioritySubmitOption) <-chan error {
+	o := &PrioritySubmitOptions{}
+	o.ApplyOptions(opts)
+
+	ch := make(chan error, 1)
+
+	if o.Context != nil {
+		select {
+		case <-o.Context.Done():
+			ch <- o.Context.Err()
+			return ch
+		default:
+		}
+
+		p = &contextBoundProcess{ctx: o.Context, delegate: p}
+	}
+
+	pad := pas.target
+	now := pad.clock.Now()
+
+	if !o.Deadline.IsZero() && !o.Deadline.After(now) {
+		ch <- context.DeadlineExceeded
+		return ch
+	}
+
+	item := &priorityAdhocItem{
+		process:  &adhocProcess{delegate: p, ch: ch},
+		key:      pad.key(o.Priority, now),
+		deadline: o.Deadline,
+		ctx:      o.Context,
+		done:     make(chan struct{}),
+	}
+
+	pad.cond.L.Lock()
+	defer pad.cond.L.Unlock()
+
+	if pad.maxQueueLen > 0 && len(pad.queued) >= pad.maxQueueLen {
+		switch lowest := pad.lowest(); {
+		case pad.rejectionPolicy == RejectionPolicyEvictLowest && lowest.key < item.key:
+			pad.discard(lowest, ErrQueueFull)
+		default:
+			ch <- ErrQueueFull
+			return ch
+		}
+	}
+
+	pad.enqueue(item)
+
+	if !o.Deadline.IsZero() {
+		item.timer = clock.AfterFunc(pad.clock, o.Deadline.Sub(now), func() {
+			pad.discardWithLock(item, context.DeadlineExceeded)
+		})
+	}
+
+	if o.Context != nil {
+		go func() {
+			select {
+			case <-item.ctx.Done():
+				pad.discardWithLock(item, item.ctx.Err())
+			case <-item.done:
+			}
+		}()
+	}
+
+	return ch
+}
+
+// NewPriorityAdhocDescriptor returns a bound pair of priority adhoc descriptor
+// and submitter. Submitting work items through the returned submitter will
+// enqueue them to the returned descriptor.
+func NewPriorityAdhocDescriptor(opts ...PriorityAdhocDescriptorOption) (*PriorityAdhocDescriptor, *PriorityAdhocSubmitter) {
+	o := &PriorityAdhocDescriptorOptions{
+		Clock: clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	pad := &PriorityAdhocDescriptor{
+		maxQueueLen:     o.MaxQueueLen,
+		rejectionPolicy: o.RejectionPolicy,
+		agingRate:       o.AgingRate,
+		clock:           o.Clock,
+		epoch:           o.Clock.Now(),
+		cond:            sync.NewCond(&sync.Mutex{}),
+		queue:           datastructure.NewPriorityQueue(),
+		queued:          make(map[*priorityAdhocItem]struct{}),
+	}
+	pas := &PriorityAdhocSubmitter{target: pad}
+
+	return pad, pas
+}
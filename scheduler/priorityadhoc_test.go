@@ -0,0 +1,215 @@
+package scheduler_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+type orderRecorder struct {
+	mut   sync.Mutex
+	order []string
+}
+
+func (or *orderRecorder) process(name string) scheduler.Process {
+	return scheduler.DescribeProcessFunc(name, func(ctx context.Context) error {
+		or.mut.Lock()
+		defer or.mut.Unlock()
+
+		or.order = append(or.order, name)
+		return nil
+	})
+}
+
+func (or *orderRecorder) Order() []string {
+	or.mut.Lock()
+	defer or.mut.Unlock()
+
+	return append([]string{}, or.order...)
+}
+
+func receiveResult(t *testing.T, ctx context.Context, ch <-chan error) error {
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		require.Fail(t, "context expired waiting for result")
+		return nil
+	}
+}
+
+func runPriorityAdhocDescriptor(t *testing.T, pad *scheduler.PriorityAdhocDescriptor) {
+	slc := scheduler.
+		NewSegment(1, []scheduler.Descriptor{pad}).
+		WithErrorBehavior(scheduler.ErrorBehaviorDrop).
+		Start(scheduler.LifecycleStartOptions{})
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		assert.NoError(t, scheduler.CloseWaitContext(ctx, slc))
+		assert.Empty(t, slc.Errs())
+	})
+}
+
+func TestPriorityAdhocOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pad, pas := scheduler.NewPriorityAdhocDescriptor()
+
+	var rec orderRecorder
+	chs := []<-chan error{
+		pas.Submit(rec.process("low"), scheduler.PrioritySubmitWithPriority(1)),
+		pas.Submit(rec.process("high"), scheduler.PrioritySubmitWithPriority(10)),
+		pas.Submit(rec.process("medium"), scheduler.PrioritySubmitWithPriority(5)),
+	}
+	assert.Equal(t, 3, pas.QueueLen())
+
+	runPriorityAdhocDescriptor(t, pad)
+
+	for _, ch := range chs {
+		assert.NoError(t, receiveResult(t, ctx, ch))
+	}
+	assert.Equal(t, []string{"high", "medium", "low"}, rec.Order())
+}
+
+func TestPriorityAdhocAging(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+	pad, pas := scheduler.NewPriorityAdhocDescriptor(
+		scheduler.PriorityAdhocDescriptorWithAgingRate(1),
+		scheduler.PriorityAdhocDescriptorWithClock(k8sext.NewClock(fc)),
+	)
+
+	var rec orderRecorder
+	old := pas.Submit(rec.process("old"), scheduler.PrioritySubmitWithPriority(1))
+
+	// After 10 seconds, the old submission has an effective priority of 11.
+	fc.Step(10 * time.Second)
+	fresh := pas.Submit(rec.process("fresh"), scheduler.PrioritySubmitWithPriority(5))
+	urgent := pas.Submit(rec.process("urgent"), scheduler.PrioritySubmitWithPriority(20))
+
+	runPriorityAdhocDescriptor(t, pad)
+
+	for _, ch := range []<-chan error{old, fresh, urgent} {
+		assert.NoError(t, receiveResult(t, ctx, ch))
+	}
+	assert.Equal(t, []string{"urgent", "old", "fresh"}, rec.Order())
+}
+
+func TestPriorityAdhocDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+	_, pas := scheduler.NewPriorityAdhocDescriptor(
+		scheduler.PriorityAdhocDescriptorWithClock(k8sext.NewClock(fc)),
+	)
+
+	var rec orderRecorder
+	ch := pas.Submit(rec.process("p1"), scheduler.PrioritySubmitWithDeadline(fc.Now().Add(time.Second)))
+	require.Equal(t, 1, pas.QueueLen())
+
+	fc.Step(2 * time.Second)
+	assert.Equal(t, context.DeadlineExceeded, receiveResult(t, ctx, ch))
+	assert.Equal(t, 0, pas.QueueLen())
+
+	// A deadline in the past is rejected immediately.
+	ch = pas.Submit(rec.process("p2"), scheduler.PrioritySubmitWithDeadline(fc.Now()))
+	assert.Equal(t, context.DeadlineExceeded, receiveResult(t, ctx, ch))
+	assert.Empty(t, rec.Order())
+}
+
+func TestPriorityAdhocCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pad, pas := scheduler.NewPriorityAdhocDescriptor()
+
+	var rec orderRecorder
+
+	sctx, scancel := context.WithCancel(ctx)
+	canceled := pas.Submit(rec.process("canceled"), scheduler.PrioritySubmitWithContext(sctx), scheduler.PrioritySubmitWithPriority(10))
+	kept := pas.Submit(rec.process("kept"), scheduler.PrioritySubmitWithPriority(5))
+
+	scancel()
+	assert.Equal(t, context.Canceled, receiveResult(t, ctx, canceled))
+	assert.Equal(t, 1, pas.QueueLen())
+
+	// Canceling a running submission cancels the process context.
+	started := make(chan struct{})
+	rctx, rcancel := context.WithCancel(ctx)
+	running := pas.Submit(scheduler.ProcessFunc(func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}), scheduler.PrioritySubmitWithContext(rctx))
+
+	runPriorityAdhocDescriptor(t, pad)
+
+	assert.NoError(t, receiveResult(t, ctx, kept))
+
+	select {
+	case <-started:
+	case <-ctx.Done():
+		require.Fail(t, "process did not start")
+	}
+	rcancel()
+	assert.Equal(t, context.Canceled, receiveResult(t, ctx, running))
+
+	assert.Equal(t, []string{"kept"}, rec.Order())
+}
+
+func TestPriorityAdhocRejectionPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("Reject new", func(t *testing.T) {
+		_, pas := scheduler.NewPriorityAdhocDescriptor(
+			scheduler.PriorityAdhocDescriptorWithMaxQueueLen(2, scheduler.RejectionPolicyRejectNew),
+		)
+
+		var rec orderRecorder
+		pas.Submit(rec.process("p1"))
+		pas.Submit(rec.process("p2"))
+
+		ch := pas.Submit(rec.process("p3"), scheduler.PrioritySubmitWithPriority(100))
+		assert.Equal(t, scheduler.ErrQueueFull, receiveResult(t, ctx, ch))
+		assert.Equal(t, 2, pas.QueueLen())
+	})
+
+	t.Run("Evict lowest", func(t *testing.T) {
+		pad, pas := scheduler.NewPriorityAdhocDescriptor(
+			scheduler.PriorityAdhocDescriptorWithMaxQueueLen(2, scheduler.RejectionPolicyEvictLowest),
+		)
+
+		var rec orderRecorder
+		low := pas.Submit(rec.process("low"), scheduler.PrioritySubmitWithPriority(1))
+		medium := pas.Submit(rec.process("medium"), scheduler.PrioritySubmitWithPriority(5))
+
+		high := pas.Submit(rec.process("high"), scheduler.PrioritySubmitWithPriority(10))
+		assert.Equal(t, scheduler.ErrQueueFull, receiveResult(t, ctx, low))
+
+		// A submission with a lower priority than everything in the queue is
+		// rejected instead.
+		lowest := pas.Submit(rec.process("lowest"), scheduler.PrioritySubmitWithPriority(0))
+		assert.Equal(t, scheduler.ErrQueueFull, receiveResult(t, ctx, lowest))
+		assert.Equal(t, 2, pas.QueueLen())
+
+		runPriorityAdhocDescriptor(t, pad)
+
+		assert.NoError(t, receiveResult(t, ctx, high))
+		assert.NoError(t, receiveResult(t, ctx, medium))
+		assert.Equal(t, []string{"high", "medium"}, rec.Order())
+	})
+}
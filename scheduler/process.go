@@ -4,7 +4,6 @@ import (
 	"context"
 
 	"github.com/puppetlabs/leg/instrumentation/alerts/trackers"
-	logging "github.com/puppetlabs/leg/logging"
 	"github.com/puppetlabs/leg/request"
 )
 
@@ -36,17 +35,35 @@ func SchedulableProcess(p Process) Schedulable {
 		capturer, _ := trackers.CapturerFromContext(ctx)
 		capturer = coalesceCapturer(capturer)
 
-		req := request.New()
+		// If the scheduler is running on behalf of another request, such as a
+		// parent process or an HTTP request, each process is a child span of
+		// its trace.
+		var req *request.Request
+		if parent, ok := request.FromContext(ctx); ok {
+			req = request.NewChild(parent)
+		} else {
+			req = request.New()
+		}
 
 		ctx = request.NewContext(ctx, req)
-		ctx = logging.NewContext(ctx, "request", req.Identifier)
 
 		log(ctx).Debug("process running", "description", p.Description())
 
+		var perr error
+
+		tracker, ok := processTrackerFromContext(ctx)
+		if ok {
+			ps := tracker.start(req, p)
+			defer func() {
+				tracker.done(req, ps, perr)
+			}()
+		}
+
 		err := capturer.Try(ctx, func(ctx context.Context) {
 			if err := p.Run(ctx); err != nil {
 				log(ctx).Warn("process failed", "error", err)
 
+				perr = err
 				er.Put(processError(req, p, err))
 				capturer.Capture(err).AsWarning().Report(ctx)
 			} else {
@@ -55,7 +72,9 @@ func SchedulableProcess(p Process) Schedulable {
 		})
 		if err != nil {
 			log(ctx).Crit("process panic()!", "error", err)
-			er.Put(processError(req, p, coercePanic(err)))
+
+			perr = coercePanic(err)
+			er.Put(processError(req, p, perr))
 		}
 	})
 }
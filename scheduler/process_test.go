@@ -0,0 +1,64 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/puppetlabs/leg/request"
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errorCollector struct {
+	errs []error
+}
+
+func (ec *errorCollector) Put(err error) {
+	ec.errs = append(ec.errs, err)
+}
+
+func runRequestRecordingProcess(ctx context.Context, err error) (*request.Request, []error) {
+	var req *request.Request
+	p := scheduler.ProcessFunc(func(ctx context.Context) error {
+		req, _ = request.FromContext(ctx)
+		return err
+	})
+
+	ec := &errorCollector{}
+	scheduler.SchedulableProcess(p).Run(ctx, ec)
+	return req, ec.errs
+}
+
+func TestSchedulableProcessChildSpan(t *testing.T) {
+	parent := request.New()
+	ctx := request.NewContext(context.Background(), parent)
+
+	errBoom := errors.New("boom")
+	req, errs := runRequestRecordingProcess(ctx, errBoom)
+	require.NotNil(t, req)
+
+	assert.NotEqual(t, parent.Identifier, req.Identifier)
+	assert.Equal(t, parent.TraceID, req.TraceID)
+	assert.Equal(t, parent.SpanID, req.ParentSpanID)
+	assert.NotEqual(t, parent.SpanID, req.SpanID)
+
+	// The error refers to the child span.
+	require.Len(t, errs, 1)
+
+	var perr *scheduler.ProcessError
+	require.True(t, errors.As(errs[0], &perr))
+	assert.Equal(t, req, perr.Request)
+	assert.Equal(t, errBoom, perr.Cause)
+}
+
+func TestSchedulableProcessNewTrace(t *testing.T) {
+	req, errs := runRequestRecordingProcess(context.Background(), nil)
+	require.NotNil(t, req)
+	assert.Empty(t, errs)
+
+	assert.True(t, req.TraceID.IsValid())
+	assert.True(t, req.SpanID.IsValid())
+	assert.False(t, req.ParentSpanID.IsValid())
+}
@@ -0,0 +1,359 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+// ErrRateLimited is returned by a rate limiter that rejects a process instead
+// of delaying it.
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimiter controls the throughput of processes.
+type RateLimiter interface {
+	// Wait blocks until the given process is permitted to run. It returns an
+	// error if the process may not run, either because the context is done or
+	// because the rate limiter rejects it.
+	Wait(ctx context.Context, p Process) error
+}
+
+// RateLimiterOptions contains fields that configure the rate limiters in this
+// package.
+type RateLimiterOptions struct {
+	// Clock is the clock used to measure the rate of processes and to delay
+	// them. If not specified, the system clock is used.
+	Clock clock.Clock
+}
+
+// RateLimiterOption is a setter for one or more rate limiter options.
+type RateLimiterOption interface {
+	// ApplyToRateLimiterOptions configures the specified rate limiter options
+	// for this option.
+	ApplyToRateLimiterOptions(target *RateLimiterOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *RateLimiterOptions) ApplyOptions(opts []RateLimiterOption) {
+	for _, opt := range opts {
+		opt.ApplyToRateLimiterOptions(o)
+	}
+}
+
+// RateLimiterOptionFunc allows a function to be used as a rate limiter option.
+type RateLimiterOptionFunc func(target *RateLimiterOptions)
+
+var _ RateLimiterOption = RateLimiterOptionFunc(nil)
+
+// ApplyToRateLimiterOptions configures the specified rate limiter options by
+// calling this function.
+func (rlof RateLimiterOptionFunc) ApplyToRateLimiterOptions(target *RateLimiterOptions) {
+	rlof(target)
+}
+
+// RateLimiterWithClock changes the clock to the specified one.
+func RateLimiterWithClock(c clock.Clock) RateLimiterOption {
+	return RateLimiterOptionFunc(func(target *RateLimiterOptions) {
+		target.Clock = c
+	})
+}
+
+func newRateLimiterOptions(opts []RateLimiterOption) *RateLimiterOptions {
+	o := &RateLimiterOptions{
+		Clock: clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+	return o
+}
+
+func waitUntil(ctx context.Context, c clock.Clock, d time.Duration) error {
+	t := c.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C():
+		return nil
+	}
+}
+
+// TokenBucketRateLimiter permits processes to run as long as tokens are
+// available in a bucket. The bucket starts full and is refilled at a constant
+// rate up to its capacity, so bursts of processes may run immediately after a
+// period of inactivity.
+type TokenBucketRateLimiter struct {
+	interval time.Duration
+	burst    int
+	clock    clock.Clock
+
+	mut    sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var _ RateLimiter = &TokenBucketRateLimiter{}
+
+func (tb *TokenBucketRateLimiter) refill(now time.Time) {
+	if tb.last.IsZero() {
+		tb.tokens = float64(tb.burst)
+	} else if elapsed := now.Sub(tb.last); elapsed > 0 {
+		tb.tokens += float64(elapsed) / float64(tb.interval)
+	}
+
+	if tb.tokens > float64(tb.burst) {
+		tb.tokens = float64(tb.burst)
+	}
+	tb.last = now
+}
+
+// Wait takes a token from the bucket, blocking until one is available.
+func (tb *TokenBucketRateLimiter) Wait(ctx context.Context, p Process) error {
+	tb.mut.Lock()
+	tb.refill(tb.clock.Now())
+
+	// We reserve the token now, even if it has not yet been added to the
+	// bucket, so that waiting processes run in order.
+	tb.tokens--
+
+	var d time.Duration
+	if tb.tokens < 0 {
+		d = time.Duration(-tb.tokens * float64(tb.interval))
+	}
+	tb.mut.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	if err := waitUntil(ctx, tb.clock, d); err != nil {
+		tb.mut.Lock()
+		defer tb.mut.Unlock()
+
+		// Return our reservation.
+		tb.refill(tb.clock.Now())
+		tb.tokens++
+		if tb.tokens > float64(tb.burst) {
+			tb.tokens = float64(tb.burst)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// NewTokenBucketRateLimiter creates a new token bucket rate limiter that adds a
+// token to the bucket every interval and holds at most burst tokens.
+func NewTokenBucketRateLimiter(interval time.Duration, burst int, opts ...RateLimiterOption) *TokenBucketRateLimiter {
+	o := newRateLimiterOptions(opts)
+
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &TokenBucketRateLimiter{
+		interval: interval,
+		burst:    burst,
+		clock:    o.Clock,
+	}
+}
+
+// LeakyBucketRateLimiter permits processes to run at a constant rate. Unlike
+// TokenBucketRateLimiter, it never permits bursts: consecutive processes are
+// always separated by at least the configured interval.
+//
+// Processes that must wait are queued in the bucket. If the bucket is full,
+// additional processes are rejected with ErrRateLimited.
+type LeakyBucketRateLimiter struct {
+	interval time.Duration
+	capacity int
+	clock    clock.Clock
+
+	mut     sync.Mutex
+	next    time.Time
+	waiting int
+}
+
+var _ RateLimiter = &LeakyBucketRateLimiter{}
+
+// Wait blocks until the process reaches the front of the queue, or returns
+// ErrRateLimited immediately if the queue is full.
+func (lb *LeakyBucketRateLimiter) Wait(ctx context.Context, p Process) error {
+	lb.mut.Lock()
+
+	now := lb.clock.Now()
+
+	at := lb.next
+	if at.Before(now) {
+		at = now
+	}
+
+	d := at.Sub(now)
+	if d > 0 {
+		if lb.capacity > 0 && lb.waiting >= lb.capacity {
+			lb.mut.Unlock()
+			return ErrRateLimited
+		}
+		lb.waiting++
+	}
+
+	lb.next = at.Add(lb.interval)
+	lb.mut.Unlock()
+
+	if d <= 0 {
+		return nil
+	}
+
+	err := waitUntil(ctx, lb.clock, d)
+
+	lb.mut.Lock()
+	defer lb.mut.Unlock()
+
+	lb.waiting--
+
+	// If no other process queued behind us, we can give our slot back.
+	if err != nil && lb.next.Equal(at.Add(lb.interval)) {
+		lb.next = at
+	}
+
+	return err
+}
+
+// NewLeakyBucketRateLimiter creates a new leaky bucket rate limiter that
+// permits one process to run every interval and queues at most capacity
+// processes. If capacity is not positive, the queue is unbounded.
+func NewLeakyBucketRateLimiter(interval time.Duration, capacity int, opts ...RateLimiterOption) *LeakyBucketRateLimiter {
+	o := newRateLimiterOptions(opts)
+
+	return &LeakyBucketRateLimiter{
+		interval: interval,
+		capacity: capacity,
+		clock:    o.Clock,
+	}
+}
+
+// KeyedRateLimiter applies a separate rate limit to each group of processes
+// that share a key, so that processes with one key do not consume the
+// throughput available to processes with another.
+//
+// A rate limiter is created the first time each key is seen and is retained for
+// the lifetime of the keyed rate limiter, so the set of keys should be bounded.
+type KeyedRateLimiter struct {
+	key     func(p Process) string
+	factory func(key string) RateLimiter
+
+	mut      sync.Mutex
+	limiters map[string]RateLimiter
+}
+
+var _ RateLimiter = &KeyedRateLimiter{}
+
+// Wait blocks until the rate limiter for the key of the given process permits
+// it to run.
+func (krl *KeyedRateLimiter) Wait(ctx context.Context, p Process) error {
+	key := krl.key(p)
+
+	krl.mut.Lock()
+	rl, found := krl.limiters[key]
+	if !found {
+		rl = krl.factory(key)
+		krl.limiters[key] = rl
+	}
+	krl.mut.Unlock()
+
+	return rl.Wait(ctx, p)
+}
+
+// NewKeyedRateLimiter creates a new rate limiter that derives a key from each
+// process using the given function and limits the processes of each key using
+// a rate limiter created by the given factory.
+func NewKeyedRateLimiter(key func(p Process) string, factory func(key string) RateLimiter) *KeyedRateLimiter {
+	return &KeyedRateLimiter{
+		key:      key,
+		factory:  factory,
+		limiters: make(map[string]RateLimiter),
+	}
+}
+
+// ProcessDescriptionKey uses the description of a process as its key. It is
+// suitable for use with NewKeyedRateLimiter.
+func ProcessDescriptionKey(p Process) string {
+	return p.Description()
+}
+
+type rateLimitedProcess struct {
+	delegate Process
+	limiter  RateLimiter
+}
+
+var _ Process = &rateLimitedProcess{}
+
+func (rlp *rateLimitedProcess) Description() string {
+	return rlp.delegate.Description()
+}
+
+func (rlp *rateLimitedProcess) Run(ctx context.Context) error {
+	if err := rlp.limiter.Wait(ctx, rlp.delegate); err != nil {
+		return err
+	}
+
+	return rlp.delegate.Run(ctx)
+}
+
+// NewRateLimitedProcess wraps the given process so that it waits for the given
+// rate limiter to permit it before running. If the rate limiter returns an
+// error, the process does not run and the error is returned instead.
+func NewRateLimitedProcess(p Process, rl RateLimiter) Process {
+	return &rateLimitedProcess{
+		delegate: p,
+		limiter:  rl,
+	}
+}
+
+// RateLimitedDescriptor wraps each process emitted by a delegate descriptor
+// using NewRateLimitedProcess. It allows rate limits to be applied to processes
+// run by any lifecycle.
+//
+// The processes are limited when they run, not when they are emitted, so a
+// process waiting for the rate limiter occupies a worker of the lifecycle that
+// runs it.
+type RateLimitedDescriptor struct {
+	delegate Descriptor
+	limiter  RateLimiter
+}
+
+var _ Descriptor = &RateLimitedDescriptor{}
+
+// Run runs the delegate descriptor, forwarding its processes to the given
+// channel. It terminates when the delegate terminates.
+func (rld *RateLimitedDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	ch := make(chan Process)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(ch)
+		errCh <- rld.delegate.Run(ctx, ch)
+	}()
+
+	for p := range ch {
+		select {
+		case <-ctx.Done():
+		case pc <- NewRateLimitedProcess(p, rld.limiter):
+		}
+	}
+
+	return <-errCh
+}
+
+// NewRateLimitedDescriptor creates a new descriptor that limits the processes
+// of the given descriptor using the given rate limiter.
+func NewRateLimitedDescriptor(delegate Descriptor, rl RateLimiter) *RateLimitedDescriptor {
+	return &RateLimitedDescriptor{
+		delegate: delegate,
+		limiter:  rl,
+	}
+}
@@ -0,0 +1,199 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+var noopProcess = scheduler.ProcessFunc(func(ctx context.Context) error { return nil })
+
+func waitAsync(ctx context.Context, rl scheduler.RateLimiter, p scheduler.Process) <-chan error {
+	ch := make(chan error, 1)
+	go func() {
+		ch <- rl.Wait(ctx, p)
+	}()
+	return ch
+}
+
+func requireBlocked(t *testing.T, ch <-chan error) {
+	select {
+	case err := <-ch:
+		require.Fail(t, "rate limiter did not block", "error: %+v", err)
+	default:
+	}
+}
+
+func requireDone(t *testing.T, ch <-chan error) error {
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "rate limiter did not unblock")
+		return nil
+	}
+}
+
+func TestTokenBucketRateLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	fc := testclock.NewFakeClock(time.Now())
+	rl := scheduler.NewTokenBucketRateLimiter(time.Second, 2, scheduler.RateLimiterWithClock(k8sext.NewClock(fc)))
+
+	// The bucket starts full.
+	require.NoError(t, rl.Wait(ctx, noopProcess))
+	require.NoError(t, rl.Wait(ctx, noopProcess))
+
+	ch := waitAsync(ctx, rl, noopProcess)
+	waitForTimer(t, fc)
+	requireBlocked(t, ch)
+
+	fc.Step(time.Second)
+	require.NoError(t, requireDone(t, ch))
+
+	// After a long period of inactivity, the bucket only holds its burst.
+	fc.Step(time.Minute)
+	require.NoError(t, rl.Wait(ctx, noopProcess))
+	require.NoError(t, rl.Wait(ctx, noopProcess))
+
+	ctx, cancel := context.WithCancel(ctx)
+	ch = waitAsync(ctx, rl, noopProcess)
+	waitForTimer(t, fc)
+	cancel()
+	assert.True(t, errors.Is(requireDone(t, ch), context.Canceled))
+
+	// The canceled reservation is returned to the bucket.
+	fc.Step(time.Second)
+	require.NoError(t, rl.Wait(context.Background(), noopProcess))
+}
+
+func TestLeakyBucketRateLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	fc := testclock.NewFakeClock(time.Now())
+	rl := scheduler.NewLeakyBucketRateLimiter(time.Second, 1, scheduler.RateLimiterWithClock(k8sext.NewClock(fc)))
+
+	require.NoError(t, rl.Wait(ctx, noopProcess))
+
+	// There is no burst, so the next process must wait.
+	ch := waitAsync(ctx, rl, noopProcess)
+	waitForTimer(t, fc)
+	requireBlocked(t, ch)
+
+	// The queue is full.
+	assert.Equal(t, scheduler.ErrRateLimited, rl.Wait(ctx, noopProcess))
+
+	fc.Step(time.Second)
+	require.NoError(t, requireDone(t, ch))
+
+	// The rate is constant even after a period of inactivity.
+	fc.Step(time.Minute)
+	require.NoError(t, rl.Wait(ctx, noopProcess))
+
+	ch = waitAsync(ctx, rl, noopProcess)
+	waitForTimer(t, fc)
+	requireBlocked(t, ch)
+
+	fc.Step(time.Second)
+	require.NoError(t, requireDone(t, ch))
+}
+
+func TestKeyedRateLimiter(t *testing.T) {
+	fc := testclock.NewFakeClock(time.Now())
+
+	var created int32
+	rl := scheduler.NewKeyedRateLimiter(scheduler.ProcessDescriptionKey, func(key string) scheduler.RateLimiter {
+		atomic.AddInt32(&created, 1)
+		return scheduler.NewTokenBucketRateLimiter(time.Minute, 1, scheduler.RateLimiterWithClock(k8sext.NewClock(fc)))
+	})
+
+	a := scheduler.DescribeProcessFunc("a", noopProcess)
+	b := scheduler.DescribeProcessFunc("b", noopProcess)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, rl.Wait(ctx, a))
+
+	ch := waitAsync(ctx, rl, a)
+	waitForTimer(t, fc)
+	requireBlocked(t, ch)
+
+	// Key b has its own bucket.
+	require.NoError(t, rl.Wait(ctx, b))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&created))
+
+	fc.Step(time.Minute)
+	require.NoError(t, requireDone(t, ch))
+}
+
+func TestSegmentRateLimiter(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+
+	var ran int32
+	process := scheduler.ProcessFunc(func(ctx context.Context) error {
+		atomic.AddInt32(&ran, 1)
+		return nil
+	})
+
+	lc := scheduler.NewSegment(4, []scheduler.Descriptor{
+		scheduler.DescriptorFunc(func(ctx context.Context, pc chan<- scheduler.Process) error {
+			for i := 0; i < 3; i++ {
+				select {
+				case <-ctx.Done():
+					return nil
+				case pc <- process:
+				}
+			}
+			return nil
+		}),
+	}).WithRateLimiter(scheduler.NewLeakyBucketRateLimiter(time.Second, 0, scheduler.RateLimiterWithClock(k8sext.NewClock(fc))))
+
+	slc := lc.Start(scheduler.LifecycleStartOptions{})
+	defer slc.Close()
+
+	for i := 1; i <= 3; i++ {
+		i := i
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&ran) == int32(i) }, 5*time.Second, time.Millisecond)
+
+		if i < 3 {
+			waitForTimer(t, fc)
+			fc.Step(time.Second)
+		}
+	}
+
+	require.NoError(t, scheduler.WaitContext(ctx, slc))
+	assert.Empty(t, slc.Errs())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&ran))
+}
+
+func TestRateLimitedDescriptor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	fc := testclock.NewFakeClock(time.Now())
+
+	lc := scheduler.NewSegment(2, []scheduler.Descriptor{
+		scheduler.NewRateLimitedDescriptor(
+			scheduler.NewImmediateDescriptor(noopProcess),
+			scheduler.NewLeakyBucketRateLimiter(time.Second, 0, scheduler.RateLimiterWithClock(k8sext.NewClock(fc))),
+		),
+	})
+
+	slc := lc.Start(scheduler.LifecycleStartOptions{})
+	defer slc.Close()
+
+	require.NoError(t, scheduler.WaitContext(ctx, slc))
+	assert.Empty(t, slc.Errs())
+}
@@ -0,0 +1,51 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/puppetlabs/leg/timeutil/pkg/iso8601"
+)
+
+// RecurringIntervalDescriptor schedules a process to run at the start of each
+// interval of an ISO 8601 recurring time interval, for example,
+// "R/2021-01-01T09:00:00Z/P1W" to run every week starting from a given time.
+//
+// If the recurring interval has a limited number of repetitions, the
+// descriptor terminates after the last one. Missed runs are handled according
+// to the descriptor's MissedRunPolicy.
+type RecurringIntervalDescriptor struct {
+	calendar *calendar
+}
+
+var _ Descriptor = &RecurringIntervalDescriptor{}
+
+// Run starts scheduling this descriptor's process to the given channel. It
+// terminates when the context terminates or when the recurring interval has no
+// further repetitions.
+func (rid *RecurringIntervalDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	return rid.calendar.run(ctx, pc)
+}
+
+// NewRecurringIntervalDescriptor creates a new descriptor that runs the given
+// process at the start of each interval of the given recurring interval.
+func NewRecurringIntervalDescriptor(ri iso8601.RecurringInterval, process Process, opts ...CalendarDescriptorOption) *RecurringIntervalDescriptor {
+	o := newCalendarDescriptorOptions(opts)
+
+	return &RecurringIntervalDescriptor{
+		calendar: &calendar{
+			next: func(after time.Time) (time.Time, bool) {
+				// Next returns the interval starting at or after the given
+				// time, but we only want the ones that start after it.
+				i, ok := ri.Next(after.Add(time.Nanosecond))
+				if !ok {
+					return time.Time{}, false
+				}
+				return i.Start(), true
+			},
+			process: process,
+			policy:  o.MissedRunPolicy,
+			clock:   o.Clock,
+		},
+	}
+}
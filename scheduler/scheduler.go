@@ -18,8 +18,15 @@ type SchedulerEventHandler interface {
 type SchedulerEventHandlerFuncs struct {
 	// OnDoneFunc is the function to call when the scheduler terminates.
 	OnDoneFunc func()
+
+	// OnCircuitBreakerStateChangeFunc is the function to call when a circuit
+	// breaker this handler is attached to changes state.
+	OnCircuitBreakerStateChangeFunc func(from, to CircuitBreakerState)
 }
 
+var _ SchedulerEventHandler = &SchedulerEventHandlerFuncs{}
+var _ CircuitBreakerEventHandler = &SchedulerEventHandlerFuncs{}
+
 // OnDone fires OnDoneFunc if non-nil.
 func (sehf *SchedulerEventHandlerFuncs) OnDone() {
 	if sehf.OnDoneFunc == nil {
@@ -29,6 +36,15 @@ func (sehf *SchedulerEventHandlerFuncs) OnDone() {
 	sehf.OnDoneFunc()
 }
 
+// OnCircuitBreakerStateChange fires OnCircuitBreakerStateChangeFunc if non-nil.
+func (sehf *SchedulerEventHandlerFuncs) OnCircuitBreakerStateChange(from, to CircuitBreakerState) {
+	if sehf.OnCircuitBreakerStateChangeFunc == nil {
+		return
+	}
+
+	sehf.OnCircuitBreakerStateChangeFunc(from, to)
+}
+
 type startedScheduler struct {
 	ctx           context.Context
 	cancel        context.CancelFunc
@@ -36,8 +52,11 @@ type startedScheduler struct {
 	waiter        chan struct{}
 	errorHandler  ErrorHandler
 	eventHandlers []SchedulerEventHandler
+	tracker       *processTracker
 }
 
+var _ Snapshotter = &startedScheduler{}
+
 func (ss *startedScheduler) Done() <-chan struct{} {
 	return ss.waiter
 }
@@ -55,6 +74,10 @@ func (ss *startedScheduler) Close() {
 	ss.cancel()
 }
 
+func (ss *startedScheduler) Snapshot() *Snapshot {
+	return ss.tracker.Snapshot()
+}
+
 func (ss *startedScheduler) supervise(i int, fn func(ctx context.Context, i int, er ErrorReporter)) {
 	defer func() {
 		close(ss.children[i])
@@ -120,6 +143,9 @@ func (s *Scheduler) Start(opts LifecycleStartOptions) StartedLifecycle {
 		ctx = trackers.NewContextWithCapturer(ctx, opts.Capturer)
 	}
 
+	tracker := newProcessTracker(opts.ProcessEventHandler)
+	ctx = withProcessTracker(ctx, tracker)
+
 	childrenLen := s.children.Len()
 
 	ss := &startedScheduler{
@@ -129,6 +155,7 @@ func (s *Scheduler) Start(opts LifecycleStartOptions) StartedLifecycle {
 		waiter:        make(chan struct{}),
 		errorHandler:  s.errorBehavior.NewHandler(),
 		eventHandlers: s.eventHandlers,
+		tracker:       tracker,
 	}
 
 	for i := 0; i < childrenLen; i++ {
@@ -2,8 +2,42 @@ package scheduler
 
 import (
 	"context"
+	"fmt"
+	"sync"
 )
 
+type startedSegment struct {
+	StartedLifecycle
+	descriptors []Descriptor
+	draining    chan struct{}
+	drainOnce   sync.Once
+}
+
+var _ Snapshotter = &startedSegment{}
+var _ Drainer = &startedSegment{}
+
+func (ss *startedSegment) Drain() {
+	ss.drainOnce.Do(func() { close(ss.draining) })
+}
+
+func (ss *startedSegment) Snapshot() *Snapshot {
+	s := &Snapshot{}
+	if snapshotter, ok := ss.StartedLifecycle.(Snapshotter); ok {
+		s.merge(snapshotter.Snapshot())
+	}
+
+	for _, d := range ss.descriptors {
+		if ql, ok := d.(QueueLener); ok {
+			s.Queues = append(s.Queues, QueueSnapshot{
+				Descriptor: fmt.Sprintf("%T", d),
+				Len:        ql.QueueLen(),
+			})
+		}
+	}
+
+	return s
+}
+
 // Segment is a bounded executor for processes.
 //
 // It manages a slice of descriptors, which are responsible for emitting the
@@ -16,11 +50,19 @@ import (
 // The concurrency of the segment defines the size of the worker pool that
 // handle processes. If all workers are busy, the channel used by descriptors to
 // emit processes will block until a process completes.
+//
+// A segment can be drained to stop its descriptors without interrupting the
+// processes its workers are running. Once the workers finish, the segment
+// terminates.
+//
+// A segment may also limit the throughput of its processes using a rate
+// limiter. A worker waits for the rate limiter before running each process.
 type Segment struct {
 	concurrency             int
 	descriptors             []Descriptor
 	descriptorErrorBehavior ErrorBehavior
 	processErrorBehavior    ErrorBehavior
+	rateLimiter             RateLimiter
 }
 
 var _ Lifecycle = &Segment{}
@@ -45,10 +87,19 @@ func (s *Segment) WithProcessErrorBehavior(behavior ErrorBehavior) *Segment {
 	return s
 }
 
+// WithRateLimiter sets the rate limiter for processes run by this segment. If
+// the rate limiter rejects a process, the rejection is handled according to
+// the process error behavior of the segment.
+func (s *Segment) WithRateLimiter(rl RateLimiter) *Segment {
+	s.rateLimiter = rl
+	return s
+}
+
 // Start starts this segment, creating a worker pool of size equal to the
 // concurrency of this segment and executing all descriptors.
 func (s *Segment) Start(opts LifecycleStartOptions) StartedLifecycle {
 	pc := make(chan Process)
+	rl := s.rateLimiter
 
 	// Bind the lifecycle all the way up here so we can close it in the worker.
 	ch := make(chan StartedLifecycle, 1)
@@ -61,6 +112,10 @@ func (s *Segment) Start(opts LifecycleStartOptions) StartedLifecycle {
 					return
 				}
 
+				if rl != nil {
+					proc = NewRateLimitedProcess(proc, rl)
+				}
+
 				SchedulableProcess(proc).Run(ctx, er)
 			case <-ctx.Done():
 				// We want to let the lifecycle know that we're preparing to
@@ -75,8 +130,16 @@ func (s *Segment) Start(opts LifecycleStartOptions) StartedLifecycle {
 		}
 	})
 
+	// Draining only terminates the descriptors. The workers finish any
+	// processes already emitted and then exit when the process channel
+	// closes.
+	draining := make(chan struct{})
+
 	// This scheduler runs all the descriptors.
-	ds := NewScheduler(ManySchedulableDescriptor(s.descriptors, pc)).
+	ds := NewScheduler(&drainManySchedulable{
+		delegate: ManySchedulableDescriptor(s.descriptors, pc),
+		draining: draining,
+	}).
 		WithErrorBehavior(s.descriptorErrorBehavior).
 		WithEventHandler(&SchedulerEventHandlerFuncs{
 			OnDoneFunc: func() { close(pc) },
@@ -92,7 +155,11 @@ func (s *Segment) Start(opts LifecycleStartOptions) StartedLifecycle {
 	// Let the worker know that we have the lifecycle now.
 	ch <- slc
 
-	return slc
+	return &startedSegment{
+		StartedLifecycle: slc,
+		descriptors:      s.descriptors,
+		draining:         draining,
+	}
 }
 
 // NewSegment creates a new segment with the given worker pool size
@@ -0,0 +1,288 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/leg/request"
+)
+
+// ProcessSnapshot describes a process that is running.
+type ProcessSnapshot struct {
+	// Description is the description of the process.
+	Description string `json:"description"`
+
+	// Request is the identifier of the request the process is running in. It
+	// corresponds to the request identifier in the logs of the process.
+	Request string `json:"request"`
+
+	// StartedAt is the time the process started running.
+	StartedAt time.Time `json:"started_at"`
+}
+
+// QueueSnapshot describes the work items queued by a descriptor.
+type QueueSnapshot struct {
+	// Descriptor is the type of the descriptor.
+	Descriptor string `json:"descriptor"`
+
+	// Len is the number of work items in the descriptor's queue.
+	Len int `json:"len"`
+}
+
+// Snapshot is a point-in-time view of the work being performed by a started
+// lifecycle and all of the lifecycles it manages.
+type Snapshot struct {
+	// Processes are the processes that are currently running, ordered by the
+	// time they started.
+	Processes []ProcessSnapshot `json:"processes"`
+
+	// Queues are the queues of descriptors that have work waiting to be
+	// scheduled.
+	Queues []QueueSnapshot `json:"queues"`
+
+	// Completed is the number of processes that have run successfully.
+	Completed uint64 `json:"completed"`
+
+	// Failed is the number of processes that have returned an error or
+	// panicked.
+	Failed uint64 `json:"failed"`
+}
+
+func (s *Snapshot) merge(other *Snapshot) {
+	s.Processes = append(s.Processes, other.Processes...)
+	s.Queues = append(s.Queues, other.Queues...)
+	s.Completed += other.Completed
+	s.Failed += other.Failed
+}
+
+func (s *Snapshot) sort() {
+	sort.SliceStable(s.Processes, func(i, j int) bool {
+		return s.Processes[i].StartedAt.Before(s.Processes[j].StartedAt)
+	})
+}
+
+// Snapshotter is implemented by started lifecycles that can report the work
+// they are performing. The started lifecycles returned by Scheduler, Segment,
+// and Parent implement this interface.
+type Snapshotter interface {
+	// Snapshot returns the current state of the lifecycle.
+	Snapshot() *Snapshot
+}
+
+// SnapshotOf returns the current state of the given started lifecycle. If the
+// lifecycle does not implement Snapshotter, the snapshot is empty.
+func SnapshotOf(slc StartedLifecycle) *Snapshot {
+	s := &Snapshot{
+		Processes: []ProcessSnapshot{},
+		Queues:    []QueueSnapshot{},
+	}
+
+	if snapshotter, ok := slc.(Snapshotter); ok {
+		s.merge(snapshotter.Snapshot())
+	}
+
+	s.sort()
+	return s
+}
+
+// QueueLener is implemented by descriptors that queue work, such as
+// AdhocDescriptor. A segment includes the queue lengths of its descriptors in
+// its snapshot.
+type QueueLener interface {
+	// QueueLen returns the number of work items in the descriptor's queue.
+	QueueLen() int
+}
+
+// ProcessEventHandler defines an interface by which a client can respond to
+// processes starting and finishing. It can be provided to a lifecycle using
+// LifecycleStartOptions.
+type ProcessEventHandler interface {
+	// OnProcessStart is fired when a process starts running.
+	OnProcessStart(ps ProcessSnapshot)
+
+	// OnProcessDone is fired when a process finishes running. If the process
+	// failed, err is the error it returned.
+	OnProcessDone(ps ProcessSnapshot, err error)
+}
+
+// ProcessEventHandlerFuncs allows a client to partially implement a process
+// event handler, choosing to receive only the events they provide handlers
+// for.
+type ProcessEventHandlerFuncs struct {
+	// OnProcessStartFunc is the function to call when a process starts.
+	OnProcessStartFunc func(ps ProcessSnapshot)
+
+	// OnProcessDoneFunc is the function to call when a process finishes.
+	OnProcessDoneFunc func(ps ProcessSnapshot, err error)
+}
+
+var _ ProcessEventHandler = &ProcessEventHandlerFuncs{}
+
+// OnProcessStart fires OnProcessStartFunc if non-nil.
+func (pehf *ProcessEventHandlerFuncs) OnProcessStart(ps ProcessSnapshot) {
+	if pehf.OnProcessStartFunc == nil {
+		return
+	}
+
+	pehf.OnProcessStartFunc(ps)
+}
+
+// OnProcessDone fires OnProcessDoneFunc if non-nil.
+func (pehf *ProcessEventHandlerFuncs) OnProcessDone(ps ProcessSnapshot, err error) {
+	if pehf.OnProcessDoneFunc == nil {
+		return
+	}
+
+	pehf.OnProcessDoneFunc(ps, err)
+}
+
+// processTracker records the processes run by a scheduler.
+type processTracker struct {
+	eventHandler ProcessEventHandler
+
+	mut       sync.Mutex
+	active    map[*request.Request]ProcessSnapshot
+	completed uint64
+	failed    uint64
+}
+
+func (pt *processTracker) start(req *request.Request, p Process) ProcessSnapshot {
+	ps := ProcessSnapshot{
+		Description: p.Description(),
+		Request:     req.Identifier,
+		StartedAt:   time.Now(),
+	}
+
+	pt.mut.Lock()
+	pt.active[req] = ps
+	pt.mut.Unlock()
+
+	if pt.eventHandler != nil {
+		pt.eventHandler.OnProcessStart(ps)
+	}
+
+	return ps
+}
+
+func (pt *processTracker) done(req *request.Request, ps ProcessSnapshot, err error) {
+	pt.mut.Lock()
+	delete(pt.active, req)
+	if err != nil {
+		pt.failed++
+	} else {
+		pt.completed++
+	}
+	pt.mut.Unlock()
+
+	if pt.eventHandler != nil {
+		pt.eventHandler.OnProcessDone(ps, err)
+	}
+}
+
+func (pt *processTracker) Snapshot() *Snapshot {
+	pt.mut.Lock()
+	defer pt.mut.Unlock()
+
+	s := &Snapshot{
+		Processes: make([]ProcessSnapshot, 0, len(pt.active)),
+		Completed: pt.completed,
+		Failed:    pt.failed,
+	}
+	for _, ps := range pt.active {
+		s.Processes = append(s.Processes, ps)
+	}
+	return s
+}
+
+func newProcessTracker(eh ProcessEventHandler) *processTracker {
+	return &processTracker{
+		eventHandler: eh,
+		active:       make(map[*request.Request]ProcessSnapshot),
+	}
+}
+
+type processTrackerContextKey struct{}
+
+func withProcessTracker(ctx context.Context, pt *processTracker) context.Context {
+	return context.WithValue(ctx, processTrackerContextKey{}, pt)
+}
+
+func processTrackerFromContext(ctx context.Context) (*processTracker, bool) {
+	pt, ok := ctx.Value(processTrackerContextKey{}).(*processTracker)
+	return pt, ok
+}
+
+// startedLifecycleSet collects the started lifecycles managed by another
+// lifecycle so that their snapshots can be aggregated and they can be drained.
+type startedLifecycleSet struct {
+	mut        sync.Mutex
+	lifecycles []StartedLifecycle
+	draining   bool
+}
+
+func (sls *startedLifecycleSet) add(slc StartedLifecycle) {
+	sls.mut.Lock()
+	defer sls.mut.Unlock()
+
+	sls.lifecycles = append(sls.lifecycles, slc)
+
+	// If we were asked to drain before this lifecycle started, we drain it
+	// now.
+	if drainer, ok := slc.(Drainer); ok && sls.draining {
+		drainer.Drain()
+	}
+}
+
+func (sls *startedLifecycleSet) drain() {
+	sls.mut.Lock()
+	defer sls.mut.Unlock()
+
+	sls.draining = true
+
+	for _, slc := range sls.lifecycles {
+		if drainer, ok := slc.(Drainer); ok {
+			drainer.Drain()
+		}
+	}
+}
+
+func (sls *startedLifecycleSet) Snapshot() *Snapshot {
+	sls.mut.Lock()
+	lifecycles := append([]StartedLifecycle{}, sls.lifecycles...)
+	sls.mut.Unlock()
+
+	s := &Snapshot{}
+	for _, slc := range lifecycles {
+		if snapshotter, ok := slc.(Snapshotter); ok {
+			s.merge(snapshotter.Snapshot())
+		}
+	}
+	return s
+}
+
+// NewSnapshotHandler returns an HTTP handler that responds with a JSON
+// representation of the current snapshot of the given started lifecycle. It is
+// intended to be mounted as a debug endpoint.
+func NewSnapshotHandler(slc StartedLifecycle) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", fmt.Sprintf("%s, %s", http.MethodGet, http.MethodHead))
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		b, err := json.Marshal(SnapshotOf(slc))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(b)
+	})
+}
@@ -0,0 +1,169 @@
+package scheduler_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/instrumentation/metrics"
+	"github.com/puppetlabs/leg/instrumentation/metrics/delegates"
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var started, done int32
+	eh := &scheduler.ProcessEventHandlerFuncs{
+		OnProcessStartFunc: func(ps scheduler.ProcessSnapshot) { atomic.AddInt32(&started, 1) },
+		OnProcessDoneFunc:  func(ps scheduler.ProcessSnapshot, err error) { atomic.AddInt32(&done, 1) },
+	}
+
+	ad, as := scheduler.NewAdhocDescriptor()
+	slc := scheduler.
+		NewParent(scheduler.NewSegment(1, []scheduler.Descriptor{ad})).
+		Start(scheduler.LifecycleStartOptions{ProcessEventHandler: eh})
+	defer func() {
+		assert.NoError(t, scheduler.CloseWaitContext(ctx, slc))
+	}()
+
+	running := make(chan struct{})
+	release := make(chan struct{})
+
+	p1 := as.Submit(scheduler.DescribeProcessFunc("blocked", func(ctx context.Context) error {
+		close(running)
+		<-release
+		return nil
+	}))
+	p2 := as.Submit(scheduler.DescribeProcessFunc("failing", func(ctx context.Context) error {
+		return fmt.Errorf("boom")
+	}))
+	p3 := as.Submit(scheduler.DescribeProcessFunc("succeeding", func(ctx context.Context) error {
+		return nil
+	}))
+
+	select {
+	case <-running:
+	case <-ctx.Done():
+		require.Fail(t, "process did not start")
+	}
+
+	// The descriptor is holding the second process, waiting for a worker, so
+	// only the third process is in its queue.
+	require.Eventually(t, func() bool { return as.QueueLen() == 1 }, 5*time.Second, time.Millisecond)
+
+	s := scheduler.SnapshotOf(slc)
+	require.Len(t, s.Processes, 1)
+	assert.Equal(t, "blocked", s.Processes[0].Description)
+	assert.NotEmpty(t, s.Processes[0].Request)
+	assert.False(t, s.Processes[0].StartedAt.IsZero())
+	assert.Equal(t, []scheduler.QueueSnapshot{{Descriptor: "*scheduler.AdhocDescriptor", Len: 1}}, s.Queues)
+	assert.Equal(t, uint64(0), s.Completed)
+	assert.Equal(t, uint64(0), s.Failed)
+
+	close(release)
+	for _, ch := range []<-chan error{p1, p2, p3} {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			require.Fail(t, "process did not complete")
+		}
+	}
+
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&done) == 3 }, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&started))
+
+	s = scheduler.SnapshotOf(slc)
+	assert.Empty(t, s.Processes)
+	assert.Equal(t, uint64(2), s.Completed)
+	assert.Equal(t, uint64(1), s.Failed)
+}
+
+func TestSnapshotHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	slc := scheduler.NewSegment(1, []scheduler.Descriptor{
+		scheduler.NewImmediateDescriptor(scheduler.DescribeProcessFunc("blocked", func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})),
+	}).Start(scheduler.LifecycleStartOptions{})
+	defer func() {
+		assert.NoError(t, scheduler.CloseWaitContext(ctx, slc))
+	}()
+
+	require.Eventually(t, func() bool { return len(scheduler.SnapshotOf(slc).Processes) == 1 }, 5*time.Second, time.Millisecond)
+
+	srv := httptest.NewServer(scheduler.NewSnapshotHandler(slc))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("content-type"))
+
+	var s scheduler.Snapshot
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&s))
+	require.Len(t, s.Processes, 1)
+	assert.Equal(t, "blocked", s.Processes[0].Description)
+
+	resp, err = http.Post(srv.URL, "application/json", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestMetricsProcessEventHandler(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Prometheus metrics are registered globally, so we need a unique
+	// namespace each time this test runs.
+	namespace := fmt.Sprintf("test_%d", time.Now().UnixNano())
+
+	m, err := metrics.NewNamespace(namespace, metrics.Options{
+		DelegateType:  delegates.PrometheusDelegate,
+		ErrorBehavior: metrics.ErrorBehaviorLog,
+	})
+	require.NoError(t, err)
+
+	eh, err := scheduler.NewMetricsProcessEventHandler(m)
+	require.NoError(t, err)
+
+	slc := scheduler.NewSegment(1, []scheduler.Descriptor{
+		scheduler.NewImmediateDescriptor(scheduler.ProcessFunc(func(ctx context.Context) error {
+			return nil
+		})),
+		scheduler.NewImmediateDescriptor(scheduler.ProcessFunc(func(ctx context.Context) error {
+			return fmt.Errorf("boom")
+		})),
+	}).Start(scheduler.LifecycleStartOptions{ProcessEventHandler: eh})
+	require.NoError(t, scheduler.WaitContext(ctx, slc))
+
+	srv := httptest.NewServer(m.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(b), namespace+"_scheduler_processes_started 2")
+	assert.Contains(t, string(b), namespace+`_scheduler_processes_finished{status="completed"} 1`)
+	assert.Contains(t, string(b), namespace+`_scheduler_processes_finished{status="failed"} 1`)
+}
@@ -0,0 +1,795 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/puppetlabs/leg/errmap/pkg/errmark"
+	"github.com/puppetlabs/leg/sqlutil"
+	"github.com/puppetlabs/leg/timeutil/pkg/backoff"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock"
+)
+
+var (
+	// ErrSQLJobNotFound is returned when a job does not exist in a SQL queue.
+	ErrSQLJobNotFound = errors.New("job not found")
+
+	// ErrSQLJobLeaseLost is returned when a job is acknowledged, retried, or
+	// moved to the dead-letter list after its lease expired and another worker
+	// leased it.
+	ErrSQLJobLeaseLost = errors.New("job lease lost")
+)
+
+// DefaultSQLQueueRetryBackoffFactory is an exponential backoff starting at 1
+// second with a factor of 2 and a 5 minute cap.
+var DefaultSQLQueueRetryBackoffFactory = backoff.Build(
+	backoff.Exponential(time.Second, 2.0),
+	backoff.MaxBound(5*time.Minute),
+)
+
+// SQLPlaceholderFunc returns the bind parameter placeholder for the ith
+// (1-indexed) parameter of a query.
+type SQLPlaceholderFunc func(i int) string
+
+var (
+	// SQLPlaceholderQuestion formats placeholders as "?". It is suitable for
+	// SQLite and MySQL.
+	SQLPlaceholderQuestion SQLPlaceholderFunc = func(i int) string { return "?" }
+
+	// SQLPlaceholderDollar formats placeholders as "$1", "$2", and so on. It is
+	// suitable for PostgreSQL.
+	SQLPlaceholderDollar SQLPlaceholderFunc = func(i int) string { return fmt.Sprintf("$%d", i) }
+)
+
+// formatSQLQuery replaces each "?" in the given query with a placeholder from
+// the given function and each "{table}" with the given table name.
+func formatSQLQuery(query, table string, pf SQLPlaceholderFunc) string {
+	query = strings.ReplaceAll(query, "{table}", table)
+
+	var b strings.Builder
+	i := 0
+	for _, c := range query {
+		if c == '?' {
+			i++
+			b.WriteString(pf(i))
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// SQLJob is a work item stored in a SQL queue.
+type SQLJob struct {
+	// ID is the unique identifier of the job.
+	ID string
+
+	// Queue is the name of the queue the job belongs to.
+	Queue string
+
+	// Payload is the data provided when the job was enqueued.
+	Payload []byte
+
+	// Attempts is the number of times the job has been leased, including the
+	// current lease.
+	Attempts int
+
+	// EnqueuedAt is the time the job was enqueued.
+	EnqueuedAt time.Time
+
+	// LastError is the error message from the most recent failed attempt, if
+	// any.
+	LastError string
+
+	// DeadAt is the time the job was moved to the dead-letter list. It is zero
+	// for jobs that are not dead.
+	DeadAt time.Time
+
+	lease string
+}
+
+// SQLQueueOptions contains fields that configure a SQL queue.
+type SQLQueueOptions struct {
+	// Table is the name of the table that stores jobs. If not specified,
+	// "scheduler_jobs" is used. It is interpolated directly into queries, so it
+	// must not come from untrusted input.
+	Table string
+
+	// PlaceholderFunc formats bind parameters for the database driver. If not
+	// specified, SQLPlaceholderQuestion is used.
+	PlaceholderFunc SQLPlaceholderFunc
+
+	// VisibilityTimeout is how long a leased job is hidden from other workers.
+	// If the job is not acknowledged or retried within this time, it becomes
+	// available to lease again. If not specified, 30 seconds is used.
+	VisibilityTimeout time.Duration
+
+	// MaxAttempts is the number of times a job may be leased before it is moved
+	// to the dead-letter list. If not specified, 5 is used.
+	MaxAttempts int
+
+	// RetryBackoffFactory determines how long a failed job waits before it
+	// becomes available to lease again. The nth retry uses the nth duration
+	// produced by a new backoff. If the backoff returns an error, the job is
+	// moved to the dead-letter list instead. If not specified,
+	// DefaultSQLQueueRetryBackoffFactory is used.
+	RetryBackoffFactory *backoff.Factory
+
+	// Clock is the clock used to compute visibility. If not specified, the
+	// system clock is used.
+	Clock clock.Clock
+}
+
+// SQLQueueOption is a setter for one or more SQL queue options.
+type SQLQueueOption interface {
+	// ApplyToSQLQueueOptions configures the specified SQL queue options for
+	// this option.
+	ApplyToSQLQueueOptions(target *SQLQueueOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *SQLQueueOptions) ApplyOptions(opts []SQLQueueOption) {
+	for _, opt := range opts {
+		opt.ApplyToSQLQueueOptions(o)
+	}
+}
+
+// SQLQueueOptionFunc allows a function to be used as a SQL queue option.
+type SQLQueueOptionFunc func(target *SQLQueueOptions)
+
+var _ SQLQueueOption = SQLQueueOptionFunc(nil)
+
+// ApplyToSQLQueueOptions configures the specified SQL queue options by calling
+// this function.
+func (sqof SQLQueueOptionFunc) ApplyToSQLQueueOptions(target *SQLQueueOptions) {
+	sqof(target)
+}
+
+// SQLQueueWithTable changes the name of the table that stores jobs.
+func SQLQueueWithTable(table string) SQLQueueOption {
+	return SQLQueueOptionFunc(func(target *SQLQueueOptions) {
+		target.Table = table
+	})
+}
+
+// SQLQueueWithPlaceholderFunc changes the bind parameter format to the
+// specified one.
+func SQLQueueWithPlaceholderFunc(fn SQLPlaceholderFunc) SQLQueueOption {
+	return SQLQueueOptionFunc(func(target *SQLQueueOptions) {
+		target.PlaceholderFunc = fn
+	})
+}
+
+// SQLQueueWithVisibilityTimeout changes how long a leased job is hidden from
+// other workers.
+func SQLQueueWithVisibilityTimeout(timeout time.Duration) SQLQueueOption {
+	return SQLQueueOptionFunc(func(target *SQLQueueOptions) {
+		target.VisibilityTimeout = timeout
+	})
+}
+
+// SQLQueueWithMaxAttempts changes the number of times a job may be leased
+// before it is moved to the dead-letter list.
+func SQLQueueWithMaxAttempts(n int) SQLQueueOption {
+	return SQLQueueOptionFunc(func(target *SQLQueueOptions) {
+		target.MaxAttempts = n
+	})
+}
+
+// SQLQueueWithRetryBackoffFactory changes the retry backoff algorithm to the
+// specified one.
+func SQLQueueWithRetryBackoffFactory(bf *backoff.Factory) SQLQueueOption {
+	return SQLQueueOptionFunc(func(target *SQLQueueOptions) {
+		target.RetryBackoffFactory = bf
+	})
+}
+
+// SQLQueueWithClock changes the clock to the specified one.
+func SQLQueueWithClock(c clock.Clock) SQLQueueOption {
+	return SQLQueueOptionFunc(func(target *SQLQueueOptions) {
+		target.Clock = c
+	})
+}
+
+// SQLQueue is a durable queue of jobs stored in a database table. Unlike the
+// queue of an AdhocDescriptor, jobs survive process restarts and may be shared
+// by many workers.
+//
+// The table must have the following columns, using types appropriate for the
+// database (for example, BYTEA instead of BLOB in PostgreSQL):
+//
+//	CREATE TABLE scheduler_jobs (
+//	  id VARCHAR(36) PRIMARY KEY,
+//	  queue VARCHAR(255) NOT NULL,
+//	  payload BLOB,
+//	  attempts INTEGER NOT NULL,
+//	  enqueued_at BIGINT NOT NULL,
+//	  visible_at BIGINT NOT NULL,
+//	  lease VARCHAR(36) NOT NULL,
+//	  last_error TEXT NOT NULL,
+//	  dead_at BIGINT NOT NULL
+//	);
+//
+// An index on (queue, dead_at, visible_at) is recommended. Times are stored as
+// nanoseconds since the Unix epoch.
+//
+// Every operation runs using sqlutil.WithTx, so an operation performed with a
+// context that carries a transaction participates in that transaction. In
+// particular, a job can be enqueued atomically with other changes to the
+// database.
+type SQLQueue struct {
+	db                  *sql.DB
+	name                string
+	table               string
+	placeholderFunc     SQLPlaceholderFunc
+	visibilityTimeout   time.Duration
+	maxAttempts         int
+	retryBackoffFactory *backoff.Factory
+	clock               clock.Clock
+
+	mut      sync.Mutex
+	enqueued chan struct{}
+}
+
+func (q *SQLQueue) query(query string) string {
+	return formatSQLQuery(query, q.table, q.placeholderFunc)
+}
+
+func (q *SQLQueue) notify() {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	close(q.enqueued)
+	q.enqueued = make(chan struct{})
+}
+
+// waitCh returns a channel that is closed the next time a job is enqueued
+// using this queue.
+func (q *SQLQueue) waitCh() <-chan struct{} {
+	q.mut.Lock()
+	defer q.mut.Unlock()
+
+	return q.enqueued
+}
+
+// Name returns the name of this queue.
+func (q *SQLQueue) Name() string {
+	return q.name
+}
+
+// Enqueue adds a new job with the given payload to this queue. It is
+// immediately available to lease.
+func (q *SQLQueue) Enqueue(ctx context.Context, payload []byte) (*SQLJob, error) {
+	now := q.clock.Now()
+
+	job := &SQLJob{
+		ID:         uuid.New().String(),
+		Queue:      q.name,
+		Payload:    payload,
+		EnqueuedAt: now,
+	}
+
+	if err := sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, q.query(`
+			INSERT INTO {table} (id, queue, payload, attempts, enqueued_at, visible_at, lease, last_error, dead_at)
+			VALUES (?, ?, ?, 0, ?, ?, '', '', 0)
+		`), job.ID, job.Queue, job.Payload, now.UnixNano(), now.UnixNano())
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	q.notify()
+	return job, nil
+}
+
+// sqlQueueLeaseAttempts is the number of candidate jobs Lease considers before
+// giving up until the next poll.
+const sqlQueueLeaseAttempts = 3
+
+// lease tries to lease the next available job in its own transaction. If the
+// candidate job was moved to the dead-letter list or leased by another worker
+// first, it returns retry so the caller can try again in a fresh transaction.
+func (q *SQLQueue) lease(ctx context.Context) (job *SQLJob, found, retry bool, err error) {
+	err = sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		now := q.clock.Now()
+
+		candidate := &SQLJob{Queue: q.name}
+
+		var enqueuedAt, visibleAt int64
+		err := tx.QueryRowContext(ctx, q.query(`
+			SELECT id, payload, attempts, enqueued_at, visible_at, lease, last_error
+			FROM {table}
+			WHERE queue = ? AND dead_at = 0 AND visible_at <= ?
+			ORDER BY visible_at, enqueued_at
+			LIMIT 1
+		`), q.name, now.UnixNano()).Scan(
+			&candidate.ID,
+			&candidate.Payload,
+			&candidate.Attempts,
+			&enqueuedAt,
+			&visibleAt,
+			&candidate.lease,
+			&candidate.LastError,
+		)
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		candidate.EnqueuedAt = time.Unix(0, enqueuedAt)
+
+		if candidate.Attempts >= q.maxAttempts {
+			// A worker leased this job for its last attempt but never finished
+			// it.
+			if candidate.LastError == "" {
+				candidate.LastError = "visibility timeout expired"
+			}
+
+			if err := q.deadLetter(ctx, tx, candidate, now); err != nil && err != ErrSQLJobLeaseLost {
+				return err
+			}
+
+			retry = true
+			return nil
+		}
+
+		lease := uuid.New().String()
+
+		// The visibility and lease conditions guard against another worker
+		// leasing the same job concurrently at weaker isolation levels.
+		r, err := tx.ExecContext(ctx, q.query(`
+			UPDATE {table}
+			SET attempts = attempts + 1, visible_at = ?, lease = ?
+			WHERE id = ? AND visible_at = ? AND lease = ?
+		`), now.Add(q.visibilityTimeout).UnixNano(), lease, candidate.ID, visibleAt, candidate.lease)
+		if err != nil {
+			return err
+		} else if n, err := r.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			retry = true
+			return nil
+		}
+
+		candidate.Attempts++
+		candidate.lease = lease
+
+		job, found = candidate, true
+		return nil
+	})
+	if err != nil {
+		return nil, false, false, err
+	}
+
+	return
+}
+
+// Lease acquires the next available job in this queue, hiding it from other
+// workers for the visibility timeout. If no job is available, it returns false.
+// It may also return false when other workers keep leasing the available jobs
+// first, in which case the caller should simply try again later.
+//
+// A job whose lease expired without being acknowledged or retried is
+// available to lease again, unless it has reached the maximum number of
+// attempts, in which case it is moved to the dead-letter list.
+func (q *SQLQueue) Lease(ctx context.Context) (job *SQLJob, found bool, err error) {
+	for i := 0; i < sqlQueueLeaseAttempts; i++ {
+		var retry bool
+
+		job, found, retry, err = q.lease(ctx)
+		if err != nil || !retry {
+			return
+		}
+	}
+
+	return nil, false, nil
+}
+
+// update changes the job row with the given SET clause and arguments, provided
+// the job still holds its lease.
+func (q *SQLQueue) update(ctx context.Context, tx *sql.Tx, job *SQLJob, set string, args ...interface{}) error {
+	r, err := tx.ExecContext(ctx, q.query(`
+		UPDATE {table}
+		SET `+set+`
+		WHERE id = ? AND lease = ?
+	`), append(args, job.ID, job.lease)...)
+	if err != nil {
+		return err
+	}
+
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return ErrSQLJobLeaseLost
+	}
+
+	return nil
+}
+
+func (q *SQLQueue) deadLetter(ctx context.Context, tx *sql.Tx, job *SQLJob, now time.Time) error {
+	if err := q.update(ctx, tx, job, "dead_at = ?, last_error = ?, lease = ''", now.UnixNano(), job.LastError); err != nil {
+		return err
+	}
+
+	log(ctx).Warn("SQL queue job moved to dead-letter list", "queue", q.name, "job", job.ID, "attempts", job.Attempts, "error", job.LastError)
+
+	job.DeadAt = now
+	job.lease = ""
+	return nil
+}
+
+// Ack removes a leased job from this queue because it completed successfully.
+func (q *SQLQueue) Ack(ctx context.Context, job *SQLJob) error {
+	return sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		r, err := tx.ExecContext(ctx, q.query(`DELETE FROM {table} WHERE id = ? AND lease = ?`), job.ID, job.lease)
+		if err != nil {
+			return err
+		}
+
+		n, err := r.RowsAffected()
+		if err != nil {
+			return err
+		} else if n == 0 {
+			return ErrSQLJobLeaseLost
+		}
+
+		return nil
+	})
+}
+
+func (q *SQLQueue) retryDelay(ctx context.Context, attempts int) (d time.Duration, err error) {
+	b, err := q.retryBackoffFactory.New()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < attempts; i++ {
+		d, err = b.Next(ctx)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return
+}
+
+// Retry makes a leased job that failed with the given error available to lease
+// again after the retry backoff. If the job has reached the maximum number of
+// attempts or the backoff returns an error, the job is moved to the
+// dead-letter list instead.
+func (q *SQLQueue) Retry(ctx context.Context, job *SQLJob, cause error) error {
+	lastError := ""
+	if cause != nil {
+		lastError = cause.Error()
+	}
+
+	return sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		now := q.clock.Now()
+
+		d, err := q.retryDelay(ctx, job.Attempts)
+		if err != nil || job.Attempts >= q.maxAttempts {
+			job.LastError = lastError
+			return q.deadLetter(ctx, tx, job, now)
+		}
+
+		if err := q.update(ctx, tx, job, "visible_at = ?, last_error = ?, lease = ''", now.Add(d).UnixNano(), lastError); err != nil {
+			return err
+		}
+
+		job.LastError = lastError
+		job.lease = ""
+		return nil
+	})
+}
+
+// DeadLetter moves a leased job that failed with the given error to the
+// dead-letter list without retrying it.
+func (q *SQLQueue) DeadLetter(ctx context.Context, job *SQLJob, cause error) error {
+	return sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		if cause != nil {
+			job.LastError = cause.Error()
+		}
+
+		return q.deadLetter(ctx, tx, job, q.clock.Now())
+	})
+}
+
+// start resets the visibility timeout of a leased job that is about to run.
+// The job may have waited for a worker after it was leased, so its original
+// lease could be close to expiring.
+func (q *SQLQueue) start(ctx context.Context, job *SQLJob) error {
+	return sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		return q.update(ctx, tx, job, "visible_at = ?", q.clock.Now().Add(q.visibilityTimeout).UnixNano())
+	})
+}
+
+// release makes a leased job that never ran available to lease again
+// immediately without counting the attempt.
+func (q *SQLQueue) release(ctx context.Context, job *SQLJob) error {
+	return sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		return q.update(ctx, tx, job, "attempts = attempts - 1, visible_at = ?, lease = ''", q.clock.Now().UnixNano())
+	})
+}
+
+// DeadLetters returns the jobs in the dead-letter list of this queue, ordered
+// by the time they were moved there.
+func (q *SQLQueue) DeadLetters(ctx context.Context) ([]*SQLJob, error) {
+	var jobs []*SQLJob
+
+	if err := sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, q.query(`
+			SELECT id, payload, attempts, enqueued_at, last_error, dead_at
+			FROM {table}
+			WHERE queue = ? AND dead_at <> 0
+			ORDER BY dead_at, enqueued_at
+		`), q.name)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			job := &SQLJob{Queue: q.name}
+
+			var enqueuedAt, deadAt int64
+			if err := rows.Scan(&job.ID, &job.Payload, &job.Attempts, &enqueuedAt, &job.LastError, &deadAt); err != nil {
+				return err
+			}
+
+			job.EnqueuedAt = time.Unix(0, enqueuedAt)
+			job.DeadAt = time.Unix(0, deadAt)
+
+			jobs = append(jobs, job)
+		}
+
+		return rows.Err()
+	}); err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+// Redrive moves the job with the given ID from the dead-letter list back to
+// this queue, resetting its attempts. It is immediately available to lease.
+func (q *SQLQueue) Redrive(ctx context.Context, id string) error {
+	if err := sqlutil.WithTx(ctx, q.db, func(ctx context.Context, tx *sql.Tx) error {
+		r, err := tx.ExecContext(ctx, q.query(`
+			UPDATE {table}
+			SET attempts = 0, visible_at = ?, dead_at = 0
+			WHERE id = ? AND queue = ? AND dead_at <> 0
+		`), q.clock.Now().UnixNano(), id, q.name)
+		if err != nil {
+			return err
+		}
+
+		n, err := r.RowsAffected()
+		if err != nil {
+			return err
+		} else if n == 0 {
+			return ErrSQLJobNotFound
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	q.notify()
+	return nil
+}
+
+// NewSQLQueue creates a new handle to the queue with the given name stored in
+// the given database. Many queues may share the same table.
+func NewSQLQueue(db *sql.DB, name string, opts ...SQLQueueOption) *SQLQueue {
+	o := &SQLQueueOptions{
+		Table:               "scheduler_jobs",
+		PlaceholderFunc:     SQLPlaceholderQuestion,
+		VisibilityTimeout:   30 * time.Second,
+		MaxAttempts:         5,
+		RetryBackoffFactory: DefaultSQLQueueRetryBackoffFactory,
+		Clock:               clock.RealClock,
+	}
+	o.ApplyOptions(opts)
+
+	return &SQLQueue{
+		db:                  db,
+		name:                name,
+		table:               o.Table,
+		placeholderFunc:     o.PlaceholderFunc,
+		visibilityTimeout:   o.VisibilityTimeout,
+		maxAttempts:         o.MaxAttempts,
+		retryBackoffFactory: o.RetryBackoffFactory,
+		clock:               o.Clock,
+		enqueued:            make(chan struct{}),
+	}
+}
+
+// SQLJobHandler runs a job leased from a SQL queue.
+type SQLJobHandler func(ctx context.Context, job *SQLJob) error
+
+type sqlQueueProcess struct {
+	queue   *SQLQueue
+	job     *SQLJob
+	handler SQLJobHandler
+}
+
+var _ Process = &sqlQueueProcess{}
+
+func (sqp *sqlQueueProcess) Description() string {
+	return fmt.Sprintf("SQL queue %s job %s (attempt %d)", sqp.queue.name, sqp.job.ID, sqp.job.Attempts)
+}
+
+func (sqp *sqlQueueProcess) finish(err error) error {
+	// The process context may be done if the scheduler is terminating, but we
+	// still want to record the result.
+	ctx := context.Background()
+
+	switch {
+	case err == nil:
+		return sqp.queue.Ack(ctx, sqp.job)
+	case errmark.MarkedUser(err):
+		return sqp.queue.DeadLetter(ctx, sqp.job, err)
+	default:
+		return sqp.queue.Retry(ctx, sqp.job, err)
+	}
+}
+
+func (sqp *sqlQueueProcess) Run(ctx context.Context) (err error) {
+	if err := sqp.queue.start(ctx, sqp.job); err == ErrSQLJobLeaseLost {
+		// The lease expired while this process waited for a worker and another
+		// worker now owns the job, so it must not run here too.
+		log(ctx).Warn("SQL queue job lease expired before it started", "queue", sqp.queue.name, "job", sqp.job.ID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = coercePanic(r)
+
+			// Re-panic after we record the error.
+			defer panic(r)
+		}
+
+		if ferr := sqp.finish(err); ferr != nil {
+			log(ctx).Warn("failed to record SQL queue job result", "queue", sqp.queue.name, "job", sqp.job.ID, "error", ferr)
+
+			if err == nil {
+				err = ferr
+			}
+		}
+	}()
+
+	return sqp.handler(ctx, sqp.job)
+}
+
+// SQLQueueDescriptorOptions contains fields that configure a SQL queue
+// descriptor.
+type SQLQueueDescriptorOptions struct {
+	// PollInterval is how often the descriptor checks the database for
+	// available jobs when the queue is empty. Jobs enqueued using the same
+	// SQLQueue wake the descriptor immediately. If not specified, 1 second is
+	// used.
+	PollInterval time.Duration
+}
+
+// SQLQueueDescriptorOption is a setter for one or more SQL queue descriptor
+// options.
+type SQLQueueDescriptorOption interface {
+	// ApplyToSQLQueueDescriptorOptions configures the specified SQL queue
+	// descriptor options for this option.
+	ApplyToSQLQueueDescriptorOptions(target *SQLQueueDescriptorOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *SQLQueueDescriptorOptions) ApplyOptions(opts []SQLQueueDescriptorOption) {
+	for _, opt := range opts {
+		opt.ApplyToSQLQueueDescriptorOptions(o)
+	}
+}
+
+// SQLQueueDescriptorOptionFunc allows a function to be used as a SQL queue
+// descriptor option.
+type SQLQueueDescriptorOptionFunc func(target *SQLQueueDescriptorOptions)
+
+var _ SQLQueueDescriptorOption = SQLQueueDescriptorOptionFunc(nil)
+
+// ApplyToSQLQueueDescriptorOptions configures the specified SQL queue
+// descriptor options by calling this function.
+func (sqdof SQLQueueDescriptorOptionFunc) ApplyToSQLQueueDescriptorOptions(target *SQLQueueDescriptorOptions) {
+	sqdof(target)
+}
+
+// SQLQueueDescriptorWithPollInterval changes how often the descriptor checks
+// the database for available jobs.
+func SQLQueueDescriptorWithPollInterval(interval time.Duration) SQLQueueDescriptorOption {
+	return SQLQueueDescriptorOptionFunc(func(target *SQLQueueDescriptorOptions) {
+		target.PollInterval = interval
+	})
+}
+
+// SQLQueueDescriptor is a durable counterpart to AdhocDescriptor. It leases
+// jobs from a SQL queue and emits a process for each one that runs a handler.
+//
+// When the handler returns successfully, the job is acknowledged. When the
+// handler returns an error marked as a user error by the errmark package, the
+// job is moved to the dead-letter list. Otherwise, the job is retried. The
+// handler's error is also returned from the process, so you may want to use an
+// error behavior like ErrorBehaviorDrop for the segment running this
+// descriptor.
+//
+// Handlers should finish within the visibility timeout of the queue, measured
+// from when the process starts, otherwise the job may run more than once.
+type SQLQueueDescriptor struct {
+	queue        *SQLQueue
+	handler      SQLJobHandler
+	pollInterval time.Duration
+}
+
+var _ Descriptor = &SQLQueueDescriptor{}
+
+// Run leases jobs from the queue until the context is done. Errors leasing jobs
+// are logged and the lease is tried again after the poll interval.
+func (sqd *SQLQueueDescriptor) Run(ctx context.Context, pc chan<- Process) error {
+	for {
+		enqueued := sqd.queue.waitCh()
+
+		job, found, err := sqd.queue.Lease(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			log(ctx).Warn("failed to lease job from SQL queue", "queue", sqd.queue.name, "error", err)
+		} else if found {
+			select {
+			case <-ctx.Done():
+				if err := sqd.queue.release(context.Background(), job); err != nil {
+					log(ctx).Warn("failed to release SQL queue job", "queue", sqd.queue.name, "job", job.ID, "error", err)
+				}
+				return nil
+			case pc <- &sqlQueueProcess{queue: sqd.queue, job: job, handler: sqd.handler}:
+			}
+
+			continue
+		}
+
+		t := sqd.queue.clock.NewTimer(sqd.pollInterval)
+
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		case <-enqueued:
+		case <-t.C():
+		}
+
+		t.Stop()
+	}
+}
+
+// NewSQLQueueDescriptor creates a new descriptor that runs the given handler
+// for each job in the given queue.
+func NewSQLQueueDescriptor(queue *SQLQueue, handler SQLJobHandler, opts ...SQLQueueDescriptorOption) *SQLQueueDescriptor {
+	o := &SQLQueueDescriptorOptions{
+		PollInterval: time.Second,
+	}
+	o.ApplyOptions(opts)
+
+	return &SQLQueueDescriptor{
+		queue:        queue,
+		handler:      handler,
+		pollInterval: o.PollInterval,
+	}
+}
@@ -0,0 +1,391 @@
+package scheduler_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/puppetlabs/leg/errmap/pkg/errmark"
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/sqlutil"
+	"github.com/puppetlabs/leg/timeutil/pkg/backoff"
+	"github.com/puppetlabs/leg/timeutil/pkg/clock/k8sext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	testclock "k8s.io/apimachinery/pkg/util/clock"
+)
+
+func newSQLQueueTestDB(t *testing.T) *sql.DB {
+	dir, err := ioutil.TempDir("", "leg-scheduler-sqlqueue-")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "queue.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	// SQLite only supports a single writer.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`
+		CREATE TABLE scheduler_jobs (
+			id VARCHAR(36) PRIMARY KEY,
+			queue VARCHAR(255) NOT NULL,
+			payload BLOB,
+			attempts INTEGER NOT NULL,
+			enqueued_at BIGINT NOT NULL,
+			visible_at BIGINT NOT NULL,
+			lease VARCHAR(36) NOT NULL,
+			last_error TEXT NOT NULL,
+			dead_at BIGINT NOT NULL
+		)
+	`)
+	require.NoError(t, err)
+
+	return db
+}
+
+func newSQLQueueTest(t *testing.T, opts ...scheduler.SQLQueueOption) (*scheduler.SQLQueue, *testclock.FakeClock) {
+	fc := testclock.NewFakeClock(time.Now())
+
+	q := scheduler.NewSQLQueue(newSQLQueueTestDB(t), "test", append([]scheduler.SQLQueueOption{
+		scheduler.SQLQueueWithVisibilityTimeout(time.Minute),
+		scheduler.SQLQueueWithRetryBackoffFactory(backoff.Build(backoff.Exponential(time.Second, 2))),
+		scheduler.SQLQueueWithClock(k8sext.NewClock(fc)),
+	}, opts...)...)
+	return q, fc
+}
+
+func requireLease(t *testing.T, q *scheduler.SQLQueue) *scheduler.SQLJob {
+	job, found, err := q.Lease(context.Background())
+	require.NoError(t, err)
+	require.True(t, found, "no job available")
+	return job
+}
+
+func requireNoLease(t *testing.T, q *scheduler.SQLQueue) {
+	job, found, err := q.Lease(context.Background())
+	require.NoError(t, err)
+	require.False(t, found, "job %+v available", job)
+}
+
+func TestSQLQueueLeaseAck(t *testing.T) {
+	ctx := context.Background()
+
+	q, _ := newSQLQueueTest(t)
+	other := scheduler.NewSQLQueue(newSQLQueueTestDB(t), "other")
+
+	requireNoLease(t, q)
+
+	enqueued, err := q.Enqueue(ctx, []byte("a"))
+	require.NoError(t, err)
+	_, err = q.Enqueue(ctx, []byte("b"))
+	require.NoError(t, err)
+
+	requireNoLease(t, other)
+
+	job := requireLease(t, q)
+	assert.Equal(t, enqueued.ID, job.ID)
+	assert.Equal(t, "test", job.Queue)
+	assert.Equal(t, []byte("a"), job.Payload)
+	assert.Equal(t, 1, job.Attempts)
+	require.NoError(t, q.Ack(ctx, job))
+
+	job = requireLease(t, q)
+	assert.Equal(t, []byte("b"), job.Payload)
+	require.NoError(t, q.Ack(ctx, job))
+
+	requireNoLease(t, q)
+}
+
+func TestSQLQueueVisibilityTimeout(t *testing.T) {
+	ctx := context.Background()
+
+	q, fc := newSQLQueueTest(t)
+
+	_, err := q.Enqueue(ctx, []byte("a"))
+	require.NoError(t, err)
+
+	first := requireLease(t, q)
+	requireNoLease(t, q)
+
+	// The first worker never finishes, so the job becomes available again.
+	fc.Step(time.Minute)
+
+	second := requireLease(t, q)
+	assert.Equal(t, first.ID, second.ID)
+	assert.Equal(t, 2, second.Attempts)
+
+	assert.Equal(t, scheduler.ErrSQLJobLeaseLost, q.Ack(ctx, first))
+	require.NoError(t, q.Ack(ctx, second))
+}
+
+func TestSQLQueueRetryAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+
+	q, fc := newSQLQueueTest(t, scheduler.SQLQueueWithMaxAttempts(3))
+
+	enqueued, err := q.Enqueue(ctx, []byte("a"))
+	require.NoError(t, err)
+
+	job := requireLease(t, q)
+	require.NoError(t, q.Retry(ctx, job, errors.New("first")))
+	requireNoLease(t, q)
+
+	fc.Step(time.Second)
+	job = requireLease(t, q)
+	assert.Equal(t, "first", job.LastError)
+	require.NoError(t, q.Retry(ctx, job, errors.New("second")))
+
+	fc.Step(time.Second)
+	requireNoLease(t, q)
+
+	fc.Step(time.Second)
+	job = requireLease(t, q)
+	assert.Equal(t, 3, job.Attempts)
+	require.NoError(t, q.Retry(ctx, job, errors.New("third")))
+
+	// The job has no attempts left.
+	fc.Step(time.Hour)
+	requireNoLease(t, q)
+
+	dead, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, enqueued.ID, dead[0].ID)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "third", dead[0].LastError)
+	assert.False(t, dead[0].DeadAt.IsZero())
+
+	require.NoError(t, q.Redrive(ctx, enqueued.ID))
+	assert.Equal(t, scheduler.ErrSQLJobNotFound, q.Redrive(ctx, enqueued.ID))
+
+	job = requireLease(t, q)
+	assert.Equal(t, 1, job.Attempts)
+	require.NoError(t, q.DeadLetter(ctx, job, errors.New("permanent")))
+
+	dead, err = q.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "permanent", dead[0].LastError)
+}
+
+func TestSQLQueueVisibilityTimeoutDeadLetter(t *testing.T) {
+	ctx := context.Background()
+
+	q, fc := newSQLQueueTest(t, scheduler.SQLQueueWithMaxAttempts(1))
+
+	_, err := q.Enqueue(ctx, []byte("a"))
+	require.NoError(t, err)
+
+	requireLease(t, q)
+
+	fc.Step(time.Minute)
+	requireNoLease(t, q)
+
+	dead, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, "visibility timeout expired", dead[0].LastError)
+}
+
+func TestSQLQueueLeaseDeadLetterLimit(t *testing.T) {
+	ctx := context.Background()
+
+	q, fc := newSQLQueueTest(t, scheduler.SQLQueueWithMaxAttempts(1))
+
+	for i := 0; i < 4; i++ {
+		_, err := q.Enqueue(ctx, []byte("stale"))
+		require.NoError(t, err)
+
+		requireLease(t, q)
+	}
+
+	fc.Step(time.Minute)
+
+	fresh, err := q.Enqueue(ctx, []byte("fresh"))
+	require.NoError(t, err)
+
+	// Lease only moves a bounded number of expired jobs to the dead-letter list
+	// before giving up until the next poll.
+	requireNoLease(t, q)
+
+	dead, err := q.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dead, 3)
+
+	job := requireLease(t, q)
+	assert.Equal(t, fresh.ID, job.ID)
+
+	dead, err = q.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dead, 4)
+}
+
+func TestSQLQueueDescriptorSlowHandoff(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q, fc := newSQLQueueTest(t)
+
+	var calls []string
+	sqd := scheduler.NewSQLQueueDescriptor(q, func(ctx context.Context, job *scheduler.SQLJob) error {
+		calls = append(calls, string(job.Payload))
+		return nil
+	}, scheduler.SQLQueueDescriptorWithPollInterval(time.Hour))
+
+	pc := make(chan scheduler.Process)
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		assert.NoError(t, sqd.Run(ctx, pc))
+	}()
+	defer func() {
+		cancel()
+		<-exited
+	}()
+
+	receive := func() scheduler.Process {
+		select {
+		case p := <-pc:
+			return p
+		case <-ctx.Done():
+			require.Fail(t, "descriptor did not emit a process")
+			return nil
+		}
+	}
+
+	// Waits for the descriptor to find the queue empty and start polling, so
+	// it doesn't lease a job we expire.
+	requirePolling := func() {
+		require.Eventually(t, fc.HasWaiters, 5*time.Second, 10*time.Millisecond)
+	}
+
+	// The lease expires before a worker runs the process, and another worker
+	// takes the job.
+	_, err := q.Enqueue(ctx, []byte("a"))
+	require.NoError(t, err)
+
+	p := receive()
+	requirePolling()
+	fc.Step(time.Minute)
+
+	other := requireLease(t, q)
+	require.NoError(t, p.Run(ctx))
+	require.NoError(t, q.Ack(ctx, other))
+
+	// A process whose lease expired without another worker taking the job
+	// still runs, and its lease is reset when it starts.
+	_, err = q.Enqueue(ctx, []byte("b"))
+	require.NoError(t, err)
+
+	p = receive()
+	requirePolling()
+	fc.Step(time.Minute)
+
+	require.NoError(t, p.Run(ctx))
+	requireNoLease(t, q)
+
+	assert.Equal(t, []string{"b"}, calls)
+}
+
+func TestSQLQueueEnqueueInTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	db := newSQLQueueTestDB(t)
+	q := scheduler.NewSQLQueue(db, "test")
+
+	errRollback := errors.New("rollback")
+	require.Equal(t, errRollback, sqlutil.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := q.Enqueue(ctx, []byte("a"))
+		require.NoError(t, err)
+		return errRollback
+	}))
+
+	requireNoLease(t, q)
+
+	require.NoError(t, sqlutil.WithTx(ctx, db, func(ctx context.Context, tx *sql.Tx) error {
+		_, err := q.Enqueue(ctx, []byte("b"))
+		return err
+	}))
+
+	job := requireLease(t, q)
+	assert.Equal(t, []byte("b"), job.Payload)
+}
+
+func TestSQLQueueDescriptor(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	q := scheduler.NewSQLQueue(newSQLQueueTestDB(t), "test",
+		scheduler.SQLQueueWithRetryBackoffFactory(backoff.Build(backoff.Constant(time.Millisecond))),
+	)
+
+	var (
+		mut     sync.Mutex
+		handled []string
+		failed  bool
+		done    = make(chan struct{}, 4)
+	)
+
+	handler := func(ctx context.Context, job *scheduler.SQLJob) error {
+		defer func() { done <- struct{}{} }()
+
+		mut.Lock()
+		defer mut.Unlock()
+
+		switch string(job.Payload) {
+		case "transient":
+			// Fail the first time only.
+			if !failed {
+				failed = true
+				return errors.New("try again")
+			}
+		case "user":
+			return errmark.MarkUser(errors.New("bad payload"))
+		}
+
+		handled = append(handled, string(job.Payload))
+		return nil
+	}
+
+	slc := scheduler.
+		NewSegment(2, []scheduler.Descriptor{scheduler.NewSQLQueueDescriptor(q, handler)}).
+		WithErrorBehavior(scheduler.ErrorBehaviorDrop).
+		Start(scheduler.LifecycleStartOptions{})
+	defer func() {
+		assert.NoError(t, scheduler.CloseWaitContext(ctx, slc))
+	}()
+
+	for _, payload := range []string{"ok", "transient", "user"} {
+		_, err := q.Enqueue(ctx, []byte(payload))
+		require.NoError(t, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			require.Fail(t, "jobs did not run")
+		}
+	}
+
+	require.Eventually(t, func() bool {
+		dead, err := q.DeadLetters(ctx)
+		return err == nil && len(dead) == 1 && string(dead[0].Payload) == "user"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mut.Lock()
+	defer mut.Unlock()
+
+	sort.Strings(handled)
+	assert.Equal(t, []string{"ok", "transient"}, handled)
+}
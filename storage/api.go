@@ -8,15 +8,17 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"time"
 )
 
 type ErrorCode string
 
 const (
-	AuthError     ErrorCode = "AuthError"
-	NotFoundError ErrorCode = "NotFoundError"
-	TimeoutError  ErrorCode = "TimeoutError"
-	UnknownError  ErrorCode = "UnknownError"
+	AuthError               ErrorCode = "AuthError"
+	NotFoundError           ErrorCode = "NotFoundError"
+	PreconditionFailedError ErrorCode = "PreconditionFailedError"
+	TimeoutError            ErrorCode = "TimeoutError"
+	UnknownError            ErrorCode = "UnknownError"
 )
 
 type errorImpl struct {
@@ -51,6 +53,11 @@ func IsNotFoundError(err error) bool {
 	return ok && e.code == NotFoundError
 }
 
+func IsPreconditionFailedError(err error) bool {
+	e, ok := err.(*errorImpl)
+	return ok && e.code == PreconditionFailedError
+}
+
 func IsTimeoutError(err error) bool {
 	e, ok := err.(*errorImpl)
 	return ok && e.code == TimeoutError
@@ -66,10 +73,45 @@ type Meta struct {
 	Offset int64
 	// Size is the total size of the blob
 	Size int64
+	// ModificationTime is the time the blob was last written, if known
+	ModificationTime time.Time
+	// ETag is an opaque value that changes every time the blob is written,
+	// suitable for use in preconditions
+	ETag string
+	// MD5 is the checksum of the entire blob, if known
+	MD5 []byte
+	// ContentEncoding of the blob, e.g. "gzip"
+	ContentEncoding string
+	// CacheControl directives for HTTP clients that retrieve the blob
+	CacheControl string
+	// ContentDisposition for HTTP clients that retrieve the blob
+	ContentDisposition string
+	// Metadata is the user-defined metadata of the blob, if any
+	Metadata map[string]string
 }
 type PutOptions struct {
 	// ContentType of the blob
 	ContentType string
+	// ContentEncoding of the blob. The blob store does not encode the content
+	// itself; the sink must write content with this encoding.
+	ContentEncoding string
+	// CacheControl directives for HTTP clients that retrieve the blob
+	CacheControl string
+	// ContentDisposition for HTTP clients that retrieve the blob
+	ContentDisposition string
+	// Metadata is arbitrary user-defined metadata to store with the blob.
+	// Some blob stores treat the keys as case-insensitive.
+	Metadata map[string]string
+
+	// IfMatch, if non-empty, causes the write to fail with a
+	// PreconditionFailedError unless the blob exists and its current ETag is
+	// this value.
+	IfMatch string
+
+	// IfNoneMatch, if true, causes the write to fail with a
+	// PreconditionFailedError if the blob already exists. It may not be
+	// combined with IfMatch.
+	IfNoneMatch bool
 }
 type GetOptions struct {
 	// Offset is the byte offset to begin at, it may be negative
@@ -81,9 +123,82 @@ type GetOptions struct {
 	// be <= 0 if Offset is negative due to the limitations of
 	// HTTP range requests.
 	Length int64
+
+	// IncludeMetadata, if true, requires the Meta passed to the source to
+	// include the MD5 checksum, content disposition, and user-defined
+	// metadata of the blob. Some blob stores need an additional request to
+	// retrieve them, so they may be omitted otherwise.
+	IncludeMetadata bool
 }
 type DeleteOptions struct {
-	// TODO: Support conditional deletes?
+	// IfMatch, if non-empty, causes the delete to fail with a
+	// PreconditionFailedError unless the blob exists and its current ETag is
+	// this value.
+	IfMatch string
+}
+type CopyOptions struct {
+	// SourceIfMatch, if non-empty, causes the copy to fail with a
+	// PreconditionFailedError unless the source blob's current ETag is this
+	// value.
+	SourceIfMatch string
+
+	// IfMatch, if non-empty, causes the copy to fail with a
+	// PreconditionFailedError unless the destination blob exists and its
+	// current ETag is this value.
+	IfMatch string
+
+	// IfNoneMatch, if true, causes the copy to fail with a
+	// PreconditionFailedError if the destination blob already exists. It may
+	// not be combined with IfMatch.
+	IfNoneMatch bool
+}
+
+type SignOptions struct {
+	// Method is the HTTP method permitted by the URL, either GET (the default)
+	// to read the blob or PUT to write it.
+	Method string
+
+	// Duration is the length of time the URL remains valid. If <= 0,
+	// DefaultSignedURLDuration is used.
+	Duration time.Duration
+
+	// ContentType, if non-empty, is the content type that clients must send
+	// when writing the blob using a PUT URL.
+	ContentType string
+}
+type ListOptions struct {
+	// Prefix restricts the listing to keys that begin with this string.
+	Prefix string
+
+	// Delimiter, if non-empty, groups all keys that contain the delimiter
+	// after the prefix into a single entry in ListPage.Prefixes, much like a
+	// directory.
+	Delimiter string
+
+	// PageToken is the NextPageToken of a previous listing with the same
+	// prefix and delimiter. If empty, the listing starts from the beginning.
+	PageToken string
+
+	// PageSize is the maximum number of keys and prefixes to return in a
+	// single page. If <= 0, a backend-specific default is used.
+	PageSize int
+}
+type ListEntry struct {
+	// Key of the blob
+	Key string
+	// Meta of the blob. Offset is always 0, and backends that do not return
+	// certain metadata in listings may leave those fields empty.
+	Meta Meta
+}
+type ListPage struct {
+	// Entries are the blobs in this page, ordered by key.
+	Entries []*ListEntry
+	// Prefixes are the common prefixes (including the delimiter) of keys
+	// grouped by ListOptions.Delimiter, ordered lexicographically.
+	Prefixes []string
+	// NextPageToken is the token to use to retrieve the next page of the
+	// listing. It is empty if this is the last page.
+	NextPageToken string
 }
 
 type BlobStore interface {
@@ -91,3 +206,70 @@ type BlobStore interface {
 	Get(ctx context.Context, key string, source Source, opts GetOptions) error
 	Delete(ctx context.Context, key string, opts DeleteOptions) error
 }
+
+// Stater is an optional interface implemented by blob stores that can retrieve
+// the metadata of a blob without reading its content.
+type Stater interface {
+	Stat(ctx context.Context, key string) (*Meta, error)
+}
+
+// DefaultSignedURLDuration is the length of time a signed URL remains valid if
+// SignOptions does not specify a duration.
+const DefaultSignedURLDuration = 15 * time.Minute
+
+// Signer is an optional interface implemented by blob stores that can create
+// time-limited URLs that grant access to a single blob without further
+// credentials.
+type Signer interface {
+	SignURL(ctx context.Context, key string, opts SignOptions) (string, error)
+}
+
+// Lister is an optional interface implemented by blob stores that can
+// enumerate their keys.
+type Lister interface {
+	List(ctx context.Context, opts ListOptions) (*ListPage, error)
+}
+
+// Copier is an optional interface implemented by blob stores that can copy a
+// blob to another key in the same blob store without transferring its content
+// through the client. The copy has the same content headers and user-defined
+// metadata as the source blob.
+type Copier interface {
+	Copy(ctx context.Context, srcKey, dstKey string, opts CopyOptions) error
+}
+
+// MaxUploadParts is the largest part number permitted in a multipart upload.
+const MaxUploadParts = 10000
+
+// Part describes a part of a multipart upload that has been uploaded.
+type Part struct {
+	// Number of the part, from 1 to MaxUploadParts. Parts are assembled in
+	// ascending order of their numbers, which need not be contiguous.
+	Number int
+	// ETag of the part, which must be passed to CompleteUpload.
+	ETag string
+	// Size of the part in bytes
+	Size int64
+}
+
+// MultipartUploader is an optional interface implemented by blob stores that
+// can write a blob as a series of separately uploaded parts. Parts may be
+// uploaded in parallel, and a part that fails to upload can be retried
+// without uploading the others again. An upload is identified by the ID
+// returned by InitiateUpload, so it can be resumed by another process using
+// ListParts to determine which parts remain to be uploaded.
+//
+// The blob is only created when the upload is completed, using the options
+// that were given when it was initiated. Uploads that are neither completed
+// nor aborted may continue to consume storage.
+//
+// Operations on an upload that does not exist, including one that has
+// already been completed or aborted, fail with a NotFoundError. Some blob
+// stores require every part except the last to have a minimum size.
+type MultipartUploader interface {
+	InitiateUpload(ctx context.Context, key string, opts PutOptions) (string, error)
+	UploadPart(ctx context.Context, key, uploadID string, number int, sink Sink) (*Part, error)
+	ListParts(ctx context.Context, key, uploadID string) ([]*Part, error)
+	CompleteUpload(ctx context.Context, key, uploadID string, parts []*Part) error
+	AbortUpload(ctx context.Context, key, uploadID string) error
+}
@@ -0,0 +1,176 @@
+// Package compression provides a blob store that transparently compresses the
+// content of the blobs it writes to another blob store.
+package compression
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/puppetlabs/leg/storage"
+)
+
+// MetadataKey is the key of the blob metadata that records the algorithm used
+// to compress a blob.
+const MetadataKey = "leg-compression"
+
+// Algorithm is a compression algorithm.
+type Algorithm string
+
+const (
+	Gzip Algorithm = "gzip"
+	Zstd Algorithm = "zstd"
+)
+
+func (a Algorithm) newWriter(w io.Writer) (io.WriteCloser, error) {
+	switch a {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	default:
+		return nil, storage.Errorf(nil, storage.UnknownError, "unsupported compression algorithm %q", a)
+	}
+}
+
+func (a Algorithm) newReader(r io.Reader) (io.ReadCloser, error) {
+	switch a {
+	case Gzip:
+		return gzip.NewReader(r)
+	case Zstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, storage.Errorf(nil, storage.UnknownError, "unsupported compression algorithm %q", a)
+	}
+}
+
+// BlobStore compresses the content of blobs written to a delegate blob store
+// and decompresses them when they are read. The algorithm is recorded in the
+// metadata of each blob, so blobs that were written without compression or
+// using a different algorithm can still be read.
+//
+// The size and MD5 checksum in the metadata of a compressed blob describe the
+// compressed content. Ranged reads of compressed blobs are not supported and
+// fail with an error.
+type BlobStore struct {
+	delegate  storage.BlobStore
+	algorithm Algorithm
+}
+
+var _ storage.BlobStore = &BlobStore{}
+var _ storage.Stater = &BlobStore{}
+var _ storage.Lister = &BlobStore{}
+
+// stripAlgorithm removes the compression metadata from the given metadata and
+// returns the algorithm it recorded, if any.
+func stripAlgorithm(meta *storage.Meta) Algorithm {
+	a, found := meta.Metadata[MetadataKey]
+	if !found {
+		return ""
+	}
+
+	md := make(map[string]string, len(meta.Metadata)-1)
+	for k, v := range meta.Metadata {
+		if k != MetadataKey {
+			md[k] = v
+		}
+	}
+	if len(md) == 0 {
+		md = nil
+	}
+	meta.Metadata = md
+
+	meta.MD5 = nil
+	return Algorithm(a)
+}
+
+func (bs *BlobStore) Put(ctx context.Context, key string, sink storage.Sink, opts storage.PutOptions) error {
+	md := make(map[string]string, len(opts.Metadata)+1)
+	for k, v := range opts.Metadata {
+		md[k] = v
+	}
+	md[MetadataKey] = string(bs.algorithm)
+	opts.Metadata = md
+
+	return bs.delegate.Put(ctx, key, func(w io.Writer) error {
+		cw, err := bs.algorithm.newWriter(w)
+		if err != nil {
+			return err
+		}
+
+		if err := sink(cw); err != nil {
+			cw.Close()
+			return err
+		}
+		return cw.Close()
+	}, opts)
+}
+
+func (bs *BlobStore) Get(ctx context.Context, key string, src storage.Source, opts storage.GetOptions) error {
+	// The algorithm is recorded in the metadata of the blob.
+	opts.IncludeMetadata = true
+
+	return bs.delegate.Get(ctx, key, func(meta *storage.Meta, r io.Reader) error {
+		a := stripAlgorithm(meta)
+		if a == "" {
+			return src(meta, r)
+		} else if opts.Offset != 0 || opts.Length != 0 {
+			return storage.Errorf(nil, storage.UnknownError, "%s: ranged reads of blobs compressed with %s are not supported", key, a)
+		}
+
+		cr, err := a.newReader(r)
+		if err != nil {
+			return err
+		}
+		defer cr.Close()
+
+		return src(meta, cr)
+	}, opts)
+}
+
+func (bs *BlobStore) Delete(ctx context.Context, key string, opts storage.DeleteOptions) error {
+	return bs.delegate.Delete(ctx, key, opts)
+}
+
+func (bs *BlobStore) Stat(ctx context.Context, key string) (*storage.Meta, error) {
+	meta, err := storage.Stat(ctx, bs.delegate, key)
+	if err != nil {
+		return nil, err
+	}
+
+	stripAlgorithm(meta)
+	return meta, nil
+}
+
+// List lists the blobs of the delegate blob store, which must implement
+// storage.Lister.
+func (bs *BlobStore) List(ctx context.Context, opts storage.ListOptions) (*storage.ListPage, error) {
+	lister, ok := bs.delegate.(storage.Lister)
+	if !ok {
+		return nil, storage.Errorf(nil, storage.UnknownError, "%T does not support listing", bs.delegate)
+	}
+
+	page, err := lister.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range page.Entries {
+		stripAlgorithm(&entry.Meta)
+	}
+	return page, nil
+}
+
+// NewBlobStore creates a blob store that compresses blobs written to the given
+// delegate using the given algorithm.
+func NewBlobStore(delegate storage.BlobStore, algorithm Algorithm) *BlobStore {
+	return &BlobStore{
+		delegate:  delegate,
+		algorithm: algorithm,
+	}
+}
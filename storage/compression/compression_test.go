@@ -0,0 +1,115 @@
+package compression_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/puppetlabs/leg/storage"
+	"github.com/puppetlabs/leg/storage/compression"
+	"github.com/puppetlabs/leg/storage/mem"
+	"github.com/puppetlabs/leg/storage/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func put(t *testing.T, bs storage.BlobStore, key string, content []byte, opts storage.PutOptions) {
+	require.NoError(t, bs.Put(context.Background(), key, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	}, opts))
+}
+
+func get(bs storage.BlobStore, key string, opts storage.GetOptions) (*storage.Meta, []byte, error) {
+	var meta *storage.Meta
+	var content []byte
+	err := bs.Get(context.Background(), key, func(m *storage.Meta, r io.Reader) (err error) {
+		meta = m
+		content, err = ioutil.ReadAll(r)
+		return
+	}, opts)
+	return meta, content, err
+}
+
+func TestPreconditions(t *testing.T) {
+	t.Parallel()
+	testutils.RunPreconditionTests(t, compression.NewBlobStore(mem.NewMemory(), compression.Gzip))
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+	testutils.RunMetadataTests(t, compression.NewBlobStore(mem.NewMemory(), compression.Gzip))
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("compressible content "), 1000)
+
+	for _, algorithm := range []compression.Algorithm{compression.Gzip, compression.Zstd} {
+		algorithm := algorithm
+		t.Run(string(algorithm), func(t *testing.T) {
+			delegate := mem.NewMemory()
+			bs := compression.NewBlobStore(delegate, algorithm)
+
+			put(t, bs, "key", content, storage.PutOptions{
+				Metadata: map[string]string{"owner": "test"},
+			})
+
+			meta, actual, err := get(bs, "key", storage.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, content, actual)
+			assert.Less(t, meta.Size, int64(len(content)))
+			assert.Nil(t, meta.MD5)
+			assert.Equal(t, map[string]string{"owner": "test"}, meta.Metadata)
+
+			meta, err = bs.Stat(context.Background(), "key")
+			require.NoError(t, err)
+			assert.Equal(t, map[string]string{"owner": "test"}, meta.Metadata)
+
+			meta, _, err = get(delegate, "key", storage.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, string(algorithm), meta.Metadata[compression.MetadataKey])
+
+			page, err := bs.List(context.Background(), storage.ListOptions{})
+			require.NoError(t, err)
+			require.Len(t, page.Entries, 1)
+			assert.Equal(t, map[string]string{"owner": "test"}, page.Entries[0].Meta.Metadata)
+		})
+	}
+}
+
+func TestMixedAlgorithms(t *testing.T) {
+	t.Parallel()
+
+	delegate := mem.NewMemory()
+	put(t, delegate, "plain", []byte("plain content"), storage.PutOptions{})
+	put(t, compression.NewBlobStore(delegate, compression.Gzip), "gzip", []byte("gzip content"), storage.PutOptions{})
+
+	bs := compression.NewBlobStore(delegate, compression.Zstd)
+	for key, expected := range map[string]string{
+		"plain": "plain content",
+		"gzip":  "gzip content",
+	} {
+		_, actual, err := get(bs, key, storage.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, expected, string(actual))
+	}
+
+	_, actual, err := get(bs, "plain", storage.GetOptions{Offset: 6, Length: -1})
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(actual))
+}
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+
+	bs := compression.NewBlobStore(mem.NewMemory(), compression.Gzip)
+	put(t, bs, "key", []byte("compressed content"), storage.PutOptions{})
+
+	_, _, err := get(bs, "key", storage.GetOptions{Offset: 1, Length: 1})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ranged reads")
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"reflect"
+)
+
+// sameBlobStore returns true if the given blob stores are the same instance.
+func sameBlobStore(a, b BlobStore) bool {
+	t := reflect.TypeOf(a)
+	if t != reflect.TypeOf(b) || !t.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// Copy copies the blob with the given source key in one blob store to the
+// given destination key in another, which may be the same blob store. The copy
+// has the same content headers and user-defined metadata as the source blob.
+//
+// If both blob stores are the same and implement Copier, the blob is copied
+// without transferring its content through the client. Otherwise, the content
+// is streamed from the source blob store to the destination blob store.
+func Copy(ctx context.Context, src BlobStore, srcKey string, dst BlobStore, dstKey string, opts CopyOptions) error {
+	same := sameBlobStore(src, dst)
+	if same && srcKey == dstKey {
+		return Errorf(nil, UnknownError, "%s: source and destination are the same blob", srcKey)
+	} else if c, ok := src.(Copier); ok && same {
+		return c.Copy(ctx, srcKey, dstKey, opts)
+	}
+
+	if opts.IfMatch != "" && opts.IfNoneMatch {
+		return Errorf(nil, UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	}
+
+	// Errors from the source function may be wrapped by the source blob
+	// store, so we keep track of them to report them as they are.
+	var cerr error
+	err := src.Get(ctx, srcKey, func(meta *Meta, r io.Reader) error {
+		if opts.SourceIfMatch != "" && opts.SourceIfMatch != meta.ETag {
+			cerr = Errorf(nil, PreconditionFailedError, "%s: ETag %q does not match %q", srcKey, meta.ETag, opts.SourceIfMatch)
+			return cerr
+		}
+
+		cerr = dst.Put(ctx, dstKey, func(w io.Writer) error {
+			_, err := io.Copy(w, r)
+			return err
+		}, PutOptions{
+			ContentType:        meta.ContentType,
+			ContentEncoding:    meta.ContentEncoding,
+			CacheControl:       meta.CacheControl,
+			ContentDisposition: meta.ContentDisposition,
+			Metadata:           meta.Metadata,
+			IfMatch:            opts.IfMatch,
+			IfNoneMatch:        opts.IfNoneMatch,
+		})
+		return cerr
+	}, GetOptions{IncludeMetadata: true})
+	if cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// Move copies a blob as Copy does and then deletes the source blob. The source
+// blob is only deleted if it has not changed since it was copied. If the source
+// blob changes, Move fails with a PreconditionFailedError and both blobs are
+// left in place.
+//
+// Whether a concurrent write to the source blob can be lost depends on how the
+// source blob store checks the IfMatch precondition of Delete. The file, gcs,
+// and mem blob stores check it atomically, so the write is never lost. The s3
+// blob store checks the ETag of the blob in a separate request before deleting
+// it, so a write that happens between the two requests is deleted.
+func Move(ctx context.Context, src BlobStore, srcKey string, dst BlobStore, dstKey string, opts CopyOptions) error {
+	if opts.SourceIfMatch == "" {
+		meta, err := Stat(ctx, src, srcKey)
+		if err != nil {
+			return err
+		}
+		opts.SourceIfMatch = meta.ETag
+	}
+
+	if err := Copy(ctx, src, srcKey, dst, dstKey, opts); err != nil {
+		return err
+	}
+
+	return src.Delete(ctx, srcKey, DeleteOptions{IfMatch: opts.SourceIfMatch})
+}
@@ -0,0 +1,360 @@
+// Package encryption provides a blob store that transparently encrypts the
+// content of the blobs it writes to another blob store using envelope
+// encryption.
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/puppetlabs/leg/storage"
+)
+
+const (
+	// MetadataKey is the key of the blob metadata that records the algorithm
+	// used to encrypt a blob.
+	MetadataKey = "leg-encryption"
+
+	// MetadataKeyDataKey is the key of the blob metadata that holds the data
+	// key of a blob, encrypted by the key provider.
+	MetadataKeyDataKey = "leg-encryption-key"
+
+	// MetadataKeyChunkSize is the key of the blob metadata that records the
+	// size of the chunks a blob was encrypted in.
+	MetadataKeyChunkSize = "leg-encryption-chunk-size"
+
+	// AlgorithmAES256GCM identifies content encrypted in chunks using AES-GCM
+	// with a 256-bit data key.
+	AlgorithmAES256GCM = "aes-256-gcm"
+
+	// DefaultChunkSize is the number of bytes of content encrypted in each
+	// chunk if not otherwise specified.
+	DefaultChunkSize = 64 * 1024
+)
+
+// BlobStoreOptions contains fields that configure an encrypting blob store.
+type BlobStoreOptions struct {
+	// ChunkSize is the number of bytes of content encrypted in each chunk.
+	// Smaller chunks reduce the amount of content that must be read to serve
+	// a ranged read at the cost of a larger encrypted blob. If not specified,
+	// DefaultChunkSize is used.
+	ChunkSize int
+}
+
+// BlobStoreOption is a setter for one or more blob store options.
+type BlobStoreOption interface {
+	// ApplyToBlobStoreOptions configures the specified blob store options for
+	// this option.
+	ApplyToBlobStoreOptions(target *BlobStoreOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *BlobStoreOptions) ApplyOptions(opts []BlobStoreOption) {
+	for _, opt := range opts {
+		opt.ApplyToBlobStoreOptions(o)
+	}
+}
+
+// BlobStoreOptionFunc allows a function to be used as a blob store option.
+type BlobStoreOptionFunc func(target *BlobStoreOptions)
+
+var _ BlobStoreOption = BlobStoreOptionFunc(nil)
+
+// ApplyToBlobStoreOptions configures the specified blob store options by
+// calling this function.
+func (bsof BlobStoreOptionFunc) ApplyToBlobStoreOptions(target *BlobStoreOptions) {
+	bsof(target)
+}
+
+// WithChunkSize changes the number of bytes of content encrypted in each
+// chunk.
+func WithChunkSize(size int) BlobStoreOption {
+	return BlobStoreOptionFunc(func(target *BlobStoreOptions) {
+		target.ChunkSize = size
+	})
+}
+
+// BlobStore encrypts the content of blobs written to a delegate blob store and
+// decrypts them when they are read. Each blob is encrypted with a new data key,
+// which is itself encrypted by a key provider and stored in the metadata of
+// the blob. Blobs without encryption metadata are read unchanged.
+//
+// Content is encrypted in chunks, so ranged reads only retrieve and decrypt
+// the chunks that overlap the range. A ranged read retrieves the metadata of
+// the blob first to determine its size.
+//
+// The size in the metadata of an encrypted blob is the size of its content
+// before encryption, except in listings from blob stores that do not include
+// user-defined metadata. MD5 checksums of encrypted blobs are omitted.
+type BlobStore struct {
+	delegate  storage.BlobStore
+	keys      KeyProvider
+	chunkSize int
+}
+
+var _ storage.BlobStore = &BlobStore{}
+var _ storage.Stater = &BlobStore{}
+var _ storage.Lister = &BlobStore{}
+
+// envelope is the encryption metadata of a blob.
+type envelope struct {
+	dataKey   []byte
+	chunkSize int
+}
+
+// stripEnvelope removes the encryption metadata from the given metadata and
+// returns it. If the blob is not encrypted, it returns nil. The size in the
+// metadata is adjusted to the size of the content before encryption.
+func stripEnvelope(meta *storage.Meta) (*envelope, error) {
+	algorithm, found := meta.Metadata[MetadataKey]
+	if !found {
+		return nil, nil
+	} else if algorithm != AlgorithmAES256GCM {
+		return nil, storage.Errorf(nil, storage.UnknownError, "unsupported encryption algorithm %q", algorithm)
+	}
+
+	dataKey, err := base64.StdEncoding.DecodeString(meta.Metadata[MetadataKeyDataKey])
+	if err != nil {
+		return nil, storage.Errorf(err, storage.UnknownError, "invalid encrypted data key: %s", err.Error())
+	}
+
+	chunkSize, err := strconv.Atoi(meta.Metadata[MetadataKeyChunkSize])
+	if err != nil || chunkSize <= 0 {
+		return nil, storage.Errorf(err, storage.UnknownError, "invalid encryption chunk size %q", meta.Metadata[MetadataKeyChunkSize])
+	}
+
+	md := make(map[string]string, len(meta.Metadata))
+	for k, v := range meta.Metadata {
+		switch k {
+		case MetadataKey, MetadataKeyDataKey, MetadataKeyChunkSize:
+		default:
+			md[k] = v
+		}
+	}
+	if len(md) == 0 {
+		md = nil
+	}
+	meta.Metadata = md
+
+	meta.Size, _ = plaintextSize(meta.Size, chunkSize, gcmOverhead)
+	meta.MD5 = nil
+
+	return &envelope{
+		dataKey:   dataKey,
+		chunkSize: chunkSize,
+	}, nil
+}
+
+// gcmOverhead is the number of bytes added to each chunk by AES-GCM.
+const gcmOverhead = 16
+
+func (bs *BlobStore) aead(ctx context.Context, key string, env *envelope) (cipher.AEAD, error) {
+	dataKey, err := bs.keys.Decrypt(ctx, env.dataKey)
+	if err != nil {
+		return nil, storage.Errorf(err, storage.UnknownError, "%s: failed to decrypt data key: %s", key, err.Error())
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, storage.Errorf(err, storage.UnknownError, "%s: invalid data key: %s", key, err.Error())
+	}
+	return aead, nil
+}
+
+func (bs *BlobStore) Put(ctx context.Context, key string, sink storage.Sink, opts storage.PutOptions) error {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return storage.Errorf(err, storage.UnknownError, "%s: failed to generate data key: %s", key, err.Error())
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return storage.Errorf(err, storage.UnknownError, "%s: %s", key, err.Error())
+	}
+
+	encryptedKey, err := bs.keys.Encrypt(ctx, dataKey)
+	if err != nil {
+		return storage.Errorf(err, storage.UnknownError, "%s: failed to encrypt data key: %s", key, err.Error())
+	}
+
+	md := make(map[string]string, len(opts.Metadata)+3)
+	for k, v := range opts.Metadata {
+		md[k] = v
+	}
+	md[MetadataKey] = AlgorithmAES256GCM
+	md[MetadataKeyDataKey] = base64.StdEncoding.EncodeToString(encryptedKey)
+	md[MetadataKeyChunkSize] = strconv.Itoa(bs.chunkSize)
+	opts.Metadata = md
+
+	return bs.delegate.Put(ctx, key, func(w io.Writer) error {
+		ew := newEncrypter(w, aead, bs.chunkSize)
+		if err := sink(ew); err != nil {
+			return err
+		}
+		return ew.Close()
+	}, opts)
+}
+
+func (bs *BlobStore) Get(ctx context.Context, key string, src storage.Source, opts storage.GetOptions) error {
+	if opts.Offset != 0 || opts.Length != 0 {
+		return bs.getRange(ctx, key, src, opts)
+	}
+
+	// The envelope is recorded in the metadata of the blob.
+	opts.IncludeMetadata = true
+
+	return bs.delegate.Get(ctx, key, func(meta *storage.Meta, r io.Reader) error {
+		env, err := stripEnvelope(meta)
+		if err != nil {
+			return err
+		} else if env == nil {
+			return src(meta, r)
+		}
+
+		aead, err := bs.aead(ctx, key, env)
+		if err != nil {
+			return err
+		}
+
+		return src(meta, newDecrypter(r, aead, env.chunkSize, 0, -1))
+	}, opts)
+}
+
+// getRange reads a range of the content of a blob by retrieving only the
+// encrypted chunks that overlap it.
+func (bs *BlobStore) getRange(ctx context.Context, key string, src storage.Source, opts storage.GetOptions) error {
+	if opts.Offset < 0 && opts.Length > 0 {
+		return storage.Errorf(
+			nil,
+			storage.UnknownError,
+			"Length must be -1 if Offset is negative in storage.GetOptions")
+	}
+
+	stat, err := storage.Stat(ctx, bs.delegate, key)
+	if err != nil {
+		return err
+	}
+	sealedSize := stat.Size
+	env, err := stripEnvelope(stat)
+	if err != nil {
+		return err
+	} else if env == nil {
+		return bs.delegate.Get(ctx, key, src, opts)
+	}
+	_, chunks := plaintextSize(sealedSize, env.chunkSize, gcmOverhead)
+
+	start, end := opts.Offset, stat.Size
+	if start < 0 {
+		if start += stat.Size; start < 0 {
+			start = 0
+		}
+	} else if start > stat.Size {
+		start = stat.Size
+	}
+	if opts.Length > 0 && start+opts.Length < end {
+		end = start + opts.Length
+	}
+
+	offset := start
+	if opts.Offset > stat.Size {
+		offset = opts.Offset
+	}
+
+	if start >= end {
+		meta := *stat
+		meta.Offset = offset
+		return src(&meta, bytes.NewReader(nil))
+	}
+
+	sealed := int64(env.chunkSize + gcmOverhead)
+	first, last := start/int64(env.chunkSize), (end-1)/int64(env.chunkSize)
+
+	return bs.delegate.Get(ctx, key, func(meta *storage.Meta, r io.Reader) error {
+		if stat.ETag != "" && meta.ETag != stat.ETag {
+			return storage.Errorf(nil, storage.PreconditionFailedError, "%s: blob changed while reading", key)
+		}
+
+		env, err := stripEnvelope(meta)
+		if err != nil {
+			return err
+		} else if env == nil {
+			return storage.Errorf(nil, storage.PreconditionFailedError, "%s: blob changed while reading", key)
+		}
+
+		aead, err := bs.aead(ctx, key, env)
+		if err != nil {
+			return err
+		}
+
+		dr := newDecrypter(r, aead, env.chunkSize, first, chunks-1)
+		if _, err := io.CopyN(ioutil.Discard, dr, start-first*int64(env.chunkSize)); err != nil {
+			return err
+		}
+
+		meta.Size = stat.Size
+		meta.Offset = start
+		return src(meta, io.LimitReader(dr, end-start))
+	}, storage.GetOptions{
+		Offset:          first * sealed,
+		Length:          (last - first + 1) * sealed,
+		IncludeMetadata: true,
+	})
+}
+
+func (bs *BlobStore) Delete(ctx context.Context, key string, opts storage.DeleteOptions) error {
+	return bs.delegate.Delete(ctx, key, opts)
+}
+
+func (bs *BlobStore) Stat(ctx context.Context, key string) (*storage.Meta, error) {
+	meta, err := storage.Stat(ctx, bs.delegate, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := stripEnvelope(meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// List lists the blobs of the delegate blob store, which must implement
+// storage.Lister.
+func (bs *BlobStore) List(ctx context.Context, opts storage.ListOptions) (*storage.ListPage, error) {
+	lister, ok := bs.delegate.(storage.Lister)
+	if !ok {
+		return nil, storage.Errorf(nil, storage.UnknownError, "%T does not support listing", bs.delegate)
+	}
+
+	page, err := lister.List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range page.Entries {
+		if _, err := stripEnvelope(&entry.Meta); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// NewBlobStore creates a blob store that encrypts blobs written to the given
+// delegate using data keys protected by the given key provider.
+func NewBlobStore(delegate storage.BlobStore, keys KeyProvider, opts ...BlobStoreOption) *BlobStore {
+	o := &BlobStoreOptions{
+		ChunkSize: DefaultChunkSize,
+	}
+	o.ApplyOptions(opts)
+
+	return &BlobStore{
+		delegate:  delegate,
+		keys:      keys,
+		chunkSize: o.ChunkSize,
+	}
+}
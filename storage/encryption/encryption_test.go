@@ -0,0 +1,261 @@
+package encryption_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/puppetlabs/leg/storage"
+	"github.com/puppetlabs/leg/storage/compression"
+	"github.com/puppetlabs/leg/storage/encryption"
+	"github.com/puppetlabs/leg/storage/mem"
+	"github.com/puppetlabs/leg/storage/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newKeyProvider(t *testing.T) encryption.KeyProvider {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	keys, err := encryption.NewAESKeyProvider(key)
+	require.NoError(t, err)
+	return keys
+}
+
+func newBlobStore(t *testing.T, opts ...encryption.BlobStoreOption) (*encryption.BlobStore, *mem.Memory) {
+	delegate := mem.NewMemory()
+	return encryption.NewBlobStore(delegate, newKeyProvider(t), opts...), delegate
+}
+
+func put(t *testing.T, bs storage.BlobStore, key string, content []byte, opts storage.PutOptions) {
+	require.NoError(t, bs.Put(context.Background(), key, func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	}, opts))
+}
+
+func get(bs storage.BlobStore, key string, opts storage.GetOptions) (*storage.Meta, []byte, error) {
+	var meta *storage.Meta
+	var content []byte
+	err := bs.Get(context.Background(), key, func(m *storage.Meta, r io.Reader) (err error) {
+		meta = m
+		content, err = ioutil.ReadAll(r)
+		return
+	}, opts)
+	return meta, content, err
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	bs, _ := newBlobStore(t)
+	testutils.RunListerTests(t, bs)
+}
+
+func TestPreconditions(t *testing.T) {
+	t.Parallel()
+	bs, _ := newBlobStore(t)
+	testutils.RunPreconditionTests(t, bs)
+}
+
+func TestStat(t *testing.T) {
+	t.Parallel()
+	bs, _ := newBlobStore(t)
+	testutils.RunStatTests(t, bs)
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+	bs, _ := newBlobStore(t)
+	testutils.RunMetadataTests(t, bs)
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	content := make([]byte, 1000)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name      string
+		ChunkSize int
+		Content   []byte
+	}{
+		{Name: "Empty", ChunkSize: 64, Content: []byte{}},
+		{Name: "Smaller than chunk", ChunkSize: 2048, Content: content},
+		{Name: "Multiple of chunk size", ChunkSize: 100, Content: content},
+		{Name: "Partial final chunk", ChunkSize: 64, Content: content},
+		{Name: "Default chunk size", Content: content},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			var opts []encryption.BlobStoreOption
+			if test.ChunkSize > 0 {
+				opts = append(opts, encryption.WithChunkSize(test.ChunkSize))
+			}
+			bs, delegate := newBlobStore(t, opts...)
+
+			put(t, bs, "key", test.Content, storage.PutOptions{
+				Metadata: map[string]string{"owner": "test"},
+			})
+
+			meta, actual, err := get(bs, "key", storage.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, test.Content, actual)
+			assert.Equal(t, int64(len(test.Content)), meta.Size)
+			assert.Nil(t, meta.MD5)
+			assert.Equal(t, map[string]string{"owner": "test"}, meta.Metadata)
+
+			_, stored, err := get(delegate, "key", storage.GetOptions{})
+			require.NoError(t, err)
+			assert.Greater(t, len(stored), len(test.Content))
+			if len(test.Content) > 0 {
+				assert.False(t, bytes.Contains(stored, test.Content[:32]))
+			}
+		})
+	}
+}
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+
+	content := make([]byte, 1000)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	bs, _ := newBlobStore(t, encryption.WithChunkSize(64))
+	put(t, bs, "key", content, storage.PutOptions{})
+
+	tests := []struct {
+		Offset         int64
+		Length         int64
+		ExpectedOffset int64
+		Expected       []byte
+	}{
+		{Offset: 0, Length: 10, Expected: content[:10]},
+		{Offset: 10, Length: -1, ExpectedOffset: 10, Expected: content[10:]},
+		{Offset: 60, Length: 10, ExpectedOffset: 60, Expected: content[60:70]},
+		{Offset: 64, Length: 64, ExpectedOffset: 64, Expected: content[64:128]},
+		{Offset: 100, Length: 500, ExpectedOffset: 100, Expected: content[100:600]},
+		{Offset: 990, Length: 100, ExpectedOffset: 990, Expected: content[990:]},
+		{Offset: -20, Length: -1, ExpectedOffset: 980, Expected: content[980:]},
+		{Offset: -2000, Length: -1, Expected: content},
+		{Offset: 1000, Length: 10, ExpectedOffset: 1000, Expected: []byte{}},
+		{Offset: 2000, Length: -1, ExpectedOffset: 2000, Expected: []byte{}},
+	}
+	for _, test := range tests {
+		meta, actual, err := get(bs, "key", storage.GetOptions{
+			Offset: test.Offset,
+			Length: test.Length,
+		})
+		require.NoError(t, err, "offset %d, length %d", test.Offset, test.Length)
+		assert.Equal(t, test.Expected, actual, "offset %d, length %d", test.Offset, test.Length)
+		assert.Equal(t, test.ExpectedOffset, meta.Offset, "offset %d, length %d", test.Offset, test.Length)
+		assert.Equal(t, int64(len(content)), meta.Size, "offset %d, length %d", test.Offset, test.Length)
+	}
+
+	_, _, err = get(bs, "key", storage.GetOptions{Offset: -1, Length: 1})
+	require.Error(t, err)
+
+	_, _, err = get(bs, "missing", storage.GetOptions{Offset: 1, Length: 1})
+	require.True(t, storage.IsNotFoundError(err), "%+v", err)
+}
+
+func TestUnencrypted(t *testing.T) {
+	t.Parallel()
+
+	bs, delegate := newBlobStore(t)
+	put(t, delegate, "key", []byte("plain content"), storage.PutOptions{})
+
+	meta, actual, err := get(bs, "key", storage.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "plain content", string(actual))
+	assert.Equal(t, int64(len("plain content")), meta.Size)
+
+	_, actual, err = get(bs, "key", storage.GetOptions{Offset: 6, Length: -1})
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(actual))
+}
+
+func TestTampering(t *testing.T) {
+	t.Parallel()
+
+	content := make([]byte, 300)
+	_, err := rand.Read(content)
+	require.NoError(t, err)
+
+	tests := []struct {
+		Name   string
+		Modify func(stored []byte) []byte
+	}{
+		{
+			Name: "Modified",
+			Modify: func(stored []byte) []byte {
+				stored[100] ^= 1
+				return stored
+			},
+		},
+		{
+			Name: "Truncated at chunk boundary",
+			Modify: func(stored []byte) []byte {
+				return stored[:64+16]
+			},
+		},
+		{
+			Name: "Truncated within chunk",
+			Modify: func(stored []byte) []byte {
+				return stored[:len(stored)-10]
+			},
+		},
+		{
+			Name: "Empty",
+			Modify: func(stored []byte) []byte {
+				return nil
+			},
+		},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			bs, delegate := newBlobStore(t, encryption.WithChunkSize(64))
+			put(t, bs, "key", content, storage.PutOptions{})
+
+			meta, stored, err := get(delegate, "key", storage.GetOptions{})
+			require.NoError(t, err)
+			put(t, delegate, "key", test.Modify(stored), storage.PutOptions{Metadata: meta.Metadata})
+
+			_, _, err = get(bs, "key", storage.GetOptions{})
+			require.Error(t, err)
+		})
+	}
+
+	t.Run("Wrong key provider", func(t *testing.T) {
+		bs, delegate := newBlobStore(t)
+		put(t, bs, "key", content, storage.PutOptions{})
+
+		_, _, err := get(encryption.NewBlobStore(delegate, newKeyProvider(t)), "key", storage.GetOptions{})
+		require.Error(t, err)
+	})
+}
+
+func TestCompression(t *testing.T) {
+	t.Parallel()
+
+	content := bytes.Repeat([]byte("compressible content "), 1000)
+
+	bs, _ := newBlobStore(t)
+	cbs := compression.NewBlobStore(bs, compression.Zstd)
+	put(t, cbs, "key", content, storage.PutOptions{})
+
+	meta, actual, err := get(cbs, "key", storage.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, content, actual)
+	assert.Less(t, meta.Size, int64(len(content)))
+	assert.Empty(t, meta.Metadata)
+}
@@ -0,0 +1,62 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// KeyProvider encrypts and decrypts the data keys used to encrypt blobs. Each
+// blob is encrypted with its own data key, which is stored with the blob in
+// encrypted form.
+//
+// The Vault transit client in the vaultutil module implements this interface.
+type KeyProvider interface {
+	Encrypt(ctx context.Context, plaintext []byte) ([]byte, error)
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+// AESKeyProvider encrypts data keys using AES-GCM with a fixed key-encryption
+// key held in memory.
+type AESKeyProvider struct {
+	aead cipher.AEAD
+}
+
+var _ KeyProvider = &AESKeyProvider{}
+
+func (akp *AESKeyProvider) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, akp.aead.NonceSize(), akp.aead.NonceSize()+len(plaintext)+akp.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return akp.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (akp *AESKeyProvider) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < akp.aead.NonceSize() {
+		return nil, errors.New("encrypted key is too short")
+	}
+
+	nonce, ciphertext := ciphertext[:akp.aead.NonceSize()], ciphertext[akp.aead.NonceSize():]
+	return akp.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// NewAESKeyProvider creates a key provider using the given key-encryption key,
+// which must be 16, 24, or 32 bytes long.
+func NewAESKeyProvider(key []byte) (*AESKeyProvider, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESKeyProvider{aead: aead}, nil
+}
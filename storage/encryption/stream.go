@@ -0,0 +1,176 @@
+package encryption
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Content is encrypted in chunks of a fixed size so that it can be decrypted
+// as a stream and so that ranged reads only need to decrypt the chunks that
+// overlap the range. Each chunk is sealed with AES-GCM using its index and
+// whether it is the final chunk as the nonce, which is safe because every blob
+// has its own data key. Marking the final chunk prevents truncation at a chunk
+// boundary from going undetected. Empty content is encrypted as a single empty
+// final chunk.
+
+var errTruncated = errors.New("encrypted content is truncated")
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(aead cipher.AEAD, index int64, final bool) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+	if final {
+		nonce[8] = 1
+	}
+	return nonce
+}
+
+// plaintextSize returns the size of the content that was encrypted into the
+// given number of bytes, and the number of chunks it occupies.
+func plaintextSize(size int64, chunkSize int, overhead int) (int64, int64) {
+	sealed := int64(chunkSize + overhead)
+
+	chunks := (size + sealed - 1) / sealed
+	if chunks < 1 {
+		chunks = 1
+	}
+	return size - chunks*int64(overhead), chunks
+}
+
+type encrypter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	buf   []byte
+	index int64
+}
+
+func (e *encrypter) seal(final bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.aead, e.index, final), e.buf, nil)
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+
+	e.buf = e.buf[:0]
+	e.index++
+	return nil
+}
+
+func (e *encrypter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		// A full chunk is only sealed once we know it is not the final one.
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return n, err
+			}
+		}
+
+		c := copy(e.buf[len(e.buf):cap(e.buf)], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// Close seals the final chunk. It does not close the underlying writer.
+func (e *encrypter) Close() error {
+	return e.seal(true)
+}
+
+func newEncrypter(w io.Writer, aead cipher.AEAD, chunkSize int) *encrypter {
+	return &encrypter{
+		w:    w,
+		aead: aead,
+		buf:  make([]byte, 0, chunkSize),
+	}
+}
+
+type decrypter struct {
+	r     *bufio.Reader
+	aead  cipher.AEAD
+	index int64
+
+	// final is the index of the final chunk of the content if it is known in
+	// advance, or -1 to detect the final chunk by reaching the end of the
+	// reader.
+	final int64
+
+	sealed []byte
+	plain  []byte
+	buf    []byte
+	done   bool
+}
+
+func (d *decrypter) open() error {
+	n, err := io.ReadFull(d.r, d.sealed)
+	switch {
+	case err == io.EOF:
+		return errTruncated
+	case err == io.ErrUnexpectedEOF:
+	case err != nil:
+		return err
+	}
+
+	var final bool
+	if d.final >= 0 {
+		final = d.index == d.final
+	} else if n < len(d.sealed) {
+		final = true
+	} else if _, err := d.r.Peek(1); err == io.EOF {
+		final = true
+	} else if err != nil {
+		return err
+	}
+
+	if n < len(d.sealed) && !final {
+		return errTruncated
+	}
+
+	d.buf, err = d.aead.Open(d.plain[:0], chunkNonce(d.aead, d.index, final), d.sealed[:n], nil)
+	if err != nil {
+		return err
+	}
+
+	d.index++
+	d.done = final
+	return nil
+}
+
+func (d *decrypter) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+func newDecrypter(r io.Reader, aead cipher.AEAD, chunkSize int, index, final int64) *decrypter {
+	return &decrypter{
+		r:      bufio.NewReader(r),
+		aead:   aead,
+		index:  index,
+		final:  final,
+		sealed: make([]byte, chunkSize+aead.Overhead()),
+		plain:  make([]byte, 0, chunkSize),
+	}
+}
@@ -2,13 +2,19 @@ package filesystem
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 
 	"github.com/puppetlabs/leg/storage"
@@ -22,12 +28,24 @@ const (
 	// DefaultDirPermissions is the default permission octal for all directories created
 	// as part of a key's path.
 	DefaultDirPermissions = os.FileMode(0740)
+
+	// DefaultListPageSize is the maximum number of keys and prefixes returned
+	// by a single call to List if the page size is not specified.
+	DefaultListPageSize = 1000
 )
 
 func init() {
 	storage.RegisterFactory("file", New)
 }
 
+// New creates a blob store in the directory given by the path of the URL,
+// which must already exist. The following query parameters are recognized:
+//
+//	filePermissions: The octal permissions of blob files.
+//	dirPermissions: The octal permissions of directories.
+//	signingKey: The secret used to sign URLs.
+//	signingBaseURL: The URL at which the handler returned by
+//	  SignedURLHandler is mounted, used as the base of signed URLs.
 func New(u url.URL) (storage.BlobStore, error) {
 	stat, err := os.Stat(u.Path)
 	if err != nil {
@@ -39,6 +57,8 @@ func New(u url.URL) (storage.BlobStore, error) {
 	fs := &Filesystem{
 		blobPath:        filepath.Join(u.Path, "blob"),
 		metaPath:        filepath.Join(u.Path, "meta"),
+		tmpPath:         filepath.Join(u.Path, "tmp"),
+		uploadPath:      filepath.Join(u.Path, "uploads"),
 		filePermissions: DefaultFilePermissions,
 		dirPermissions:  DefaultDirPermissions,
 	}
@@ -56,21 +76,46 @@ func New(u url.URL) (storage.BlobStore, error) {
 		}
 		fs.dirPermissions = os.FileMode(perm)
 	}
-	// Ensure the blob/ and meta/ dirs exist:
+	if arr := u.Query()["signingKey"]; len(arr) > 0 {
+		fs.signingKey = []byte(arr[0])
+	}
+	if arr := u.Query()["signingBaseURL"]; len(arr) > 0 {
+		base, err := url.Parse(arr[0])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse signingBaseURL=%s (%s)", arr[0], err.Error())
+		}
+		fs.signingBaseURL = base
+	}
+	// Ensure the blob/, meta/, tmp/, and uploads/ dirs exist:
 	if err := os.MkdirAll(fs.blobPath, fs.dirPermissions); err != nil {
 		return nil, err
 	}
 	if err := os.MkdirAll(fs.metaPath, fs.dirPermissions); err != nil {
 		return nil, err
 	}
+	if err := os.MkdirAll(fs.tmpPath, fs.dirPermissions); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(fs.uploadPath, fs.dirPermissions); err != nil {
+		return nil, err
+	}
 	return fs, nil
 }
 
 type Filesystem struct {
 	blobPath        string
 	metaPath        string
+	tmpPath         string
+	uploadPath      string
 	filePermissions os.FileMode
 	dirPermissions  os.FileMode
+	signingKey      []byte
+	signingBaseURL  *url.URL
+
+	// mut serializes updates to blobs and multipart uploads so that
+	// preconditions can be checked atomically. Preconditions are therefore only guaranteed to hold with
+	// respect to other operations using the same Filesystem.
+	mut sync.Mutex
 }
 
 func translateError(err error, format string, a ...interface{}) error {
@@ -113,14 +158,160 @@ func isErrInvalid(err error) bool {
 }
 
 type Meta struct {
-	ContentType string `json:"Content-Type"`
+	ContentType        string            `json:"Content-Type"`
+	ContentEncoding    string            `json:"Content-Encoding,omitempty"`
+	CacheControl       string            `json:"Cache-Control,omitempty"`
+	ContentDisposition string            `json:"Content-Disposition,omitempty"`
+	Metadata           map[string]string `json:"Metadata,omitempty"`
+	Generation         int64             `json:"Generation,omitempty"`
+	MD5                []byte            `json:"MD5,omitempty"`
+}
+
+// ETag returns the ETag of the blob, which is derived from its generation.
+func (m *Meta) ETag() string {
+	return strconv.FormatInt(m.Generation, 10)
+}
+
+// storageMeta converts the metadata to a storage.Meta for a blob with the
+// given file information.
+func (m *Meta) storageMeta(fi os.FileInfo) storage.Meta {
+	return storage.Meta{
+		ContentType:        m.ContentType,
+		Size:               fi.Size(),
+		ModificationTime:   fi.ModTime(),
+		ETag:               m.ETag(),
+		MD5:                m.MD5,
+		ContentEncoding:    m.ContentEncoding,
+		CacheControl:       m.CacheControl,
+		ContentDisposition: m.ContentDisposition,
+		Metadata:           m.Metadata,
+	}
+}
+
+func (fs *Filesystem) readMeta(key string) (*Meta, error) {
+	m := &Meta{}
+	if err := readJSON(filepath.Join(fs.metaPath, key), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (fs *Filesystem) writeMeta(key string, m *Meta) error {
+	return fs.writeJSON(filepath.Join(fs.metaPath, key), m)
+}
+
+func readJSON(path string, v interface{}) (err error) {
+	f, rerr := os.Open(path)
+	if rerr != nil {
+		return translateError(rerr, "open(%s)", path)
+	}
+	defer func() {
+		rerr := f.Close()
+		if nil == err {
+			err = translateError(rerr, "close(%s)", path)
+		}
+	}()
+
+	if rerr := json.NewDecoder(f).Decode(v); rerr != nil {
+		return translateError(rerr, "read(%s)", path)
+	}
+	return nil
+}
+
+// writeJSON atomically replaces the file at the given path with the JSON
+// encoding of v.
+func (fs *Filesystem) writeJSON(path string, v interface{}) error {
+	tmp, err := fs.writeTemp(func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return translateError(err, "rename(%s, %s)", tmp, path)
+	}
+	return nil
+}
+
+// writeTemp writes content to a new file in the temporary directory and
+// returns its path. The file can then be atomically moved into place.
+func (fs *Filesystem) writeTemp(fn func(io.Writer) error) (_ string, err error) {
+	f, rerr := ioutil.TempFile(fs.tmpPath, "put-")
+	if rerr != nil {
+		return "", translateError(rerr, "create(%s)", fs.tmpPath)
+	}
+	path := f.Name()
+	defer func() {
+		rerr := f.Close()
+		if nil == err {
+			err = translateError(rerr, "close(%s)", path)
+		}
+		if nil != err {
+			os.Remove(path)
+		}
+	}()
+
+	if rerr := f.Chmod(fs.filePermissions); rerr != nil {
+		return "", translateError(rerr, "chmod(%s)", path)
+	}
+	if rerr := fn(f); rerr != nil {
+		return "", translateError(rerr, "write(%s)", path)
+	}
+	return path, nil
+}
+
+// checkPreconditions must be called with the lock held.
+func (fs *Filesystem) checkPreconditions(key string, ifMatch string, ifNoneMatch bool) (*Meta, error) {
+	if ifMatch != "" && ifNoneMatch {
+		return nil, storage.Errorf(nil, storage.UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	}
+
+	m, err := fs.readMeta(key)
+	if storage.IsNotFoundError(err) {
+		if ifMatch != "" {
+			return nil, storage.Errorf(err, storage.PreconditionFailedError, "%s: blob does not exist", key)
+		}
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if ifNoneMatch {
+		return nil, storage.Errorf(nil, storage.PreconditionFailedError, "%s: blob already exists", key)
+	} else if ifMatch != "" && ifMatch != m.ETag() {
+		return nil, storage.Errorf(nil, storage.PreconditionFailedError, "%s: ETag %q does not match %q", key, m.ETag(), ifMatch)
+	}
+	return m, nil
 }
 
-func (fs *Filesystem) Put(ctx context.Context, key string, sink storage.Sink, opts storage.PutOptions) (err error) {
+func (fs *Filesystem) Put(ctx context.Context, key string, sink storage.Sink, opts storage.PutOptions) error {
 	if key == "" {
 		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
 	}
 
+	// The sink writes to a temporary file so that the blob is replaced
+	// atomically once we know the preconditions still hold.
+	h := md5.New()
+	tmp, err := fs.writeTemp(func(w io.Writer) error {
+		return sink(io.MultiWriter(w, h))
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	return fs.commit(key, tmp, h.Sum(nil), opts)
+}
+
+// commit moves a temporary file into place as the content of the blob with the
+// given key if the preconditions in opts hold. It must be called with the lock
+// held.
+func (fs *Filesystem) commit(key, tmp string, sum []byte, opts storage.PutOptions) error {
 	dir, _ := filepath.Split(key)
 
 	if dir != "" {
@@ -134,45 +325,30 @@ func (fs *Filesystem) Put(ctx context.Context, key string, sink storage.Sink, op
 		}
 	}
 
-	if true {
-		path := filepath.Join(fs.metaPath, key)
-
-		f, rerr := os.OpenFile(path, os.O_RDWR|os.O_CREATE, fs.filePermissions)
-		if rerr != nil {
-			return translateError(rerr, "open(%s)", path)
-		}
-		defer func() {
-			rerr := f.Close()
-			if nil == err {
-				err = translateError(rerr, "close(%s)", path)
-			}
-		}()
-		rerr = json.NewEncoder(f).Encode(&Meta{
-			ContentType: opts.ContentType,
-		})
-		if rerr != nil {
-			return translateError(rerr, "write(%s)", path)
-		}
+	prev, err := fs.checkPreconditions(key, opts.IfMatch, opts.IfNoneMatch)
+	if err != nil {
+		return err
 	}
 
-	path := filepath.Join(fs.blobPath, key)
-
-	f, rerr := os.OpenFile(path, os.O_RDWR|os.O_CREATE, fs.filePermissions)
-	if rerr != nil {
-		return translateError(rerr, "open(%s)", path)
+	m := &Meta{
+		ContentType:        opts.ContentType,
+		ContentEncoding:    opts.ContentEncoding,
+		CacheControl:       opts.CacheControl,
+		ContentDisposition: opts.ContentDisposition,
+		Metadata:           opts.Metadata,
+		Generation:         1,
+		MD5:                sum,
+	}
+	if prev != nil {
+		m.Generation = prev.Generation + 1
 	}
-	defer func() {
-		rerr := f.Close()
-		if nil == err {
-			err = translateError(rerr, "close(%s)", path)
-		}
-	}()
 
-	if rerr := sink(f); rerr != nil {
-		return translateError(rerr, "write(%s)", path)
+	path := filepath.Join(fs.blobPath, key)
+	if rerr := os.Rename(tmp, path); rerr != nil {
+		return translateError(rerr, "rename(%s, %s)", tmp, path)
 	}
 
-	return nil
+	return fs.writeMeta(key, m)
 }
 
 type truncatedReader struct {
@@ -197,34 +373,13 @@ func (fs *Filesystem) Get(ctx context.Context, key string, src storage.Source, o
 		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
 	}
 
-	var meta storage.Meta
-	if true {
-		path := filepath.Join(fs.metaPath, key)
-
-		f, rerr := os.Open(path)
-		if rerr != nil {
-			return translateError(rerr, "open(%s)", path)
-		}
-		defer func() {
-			rerr := f.Close()
-			if nil == err {
-				err = translateError(rerr, "close(%s)", path)
-			}
-		}()
-		var m Meta
-		rerr = json.NewDecoder(f).Decode(&m)
-		if rerr != nil {
-			return translateError(rerr, "read(%s)", path)
-		}
-		meta.ContentType = m.ContentType
+	m, f, rerr := fs.openBlob(key)
+	if rerr != nil {
+		return rerr
 	}
 
 	path := filepath.Join(fs.blobPath, key)
 
-	f, rerr := os.Open(path)
-	if rerr != nil {
-		return translateError(rerr, "open(%s)", path)
-	}
 	defer func() {
 		rerr := f.Close()
 		if nil == err {
@@ -236,7 +391,7 @@ func (fs *Filesystem) Get(ctx context.Context, key string, src storage.Source, o
 	if nil != rerr {
 		return translateError(rerr, "stat(%s)", path)
 	}
-	meta.Size = fi.Size()
+	meta := m.storageMeta(fi)
 
 	var reader io.Reader
 	if opts.Offset < 0 {
@@ -277,11 +432,84 @@ func (fs *Filesystem) Get(ctx context.Context, key string, src storage.Source, o
 	return nil
 }
 
+// Copy copies a blob. The content of the source blob is copied to a temporary
+// file first, so the destination blob is replaced atomically.
+func (fs *Filesystem) Copy(ctx context.Context, srcKey, dstKey string, opts storage.CopyOptions) error {
+	if srcKey == "" || dstKey == "" {
+		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	} else if opts.IfMatch != "" && opts.IfNoneMatch {
+		return storage.Errorf(nil, storage.UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	}
+
+	m, f, err := fs.openBlob(srcKey)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if opts.SourceIfMatch != "" && opts.SourceIfMatch != m.ETag() {
+		return storage.Errorf(nil, storage.PreconditionFailedError, "%s: ETag %q does not match %q", srcKey, m.ETag(), opts.SourceIfMatch)
+	}
+
+	h := md5.New()
+	tmp, err := fs.writeTemp(func(w io.Writer) error {
+		_, err := io.Copy(io.MultiWriter(w, h), f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	return fs.commit(dstKey, tmp, h.Sum(nil), storage.PutOptions{
+		ContentType:        m.ContentType,
+		ContentEncoding:    m.ContentEncoding,
+		CacheControl:       m.CacheControl,
+		ContentDisposition: m.ContentDisposition,
+		Metadata:           m.Metadata,
+		IfMatch:            opts.IfMatch,
+		IfNoneMatch:        opts.IfNoneMatch,
+	})
+}
+
+// openBlob opens a blob and reads its metadata. Blobs are replaced by renaming
+// them, so the open file continues to hold the content that corresponds to the
+// metadata even if the blob is replaced while it is being read.
+func (fs *Filesystem) openBlob(key string) (*Meta, *os.File, error) {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	m, err := fs.readMeta(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	path := filepath.Join(fs.blobPath, key)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, translateError(err, "open(%s)", path)
+	}
+	return m, f, nil
+}
+
 func (fs *Filesystem) Delete(ctx context.Context, key string, opts storage.DeleteOptions) error {
 	if key == "" {
 		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
 	}
 
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	if opts.IfMatch != "" {
+		if _, err := fs.checkPreconditions(key, opts.IfMatch, false); err != nil {
+			return err
+		}
+	}
+
 	if true {
 		path := filepath.Join(fs.metaPath, key)
 
@@ -300,3 +528,135 @@ func (fs *Filesystem) Delete(ctx context.Context, key string, opts storage.Delet
 
 	return nil
 }
+
+func (fs *Filesystem) Stat(ctx context.Context, key string) (*storage.Meta, error) {
+	if key == "" {
+		return nil, storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	}
+
+	m, f, err := fs.openBlob(key)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	path := filepath.Join(fs.blobPath, key)
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, translateError(err, "stat(%s)", path)
+	}
+
+	meta := m.storageMeta(fi)
+	return &meta, nil
+}
+
+func encodePageToken(last string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(last))
+}
+
+func decodePageToken(token string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", storage.Errorf(err, storage.UnknownError, "invalid page token %q: %s", token, err.Error())
+	}
+	return string(b), nil
+}
+
+func (fs *Filesystem) List(ctx context.Context, opts storage.ListOptions) (*storage.ListPage, error) {
+	var start string
+	if opts.PageToken != "" {
+		var err error
+		if start, err = decodePageToken(opts.PageToken); err != nil {
+			return nil, err
+		}
+	}
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultListPageSize
+	}
+
+	// Only the directory that contains the prefix needs to be walked.
+	root := fs.blobPath
+	if i := strings.LastIndex(opts.Prefix, "/"); i >= 0 {
+		root = filepath.Join(fs.blobPath, filepath.FromSlash(opts.Prefix[:i]))
+	}
+
+	infos := make(map[string]os.FileInfo)
+	var keys []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == root && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(fs.blobPath, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			if path != root && !strings.HasPrefix(key+"/", opts.Prefix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(key, opts.Prefix) {
+			keys = append(keys, key)
+			infos[key] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, translateError(err, "walk(%s)", root)
+	}
+
+	// Walking orders by path component, not by key.
+	sort.Strings(keys)
+
+	page := &storage.ListPage{}
+	var last string
+	for _, key := range keys {
+		item, isPrefix := key, false
+		if opts.Delimiter != "" {
+			if i := strings.Index(key[len(opts.Prefix):], opts.Delimiter); i >= 0 {
+				item, isPrefix = key[:len(opts.Prefix)+i+len(opts.Delimiter)], true
+			}
+		}
+
+		if item <= start || item == last {
+			continue
+		} else if len(page.Entries)+len(page.Prefixes) >= pageSize {
+			page.NextPageToken = encodePageToken(last)
+			break
+		}
+		last = item
+
+		if isPrefix {
+			page.Prefixes = append(page.Prefixes, item)
+			continue
+		}
+
+		m, err := fs.readMeta(key)
+		if storage.IsNotFoundError(err) {
+			// The blob was deleted after we walked the directory.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		page.Entries = append(page.Entries, &storage.ListEntry{
+			Key:  key,
+			Meta: m.storageMeta(infos[key]),
+		})
+	}
+	return page, nil
+}
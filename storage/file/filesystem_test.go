@@ -3,15 +3,23 @@ package filesystem_test
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/puppetlabs/leg/storage"
+	filesystem "github.com/puppetlabs/leg/storage/file"
 	"github.com/puppetlabs/leg/storage/testutils"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -294,3 +302,266 @@ func TestCanDeleteFile(t *testing.T) {
 		}
 	})
 }
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		testutils.RunListerTests(t, backend)
+	})
+}
+
+func TestPreconditions(t *testing.T) {
+	t.Parallel()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		testutils.RunPreconditionTests(t, backend)
+	})
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		testutils.RunCopyTests(t, backend)
+	})
+}
+
+func TestMultipartUpload(t *testing.T) {
+	t.Parallel()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		testutils.RunMultipartUploadTests(t, backend)
+
+		// Completed and aborted uploads must not leave any staged parts.
+		entries, err := ioutil.ReadDir(filepath.Join(tmp, "uploads"))
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+}
+
+func TestConcurrentConditionalUpdates(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		require.NoError(t, backend.Put(ctx, "counter", func(w io.Writer) error {
+			_, err := io.WriteString(w, "0")
+			return err
+		}, storage.PutOptions{IfNoneMatch: true}))
+
+		const n = 10
+
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for {
+					var etag string
+					var value int
+					if !assert.NoError(t, backend.Get(ctx, "counter", func(meta *storage.Meta, r io.Reader) (err error) {
+						etag = meta.ETag
+						_, err = fmt.Fscan(r, &value)
+						return
+					}, storage.GetOptions{})) {
+						return
+					}
+
+					err := backend.Put(ctx, "counter", func(w io.Writer) error {
+						_, err := fmt.Fprint(w, value+1)
+						return err
+					}, storage.PutOptions{IfMatch: etag})
+					if storage.IsPreconditionFailedError(err) {
+						continue
+					}
+					assert.NoError(t, err)
+					return
+				}
+			}()
+		}
+		wg.Wait()
+
+		b, err := ioutil.ReadFile(filepath.Join(tmp, "blob", "counter"))
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprint(n), string(b))
+	})
+}
+
+func TestConcurrentReadsMatchMetadata(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		put := func(gen int) error {
+			return backend.Put(ctx, "blob", func(w io.Writer) error {
+				_, err := io.WriteString(w, strings.Repeat("x", gen))
+				return err
+			}, storage.PutOptions{Metadata: map[string]string{"gen": fmt.Sprint(gen)}})
+		}
+		require.NoError(t, put(1))
+
+		const n = 100
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := 2; i <= n; i++ {
+				if !assert.NoError(t, put(i)) {
+					return
+				}
+			}
+		}()
+
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < n; j++ {
+					if !assert.NoError(t, backend.Get(ctx, "blob", func(meta *storage.Meta, r io.Reader) error {
+						b, err := ioutil.ReadAll(r)
+						if err != nil {
+							return err
+						}
+						assert.Equal(t, meta.Metadata["gen"], fmt.Sprint(len(b)))
+						return nil
+					}, storage.GetOptions{})) {
+						return
+					}
+
+					meta, err := storage.Stat(ctx, backend, "blob")
+					if !assert.NoError(t, err) {
+						return
+					}
+					assert.Equal(t, meta.Metadata["gen"], fmt.Sprint(meta.Size))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestStat(t *testing.T) {
+	t.Parallel()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		testutils.RunStatTests(t, backend)
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		testutils.RunMetadataTests(t, backend)
+	})
+}
+
+func TestSignedURLs(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	tmp, err := ioutil.TempDir("", "tmp-blob-store-")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	var h http.Handler
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse("file://" + tmp)
+	require.NoError(t, err)
+	u.RawQuery = url.Values{
+		"signingKey":     []string{"secret"},
+		"signingBaseURL": []string{ts.URL + "/blobs/"},
+	}.Encode()
+
+	backend, err := storage.NewBlobStore(*u)
+	require.NoError(t, err)
+	h = backend.(*filesystem.Filesystem).SignedURLHandler()
+
+	signer := backend.(storage.Signer)
+
+	do := func(method, u, contentType string, body io.Reader) (*http.Response, string) {
+		req, err := http.NewRequest(method, u, body)
+		require.NoError(t, err)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(b)
+	}
+
+	put, err := signer.SignURL(ctx, "dir/key.txt", storage.SignOptions{
+		Method:      http.MethodPut,
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(put, ts.URL+"/blobs/dir/key.txt?"), put)
+
+	resp, _ := do(http.MethodPut, put, "application/json", strings.NewReader("test content"))
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, _ = do(http.MethodPut, put, "text/plain", strings.NewReader("test content"))
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	get, err := signer.SignURL(ctx, "dir/key.txt", storage.SignOptions{})
+	require.NoError(t, err)
+
+	resp, body := do(http.MethodGet, get, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+	assert.Equal(t, "test content", body)
+
+	req, err := http.NewRequest(http.MethodGet, get, nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=5-")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "content", string(b))
+
+	// A GET URL can't be used to write.
+	resp, _ = do(http.MethodPut, get, "text/plain", strings.NewReader("other content"))
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// Nor can it be used for a different key.
+	resp, _ = do(http.MethodGet, strings.Replace(get, "key.txt", "other.txt", 1), "", nil)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	missing, err := signer.SignURL(ctx, "dir/missing.txt", storage.SignOptions{})
+	require.NoError(t, err)
+	resp, _ = do(http.MethodGet, missing, "", nil)
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	expiring, err := signer.SignURL(ctx, "dir/key.txt", storage.SignOptions{Duration: time.Second})
+	require.NoError(t, err)
+	time.Sleep(2 * time.Second)
+	resp, _ = do(http.MethodGet, expiring, "", nil)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestSignURLRequiresConfiguration(t *testing.T) {
+	t.Parallel()
+
+	withTempDir(t, func(t *testing.T, backend storage.BlobStore, tmp string) {
+		_, err := backend.(storage.Signer).SignURL(context.Background(), "key", storage.SignOptions{})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,249 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/puppetlabs/leg/storage"
+)
+
+// upload is the manifest of a multipart upload. It is stored in the directory
+// of the upload alongside the staged part files.
+type upload struct {
+	Key     string
+	Options storage.PutOptions
+	Parts   map[int]*uploadPart `json:",omitempty"`
+}
+
+type uploadPart struct {
+	ETag string
+	Size int64
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", storage.Errorf(err, storage.UnknownError, "failed to generate upload ID: %s", err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// uploadDir returns the directory holding the manifest and parts of an upload.
+// Upload IDs are validated so that they cannot refer to other paths.
+func (fs *Filesystem) uploadDir(key, uploadID string) (string, error) {
+	if b, err := hex.DecodeString(uploadID); err != nil || len(b) != 16 {
+		return "", storage.Errorf(err, storage.NotFoundError, "%s: upload %q does not exist", key, uploadID)
+	}
+	return filepath.Join(fs.uploadPath, uploadID), nil
+}
+
+// readUpload reads the manifest of an upload, which must be for the given key.
+func (fs *Filesystem) readUpload(key, uploadID string) (*upload, string, error) {
+	dir, err := fs.uploadDir(key, uploadID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	u := &upload{}
+	if err := readJSON(filepath.Join(dir, "upload.json"), u); storage.IsNotFoundError(err) || (err == nil && u.Key != key) {
+		return nil, "", storage.Errorf(err, storage.NotFoundError, "%s: upload %q does not exist", key, uploadID)
+	} else if err != nil {
+		return nil, "", err
+	}
+	if u.Parts == nil {
+		u.Parts = make(map[int]*uploadPart)
+	}
+	return u, dir, nil
+}
+
+// InitiateUpload starts a multipart upload. Parts are staged in the uploads
+// directory of the blob store until the upload is completed or aborted.
+func (fs *Filesystem) InitiateUpload(ctx context.Context, key string, opts storage.PutOptions) (string, error) {
+	if key == "" {
+		return "", storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	} else if opts.IfMatch != "" && opts.IfNoneMatch {
+		return "", storage.Errorf(nil, storage.UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := fs.uploadDir(key, uploadID)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Mkdir(dir, fs.dirPermissions); err != nil {
+		return "", translateError(err, "mkdir %s", dir)
+	}
+
+	if err := fs.writeJSON(filepath.Join(dir, "upload.json"), &upload{Key: key, Options: opts}); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return uploadID, nil
+}
+
+func (fs *Filesystem) UploadPart(ctx context.Context, key, uploadID string, number int, sink storage.Sink) (*storage.Part, error) {
+	if err := storage.ValidatePartNumber(number); err != nil {
+		return nil, err
+	}
+
+	h := md5.New()
+	cw := &countingWriter{wrap: h}
+	tmp, err := fs.writeTemp(func(w io.Writer) error {
+		return sink(io.MultiWriter(w, cw))
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp)
+
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	u, dir, err := fs.readUpload(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, strconv.Itoa(number))
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, translateError(err, "rename(%s, %s)", tmp, path)
+	}
+
+	part := &uploadPart{
+		ETag: hex.EncodeToString(h.Sum(nil)),
+		Size: cw.n,
+	}
+	u.Parts[number] = part
+	if err := fs.writeJSON(filepath.Join(dir, "upload.json"), u); err != nil {
+		return nil, err
+	}
+
+	return &storage.Part{
+		Number: number,
+		ETag:   part.ETag,
+		Size:   part.Size,
+	}, nil
+}
+
+func (fs *Filesystem) ListParts(ctx context.Context, key, uploadID string) ([]*storage.Part, error) {
+	u, _, err := fs.readUpload(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*storage.Part, 0, len(u.Parts))
+	for number, part := range u.Parts {
+		parts = append(parts, &storage.Part{
+			Number: number,
+			ETag:   part.ETag,
+			Size:   part.Size,
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+// CompleteUpload concatenates the given parts into the blob. The parts are
+// copied without holding the lock on the blob store, so each part is verified
+// against its ETag in case it is concurrently replaced.
+func (fs *Filesystem) CompleteUpload(ctx context.Context, key, uploadID string, parts []*storage.Part) error {
+	u, dir, err := fs.readUpload(key, uploadID)
+	if err != nil {
+		return err
+	} else if err := storage.ValidateParts(parts); err != nil {
+		return err
+	}
+
+	for _, part := range parts {
+		if staged, found := u.Parts[part.Number]; !found || staged.ETag != part.ETag {
+			return storage.Errorf(nil, storage.UnknownError, "%s: part %d with ETag %q was not uploaded", key, part.Number, part.ETag)
+		}
+	}
+
+	h := md5.New()
+	tmp, err := fs.writeTemp(func(w io.Writer) error {
+		for _, part := range parts {
+			if err := copyPart(io.MultiWriter(w, h), filepath.Join(dir, strconv.Itoa(part.Number)), part.ETag); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	// Make sure the upload was not completed or aborted while we were copying
+	// the parts.
+	if _, _, err := fs.readUpload(key, uploadID); err != nil {
+		return err
+	}
+
+	if err := fs.commit(key, tmp, h.Sum(nil), u.Options); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return translateError(err, "remove(%s)", dir)
+	}
+	return nil
+}
+
+func copyPart(w io.Writer, path, etag string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), f); err != nil {
+		return err
+	}
+
+	if hex.EncodeToString(h.Sum(nil)) != etag {
+		return storage.Errorf(nil, storage.UnknownError, "%s: part was replaced during upload completion", path)
+	}
+	return nil
+}
+
+func (fs *Filesystem) AbortUpload(ctx context.Context, key, uploadID string) error {
+	fs.mut.Lock()
+	defer fs.mut.Unlock()
+
+	_, dir, err := fs.readUpload(key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return translateError(err, "remove(%s)", dir)
+	}
+	return nil
+}
+
+type countingWriter struct {
+	wrap io.Writer
+	n    int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.wrap.Write(p)
+	w.n += int64(n)
+	return n, err
+}
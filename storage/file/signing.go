@@ -0,0 +1,185 @@
+package filesystem
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/leg/storage"
+)
+
+func (fs *Filesystem) signature(method, key string, expires int64, contentType string) []byte {
+	mac := hmac.New(sha256.New, fs.signingKey)
+	io.WriteString(mac, strings.Join([]string{method, key, strconv.FormatInt(expires, 10), contentType}, "\n"))
+	return mac.Sum(nil)
+}
+
+// keyPrefix returns the path prefix of signed URLs.
+func (fs *Filesystem) keyPrefix() string {
+	return strings.TrimSuffix(fs.signingBaseURL.Path, "/") + "/"
+}
+
+// SignURL creates a URL for the blob under the signing base URL of the blob
+// store, authenticated with an HMAC-SHA256 signature. The URL is served by the
+// handler returned by SignedURLHandler.
+func (fs *Filesystem) SignURL(ctx context.Context, key string, opts storage.SignOptions) (string, error) {
+	if key == "" {
+		return "", storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	} else if fs.signingKey == nil || fs.signingBaseURL == nil {
+		return "", storage.Errorf(nil, storage.UnknownError, "signingKey and signingBaseURL must be configured to sign URLs")
+	}
+
+	method := opts.Method
+	switch method {
+	case "":
+		method = http.MethodGet
+	case http.MethodGet, http.MethodPut:
+	default:
+		return "", storage.Errorf(nil, storage.UnknownError, "unsupported method %q for signed URL", method)
+	}
+
+	duration := opts.Duration
+	if duration <= 0 {
+		duration = storage.DefaultSignedURLDuration
+	}
+	expires := time.Now().Add(duration).Unix()
+
+	q := make(url.Values)
+	q.Set("Expires", strconv.FormatInt(expires, 10))
+	if opts.ContentType != "" {
+		q.Set("ContentType", opts.ContentType)
+	}
+	q.Set("Signature", hex.EncodeToString(fs.signature(method, key, expires, opts.ContentType)))
+
+	u := *fs.signingBaseURL
+	u.Path = fs.keyPrefix() + key
+	u.RawPath = ""
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// SignedURLHandler returns an HTTP handler that serves URLs created by
+// SignURL. It must be mounted such that request paths include the path of the
+// signing base URL. GET URLs also permit HEAD requests and support ranges.
+func (fs *Filesystem) SignedURLHandler() http.Handler {
+	return http.HandlerFunc(fs.serveSignedURL)
+}
+
+func (fs *Filesystem) serveSignedURL(w http.ResponseWriter, r *http.Request) {
+	if fs.signingKey == nil || fs.signingBaseURL == nil {
+		http.Error(w, "URL signing is not configured", http.StatusInternalServerError)
+		return
+	}
+
+	if !strings.HasPrefix(r.URL.Path, fs.keyPrefix()) {
+		http.NotFound(w, r)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, fs.keyPrefix())
+
+	method := r.Method
+	switch method {
+	case http.MethodHead:
+		method = http.MethodGet
+	case http.MethodGet, http.MethodPut:
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("Expires"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid expiration", http.StatusForbidden)
+		return
+	}
+	sig, err := hex.DecodeString(q.Get("Signature"))
+	if err != nil || !hmac.Equal(sig, fs.signature(method, key, expires, q.Get("ContentType"))) {
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	if time.Now().Unix() > expires {
+		http.Error(w, "signed URL has expired", http.StatusForbidden)
+		return
+	}
+
+	if method == http.MethodPut {
+		fs.servePut(w, r, key, q.Get("ContentType"))
+	} else {
+		fs.serveGet(w, r, key)
+	}
+}
+
+func writeStorageError(w http.ResponseWriter, err error) {
+	switch {
+	case storage.IsNotFoundError(err):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case storage.IsAuthError(err):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (fs *Filesystem) serveGet(w http.ResponseWriter, r *http.Request, key string) {
+	meta, err := fs.Stat(r.Context(), key)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	path := filepath.Join(fs.blobPath, key)
+
+	f, err := os.Open(path)
+	if err != nil {
+		writeStorageError(w, translateError(err, "open(%s)", path))
+		return
+	}
+	defer f.Close()
+
+	if meta.ContentType != "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	if meta.ContentEncoding != "" {
+		w.Header().Set("Content-Encoding", meta.ContentEncoding)
+	}
+	if meta.CacheControl != "" {
+		w.Header().Set("Cache-Control", meta.CacheControl)
+	}
+	if meta.ContentDisposition != "" {
+		w.Header().Set("Content-Disposition", meta.ContentDisposition)
+	}
+	w.Header().Set("ETag", strconv.Quote(meta.ETag))
+
+	http.ServeContent(w, r, "", meta.ModificationTime, f)
+}
+
+func (fs *Filesystem) servePut(w http.ResponseWriter, r *http.Request, key, contentType string) {
+	if contentType != "" && r.Header.Get("Content-Type") != contentType {
+		http.Error(w, "Content-Type does not match signed URL", http.StatusForbidden)
+		return
+	}
+
+	err := fs.Put(r.Context(), key, func(w io.Writer) error {
+		_, err := io.Copy(w, r.Body)
+		return err
+	}, storage.PutOptions{
+		ContentType: r.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
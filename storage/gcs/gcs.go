@@ -2,19 +2,30 @@ package gcs
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	gcstorage "cloud.google.com/go/storage"
 	"github.com/puppetlabs/leg/storage"
+	"golang.org/x/oauth2/google"
 	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
 )
 
 type GCS struct {
 	client     *gcstorage.Client
 	bucketName string
 	namePrefix string
+
+	// signingCredentials returns the JSON key of the service account used to
+	// sign URLs.
+	signingCredentials func(ctx context.Context) ([]byte, error)
 }
 
 func init() {
@@ -51,6 +62,11 @@ func translateError(err error, format string, a ...interface{}) error {
 				err,
 				storage.AuthError,
 				"%s: %s", msg, err.Error())
+		case 412:
+			return storage.Errorf(
+				err,
+				storage.PreconditionFailedError,
+				"%s: %s", msg, err.Error())
 		}
 	}
 	return storage.Errorf(
@@ -59,9 +75,40 @@ func translateError(err error, format string, a ...interface{}) error {
 		"%s: %s", msg, err.Error())
 }
 
+// generation parses an ETag, which is the object generation, for use in
+// preconditions.
+func generation(key, etag string) (int64, error) {
+	gen, err := strconv.ParseInt(etag, 10, 64)
+	if err != nil || gen <= 0 {
+		return 0, storage.Errorf(err, storage.PreconditionFailedError, "%s: ETag %q is not a valid generation", key, etag)
+	}
+	return gen, nil
+}
+
+// conditions applies the preconditions of a write to an object handle.
+func conditions(obj *gcstorage.ObjectHandle, key string, opts storage.PutOptions) (*gcstorage.ObjectHandle, error) {
+	switch {
+	case opts.IfMatch != "" && opts.IfNoneMatch:
+		return nil, storage.Errorf(nil, storage.UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	case opts.IfMatch != "":
+		gen, err := generation(key, opts.IfMatch)
+		if err != nil {
+			return nil, err
+		}
+		obj = obj.If(gcstorage.Conditions{GenerationMatch: gen})
+	case opts.IfNoneMatch:
+		obj = obj.If(gcstorage.Conditions{DoesNotExist: true})
+	}
+	return obj, nil
+}
+
 func (s *GCS) Put(ctx context.Context, key string, sink storage.Sink, opts storage.PutOptions) (err error) {
 	key = path.Join(s.namePrefix, key)
-	w := s.client.Bucket(s.bucketName).Object(key).NewWriter(ctx)
+	obj, err := conditions(s.client.Bucket(s.bucketName).Object(key), key, opts)
+	if err != nil {
+		return err
+	}
+	w := obj.NewWriter(ctx)
 	defer func() {
 		cerr := w.Close()
 		if nil != cerr && nil == err {
@@ -69,15 +116,33 @@ func (s *GCS) Put(ctx context.Context, key string, sink storage.Sink, opts stora
 		}
 	}()
 	w.ObjectAttrs.ContentType = opts.ContentType
+	w.ObjectAttrs.ContentEncoding = opts.ContentEncoding
+	w.ObjectAttrs.CacheControl = opts.CacheControl
+	w.ObjectAttrs.ContentDisposition = opts.ContentDisposition
+	w.ObjectAttrs.Metadata = opts.Metadata
 	err = translateError(sink(w), "PUT gc://%s/%s", s.bucketName, key)
 	return
 }
 
+// Get reads a blob from the bucket. The reader does not provide all of the
+// metadata of the object, so if GetOptions.IncludeMetadata is set, the
+// attributes of the object are retrieved first and the same generation of the
+// object is then read in a separate request.
 func (s *GCS) Get(ctx context.Context, key string, src storage.Source, opts storage.GetOptions) (err error) {
 	key = path.Join(s.namePrefix, key)
-	obj := s.client.Bucket(s.bucketName).Object(key)
-	var r *gcstorage.Reader
+	// Read the content exactly as it was written, even if it has a content
+	// encoding that GCS could transcode.
+	obj := s.client.Bucket(s.bucketName).Object(key).ReadCompressed(true)
+	var attrs *gcstorage.ObjectAttrs
 	var rerr error
+	if opts.IncludeMetadata {
+		attrs, rerr = obj.Attrs(ctx)
+		if nil != rerr {
+			return translateError(rerr, "GET gc://%s/%s", s.bucketName, key)
+		}
+		obj = obj.Generation(attrs.Generation)
+	}
+	var r *gcstorage.Reader
 	if opts.Length != 0 || opts.Offset != 0 {
 		// Treat 0 length as "undefined length" (aka length=-1) so one can specify
 		// storage.GetOptions{Offset:-10} to fetch the last 10 bytes for example.
@@ -98,19 +163,202 @@ func (s *GCS) Get(ctx context.Context, key string, src storage.Source, opts stor
 			err = translateError(rerr, "GET gc://%s/%s", s.bucketName, key)
 		}
 	}()
-	meta := &storage.Meta{
-		ContentType: r.ContentType(),
-		Offset:      r.Attrs.StartOffset,
-		Size:        r.Attrs.Size,
+	var meta *storage.Meta
+	if attrs != nil {
+		meta = objectMeta(attrs)
+	} else {
+		meta = readerMeta(&r.Attrs)
 	}
+	meta.Offset = r.Attrs.StartOffset
 	err = translateError(src(meta, r), "GET gc://%s/%s", s.bucketName, key)
 	return
 }
 
 func (s *GCS) Delete(ctx context.Context, key string, opts storage.DeleteOptions) error {
 	key = path.Join(s.namePrefix, key)
-	return translateError(s.client.Bucket(s.bucketName).Object(key).Delete(ctx),
-		"DELETE gc://%s/%s", s.bucketName, key)
+	obj := s.client.Bucket(s.bucketName).Object(key)
+	if opts.IfMatch != "" {
+		gen, err := generation(key, opts.IfMatch)
+		if err != nil {
+			return err
+		}
+		obj = obj.If(gcstorage.Conditions{GenerationMatch: gen})
+	}
+
+	err := translateError(obj.Delete(ctx), "DELETE gc://%s/%s", s.bucketName, key)
+	if opts.IfMatch != "" && storage.IsNotFoundError(err) {
+		// A missing object can't match the requested generation.
+		return storage.Errorf(err, storage.PreconditionFailedError, "%s: blob does not exist", key)
+	}
+	return err
+}
+
+// Copy copies a blob within the bucket using the GCS rewrite API, which copies
+// the content headers and metadata of the source object.
+func (s *GCS) Copy(ctx context.Context, srcKey, dstKey string, opts storage.CopyOptions) error {
+	srcName, dstName := path.Join(s.namePrefix, srcKey), path.Join(s.namePrefix, dstKey)
+	bucket := s.client.Bucket(s.bucketName)
+
+	src := bucket.Object(srcName)
+	if opts.SourceIfMatch != "" {
+		gen, err := generation(srcName, opts.SourceIfMatch)
+		if err != nil {
+			return err
+		}
+		src = src.If(gcstorage.Conditions{GenerationMatch: gen})
+	}
+
+	dst, err := conditions(bucket.Object(dstName), dstName, storage.PutOptions{
+		IfMatch:     opts.IfMatch,
+		IfNoneMatch: opts.IfNoneMatch,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.CopierFrom(src).Run(ctx)
+	return translateError(err, "COPY gc://%s/%s to gc://%s/%s", s.bucketName, srcName, s.bucketName, dstName)
+}
+
+func objectMeta(attrs *gcstorage.ObjectAttrs) *storage.Meta {
+	meta := &storage.Meta{
+		ContentType:        attrs.ContentType,
+		Size:               attrs.Size,
+		ModificationTime:   attrs.Updated,
+		ETag:               strconv.FormatInt(attrs.Generation, 10),
+		ContentEncoding:    attrs.ContentEncoding,
+		CacheControl:       attrs.CacheControl,
+		ContentDisposition: attrs.ContentDisposition,
+		Metadata:           attrs.Metadata,
+	}
+	// GCS does not provide an MD5 checksum for composite objects.
+	if len(attrs.MD5) > 0 {
+		meta.MD5 = attrs.MD5
+	}
+	return meta
+}
+
+func readerMeta(attrs *gcstorage.ReaderObjectAttrs) *storage.Meta {
+	return &storage.Meta{
+		ContentType:      attrs.ContentType,
+		Size:             attrs.Size,
+		ModificationTime: attrs.LastModified,
+		ETag:             strconv.FormatInt(attrs.Generation, 10),
+		ContentEncoding:  attrs.ContentEncoding,
+		CacheControl:     attrs.CacheControl,
+	}
+}
+
+func (s *GCS) Stat(ctx context.Context, key string) (*storage.Meta, error) {
+	key = path.Join(s.namePrefix, key)
+	attrs, err := s.client.Bucket(s.bucketName).Object(key).Attrs(ctx)
+	if err != nil {
+		return nil, translateError(err, "HEAD gc://%s/%s", s.bucketName, key)
+	}
+	return objectMeta(attrs), nil
+}
+
+// DefaultListPageSize is the maximum number of keys and prefixes returned by a
+// single call to List if the page size is not specified.
+const DefaultListPageSize = 1000
+
+// objectName returns the name of the object in the bucket corresponding to a
+// key prefix. Unlike path.Join, it preserves any trailing slash.
+func (s *GCS) objectName(prefix string) string {
+	if s.namePrefix == "" || s.namePrefix == "." {
+		return prefix
+	}
+	return s.namePrefix + "/" + prefix
+}
+
+// key returns the storage key corresponding to an object name.
+func (s *GCS) key(name string) string {
+	return strings.TrimPrefix(name, s.objectName(""))
+}
+
+func (s *GCS) List(ctx context.Context, opts storage.ListOptions) (*storage.ListPage, error) {
+	prefix := s.objectName(opts.Prefix)
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultListPageSize
+	}
+
+	it := s.client.Bucket(s.bucketName).Objects(ctx, &gcstorage.Query{
+		Prefix:    prefix,
+		Delimiter: opts.Delimiter,
+	})
+
+	var attrs []*gcstorage.ObjectAttrs
+	token, err := iterator.NewPager(it, pageSize, opts.PageToken).NextPage(&attrs)
+	if err != nil {
+		return nil, translateError(err, "LIST gc://%s/%s", s.bucketName, prefix)
+	}
+
+	page := &storage.ListPage{
+		NextPageToken: token,
+	}
+	for _, attr := range attrs {
+		if attr.Prefix != "" {
+			page.Prefixes = append(page.Prefixes, s.key(attr.Prefix))
+			continue
+		}
+
+		page.Entries = append(page.Entries, &storage.ListEntry{
+			Key:  s.key(attr.Name),
+			Meta: *objectMeta(attr),
+		})
+	}
+	return page, nil
+}
+
+func defaultSigningCredentials(ctx context.Context) ([]byte, error) {
+	creds, err := google.FindDefaultCredentials(ctx, gcstorage.ScopeReadWrite)
+	if err != nil {
+		return nil, err
+	} else if creds.JSON == nil {
+		return nil, errors.New("default credentials do not include a service account key")
+	}
+	return creds.JSON, nil
+}
+
+// SignURL creates a V4 signed URL for the object. Signing requires the
+// application default credentials to be a service account key.
+func (s *GCS) SignURL(ctx context.Context, key string, opts storage.SignOptions) (string, error) {
+	key = path.Join(s.namePrefix, key)
+
+	method := opts.Method
+	switch method {
+	case "":
+		method = http.MethodGet
+	case http.MethodGet, http.MethodPut:
+	default:
+		return "", storage.Errorf(nil, storage.UnknownError, "SIGN gc://%s/%s: unsupported method %q", s.bucketName, key, method)
+	}
+
+	duration := opts.Duration
+	if duration <= 0 {
+		duration = storage.DefaultSignedURLDuration
+	}
+
+	b, err := s.signingCredentials(ctx)
+	if err != nil {
+		return "", storage.Errorf(err, storage.AuthError, "SIGN gc://%s/%s: %s", s.bucketName, key, err.Error())
+	}
+	conf, err := google.JWTConfigFromJSON(b)
+	if err != nil {
+		return "", storage.Errorf(err, storage.AuthError, "SIGN gc://%s/%s: %s", s.bucketName, key, err.Error())
+	}
+
+	u, err := gcstorage.SignedURL(s.bucketName, key, &gcstorage.SignedURLOptions{
+		GoogleAccessID: conf.Email,
+		PrivateKey:     conf.PrivateKey,
+		Method:         method,
+		Expires:        time.Now().Add(duration),
+		ContentType:    opts.ContentType,
+		Scheme:         gcstorage.SigningSchemeV4,
+	})
+	return u, translateError(err, "SIGN gc://%s/%s", s.bucketName, key)
 }
 
 func stripSlash(path string) string {
@@ -122,9 +370,10 @@ func stripSlash(path string) string {
 
 func newGCS(u url.URL, client *gcstorage.Client) (storage.BlobStore, error) {
 	return &GCS{
-		client:     client,
-		bucketName: u.Hostname(),
-		namePrefix: stripSlash(path.Clean(u.Path)),
+		client:             client,
+		bucketName:         u.Hostname(),
+		namePrefix:         stripSlash(path.Clean(u.Path)),
+		signingCredentials: defaultSigningCredentials,
 	}, nil
 }
 
@@ -3,9 +3,18 @@ package gcs
 import (
 	"bytes"
 	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net"
@@ -13,12 +22,18 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	gcstorage "cloud.google.com/go/storage"
 	"github.com/google/uuid"
 	"github.com/puppetlabs/leg/storage"
+	"github.com/puppetlabs/leg/storage/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/api/option"
@@ -193,8 +208,16 @@ func TestPut(t *testing.T) {
 			t.Fatal(err)
 		}
 		rd := multipart.NewReader(r.Body, params["boundary"])
-		rd.NextPart()
 		part, err := rd.NextPart()
+		require.NoError(t, err)
+		var obj raw.Object
+		require.NoError(t, json.NewDecoder(part).Decode(&obj))
+		assert.Equal(t, "text/plain", obj.ContentType)
+		assert.Equal(t, "identity", obj.ContentEncoding)
+		assert.Equal(t, "no-cache", obj.CacheControl)
+		assert.Equal(t, "attachment", obj.ContentDisposition)
+		assert.Equal(t, map[string]string{"foo": "bar"}, obj.Metadata)
+		part, err = rd.NextPart()
 		buf := &bytes.Buffer{}
 		_, err = io.Copy(buf, part)
 		require.Equal(t, buf.Bytes(), payload)
@@ -212,7 +235,13 @@ func TestPut(t *testing.T) {
 		require.NoError(t, gcs.Put(ctx, "test/key", func(w io.Writer) error {
 			_, err := io.Copy(w, buf)
 			return err
-		}, storage.PutOptions{}))
+		}, storage.PutOptions{
+			ContentType:        "text/plain",
+			ContentEncoding:    "identity",
+			CacheControl:       "no-cache",
+			ContentDisposition: "attachment",
+			Metadata:           map[string]string{"foo": "bar"},
+		}))
 	})
 }
 
@@ -222,19 +251,74 @@ func TestGet(t *testing.T) {
 
 	payload := []byte("{\"test\": \"payload\"}")
 
+	var attrRequests int32
 	h := func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/storage/v1/") {
+			atomic.AddInt32(&attrRequests, 1)
+			res := &raw.Object{
+				Name:               "test/key",
+				ContentType:        "application/json",
+				ContentEncoding:    "identity",
+				CacheControl:       "no-cache",
+				ContentDisposition: "attachment",
+				Size:               uint64(len(payload)),
+				Generation:         42,
+				Metadata:           map[string]string{"foo": "bar"},
+			}
+			bytes, err := res.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(bytes)
+			return
+		}
+
+		if gen := r.URL.Query().Get("generation"); gen != "" {
+			assert.Equal(t, "42", gen)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "identity")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Goog-Generation", "42")
 		w.Write(payload)
 	}
 
 	withTestServer(t, http.HandlerFunc(h), func(gcs storage.BlobStore) {
-		buf := &bytes.Buffer{}
-		err := gcs.Get(ctx, "test/key", func(meta *storage.Meta, r io.Reader) error {
-			_, err := io.Copy(buf, r)
-			return err
-		}, storage.GetOptions{})
-		require.NoError(t, err)
+		get := func(t *testing.T, opts storage.GetOptions) *storage.Meta {
+			var meta *storage.Meta
+			buf := &bytes.Buffer{}
+			require.NoError(t, gcs.Get(ctx, "test/key", func(m *storage.Meta, r io.Reader) error {
+				meta = m
+				_, err := io.Copy(buf, r)
+				return err
+			}, opts))
+			require.Equal(t, payload, buf.Bytes())
+
+			assert.Equal(t, "42", meta.ETag)
+			assert.Equal(t, "application/json", meta.ContentType)
+			assert.Equal(t, "identity", meta.ContentEncoding)
+			assert.Equal(t, "no-cache", meta.CacheControl)
+			assert.Equal(t, int64(len(payload)), meta.Size)
+			return meta
+		}
+
+		t.Run("Reader attributes", func(t *testing.T) {
+			atomic.StoreInt32(&attrRequests, 0)
 
-		require.Equal(t, payload, buf.Bytes())
+			meta := get(t, storage.GetOptions{})
+			assert.Empty(t, meta.ContentDisposition)
+			assert.Empty(t, meta.Metadata)
+			assert.Equal(t, int32(0), atomic.LoadInt32(&attrRequests))
+		})
+
+		t.Run("Include metadata", func(t *testing.T) {
+			atomic.StoreInt32(&attrRequests, 0)
+
+			meta := get(t, storage.GetOptions{IncludeMetadata: true})
+			assert.Equal(t, "attachment", meta.ContentDisposition)
+			assert.Equal(t, map[string]string{"foo": "bar"}, meta.Metadata)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&attrRequests))
+		})
 	})
 }
 
@@ -255,3 +339,596 @@ func TestDelete(t *testing.T) {
 		require.NoError(t, gcs.Delete(ctx, "test/key", storage.DeleteOptions{}))
 	})
 }
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	updated := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "a/", r.URL.Query().Get("prefix"))
+		assert.Equal(t, "/", r.URL.Query().Get("delimiter"))
+		assert.Equal(t, "2", r.URL.Query().Get("maxResults"))
+
+		res := &raw.Objects{
+			Items: []*raw.Object{
+				{
+					Name:        "a/1",
+					ContentType: "text/plain",
+					Size:        1,
+					Updated:     updated.Format(time.RFC3339),
+					Generation:  3,
+				},
+			},
+			Prefixes: []string{"a/b/"},
+		}
+		if r.URL.Query().Get("pageToken") == "" {
+			res.NextPageToken = "next"
+		}
+		bytes, err := res.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes)
+	}
+
+	withTestServer(t, http.HandlerFunc(h), func(gcs storage.BlobStore) {
+		page, err := gcs.(storage.Lister).List(ctx, storage.ListOptions{
+			Prefix:    "a/",
+			Delimiter: "/",
+			PageSize:  2,
+		})
+		require.NoError(t, err)
+		require.Equal(t, &storage.ListPage{
+			Entries: []*storage.ListEntry{
+				{
+					Key: "a/1",
+					Meta: storage.Meta{
+						ContentType:      "text/plain",
+						Size:             1,
+						ModificationTime: updated,
+						ETag:             "3",
+					},
+				},
+			},
+			Prefixes:      []string{"a/b/"},
+			NextPageToken: "next",
+		}, page)
+
+		page, err = gcs.(storage.Lister).List(ctx, storage.ListOptions{
+			Prefix:    "a/",
+			Delimiter: "/",
+			PageSize:  2,
+			PageToken: page.NextPageToken,
+		})
+		require.NoError(t, err)
+		require.Empty(t, page.NextPageToken)
+	})
+}
+
+func TestPreconditions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var expected string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, expected, r.URL.Query().Get("ifGenerationMatch"))
+
+		w.WriteHeader(http.StatusPreconditionFailed)
+		w.Write([]byte(`{"error": {"code": 412, "message": "Precondition Failed"}}`))
+	}
+
+	withTestServer(t, http.HandlerFunc(h), func(gcs storage.BlobStore) {
+		expected = "5"
+		err := gcs.Put(ctx, "test/key", func(w io.Writer) error {
+			_, err := w.Write([]byte("test string"))
+			return err
+		}, storage.PutOptions{IfMatch: "5"})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		expected = "0"
+		err = gcs.Put(ctx, "test/key", func(w io.Writer) error {
+			_, err := w.Write([]byte("test string"))
+			return err
+		}, storage.PutOptions{IfNoneMatch: true})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		expected = "7"
+		err = gcs.Delete(ctx, "test/key", storage.DeleteOptions{IfMatch: "7"})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		err = gcs.Delete(ctx, "test/key", storage.DeleteOptions{IfMatch: "not-a-generation"})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+	})
+}
+
+func TestStat(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	updated := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		res := &raw.Object{
+			Name:        "test/key",
+			ContentType: "text/plain",
+			Size:        11,
+			Updated:     updated.Format(time.RFC3339),
+			Generation:  3,
+			Md5Hash:     "bzhJL5pH+ndYQsPsWA9TJg==",
+			Metadata:    map[string]string{"foo": "bar"},
+		}
+		bytes, err := res.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(bytes)
+	}
+
+	withTestServer(t, http.HandlerFunc(h), func(gcs storage.BlobStore) {
+		meta, err := gcs.(storage.Stater).Stat(ctx, "test/key")
+		require.NoError(t, err)
+		require.Equal(t, &storage.Meta{
+			ContentType:      "text/plain",
+			Size:             11,
+			ModificationTime: updated,
+			ETag:             "3",
+			MD5:              []byte{0x6f, 0x38, 0x49, 0x2f, 0x9a, 0x47, 0xfa, 0x77, 0x58, 0x42, 0xc3, 0xec, 0x58, 0x0f, 0x53, 0x26},
+			Metadata:         map[string]string{"foo": "bar"},
+		}, meta)
+	})
+}
+
+func TestStatNotFound(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"code": 404, "message": "Not Found"}}`))
+	}
+
+	withTestServer(t, http.HandlerFunc(h), func(gcs storage.BlobStore) {
+		_, err := gcs.(storage.Stater).Stat(ctx, "test/key")
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+	})
+}
+
+func TestSignURL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	creds, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "test@example.iam.gserviceaccount.com",
+		"private_key": string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(key),
+		})),
+	})
+	require.NoError(t, err)
+
+	bs, err := newGCS(toUrl("gs://bucket/prefix"), nil)
+	require.NoError(t, err)
+
+	gcs := bs.(*GCS)
+	gcs.signingCredentials = func(ctx context.Context) ([]byte, error) {
+		return creds, nil
+	}
+
+	s, err := gcs.SignURL(ctx, "test/key", storage.SignOptions{
+		Method:      http.MethodPut,
+		Duration:    time.Hour,
+		ContentType: "text/plain",
+	})
+	require.NoError(t, err)
+
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+	assert.Equal(t, "/bucket/prefix/test/key", u.Path)
+	assert.Equal(t, "GOOG4-RSA-SHA256", u.Query().Get("X-Goog-Algorithm"))
+	assert.True(t, strings.HasPrefix(u.Query().Get("X-Goog-Credential"), "test@example.iam.gserviceaccount.com/"))
+	expires, err := strconv.Atoi(u.Query().Get("X-Goog-Expires"))
+	require.NoError(t, err)
+	assert.InDelta(t, 3600, expires, 5)
+	assert.Contains(t, u.Query().Get("X-Goog-SignedHeaders"), "content-type")
+	assert.NotEmpty(t, u.Query().Get("X-Goog-Signature"))
+
+	_, err = gcs.SignURL(ctx, "test/key", storage.SignOptions{Method: http.MethodDelete})
+	require.Error(t, err)
+
+	gcs.signingCredentials = func(ctx context.Context) ([]byte, error) {
+		return nil, errors.New("no credentials")
+	}
+	_, err = gcs.SignURL(ctx, "test/key", storage.SignOptions{})
+	require.True(t, storage.IsAuthError(err), "%+v", err)
+}
+
+type fakeGCSObject struct {
+	data  []byte
+	attrs *raw.Object
+}
+
+// fakeGCS is a minimal in-process stand-in for the GCS JSON API that supports
+// the requests needed to upload, read, list, compose, and delete objects in a
+// single bucket.
+type fakeGCS struct {
+	mu         sync.Mutex
+	objects    map[string]*fakeGCSObject
+	generation int64
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{
+		objects: make(map[string]*fakeGCSObject),
+	}
+}
+
+func (f *fakeGCS) writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `{"error": {"code": %d, "message": %q}}`, status, http.StatusText(status))
+}
+
+func (f *fakeGCS) writeObject(w http.ResponseWriter, obj *fakeGCSObject) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(obj.attrs)
+}
+
+// checkGeneration enforces the ifGenerationMatch precondition of a request.
+func (f *fakeGCS) checkGeneration(w http.ResponseWriter, r *http.Request, name string) bool {
+	s := r.URL.Query().Get("ifGenerationMatch")
+	if s == "" {
+		return true
+	}
+
+	gen, _ := strconv.ParseInt(s, 10, 64)
+	obj, found := f.objects[name]
+	if (gen == 0 && found) || (gen != 0 && (!found || obj.attrs.Generation != gen)) {
+		f.writeError(w, http.StatusPreconditionFailed)
+		return false
+	}
+	return true
+}
+
+// store creates a new generation of an object.
+func (f *fakeGCS) store(name string, data []byte, attrs *raw.Object, checksum bool) *fakeGCSObject {
+	f.generation++
+
+	attrs.Name = name
+	attrs.Bucket = "bucket"
+	attrs.Generation = f.generation
+	attrs.Size = uint64(len(data))
+	attrs.Updated = time.Now().UTC().Format(time.RFC3339Nano)
+	attrs.Md5Hash = ""
+	if checksum {
+		sum := md5.Sum(data)
+		attrs.Md5Hash = base64.StdEncoding.EncodeToString(sum[:])
+	}
+
+	obj := &fakeGCSObject{data: data, attrs: attrs}
+	f.objects[name] = obj
+	return obj
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path := r.URL.EscapedPath()
+	switch {
+	case strings.HasPrefix(path, "/upload/storage/v1/b/"):
+		f.insert(w, r)
+	case strings.HasPrefix(path, "/storage/v1/b/"):
+		parts := strings.SplitN(path, "/o", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			f.list(w, r)
+			return
+		}
+
+		escaped := strings.TrimPrefix(parts[1], "/")
+		if i := strings.Index(escaped, "/rewriteTo/b/"); i >= 0 && r.Method == http.MethodPost {
+			dst := strings.SplitN(escaped[i:], "/o/", 2)
+			src, serr := url.PathUnescape(escaped[:i])
+			dstName, derr := url.PathUnescape(dst[len(dst)-1])
+			if serr != nil || derr != nil || len(dst) != 2 {
+				f.writeError(w, http.StatusBadRequest)
+				return
+			}
+			f.rewrite(w, r, src, dstName)
+			return
+		}
+
+		compose := strings.HasSuffix(escaped, "/compose")
+		name, err := url.PathUnescape(strings.TrimSuffix(escaped, "/compose"))
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case compose && r.Method == http.MethodPost:
+			f.compose(w, r, name)
+		case r.Method == http.MethodGet:
+			obj, found := f.objects[name]
+			if !found {
+				f.writeError(w, http.StatusNotFound)
+				return
+			}
+			f.writeObject(w, obj)
+		case r.Method == http.MethodDelete:
+			if _, found := f.objects[name]; !found {
+				f.writeError(w, http.StatusNotFound)
+				return
+			} else if !f.checkGeneration(w, r, name) {
+				return
+			}
+			delete(f.objects, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			f.writeError(w, http.StatusMethodNotAllowed)
+		}
+	default:
+		f.read(w, r)
+	}
+}
+
+func (f *fakeGCS) insert(w http.ResponseWriter, r *http.Request) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	rd := multipart.NewReader(r.Body, params["boundary"])
+	part, err := rd.NextPart()
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest)
+		return
+	}
+	attrs := &raw.Object{}
+	if err := json.NewDecoder(part).Decode(attrs); err != nil {
+		f.writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	part, err = rd.NextPart()
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest)
+		return
+	}
+	data, err := ioutil.ReadAll(part)
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	if !f.checkGeneration(w, r, attrs.Name) {
+		return
+	}
+	f.writeObject(w, f.store(attrs.Name, data, attrs, true))
+}
+
+func (f *fakeGCS) compose(w http.ResponseWriter, r *http.Request, name string) {
+	var req raw.ComposeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.SourceObjects) > 32 {
+		f.writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	var data []byte
+	for _, src := range req.SourceObjects {
+		obj, found := f.objects[src.Name]
+		if !found || (src.Generation != 0 && src.Generation != obj.attrs.Generation) {
+			f.writeError(w, http.StatusNotFound)
+			return
+		}
+		data = append(data, obj.data...)
+	}
+
+	if !f.checkGeneration(w, r, name) {
+		return
+	}
+
+	attrs := req.Destination
+	if attrs == nil {
+		attrs = &raw.Object{}
+	}
+	f.writeObject(w, f.store(name, data, attrs, false))
+}
+
+func (f *fakeGCS) rewrite(w http.ResponseWriter, r *http.Request, src, dst string) {
+	obj, found := f.objects[src]
+	if !found {
+		f.writeError(w, http.StatusNotFound)
+		return
+	}
+
+	if s := r.URL.Query().Get("ifSourceGenerationMatch"); s != "" {
+		if gen, _ := strconv.ParseInt(s, 10, 64); gen != obj.attrs.Generation {
+			f.writeError(w, http.StatusPreconditionFailed)
+			return
+		}
+	}
+	if !f.checkGeneration(w, r, dst) {
+		return
+	}
+
+	attrs := *obj.attrs
+	copied := f.store(dst, obj.data, &attrs, true)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&raw.RewriteResponse{
+		Done:                true,
+		ObjectSize:          int64(len(copied.data)),
+		TotalBytesRewritten: int64(len(copied.data)),
+		Resource:            copied.attrs,
+	})
+}
+
+func (f *fakeGCS) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	delimiter := r.URL.Query().Get("delimiter")
+	start := r.URL.Query().Get("pageToken")
+	maxResults, err := strconv.Atoi(r.URL.Query().Get("maxResults"))
+	if err != nil || maxResults <= 0 {
+		maxResults = 1000
+	}
+
+	var names []string
+	for name := range f.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	res := &raw.Objects{}
+
+	var last string
+	for _, name := range names {
+		item, isPrefix := name, false
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				item, isPrefix = name[:len(prefix)+i+len(delimiter)], true
+			}
+		}
+
+		if item <= start || item == last {
+			continue
+		} else if len(res.Items)+len(res.Prefixes) >= maxResults {
+			res.NextPageToken = last
+			break
+		}
+		last = item
+
+		if isPrefix {
+			res.Prefixes = append(res.Prefixes, item)
+		} else {
+			res.Items = append(res.Items, f.objects[name].attrs)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (f *fakeGCS) read(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if len(parts) != 2 || r.Method != http.MethodGet {
+		f.writeError(w, http.StatusBadRequest)
+		return
+	}
+
+	obj, found := f.objects[parts[1]]
+	if !found {
+		f.writeError(w, http.StatusNotFound)
+		return
+	}
+	if s := r.URL.Query().Get("generation"); s != "" && s != strconv.FormatInt(obj.attrs.Generation, 10) {
+		f.writeError(w, http.StatusNotFound)
+		return
+	}
+
+	size := int64(len(obj.data))
+	start, end := int64(0), size-1
+	if rng := r.Header.Get("Range"); rng != "" {
+		spec := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+		if spec[0] == "" {
+			n, _ := strconv.ParseInt(spec[1], 10, 64)
+			if start = size - n; start < 0 {
+				start = 0
+			}
+		} else {
+			start, _ = strconv.ParseInt(spec[0], 10, 64)
+			if spec[1] != "" {
+				end, _ = strconv.ParseInt(spec[1], 10, 64)
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+		if start >= size {
+			f.writeError(w, http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+
+	w.Header().Set("Content-Type", obj.attrs.ContentType)
+	w.Header().Set("X-Goog-Generation", strconv.FormatInt(obj.attrs.Generation, 10))
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	if r.Header.Get("Range") != "" {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+	_, _ = w.Write(obj.data[start : end+1])
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeGCS(), func(gcs storage.BlobStore) {
+		testutils.RunCopyTests(t, gcs)
+	})
+}
+
+func TestMultipartUpload(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeGCS(), func(gcs storage.BlobStore) {
+		testutils.RunMultipartUploadTests(t, gcs)
+	})
+}
+
+func TestMultipartUploadPreconditions(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeGCS(), func(gcs storage.BlobStore) {
+		testutils.RunPreconditionTests(t, gcs)
+	})
+}
+
+func TestMultipartUploadComposesManyParts(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := newFakeGCS()
+	withTestServer(t, fake, func(gcs storage.BlobStore) {
+		uploader := gcs.(storage.MultipartUploader)
+
+		uploadID, err := uploader.InitiateUpload(ctx, "test/key", storage.PutOptions{})
+		require.NoError(t, err)
+
+		var expected bytes.Buffer
+		var parts []*storage.Part
+		for i := 1; i <= 70; i++ {
+			content := fmt.Sprintf("part %d\n", i)
+			expected.WriteString(content)
+
+			part, err := uploader.UploadPart(ctx, "test/key", uploadID, i, func(w io.Writer) error {
+				_, err := io.WriteString(w, content)
+				return err
+			})
+			require.NoError(t, err)
+			parts = append(parts, part)
+		}
+
+		require.NoError(t, uploader.CompleteUpload(ctx, "test/key", uploadID, parts))
+
+		var buf bytes.Buffer
+		require.NoError(t, gcs.Get(ctx, "test/key", func(meta *storage.Meta, r io.Reader) error {
+			_, err := io.Copy(&buf, r)
+			return err
+		}, storage.GetOptions{}))
+		assert.Equal(t, expected.String(), buf.String())
+
+		// Only the composed blob remains.
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		assert.Len(t, fake.objects, 1)
+	})
+}
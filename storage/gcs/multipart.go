@@ -0,0 +1,283 @@
+package gcs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	gcstorage "cloud.google.com/go/storage"
+	"github.com/puppetlabs/leg/storage"
+	"google.golang.org/api/iterator"
+)
+
+// maxComposeSources is the maximum number of objects GCS will compose in a
+// single request.
+const maxComposeSources = 32
+
+// uploadPrefix is the prefix, relative to the name prefix of the blob store,
+// of the temporary objects that hold the state and parts of multipart uploads.
+// These objects are visible in listings of the bucket until the upload is
+// completed or aborted.
+const uploadPrefix = ".uploads/"
+
+// upload is the content of the object that records the options of a
+// multipart upload.
+type upload struct {
+	Key     string
+	Options storage.PutOptions
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", storage.Errorf(err, storage.UnknownError, "failed to generate upload ID: %s", err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// uploadObjectName returns the name of the object that holds the part with the
+// given number, or the state of the upload if the number is 0.
+func (s *GCS) uploadObjectName(uploadID string, number int) string {
+	if number == 0 {
+		return s.objectName(uploadPrefix + uploadID + "/upload.json")
+	}
+	return s.objectName(fmt.Sprintf("%s%s/%05d", uploadPrefix, uploadID, number))
+}
+
+func (s *GCS) readUpload(ctx context.Context, key, uploadID string) (*upload, error) {
+	if b, err := hex.DecodeString(uploadID); err != nil || len(b) != 16 {
+		return nil, storage.Errorf(err, storage.NotFoundError, "%s: upload %q does not exist", key, uploadID)
+	}
+
+	name := s.uploadObjectName(uploadID, 0)
+	r, err := s.client.Bucket(s.bucketName).Object(name).NewReader(ctx)
+	if err != nil {
+		err = translateError(err, "GET gc://%s/%s", s.bucketName, name)
+		if storage.IsNotFoundError(err) {
+			return nil, storage.Errorf(err, storage.NotFoundError, "%s: upload %q does not exist", key, uploadID)
+		}
+		return nil, err
+	}
+	defer r.Close()
+
+	u := &upload{}
+	if err := json.NewDecoder(r).Decode(u); err != nil {
+		return nil, translateError(err, "GET gc://%s/%s", s.bucketName, name)
+	} else if u.Key != key {
+		return nil, storage.Errorf(nil, storage.NotFoundError, "%s: upload %q does not exist", key, uploadID)
+	}
+	return u, nil
+}
+
+// InitiateUpload starts a multipart upload. Each part is uploaded as a
+// temporary object, and the parts are composed into the blob when the upload
+// is completed.
+func (s *GCS) InitiateUpload(ctx context.Context, key string, opts storage.PutOptions) (_ string, err error) {
+	if opts.IfMatch != "" && opts.IfNoneMatch {
+		return "", storage.Errorf(nil, storage.UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+
+	name := s.uploadObjectName(uploadID, 0)
+	w := s.client.Bucket(s.bucketName).Object(name).NewWriter(ctx)
+	defer func() {
+		cerr := w.Close()
+		if nil != cerr && nil == err {
+			err = translateError(cerr, "PUT gc://%s/%s", s.bucketName, name)
+		}
+	}()
+	w.ObjectAttrs.ContentType = "application/json"
+
+	if err := json.NewEncoder(w).Encode(&upload{Key: key, Options: opts}); err != nil {
+		return "", translateError(err, "PUT gc://%s/%s", s.bucketName, name)
+	}
+	return uploadID, nil
+}
+
+func (s *GCS) UploadPart(ctx context.Context, key, uploadID string, number int, sink storage.Sink) (*storage.Part, error) {
+	if err := storage.ValidatePartNumber(number); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.readUpload(ctx, key, uploadID); err != nil {
+		return nil, err
+	}
+
+	// Canceling the context discards the object if the sink fails.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	name := s.uploadObjectName(uploadID, number)
+	w := s.client.Bucket(s.bucketName).Object(name).NewWriter(ctx)
+	if err := sink(w); err != nil {
+		cancel()
+		w.Close()
+		return nil, translateError(err, "PUT gc://%s/%s", s.bucketName, name)
+	}
+	if err := w.Close(); err != nil {
+		return nil, translateError(err, "PUT gc://%s/%s", s.bucketName, name)
+	}
+
+	attrs := w.Attrs()
+	return &storage.Part{
+		Number: number,
+		ETag:   strconv.FormatInt(attrs.Generation, 10),
+		Size:   attrs.Size,
+	}, nil
+}
+
+// listParts returns the objects that hold the parts of an upload, keyed by
+// part number.
+func (s *GCS) listParts(ctx context.Context, uploadID string) (map[int]*gcstorage.ObjectAttrs, error) {
+	prefix := s.objectName(uploadPrefix + uploadID + "/")
+
+	parts := make(map[int]*gcstorage.ObjectAttrs)
+	it := s.client.Bucket(s.bucketName).Objects(ctx, &gcstorage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		} else if err != nil {
+			return nil, translateError(err, "LIST gc://%s/%s", s.bucketName, prefix)
+		}
+
+		number, err := strconv.Atoi(strings.TrimPrefix(attrs.Name, prefix))
+		if err != nil || number < 1 {
+			// The upload state or an intermediate composite object.
+			continue
+		}
+		parts[number] = attrs
+	}
+	return parts, nil
+}
+
+func (s *GCS) ListParts(ctx context.Context, key, uploadID string) ([]*storage.Part, error) {
+	if _, err := s.readUpload(ctx, key, uploadID); err != nil {
+		return nil, err
+	}
+
+	found, err := s.listParts(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*storage.Part, 0, len(found))
+	for number := 1; len(parts) < len(found); number++ {
+		if attrs, ok := found[number]; ok {
+			parts = append(parts, &storage.Part{
+				Number: number,
+				ETag:   strconv.FormatInt(attrs.Generation, 10),
+				Size:   attrs.Size,
+			})
+		}
+	}
+	return parts, nil
+}
+
+// CompleteUpload composes the parts into the blob. GCS limits the number of
+// objects that can be composed at once, so larger uploads are composed into
+// intermediate objects first.
+func (s *GCS) CompleteUpload(ctx context.Context, key, uploadID string, parts []*storage.Part) error {
+	u, err := s.readUpload(ctx, key, uploadID)
+	if err != nil {
+		return err
+	} else if err := storage.ValidateParts(parts); err != nil {
+		return err
+	}
+
+	found, err := s.listParts(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+
+	bucket := s.client.Bucket(s.bucketName)
+
+	srcs := make([]*gcstorage.ObjectHandle, len(parts))
+	for i, part := range parts {
+		attrs, ok := found[part.Number]
+		if !ok || strconv.FormatInt(attrs.Generation, 10) != part.ETag {
+			return storage.Errorf(nil, storage.UnknownError, "%s: part %d with ETag %q was not uploaded", key, part.Number, part.ETag)
+		}
+		srcs[i] = bucket.Object(attrs.Name).Generation(attrs.Generation)
+	}
+
+	for round := 0; len(srcs) > maxComposeSources; round++ {
+		var next []*gcstorage.ObjectHandle
+		for i := 0; i < len(srcs); i += maxComposeSources {
+			end := i + maxComposeSources
+			if end > len(srcs) {
+				end = len(srcs)
+			}
+
+			name := s.objectName(fmt.Sprintf("%s%s/compose-%d-%d", uploadPrefix, uploadID, round, len(next)))
+			attrs, err := bucket.Object(name).ComposerFrom(srcs[i:end]...).Run(ctx)
+			if err != nil {
+				return translateError(err, "COMPOSE gc://%s/%s", s.bucketName, name)
+			}
+			next = append(next, bucket.Object(name).Generation(attrs.Generation))
+		}
+		srcs = next
+	}
+
+	name := path.Join(s.namePrefix, key)
+	dst, err := conditions(bucket.Object(name), name, u.Options)
+	if err != nil {
+		return err
+	}
+
+	c := dst.ComposerFrom(srcs...)
+	c.ContentType = u.Options.ContentType
+	c.ContentEncoding = u.Options.ContentEncoding
+	c.CacheControl = u.Options.CacheControl
+	c.ContentDisposition = u.Options.ContentDisposition
+	c.Metadata = u.Options.Metadata
+	if _, err := c.Run(ctx); err != nil {
+		return translateError(err, "COMPOSE gc://%s/%s", s.bucketName, name)
+	}
+
+	return s.deleteUpload(ctx, uploadID)
+}
+
+func (s *GCS) AbortUpload(ctx context.Context, key, uploadID string) error {
+	if _, err := s.readUpload(ctx, key, uploadID); err != nil {
+		return err
+	}
+
+	return s.deleteUpload(ctx, uploadID)
+}
+
+// deleteUpload deletes the objects of an upload. The object that holds the
+// state of the upload is deleted first so that the upload no longer exists
+// even if some of its parts cannot be deleted.
+func (s *GCS) deleteUpload(ctx context.Context, uploadID string) error {
+	bucket := s.client.Bucket(s.bucketName)
+
+	name := s.uploadObjectName(uploadID, 0)
+	if err := bucket.Object(name).Delete(ctx); err != nil {
+		return translateError(err, "DELETE gc://%s/%s", s.bucketName, name)
+	}
+
+	prefix := s.objectName(uploadPrefix + uploadID + "/")
+	it := bucket.Objects(ctx, &gcstorage.Query{Prefix: prefix})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		} else if err != nil {
+			return translateError(err, "LIST gc://%s/%s", s.bucketName, prefix)
+		}
+
+		if err := bucket.Object(attrs.Name).Delete(ctx); err != nil && err != gcstorage.ErrObjectNotExist {
+			return translateError(err, "DELETE gc://%s/%s", s.bucketName, attrs.Name)
+		}
+	}
+}
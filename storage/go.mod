@@ -4,8 +4,12 @@ go 1.14
 
 require (
 	cloud.google.com/go/storage v1.12.0
+	github.com/aws/aws-sdk-go v1.44.330
 	github.com/google/uuid v1.1.2
+	github.com/klauspost/compress v1.15.15
+	github.com/puppetlabs/leg/scheduler v0.3.0
 	github.com/puppetlabs/leg/workdir v0.1.0
 	github.com/stretchr/testify v1.6.1
+	golang.org/x/oauth2 v0.0.0-20200902213428-5d25da1a8d43
 	google.golang.org/api v0.35.0
 )
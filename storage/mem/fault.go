@@ -0,0 +1,102 @@
+package mem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/leg/storage"
+)
+
+// Operation identifies a blob store method for fault injection.
+type Operation string
+
+const (
+	OperationPut    Operation = "PUT"
+	OperationGet    Operation = "GET"
+	OperationDelete Operation = "DELETE"
+	OperationStat   Operation = "STAT"
+	OperationList   Operation = "LIST"
+	OperationCopy   Operation = "COPY"
+
+	OperationInitiateUpload Operation = "INITIATE_UPLOAD"
+	OperationUploadPart     Operation = "UPLOAD_PART"
+	OperationListParts      Operation = "LIST_PARTS"
+	OperationCompleteUpload Operation = "COMPLETE_UPLOAD"
+	OperationAbortUpload    Operation = "ABORT_UPLOAD"
+)
+
+// FaultFunc is called before an operation is performed. If it returns an
+// error, the operation fails with that error instead. For list operations, the
+// key is the listing prefix.
+type FaultFunc func(ctx context.Context, op Operation, key string) error
+
+// Latency delays every operation by the given duration. If the context is
+// done before the delay elapses, the operation fails with a TimeoutError.
+func Latency(d time.Duration) FaultFunc {
+	return func(ctx context.Context, op Operation, key string) error {
+		t := time.NewTimer(d)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+			return nil
+		case <-ctx.Done():
+			return storage.Errorf(ctx.Err(), storage.TimeoutError, "%s %s: %s", op, key, ctx.Err().Error())
+		}
+	}
+}
+
+// Fail causes every operation to fail with an error with the given code.
+func Fail(code storage.ErrorCode) FaultFunc {
+	return func(ctx context.Context, op Operation, key string) error {
+		return storage.Errorf(nil, code, "%s %s: injected %s", op, key, code)
+	}
+}
+
+// Times limits a fault to the first n operations it applies to, after which
+// operations succeed. It is useful for testing retries.
+func Times(n int, fault FaultFunc) FaultFunc {
+	var mut sync.Mutex
+	return func(ctx context.Context, op Operation, key string) error {
+		// Reserve one of the remaining failures so that the fault, which may
+		// block, can run without holding the lock.
+		mut.Lock()
+		if n <= 0 {
+			mut.Unlock()
+			return nil
+		}
+		n--
+		mut.Unlock()
+
+		err := fault(ctx, op, key)
+		if err == nil {
+			mut.Lock()
+			n++
+			mut.Unlock()
+		}
+		return err
+	}
+}
+
+// ForOperations restricts a fault to the given operations.
+func ForOperations(fault FaultFunc, ops ...Operation) FaultFunc {
+	return func(ctx context.Context, op Operation, key string) error {
+		for _, candidate := range ops {
+			if candidate == op {
+				return fault(ctx, op, key)
+			}
+		}
+		return nil
+	}
+}
+
+// ForKey restricts a fault to operations on the given key.
+func ForKey(fault FaultFunc, key string) FaultFunc {
+	return func(ctx context.Context, op Operation, candidate string) error {
+		if candidate != key {
+			return nil
+		}
+		return fault(ctx, op, key)
+	}
+}
@@ -0,0 +1,416 @@
+package mem
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/leg/storage"
+)
+
+// DefaultListPageSize is the maximum number of keys and prefixes returned by a
+// single call to List if the page size is not specified.
+const DefaultListPageSize = 1000
+
+var (
+	bucketsMut sync.Mutex
+	buckets    = make(map[string]*bucket)
+)
+
+func init() {
+	storage.RegisterFactory("mem", New)
+}
+
+type object struct {
+	data []byte
+	meta storage.Meta
+}
+
+// bucket holds the blobs of one or more Memory blob stores.
+type bucket struct {
+	mut        sync.RWMutex
+	objects    map[string]*object
+	uploads    map[string]*upload
+	generation int64
+}
+
+func newBucket() *bucket {
+	return &bucket{
+		objects: make(map[string]*object),
+		uploads: make(map[string]*upload),
+	}
+}
+
+// Memory is a blob store that keeps blobs in memory. It is safe for concurrent
+// use.
+type Memory struct {
+	bucket *bucket
+
+	faultsMut sync.RWMutex
+	faults    []FaultFunc
+}
+
+var _ storage.BlobStore = &Memory{}
+var _ storage.Lister = &Memory{}
+var _ storage.Stater = &Memory{}
+var _ storage.MultipartUploader = &Memory{}
+var _ storage.Copier = &Memory{}
+
+// SetFaults replaces the faults injected into operations on this blob store.
+// Each fault is evaluated in order before an operation is performed. Calling
+// SetFaults with no arguments removes all faults.
+func (m *Memory) SetFaults(faults ...FaultFunc) {
+	m.faultsMut.Lock()
+	defer m.faultsMut.Unlock()
+
+	m.faults = append([]FaultFunc(nil), faults...)
+}
+
+func (m *Memory) inject(ctx context.Context, op Operation, key string) error {
+	m.faultsMut.RLock()
+	faults := m.faults
+	m.faultsMut.RUnlock()
+
+	for _, fault := range faults {
+		if err := fault(ctx, op, key); err != nil {
+			return err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return storage.Errorf(err, storage.TimeoutError, "%s %s: %s", op, key, err.Error())
+	}
+	return nil
+}
+
+func copyMetadata(in map[string]string) map[string]string {
+	if len(in) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
+
+// copyMeta returns a copy of the metadata of the object that the caller may
+// modify.
+func (o *object) copyMeta() *storage.Meta {
+	meta := o.meta
+	meta.Metadata = copyMetadata(o.meta.Metadata)
+	return &meta
+}
+
+// checkPreconditions must be called with the lock held.
+func (b *bucket) checkPreconditions(key string, ifMatch string, ifNoneMatch bool) error {
+	if ifMatch != "" && ifNoneMatch {
+		return storage.Errorf(nil, storage.UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	}
+
+	obj, found := b.objects[key]
+	switch {
+	case !found && ifMatch != "":
+		return storage.Errorf(nil, storage.PreconditionFailedError, "%s: blob does not exist", key)
+	case found && ifNoneMatch:
+		return storage.Errorf(nil, storage.PreconditionFailedError, "%s: blob already exists", key)
+	case found && ifMatch != "" && ifMatch != obj.meta.ETag:
+		return storage.Errorf(nil, storage.PreconditionFailedError, "%s: ETag %q does not match %q", key, obj.meta.ETag, ifMatch)
+	}
+	return nil
+}
+
+func (m *Memory) Put(ctx context.Context, key string, sink storage.Sink, opts storage.PutOptions) error {
+	if key == "" {
+		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	}
+
+	if err := m.inject(ctx, OperationPut, key); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := sink(&buf); err != nil {
+		return storage.Errorf(err, storage.UnknownError, "write(%s): %s", key, err.Error())
+	}
+
+	m.bucket.mut.Lock()
+	defer m.bucket.mut.Unlock()
+
+	return m.bucket.store(key, buf.Bytes(), opts)
+}
+
+// store must be called with the lock held.
+func (b *bucket) store(key string, data []byte, opts storage.PutOptions) error {
+	if err := b.checkPreconditions(key, opts.IfMatch, opts.IfNoneMatch); err != nil {
+		return err
+	}
+
+	sum := md5.Sum(data)
+
+	b.generation++
+	b.objects[key] = &object{
+		data: data,
+		meta: storage.Meta{
+			ContentType:        opts.ContentType,
+			Size:               int64(len(data)),
+			ModificationTime:   time.Now(),
+			ETag:               strconv.FormatInt(b.generation, 10),
+			MD5:                sum[:],
+			ContentEncoding:    opts.ContentEncoding,
+			CacheControl:       opts.CacheControl,
+			ContentDisposition: opts.ContentDisposition,
+			Metadata:           copyMetadata(opts.Metadata),
+		},
+	}
+	return nil
+}
+
+func (m *Memory) get(key string) (*object, error) {
+	m.bucket.mut.RLock()
+	defer m.bucket.mut.RUnlock()
+
+	obj, found := m.bucket.objects[key]
+	if !found {
+		return nil, storage.Errorf(nil, storage.NotFoundError, "%s: blob does not exist", key)
+	}
+	return obj, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string, src storage.Source, opts storage.GetOptions) error {
+	if key == "" {
+		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	}
+
+	if err := m.inject(ctx, OperationGet, key); err != nil {
+		return err
+	}
+
+	obj, err := m.get(key)
+	if err != nil {
+		return err
+	}
+
+	// Objects are never modified once stored, so it is safe to read the data
+	// without holding the lock.
+	meta := obj.copyMeta()
+	start, end := int64(0), meta.Size
+	if opts.Offset < 0 {
+		if opts.Length > 0 {
+			return storage.Errorf(
+				nil,
+				storage.UnknownError,
+				"Length must be -1 if Offset is negative in storage.GetOptions")
+		}
+		if start = meta.Size + opts.Offset; start < 0 {
+			start = 0
+		}
+	} else if opts.Offset > 0 {
+		if start = opts.Offset; start > meta.Size {
+			start = meta.Size
+		}
+	}
+	if opts.Length > 0 && start+opts.Length < end {
+		end = start + opts.Length
+	}
+	meta.Offset = start
+	if opts.Offset > meta.Size {
+		meta.Offset = opts.Offset
+	}
+
+	if err := src(meta, bytes.NewReader(obj.data[start:end])); err != nil {
+		return storage.Errorf(err, storage.UnknownError, "read(%s): %s", key, err.Error())
+	}
+	return nil
+}
+
+// Copy copies a blob. Faults for the operation are evaluated with the source
+// key.
+func (m *Memory) Copy(ctx context.Context, srcKey, dstKey string, opts storage.CopyOptions) error {
+	if srcKey == "" || dstKey == "" {
+		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	}
+
+	if err := m.inject(ctx, OperationCopy, srcKey); err != nil {
+		return err
+	}
+
+	m.bucket.mut.Lock()
+	defer m.bucket.mut.Unlock()
+
+	obj, found := m.bucket.objects[srcKey]
+	if !found {
+		return storage.Errorf(nil, storage.NotFoundError, "%s: blob does not exist", srcKey)
+	} else if opts.SourceIfMatch != "" && opts.SourceIfMatch != obj.meta.ETag {
+		return storage.Errorf(nil, storage.PreconditionFailedError, "%s: ETag %q does not match %q", srcKey, obj.meta.ETag, opts.SourceIfMatch)
+	}
+
+	// Blob content is never modified in place, so the copy can share it.
+	return m.bucket.store(dstKey, obj.data, storage.PutOptions{
+		ContentType:        obj.meta.ContentType,
+		ContentEncoding:    obj.meta.ContentEncoding,
+		CacheControl:       obj.meta.CacheControl,
+		ContentDisposition: obj.meta.ContentDisposition,
+		Metadata:           obj.meta.Metadata,
+		IfMatch:            opts.IfMatch,
+		IfNoneMatch:        opts.IfNoneMatch,
+	})
+}
+
+func (m *Memory) Delete(ctx context.Context, key string, opts storage.DeleteOptions) error {
+	if key == "" {
+		return storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	}
+
+	if err := m.inject(ctx, OperationDelete, key); err != nil {
+		return err
+	}
+
+	m.bucket.mut.Lock()
+	defer m.bucket.mut.Unlock()
+
+	if err := m.bucket.checkPreconditions(key, opts.IfMatch, false); err != nil {
+		return err
+	}
+
+	delete(m.bucket.objects, key)
+	return nil
+}
+
+func (m *Memory) Stat(ctx context.Context, key string) (*storage.Meta, error) {
+	if key == "" {
+		return nil, storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	}
+
+	if err := m.inject(ctx, OperationStat, key); err != nil {
+		return nil, err
+	}
+
+	obj, err := m.get(key)
+	if err != nil {
+		return nil, err
+	}
+	return obj.copyMeta(), nil
+}
+
+func (m *Memory) List(ctx context.Context, opts storage.ListOptions) (*storage.ListPage, error) {
+	if err := m.inject(ctx, OperationList, opts.Prefix); err != nil {
+		return nil, err
+	}
+
+	var start string
+	if opts.PageToken != "" {
+		b, err := base64.RawURLEncoding.DecodeString(opts.PageToken)
+		if err != nil {
+			return nil, storage.Errorf(err, storage.UnknownError, "invalid page token %q: %s", opts.PageToken, err.Error())
+		}
+		start = string(b)
+	}
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultListPageSize
+	}
+
+	m.bucket.mut.RLock()
+	defer m.bucket.mut.RUnlock()
+
+	var keys []string
+	for key := range m.bucket.objects {
+		if strings.HasPrefix(key, opts.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	page := &storage.ListPage{}
+	var last string
+	for _, key := range keys {
+		item, isPrefix := key, false
+		if opts.Delimiter != "" {
+			if i := strings.Index(key[len(opts.Prefix):], opts.Delimiter); i >= 0 {
+				item, isPrefix = key[:len(opts.Prefix)+i+len(opts.Delimiter)], true
+			}
+		}
+
+		if item <= start || item == last {
+			continue
+		} else if len(page.Entries)+len(page.Prefixes) >= pageSize {
+			page.NextPageToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		last = item
+
+		if isPrefix {
+			page.Prefixes = append(page.Prefixes, item)
+			continue
+		}
+
+		page.Entries = append(page.Entries, &storage.ListEntry{
+			Key:  key,
+			Meta: *m.bucket.objects[key].copyMeta(),
+		})
+	}
+	return page, nil
+}
+
+// NewMemory creates a new, empty in-memory blob store.
+func NewMemory() *Memory {
+	return &Memory{
+		bucket: newBucket(),
+	}
+}
+
+// New creates an in-memory blob store for a URL of the form mem://name. All
+// blob stores created with the same name share their blobs for the lifetime of
+// the process. If the name is empty, a new, empty blob store is created.
+//
+// Faults may be injected using the following query parameters, and apply only
+// to the returned blob store:
+//
+//	latency: A duration to wait before performing each operation.
+//	error: An error code, like AuthError or TimeoutError, with which every
+//	  operation fails.
+func New(u url.URL) (storage.BlobStore, error) {
+	m := NewMemory()
+	if name := u.Host; name != "" {
+		bucketsMut.Lock()
+		defer bucketsMut.Unlock()
+
+		if b, found := buckets[name]; found {
+			m.bucket = b
+		} else {
+			buckets[name] = m.bucket
+		}
+	}
+
+	var faults []FaultFunc
+	if arr := u.Query()["latency"]; len(arr) > 0 {
+		d, err := time.ParseDuration(arr[0])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse latency=%s (%s)", arr[0], err.Error())
+		}
+		faults = append(faults, Latency(d))
+	}
+	if arr := u.Query()["error"]; len(arr) > 0 {
+		code := storage.ErrorCode(arr[0])
+		switch code {
+		case storage.AuthError, storage.NotFoundError, storage.PreconditionFailedError, storage.TimeoutError, storage.UnknownError:
+		default:
+			return nil, fmt.Errorf("Failed to parse error=%s (unknown error code)", arr[0])
+		}
+		faults = append(faults, Fail(code))
+	}
+	m.SetFaults(faults...)
+
+	return m, nil
+}
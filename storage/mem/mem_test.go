@@ -0,0 +1,298 @@
+package mem_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/storage"
+	"github.com/puppetlabs/leg/storage/mem"
+	"github.com/puppetlabs/leg/storage/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBlobStore(t *testing.T, s string) storage.BlobStore {
+	u, err := url.Parse(s)
+	require.NoError(t, err)
+
+	bs, err := storage.NewBlobStore(*u)
+	require.NoError(t, err)
+	return bs
+}
+
+func put(ctx context.Context, bs storage.BlobStore, key, content string) error {
+	return bs.Put(ctx, key, func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	}, storage.PutOptions{})
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	testutils.RunListerTests(t, mem.NewMemory())
+}
+
+func TestPreconditions(t *testing.T) {
+	t.Parallel()
+	testutils.RunPreconditionTests(t, mem.NewMemory())
+}
+
+func TestStat(t *testing.T) {
+	t.Parallel()
+	testutils.RunStatTests(t, mem.NewMemory())
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+	testutils.RunMetadataTests(t, mem.NewMemory())
+}
+
+func TestMultipartUpload(t *testing.T) {
+	t.Parallel()
+	testutils.RunMultipartUploadTests(t, mem.NewMemory())
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+	testutils.RunCopyTests(t, mem.NewMemory())
+}
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	bs := mem.NewMemory()
+
+	var testPayload = "012345678Xabcdef\n012345678Yabcdef\n012345678Zabcdef\n"
+	require.NoError(t, bs.Put(ctx, "3hex", func(w io.Writer) error {
+		_, err := io.WriteString(w, testPayload)
+		return err
+	}, storage.PutOptions{
+		ContentType: "hex",
+	}))
+
+	cases := []struct {
+		offset         int64
+		length         int64
+		absoluteOffset int64
+		expect         string
+	}{
+		{-17, 0, 2 * 17, "012345678Zabcdef\n"},
+		{17, 17, 17, "012345678Yabcdef\n"},
+		{0, 17, 0, "012345678Xabcdef\n"},
+		{34, 0, 34, "012345678Zabcdef\n"},
+		{45, 100, 45, "bcdef\n"},
+		{100, 0, 100, ""},
+		{-100, 0, 0, testPayload},
+		{0, 0, 0, testPayload},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("Offset %d, length %d", c.offset, c.length), func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, bs.Get(ctx, "3hex", func(meta *storage.Meta, r io.Reader) error {
+				assert.Equal(t, "hex", meta.ContentType)
+				assert.Equal(t, c.absoluteOffset, meta.Offset)
+				assert.Equal(t, int64(len(testPayload)), meta.Size)
+
+				_, err := io.Copy(&buf, r)
+				return err
+			}, storage.GetOptions{
+				Offset: c.offset,
+				Length: c.length,
+			}))
+			assert.Equal(t, c.expect, buf.String())
+		})
+	}
+
+	err := bs.Get(ctx, "3hex", func(meta *storage.Meta, r io.Reader) error {
+		return nil
+	}, storage.GetOptions{
+		Offset: -10,
+		Length: 5,
+	})
+	require.Error(t, err)
+}
+
+func TestNotFound(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	bs := mem.NewMemory()
+
+	err := bs.Get(ctx, "missing", func(meta *storage.Meta, r io.Reader) error {
+		return nil
+	}, storage.GetOptions{})
+	require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+	require.NoError(t, put(ctx, bs, "key", "content"))
+	require.NoError(t, bs.Delete(ctx, "key", storage.DeleteOptions{}))
+	require.NoError(t, bs.Delete(ctx, "key", storage.DeleteOptions{}))
+
+	_, err = bs.Stat(ctx, "key")
+	require.True(t, storage.IsNotFoundError(err), "%+v", err)
+}
+
+func TestFaults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	bs := mem.NewMemory()
+	require.NoError(t, put(ctx, bs, "key", "content"))
+
+	bs.SetFaults(mem.Fail(storage.AuthError))
+	err := put(ctx, bs, "key", "other content")
+	require.True(t, storage.IsAuthError(err), "%+v", err)
+
+	bs.SetFaults(mem.Times(2, mem.Fail(storage.TimeoutError)))
+	for i := 0; i < 2; i++ {
+		_, err := bs.Stat(ctx, "key")
+		require.True(t, storage.IsTimeoutError(err), "%+v", err)
+	}
+	_, err = bs.Stat(ctx, "key")
+	require.NoError(t, err)
+
+	bs.SetFaults(mem.ForOperations(mem.Fail(storage.NotFoundError), mem.OperationGet))
+	require.NoError(t, put(ctx, bs, "key", "other content"))
+	err = bs.Get(ctx, "key", func(meta *storage.Meta, r io.Reader) error {
+		return nil
+	}, storage.GetOptions{})
+	require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+	bs.SetFaults(mem.ForKey(mem.Fail(storage.AuthError), "secret"))
+	require.NoError(t, put(ctx, bs, "key", "content"))
+	err = put(ctx, bs, "secret", "content")
+	require.True(t, storage.IsAuthError(err), "%+v", err)
+
+	bs.SetFaults(mem.Latency(time.Hour))
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = put(tctx, bs, "key", "content")
+	require.True(t, storage.IsTimeoutError(err), "%+v", err)
+
+	bs.SetFaults()
+	require.NoError(t, put(ctx, bs, "key", "content"))
+}
+
+func TestTimesDoesNotSerializeFaults(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	bs := mem.NewMemory()
+	require.NoError(t, put(ctx, bs, "key", "content"))
+
+	// Both operations must wait for the latency at the same time to finish
+	// before the context expires.
+	bs.SetFaults(mem.Times(2, mem.Latency(50*time.Millisecond)))
+	tctx, cancel := context.WithTimeout(ctx, 80*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := bs.Stat(tctx, "key")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// A fault that does not fail does not count toward the limit.
+	calls := 0
+	bs.SetFaults(mem.Times(1, func(ctx context.Context, op mem.Operation, key string) error {
+		calls++
+		if calls < 3 {
+			return nil
+		}
+		return storage.Errorf(nil, storage.TimeoutError, "injected")
+	}))
+	for i := 0; i < 2; i++ {
+		_, err := bs.Stat(ctx, "key")
+		require.NoError(t, err)
+	}
+	_, err := bs.Stat(ctx, "key")
+	require.True(t, storage.IsTimeoutError(err), "%+v", err)
+	_, err = bs.Stat(ctx, "key")
+	require.NoError(t, err)
+	require.Equal(t, 3, calls)
+}
+
+func TestURL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	a := newBlobStore(t, "mem://test-url")
+	b := newBlobStore(t, "mem://test-url")
+	require.NoError(t, put(ctx, a, "key", "content"))
+
+	_, err := storage.Stat(ctx, b, "key")
+	require.NoError(t, err)
+
+	anonymous := newBlobStore(t, "mem://")
+	_, err = storage.Stat(ctx, anonymous, "key")
+	require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+	failing := newBlobStore(t, "mem://test-url?error=AuthError")
+	_, err = storage.Stat(ctx, failing, "key")
+	require.True(t, storage.IsAuthError(err), "%+v", err)
+
+	// Faults only apply to the blob store created with them.
+	_, err = storage.Stat(ctx, a, "key")
+	require.NoError(t, err)
+
+	slow := newBlobStore(t, "mem://test-url?latency=1h")
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = storage.Stat(tctx, slow, "key")
+	require.True(t, storage.IsTimeoutError(err), "%+v", err)
+
+	u, err := url.Parse("mem://test-url?latency=forever")
+	require.NoError(t, err)
+	_, err = storage.NewBlobStore(*u)
+	require.Error(t, err)
+
+	u, err = url.Parse("mem://test-url?error=Oops")
+	require.NoError(t, err)
+	_, err = storage.NewBlobStore(*u)
+	require.Error(t, err)
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	bs := mem.NewMemory()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		i := i
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			key := fmt.Sprintf("key-%d", i%3)
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, put(ctx, bs, key, fmt.Sprintf("content-%d-%d", i, j)))
+
+				err := bs.Get(ctx, key, func(meta *storage.Meta, r io.Reader) error {
+					_, err := io.Copy(ioutil.Discard, r)
+					return err
+				}, storage.GetOptions{})
+				assert.NoError(t, err)
+
+				_, err = bs.List(ctx, storage.ListOptions{})
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
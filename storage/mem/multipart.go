@@ -0,0 +1,177 @@
+package mem
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+
+	"github.com/puppetlabs/leg/storage"
+)
+
+type upload struct {
+	key   string
+	opts  storage.PutOptions
+	parts map[int]*part
+}
+
+type part struct {
+	data []byte
+	etag string
+}
+
+func newUploadID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", storage.Errorf(err, storage.UnknownError, "failed to generate upload ID: %s", err.Error())
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// getUpload must be called with the lock held.
+func (b *bucket) getUpload(key, uploadID string) (*upload, error) {
+	u, found := b.uploads[uploadID]
+	if !found || u.key != key {
+		return nil, storage.Errorf(nil, storage.NotFoundError, "%s: upload %q does not exist", key, uploadID)
+	}
+	return u, nil
+}
+
+func (m *Memory) InitiateUpload(ctx context.Context, key string, opts storage.PutOptions) (string, error) {
+	if key == "" {
+		return "", storage.Errorf(nil, storage.UnknownError, "key must be non-empty")
+	} else if opts.IfMatch != "" && opts.IfNoneMatch {
+		return "", storage.Errorf(nil, storage.UnknownError, "IfMatch and IfNoneMatch are mutually exclusive")
+	}
+
+	if err := m.inject(ctx, OperationInitiateUpload, key); err != nil {
+		return "", err
+	}
+
+	uploadID, err := newUploadID()
+	if err != nil {
+		return "", err
+	}
+
+	opts.Metadata = copyMetadata(opts.Metadata)
+
+	m.bucket.mut.Lock()
+	defer m.bucket.mut.Unlock()
+
+	m.bucket.uploads[uploadID] = &upload{
+		key:   key,
+		opts:  opts,
+		parts: make(map[int]*part),
+	}
+	return uploadID, nil
+}
+
+func (m *Memory) UploadPart(ctx context.Context, key, uploadID string, number int, sink storage.Sink) (*storage.Part, error) {
+	if err := storage.ValidatePartNumber(number); err != nil {
+		return nil, err
+	}
+
+	if err := m.inject(ctx, OperationUploadPart, key); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := sink(&buf); err != nil {
+		return nil, storage.Errorf(err, storage.UnknownError, "write(%s, %d): %s", key, number, err.Error())
+	}
+	sum := md5.Sum(buf.Bytes())
+	p := &part{
+		data: buf.Bytes(),
+		etag: hex.EncodeToString(sum[:]),
+	}
+
+	m.bucket.mut.Lock()
+	defer m.bucket.mut.Unlock()
+
+	u, err := m.bucket.getUpload(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	u.parts[number] = p
+
+	return &storage.Part{
+		Number: number,
+		ETag:   p.etag,
+		Size:   int64(len(p.data)),
+	}, nil
+}
+
+func (m *Memory) ListParts(ctx context.Context, key, uploadID string) ([]*storage.Part, error) {
+	if err := m.inject(ctx, OperationListParts, key); err != nil {
+		return nil, err
+	}
+
+	m.bucket.mut.RLock()
+	defer m.bucket.mut.RUnlock()
+
+	u, err := m.bucket.getUpload(key, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := make([]*storage.Part, 0, len(u.parts))
+	for number, p := range u.parts {
+		parts = append(parts, &storage.Part{
+			Number: number,
+			ETag:   p.etag,
+			Size:   int64(len(p.data)),
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	return parts, nil
+}
+
+func (m *Memory) CompleteUpload(ctx context.Context, key, uploadID string, parts []*storage.Part) error {
+	if err := m.inject(ctx, OperationCompleteUpload, key); err != nil {
+		return err
+	}
+
+	m.bucket.mut.Lock()
+	defer m.bucket.mut.Unlock()
+
+	u, err := m.bucket.getUpload(key, uploadID)
+	if err != nil {
+		return err
+	} else if err := storage.ValidateParts(parts); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, candidate := range parts {
+		p, found := u.parts[candidate.Number]
+		if !found || p.etag != candidate.ETag {
+			return storage.Errorf(nil, storage.UnknownError, "%s: part %d with ETag %q was not uploaded", key, candidate.Number, candidate.ETag)
+		}
+		buf.Write(p.data)
+	}
+
+	if err := m.bucket.store(key, buf.Bytes(), u.opts); err != nil {
+		return err
+	}
+
+	delete(m.bucket.uploads, uploadID)
+	return nil
+}
+
+func (m *Memory) AbortUpload(ctx context.Context, key, uploadID string) error {
+	if err := m.inject(ctx, OperationAbortUpload, key); err != nil {
+		return err
+	}
+
+	m.bucket.mut.Lock()
+	defer m.bucket.mut.Unlock()
+
+	if _, err := m.bucket.getUpload(key, uploadID); err != nil {
+		return err
+	}
+
+	delete(m.bucket.uploads, uploadID)
+	return nil
+}
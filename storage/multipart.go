@@ -0,0 +1,28 @@
+package storage
+
+// ValidatePartNumber returns an error if the given number is not a valid part
+// number for a multipart upload.
+func ValidatePartNumber(number int) error {
+	if number < 1 || number > MaxUploadParts {
+		return Errorf(nil, UnknownError, "part number %d must be between 1 and %d", number, MaxUploadParts)
+	}
+	return nil
+}
+
+// ValidateParts returns an error unless the given parts, as passed to
+// CompleteUpload, are non-empty and in strictly ascending order of their
+// numbers.
+func ValidateParts(parts []*Part) error {
+	if len(parts) == 0 {
+		return Errorf(nil, UnknownError, "at least one part must be specified to complete an upload")
+	}
+
+	for i, part := range parts {
+		if err := ValidatePartNumber(part.Number); err != nil {
+			return err
+		} else if i > 0 && part.Number <= parts[i-1].Number {
+			return Errorf(nil, UnknownError, "part %d must not follow part %d; parts must be in ascending order", part.Number, parts[i-1].Number)
+		}
+	}
+	return nil
+}
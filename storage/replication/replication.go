@@ -0,0 +1,172 @@
+// Package replication copies blobs between blob stores.
+package replication
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/puppetlabs/leg/scheduler"
+	"github.com/puppetlabs/leg/storage"
+)
+
+// DefaultConcurrency is the number of blobs copied at the same time if not
+// otherwise specified.
+const DefaultConcurrency = 4
+
+// ReplicateOptions contains fields that configure a replication.
+type ReplicateOptions struct {
+	// Concurrency is the maximum number of blobs to copy at the same time. If
+	// not specified, DefaultConcurrency is used.
+	Concurrency int
+}
+
+// ReplicateOption is a setter for one or more replication options.
+type ReplicateOption interface {
+	// ApplyToReplicateOptions configures the specified replication options
+	// for this option.
+	ApplyToReplicateOptions(target *ReplicateOptions)
+}
+
+// ApplyOptions runs each of the given options against this options struct.
+func (o *ReplicateOptions) ApplyOptions(opts []ReplicateOption) {
+	for _, opt := range opts {
+		opt.ApplyToReplicateOptions(o)
+	}
+}
+
+// ReplicateOptionFunc allows a function to be used as a replication option.
+type ReplicateOptionFunc func(target *ReplicateOptions)
+
+var _ ReplicateOption = ReplicateOptionFunc(nil)
+
+// ApplyToReplicateOptions configures the specified replication options by
+// calling this function.
+func (rof ReplicateOptionFunc) ApplyToReplicateOptions(target *ReplicateOptions) {
+	rof(target)
+}
+
+// WithConcurrency changes the maximum number of blobs copied at the same time.
+func WithConcurrency(concurrency int) ReplicateOption {
+	return ReplicateOptionFunc(func(target *ReplicateOptions) {
+		target.Concurrency = concurrency
+	})
+}
+
+// Error is returned by Replicate if any blobs could not be replicated.
+type Error struct {
+	// Errs are the errors that occurred while listing or copying blobs.
+	Errs []error
+}
+
+func (e *Error) Error() string {
+	if len(e.Errs) == 1 {
+		return fmt.Sprintf("replication failed: %+v", e.Errs[0])
+	}
+	return fmt.Sprintf("replication failed with %d errors, including: %+v", len(e.Errs), e.Errs[0])
+}
+
+// unchanged returns true if the destination blob is known to have the same
+// content as the source blob.
+func unchanged(src, dst *storage.Meta) bool {
+	return src.Size == dst.Size &&
+		len(src.MD5) > 0 &&
+		bytes.Equal(src.MD5, dst.MD5)
+}
+
+// withCancelFrom returns a copy of ctx that is also canceled when other is
+// done. The scheduler runs processes with its own context, so this keeps the
+// values of the caller's context available to the blob stores.
+func withCancelFrom(ctx, other context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-other.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func replicateProcess(ctx context.Context, src, dst storage.BlobStore, entry *storage.ListEntry) scheduler.Process {
+	return scheduler.DescribeProcessFunc(fmt.Sprintf("replicate %s", entry.Key), func(sctx context.Context) error {
+		ctx, cancel := withCancelFrom(ctx, sctx)
+		defer cancel()
+
+		meta, err := storage.Stat(ctx, dst, entry.Key)
+		if err == nil && unchanged(&entry.Meta, meta) {
+			return nil
+		} else if err != nil && !storage.IsNotFoundError(err) {
+			return err
+		}
+
+		return storage.Copy(ctx, src, entry.Key, dst, entry.Key, storage.CopyOptions{
+			SourceIfMatch: entry.Meta.ETag,
+		})
+	})
+}
+
+// Replicate copies every blob in the source blob store with a key that begins
+// with the given prefix to the same key in the destination blob store. The
+// source blob store must implement storage.Lister.
+//
+// A blob is only copied if the destination does not already have a blob with
+// the same size and MD5 checksum. Blobs whose checksums are not known to the
+// source blob store are always copied. Blobs in the destination blob store
+// that do not exist in the source blob store are left in place.
+//
+// Blobs are copied concurrently as they are listed. If any blobs cannot be
+// copied, the remaining blobs are still copied and an *Error describing all of
+// the failures is returned.
+func Replicate(ctx context.Context, src, dst storage.BlobStore, prefix string, opts ...ReplicateOption) error {
+	o := &ReplicateOptions{
+		Concurrency: DefaultConcurrency,
+	}
+	o.ApplyOptions(opts)
+
+	lister, ok := src.(storage.Lister)
+	if !ok {
+		return storage.Errorf(nil, storage.UnknownError, "%T does not support listing", src)
+	}
+
+	list := scheduler.DescriptorFunc(func(sctx context.Context, pc chan<- scheduler.Process) error {
+		lctx, cancel := withCancelFrom(ctx, sctx)
+		defer cancel()
+
+		lo := storage.ListOptions{Prefix: prefix}
+		for {
+			page, err := lister.List(lctx, lo)
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range page.Entries {
+				select {
+				case pc <- replicateProcess(ctx, src, dst, entry):
+				case <-lctx.Done():
+					return lctx.Err()
+				}
+			}
+
+			if page.NextPageToken == "" {
+				return nil
+			}
+			lo.PageToken = page.NextPageToken
+		}
+	})
+
+	lc := scheduler.NewSegment(o.Concurrency, []scheduler.Descriptor{list}).
+		WithErrorBehavior(scheduler.ErrorBehaviorCollect).
+		Start(scheduler.LifecycleStartOptions{})
+	if err := scheduler.WaitContext(ctx, lc); err != nil {
+		lc.Close()
+		<-lc.Done()
+		return err
+	}
+
+	if errs := lc.Errs(); len(errs) > 0 {
+		return &Error{Errs: errs}
+	}
+	return nil
+}
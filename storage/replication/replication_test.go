@@ -0,0 +1,172 @@
+package replication_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/puppetlabs/leg/storage"
+	"github.com/puppetlabs/leg/storage/mem"
+	"github.com/puppetlabs/leg/storage/replication"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func put(t *testing.T, bs storage.BlobStore, key, content string) {
+	require.NoError(t, bs.Put(context.Background(), key, func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	}, storage.PutOptions{
+		Metadata: map[string]string{"owner": "test"},
+	}))
+}
+
+func get(t *testing.T, bs storage.BlobStore, key string) (*storage.Meta, string) {
+	var meta *storage.Meta
+	var buf bytes.Buffer
+	require.NoError(t, bs.Get(context.Background(), key, func(m *storage.Meta, r io.Reader) error {
+		meta = m
+		_, err := io.Copy(&buf, r)
+		return err
+	}, storage.GetOptions{}))
+	return meta, buf.String()
+}
+
+func TestReplicate(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	src, dst := mem.NewMemory(), mem.NewMemory()
+	put(t, src, "data/new", "new")
+	put(t, src, "data/changed", "changed")
+	put(t, src, "data/unchanged", "unchanged")
+	put(t, src, "other/ignored", "ignored")
+
+	put(t, dst, "data/changed", "old")
+	put(t, dst, "data/unchanged", "unchanged")
+	put(t, dst, "data/extra", "extra")
+	unchanged, _ := get(t, dst, "data/unchanged")
+
+	require.NoError(t, replication.Replicate(ctx, src, dst, "data/"))
+
+	for key, expected := range map[string]string{
+		"data/new":       "new",
+		"data/changed":   "changed",
+		"data/unchanged": "unchanged",
+		"data/extra":     "extra",
+	} {
+		meta, content := get(t, dst, key)
+		assert.Equal(t, expected, content, "content of %q", key)
+		assert.Equal(t, map[string]string{"owner": "test"}, meta.Metadata, "metadata of %q", key)
+	}
+
+	meta, _ := get(t, dst, "data/unchanged")
+	assert.Equal(t, unchanged.ETag, meta.ETag, "unchanged blob must not be copied")
+
+	_, err := storage.Stat(ctx, dst, "other/ignored")
+	require.True(t, storage.IsNotFoundError(err), "%+v", err)
+}
+
+func TestReplicateConcurrency(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	src, dst := mem.NewMemory(), mem.NewMemory()
+	for i := 0; i < 20; i++ {
+		put(t, src, fmt.Sprintf("key-%02d", i), "content")
+	}
+
+	var mut sync.Mutex
+	var current, max int
+	dst.SetFaults(mem.ForOperations(func(ctx context.Context, op mem.Operation, key string) error {
+		mut.Lock()
+		current++
+		if current > max {
+			max = current
+		}
+		mut.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mut.Lock()
+		current--
+		mut.Unlock()
+		return nil
+	}, mem.OperationPut))
+
+	require.NoError(t, replication.Replicate(ctx, src, dst, "", replication.WithConcurrency(3)))
+
+	page, err := dst.List(ctx, storage.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, page.Entries, 20)
+	assert.LessOrEqual(t, max, 3)
+	assert.Greater(t, max, 1)
+}
+
+func TestReplicateErrors(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	src, dst := mem.NewMemory(), mem.NewMemory()
+	put(t, src, "a", "a")
+	put(t, src, "b", "b")
+	put(t, src, "c", "c")
+
+	dst.SetFaults(mem.ForKey(mem.ForOperations(mem.Fail(storage.AuthError), mem.OperationPut), "b"))
+
+	err := replication.Replicate(ctx, src, dst, "")
+	require.Error(t, err)
+
+	rerr, ok := err.(*replication.Error)
+	require.True(t, ok, "%+v", err)
+	require.Len(t, rerr.Errs, 1)
+	assert.Contains(t, rerr.Errs[0].Error(), "replicate b")
+
+	_, content := get(t, dst, "a")
+	assert.Equal(t, "a", content)
+	_, content = get(t, dst, "c")
+	assert.Equal(t, "c", content)
+}
+
+type contextKey struct{}
+
+func TestReplicateContext(t *testing.T) {
+	t.Parallel()
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+
+	src, dst := mem.NewMemory(), mem.NewMemory()
+	put(t, src, "a", "a")
+	put(t, src, "b", "b")
+
+	var mut sync.Mutex
+	ops := make(map[mem.Operation]int)
+	requireValue := func(ctx context.Context, op mem.Operation, key string) error {
+		mut.Lock()
+		defer mut.Unlock()
+
+		ops[op]++
+		if ctx.Value(contextKey{}) != "value" {
+			return fmt.Errorf("%s %s: missing context value", op, key)
+		}
+		return nil
+	}
+	src.SetFaults(requireValue)
+	dst.SetFaults(requireValue)
+
+	require.NoError(t, replication.Replicate(ctx, src, dst, ""))
+
+	for _, op := range []mem.Operation{mem.OperationList, mem.OperationStat, mem.OperationGet, mem.OperationPut} {
+		assert.NotZero(t, ops[op], "operation %s", op)
+	}
+}
+
+func TestReplicateRequiresLister(t *testing.T) {
+	t.Parallel()
+
+	err := replication.Replicate(context.Background(), struct{ storage.BlobStore }{mem.NewMemory()}, mem.NewMemory(), "")
+	require.Error(t, err)
+}
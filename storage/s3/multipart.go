@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/puppetlabs/leg/storage"
+)
+
+// InitiateUpload creates an S3 multipart upload. Preconditions are not
+// supported. S3 requires every part except the last to be at least 5 MiB.
+func (s *S3) InitiateUpload(ctx context.Context, key string, opts storage.PutOptions) (string, error) {
+	key = path.Join(s.namePrefix, key)
+	if opts.IfMatch != "" || opts.IfNoneMatch {
+		return "", storage.Errorf(nil, storage.UnknownError, "UPLOAD s3://%s/%s: preconditions are not supported", s.bucketName, key)
+	}
+
+	input := &awss3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if opts.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+
+	out, err := s.client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return "", translateError(err, "UPLOAD s3://%s/%s", s.bucketName, key)
+	}
+	return aws.StringValue(out.UploadId), nil
+}
+
+// UploadPart uploads a part of a multipart upload. The part is buffered in
+// memory because S3 requires its length before it can be sent.
+func (s *S3) UploadPart(ctx context.Context, key, uploadID string, number int, sink storage.Sink) (*storage.Part, error) {
+	key = path.Join(s.namePrefix, key)
+	if err := storage.ValidatePartNumber(number); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := sink(&buf); err != nil {
+		return nil, translateError(err, "UPLOAD s3://%s/%s part %d", s.bucketName, key, number)
+	}
+	size := int64(buf.Len())
+
+	out, err := s.client.UploadPartWithContext(ctx, &awss3.UploadPartInput{
+		Bucket:     aws.String(s.bucketName),
+		Key:        aws.String(key),
+		UploadId:   aws.String(uploadID),
+		PartNumber: aws.Int64(int64(number)),
+		Body:       bytes.NewReader(buf.Bytes()),
+	})
+	if err != nil {
+		return nil, translateError(err, "UPLOAD s3://%s/%s part %d", s.bucketName, key, number)
+	}
+
+	return &storage.Part{
+		Number: number,
+		ETag:   aws.StringValue(out.ETag),
+		Size:   size,
+	}, nil
+}
+
+func (s *S3) ListParts(ctx context.Context, key, uploadID string) ([]*storage.Part, error) {
+	key = path.Join(s.namePrefix, key)
+
+	var parts []*storage.Part
+	err := s.client.ListPartsPagesWithContext(ctx, &awss3.ListPartsInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	}, func(out *awss3.ListPartsOutput, last bool) bool {
+		for _, part := range out.Parts {
+			parts = append(parts, &storage.Part{
+				Number: int(aws.Int64Value(part.PartNumber)),
+				ETag:   aws.StringValue(part.ETag),
+				Size:   aws.Int64Value(part.Size),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, translateError(err, "LIST PARTS s3://%s/%s", s.bucketName, key)
+	}
+	return parts, nil
+}
+
+func (s *S3) CompleteUpload(ctx context.Context, key, uploadID string, parts []*storage.Part) error {
+	key = path.Join(s.namePrefix, key)
+	if err := storage.ValidateParts(parts); err != nil {
+		return err
+	}
+
+	completed := make([]*awss3.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = &awss3.CompletedPart{
+			PartNumber: aws.Int64(int64(part.Number)),
+			ETag:       aws.String(part.ETag),
+		}
+	}
+
+	_, err := s.client.CompleteMultipartUploadWithContext(ctx, &awss3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucketName),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &awss3.CompletedMultipartUpload{Parts: completed},
+	})
+	return translateError(err, "COMPLETE s3://%s/%s", s.bucketName, key)
+}
+
+func (s *S3) AbortUpload(ctx context.Context, key, uploadID string) error {
+	key = path.Join(s.namePrefix, key)
+
+	_, err := s.client.AbortMultipartUploadWithContext(ctx, &awss3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return translateError(err, "ABORT s3://%s/%s", s.bucketName, key)
+}
@@ -0,0 +1,429 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/puppetlabs/leg/storage"
+)
+
+type S3 struct {
+	client     s3iface.S3API
+	uploader   *s3manager.Uploader
+	bucketName string
+	namePrefix string
+}
+
+func init() {
+	storage.RegisterFactory("s3", New)
+}
+
+func errorCode(err error) storage.ErrorCode {
+	for err != nil {
+		if context.Canceled == err || context.DeadlineExceeded == err {
+			return storage.TimeoutError
+		}
+
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			break
+		}
+
+		switch aerr.Code() {
+		case request.CanceledErrorCode, "RequestTimeout":
+			return storage.TimeoutError
+		case awss3.ErrCodeNoSuchKey, awss3.ErrCodeNoSuchBucket, awss3.ErrCodeNoSuchUpload, "NotFound":
+			return storage.NotFoundError
+		case "AccessDenied", "InvalidAccessKeyId", "SignatureDoesNotMatch", "ExpiredToken", "InvalidToken":
+			return storage.AuthError
+		case "PreconditionFailed":
+			return storage.PreconditionFailedError
+		}
+
+		if rf, ok := err.(awserr.RequestFailure); ok {
+			switch rf.StatusCode() {
+			case http.StatusNotFound:
+				return storage.NotFoundError
+			case http.StatusUnauthorized, http.StatusForbidden:
+				return storage.AuthError
+			}
+		}
+
+		err = aerr.OrigErr()
+	}
+	return storage.UnknownError
+}
+
+// Translate an AWS error into a storage error.
+func translateError(err error, format string, a ...interface{}) error {
+	if nil == err {
+		return nil
+	}
+	msg := fmt.Sprintf(format, a...)
+	return storage.Errorf(
+		err,
+		errorCode(err),
+		"%s: %s", msg, err.Error())
+}
+
+// Put writes a blob to the bucket. Preconditions are not supported.
+func (s *S3) Put(ctx context.Context, key string, sink storage.Sink, opts storage.PutOptions) error {
+	key = path.Join(s.namePrefix, key)
+	if opts.IfMatch != "" || opts.IfNoneMatch {
+		return storage.Errorf(nil, storage.UnknownError, "PUT s3://%s/%s: preconditions are not supported", s.bucketName, key)
+	}
+
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ContentType = aws.String(opts.ContentType)
+	}
+	if opts.ContentEncoding != "" {
+		input.ContentEncoding = aws.String(opts.ContentEncoding)
+	}
+	if opts.CacheControl != "" {
+		input.CacheControl = aws.String(opts.CacheControl)
+	}
+	if opts.ContentDisposition != "" {
+		input.ContentDisposition = aws.String(opts.ContentDisposition)
+	}
+	if len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+
+	// The uploader consumes a reader, so we run the sink in the background and
+	// connect the two with a pipe.
+	pr, pw := io.Pipe()
+	sinkErr := make(chan error, 1)
+	go func() {
+		err := sink(pw)
+		pw.CloseWithError(err)
+		sinkErr <- err
+	}()
+
+	input.Body = pr
+	_, err := s.uploader.UploadWithContext(ctx, input)
+	if err != nil {
+		// Unblock the sink if it is still writing.
+		pr.CloseWithError(err)
+	}
+
+	if serr := <-sinkErr; serr != nil && (err == nil || !errors.Is(serr, err)) {
+		return translateError(serr, "PUT s3://%s/%s", s.bucketName, key)
+	}
+	return translateError(err, "PUT s3://%s/%s", s.bucketName, key)
+}
+
+// parseContentRange parses the start offset and complete length out of a
+// Content-Range header of the form "bytes <start>-<end>/<size>".
+func parseContentRange(cr string) (offset, size int64, err error) {
+	var end int64
+	if _, err = fmt.Sscanf(cr, "bytes %d-%d/%d", &offset, &end, &size); err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q: %+v", cr, err)
+	}
+	return
+}
+
+func (s *S3) Get(ctx context.Context, key string, src storage.Source, opts storage.GetOptions) (err error) {
+	key = path.Join(s.namePrefix, key)
+
+	input := &awss3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	}
+	if opts.Offset < 0 {
+		if opts.Length > 0 {
+			return storage.Errorf(
+				nil,
+				storage.UnknownError,
+				"Length must be -1 if Offset is negative in storage.GetOptions")
+		}
+		// A suffix range, which S3 clamps to the start of the object.
+		input.Range = aws.String(fmt.Sprintf("bytes=%d", opts.Offset))
+	} else if opts.Length > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", opts.Offset, opts.Offset+opts.Length-1))
+	} else if opts.Offset > 0 {
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", opts.Offset))
+	}
+
+	out, rerr := s.client.GetObjectWithContext(ctx, input)
+	if nil != rerr {
+		return translateError(rerr, "GET s3://%s/%s", s.bucketName, key)
+	}
+	defer func() {
+		rerr := out.Body.Close()
+		if nil != rerr && nil == err {
+			err = translateError(rerr, "GET s3://%s/%s", s.bucketName, key)
+		}
+	}()
+
+	meta := &storage.Meta{
+		ContentType:        aws.StringValue(out.ContentType),
+		Size:               aws.Int64Value(out.ContentLength),
+		ModificationTime:   aws.TimeValue(out.LastModified),
+		ETag:               aws.StringValue(out.ETag),
+		ContentEncoding:    aws.StringValue(out.ContentEncoding),
+		CacheControl:       aws.StringValue(out.CacheControl),
+		ContentDisposition: aws.StringValue(out.ContentDisposition),
+		Metadata:           metadata(out.Metadata),
+	}
+	if out.ContentRange != nil {
+		meta.Offset, meta.Size, rerr = parseContentRange(*out.ContentRange)
+		if nil != rerr {
+			return translateError(rerr, "GET s3://%s/%s", s.bucketName, key)
+		}
+	}
+
+	err = translateError(src(meta, out.Body), "GET s3://%s/%s", s.bucketName, key)
+	return
+}
+
+// Delete deletes a blob from the bucket. S3 does not support conditional
+// deletes, so an IfMatch precondition is checked by retrieving the ETag of the
+// blob before deleting it. A concurrent write between the two requests may
+// therefore be deleted.
+func (s *S3) Delete(ctx context.Context, key string, opts storage.DeleteOptions) error {
+	if opts.IfMatch != "" {
+		meta, err := s.Stat(ctx, key)
+		if storage.IsNotFoundError(err) {
+			return storage.Errorf(err, storage.PreconditionFailedError, "%s: blob does not exist", key)
+		} else if err != nil {
+			return err
+		} else if meta.ETag != opts.IfMatch {
+			return storage.Errorf(nil, storage.PreconditionFailedError, "%s: ETag %q does not match %q", key, meta.ETag, opts.IfMatch)
+		}
+	}
+
+	key = path.Join(s.namePrefix, key)
+	_, err := s.client.DeleteObjectWithContext(ctx, &awss3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	return translateError(err, "DELETE s3://%s/%s", s.bucketName, key)
+}
+
+// metadata converts the user-defined metadata of an object. S3 treats the keys
+// as case-insensitive and stores them in lowercase.
+func metadata(in map[string]*string) map[string]string {
+	if len(in) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[strings.ToLower(k)] = aws.StringValue(v)
+	}
+	return out
+}
+
+func (s *S3) Stat(ctx context.Context, key string) (*storage.Meta, error) {
+	key = path.Join(s.namePrefix, key)
+	out, err := s.client.HeadObjectWithContext(ctx, &awss3.HeadObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, translateError(err, "HEAD s3://%s/%s", s.bucketName, key)
+	}
+	return &storage.Meta{
+		ContentType:        aws.StringValue(out.ContentType),
+		Size:               aws.Int64Value(out.ContentLength),
+		ModificationTime:   aws.TimeValue(out.LastModified),
+		ETag:               aws.StringValue(out.ETag),
+		ContentEncoding:    aws.StringValue(out.ContentEncoding),
+		CacheControl:       aws.StringValue(out.CacheControl),
+		ContentDisposition: aws.StringValue(out.ContentDisposition),
+		Metadata:           metadata(out.Metadata),
+	}, nil
+}
+
+// Copy copies a blob within the bucket using a single request, which S3 limits
+// to blobs of at most 5 GiB. Preconditions on the destination blob are not
+// supported.
+func (s *S3) Copy(ctx context.Context, srcKey, dstKey string, opts storage.CopyOptions) error {
+	srcKey, dstKey = path.Join(s.namePrefix, srcKey), path.Join(s.namePrefix, dstKey)
+	if opts.IfMatch != "" || opts.IfNoneMatch {
+		return storage.Errorf(nil, storage.UnknownError, "COPY s3://%s/%s: preconditions are not supported", s.bucketName, dstKey)
+	}
+
+	input := &awss3.CopyObjectInput{
+		Bucket:            aws.String(s.bucketName),
+		Key:               aws.String(dstKey),
+		CopySource:        aws.String(url.PathEscape(s.bucketName) + "/" + (&url.URL{Path: srcKey}).EscapedPath()),
+		MetadataDirective: aws.String(awss3.MetadataDirectiveCopy),
+	}
+	if opts.SourceIfMatch != "" {
+		input.CopySourceIfMatch = aws.String(opts.SourceIfMatch)
+	}
+
+	_, err := s.client.CopyObjectWithContext(ctx, input)
+	return translateError(err, "COPY s3://%s/%s to s3://%s/%s", s.bucketName, srcKey, s.bucketName, dstKey)
+}
+
+// SignURL creates a presigned URL for the object using the credentials of the
+// blob store.
+func (s *S3) SignURL(ctx context.Context, key string, opts storage.SignOptions) (string, error) {
+	key = path.Join(s.namePrefix, key)
+
+	duration := opts.Duration
+	if duration <= 0 {
+		duration = storage.DefaultSignedURLDuration
+	}
+
+	var req *request.Request
+	switch opts.Method {
+	case "", http.MethodGet:
+		req, _ = s.client.GetObjectRequest(&awss3.GetObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		})
+	case http.MethodPut:
+		input := &awss3.PutObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    aws.String(key),
+		}
+		if opts.ContentType != "" {
+			input.ContentType = aws.String(opts.ContentType)
+		}
+		req, _ = s.client.PutObjectRequest(input)
+	default:
+		return "", storage.Errorf(nil, storage.UnknownError, "SIGN s3://%s/%s: unsupported method %q", s.bucketName, key, opts.Method)
+	}
+	req.SetContext(ctx)
+
+	u, err := req.Presign(duration)
+	return u, translateError(err, "SIGN s3://%s/%s", s.bucketName, key)
+}
+
+// DefaultListPageSize is the maximum number of keys and prefixes returned by a
+// single call to List if the page size is not specified.
+const DefaultListPageSize = 1000
+
+// objectKey returns the object key in the bucket corresponding to a key
+// prefix. Unlike path.Join, it preserves any trailing slash.
+func (s *S3) objectKey(prefix string) string {
+	if s.namePrefix == "" || s.namePrefix == "." {
+		return prefix
+	}
+	return s.namePrefix + "/" + prefix
+}
+
+// key returns the storage key corresponding to an object key.
+func (s *S3) key(objectKey string) string {
+	return strings.TrimPrefix(objectKey, s.objectKey(""))
+}
+
+// List enumerates the keys in the bucket. S3 does not return content types in
+// listings, so the content type of each entry is always empty.
+func (s *S3) List(ctx context.Context, opts storage.ListOptions) (*storage.ListPage, error) {
+	prefix := s.objectKey(opts.Prefix)
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultListPageSize
+	}
+
+	input := &awss3.ListObjectsV2Input{
+		Bucket:  aws.String(s.bucketName),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(pageSize)),
+	}
+	if opts.Delimiter != "" {
+		input.Delimiter = aws.String(opts.Delimiter)
+	}
+	if opts.PageToken != "" {
+		input.ContinuationToken = aws.String(opts.PageToken)
+	}
+
+	out, err := s.client.ListObjectsV2WithContext(ctx, input)
+	if err != nil {
+		return nil, translateError(err, "LIST s3://%s/%s", s.bucketName, prefix)
+	}
+
+	page := &storage.ListPage{}
+	if aws.BoolValue(out.IsTruncated) {
+		page.NextPageToken = aws.StringValue(out.NextContinuationToken)
+	}
+	for _, cp := range out.CommonPrefixes {
+		page.Prefixes = append(page.Prefixes, s.key(aws.StringValue(cp.Prefix)))
+	}
+	for _, obj := range out.Contents {
+		page.Entries = append(page.Entries, &storage.ListEntry{
+			Key: s.key(aws.StringValue(obj.Key)),
+			Meta: storage.Meta{
+				Size:             aws.Int64Value(obj.Size),
+				ModificationTime: aws.TimeValue(obj.LastModified),
+				ETag:             aws.StringValue(obj.ETag),
+			},
+		})
+	}
+	return page, nil
+}
+
+func stripSlash(path string) string {
+	if len(path) > 0 && path[0] == '/' {
+		return path[1:]
+	}
+	return path
+}
+
+func newS3(u url.URL, client s3iface.S3API) (storage.BlobStore, error) {
+	return &S3{
+		client:     client,
+		uploader:   s3manager.NewUploaderWithClient(client),
+		bucketName: u.Hostname(),
+		namePrefix: stripSlash(path.Clean(u.Path)),
+	}, nil
+}
+
+// New creates a blob store for a URL of the form s3://bucket/prefix.
+//
+// Credentials and the default region are discovered using the standard AWS
+// SDK mechanisms (environment variables, shared configuration, and instance
+// roles). The following query parameters are also recognized:
+//
+//	region: The AWS region of the bucket.
+//	endpoint: A custom endpoint URL, e.g. for an S3-compatible service.
+//	forcePathStyle: If true, address the bucket as part of the URL path
+//	  instead of the host name.
+func New(u url.URL) (storage.BlobStore, error) {
+	cfg := aws.NewConfig()
+	if arr := u.Query()["region"]; len(arr) > 0 {
+		cfg = cfg.WithRegion(arr[0])
+	}
+	if arr := u.Query()["endpoint"]; len(arr) > 0 {
+		cfg = cfg.WithEndpoint(arr[0])
+	}
+	if arr := u.Query()["forcePathStyle"]; len(arr) > 0 {
+		b, err := strconv.ParseBool(arr[0])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse forcePathStyle=%s (%s)", arr[0], err.Error())
+		}
+		cfg = cfg.WithS3ForcePathStyle(b)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if nil != err {
+		return nil, err
+	}
+	return newS3(u, awss3.New(sess))
+}
@@ -0,0 +1,814 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/google/uuid"
+	"github.com/puppetlabs/leg/storage"
+	"github.com/puppetlabs/leg/storage/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func toUrl(s string) url.URL {
+	u, err := url.ParseRequestURI(s)
+	if nil != err {
+		panic(err)
+	}
+	return *u
+}
+
+func TestRealS3(t *testing.T) {
+	bucketName := os.Getenv("S3_BUCKET")
+	if 0 == len(bucketName) {
+		t.Skip("Define the S3_BUCKET environment variable (and optionally S3_ENDPOINT for an S3-compatible service) to enable S3 tests")
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 60*time.Second)
+	defer cancel()
+
+	key, err := uuid.NewRandom()
+	assert.NoError(t, err)
+
+	content := []byte("TEST CONTENT")
+
+	u := "s3://" + bucketName
+	if endpoint := os.Getenv("S3_ENDPOINT"); endpoint != "" {
+		u += "?forcePathStyle=true&endpoint=" + url.QueryEscape(endpoint)
+	}
+
+	s3, err := storage.NewBlobStore(toUrl(u))
+	require.NoError(t, err)
+
+	err = s3.Put(ctx, key.String(), func(w io.Writer) error {
+		_, err := w.Write(content)
+		return err
+	}, storage.PutOptions{
+		ContentType: "application/testing",
+	})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = s3.Get(ctx, key.String(), func(meta *storage.Meta, r io.Reader) error {
+		assert.Equal(t, meta.ContentType, "application/testing")
+		assert.Equal(t, meta.Offset, int64(8))
+		assert.Equal(t, meta.Size, int64(12))
+		_, err := io.Copy(&buf, r)
+		return err
+	}, storage.GetOptions{
+		Offset: -4,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("TENT"), buf.Bytes())
+
+	assert.NoError(t, s3.Delete(ctx, key.String(), storage.DeleteOptions{}))
+}
+
+type fakeObject struct {
+	data         []byte
+	header       http.Header
+	lastModified time.Time
+}
+
+// fakeS3 is a minimal in-process stand-in for the S3 REST API using path-style
+// addressing.
+type fakeS3 struct {
+	bucketName  string
+	accessKeyID string
+
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+	uploads map[string]*fakeUpload
+}
+
+type fakeUpload struct {
+	key    string
+	header http.Header
+	parts  map[int64][]byte
+}
+
+func (o *fakeObject) etag() string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(o.data))
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		bucketName:  "bucket",
+		accessKeyID: "AKID",
+		objects:     make(map[string]*fakeObject),
+		uploads:     make(map[string]*fakeUpload),
+	}
+}
+
+func (f *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{
+		Code:    code,
+		Message: code,
+	})
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Authorization"), "Credential="+f.accessKeyID+"/") &&
+		!strings.HasPrefix(r.URL.Query().Get("X-Amz-Credential"), f.accessKeyID+"/") {
+		f.writeError(w, http.StatusForbidden, "InvalidAccessKeyId")
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] != f.bucketName {
+		f.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(parts) != 2 || parts[1] == "" {
+		if r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2" {
+			f.list(w, r)
+		} else {
+			f.writeError(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+	key := parts[1]
+
+	if _, found := r.URL.Query()["uploads"]; found || r.URL.Query().Get("uploadId") != "" {
+		f.multipart(w, r, key)
+		return
+	}
+
+	if r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "" {
+		f.copy(w, r, key)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		f.objects[key] = &fakeObject{
+			data:         data,
+			header:       contentHeader(r),
+			lastModified: time.Now(),
+		}
+		w.Header().Set("ETag", f.objects[key].etag())
+	case http.MethodGet, http.MethodHead:
+		obj, found := f.objects[key]
+		if !found {
+			f.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+
+		size := int64(len(obj.data))
+		start, end := int64(0), size-1
+		if rng := r.Header.Get("Range"); rng != "" {
+			spec := strings.SplitN(strings.TrimPrefix(rng, "bytes="), "-", 2)
+			if spec[0] == "" {
+				n, _ := strconv.ParseInt(spec[1], 10, 64)
+				if start = size - n; start < 0 {
+					start = 0
+				}
+			} else {
+				start, _ = strconv.ParseInt(spec[0], 10, 64)
+				if spec[1] != "" {
+					end, _ = strconv.ParseInt(spec[1], 10, 64)
+				}
+				if end >= size {
+					end = size - 1
+				}
+			}
+			if start >= size {
+				f.writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		}
+
+		for name, values := range obj.header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("ETag", obj.etag())
+		w.Header().Set("Last-Modified", obj.lastModified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+		if r.Header.Get("Range") != "" {
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		_, _ = w.Write(obj.data[start : end+1])
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+type fakeCopyResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string
+	LastModified time.Time
+}
+
+func (f *fakeS3) copy(w http.ResponseWriter, r *http.Request, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		f.writeError(w, http.StatusBadRequest, "InvalidArgument")
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+	if len(parts) != 2 || parts[0] != f.bucketName {
+		f.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+
+	src, found := f.objects[parts[1]]
+	if !found {
+		f.writeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	} else if etag := r.Header.Get("X-Amz-Copy-Source-If-Match"); etag != "" && etag != src.etag() {
+		f.writeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return
+	} else if r.Header.Get("X-Amz-Metadata-Directive") != "COPY" {
+		f.writeError(w, http.StatusNotImplemented, "NotImplemented")
+		return
+	}
+
+	obj := &fakeObject{
+		data:         src.data,
+		header:       src.header,
+		lastModified: time.Now(),
+	}
+	f.objects[key] = obj
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(&fakeCopyResult{
+		ETag:         obj.etag(),
+		LastModified: obj.lastModified.UTC(),
+	})
+}
+
+// contentHeader returns the headers of a request that are stored with an
+// object.
+func contentHeader(r *http.Request) http.Header {
+	header := make(http.Header)
+	for name, values := range r.Header {
+		switch {
+		case name == "Content-Type", name == "Content-Encoding", name == "Cache-Control", name == "Content-Disposition":
+		case strings.HasPrefix(name, "X-Amz-Meta-"):
+		default:
+			continue
+		}
+		header[name] = values
+	}
+	return header
+}
+
+type fakeInitiateResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type fakePart struct {
+	PartNumber int64
+	ETag       string
+	Size       int64 `xml:",omitempty"`
+}
+
+type fakeListPartsResult struct {
+	XMLName     xml.Name `xml:"ListPartsResult"`
+	Bucket      string
+	Key         string
+	UploadId    string
+	IsTruncated bool
+	Part        []fakePart
+}
+
+type fakeCompleteRequest struct {
+	Part []fakePart
+}
+
+type fakeCompleteResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string
+	Key     string
+	ETag    string
+}
+
+func partETag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(data))
+}
+
+func (f *fakeS3) multipart(w http.ResponseWriter, r *http.Request, key string) {
+	w.Header().Set("Content-Type", "application/xml")
+
+	if _, found := r.URL.Query()["uploads"]; found {
+		if r.Method != http.MethodPost {
+			f.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+			return
+		}
+
+		uploadID := uuid.New().String()
+		f.uploads[uploadID] = &fakeUpload{
+			key:    key,
+			header: contentHeader(r),
+			parts:  make(map[int64][]byte),
+		}
+		_ = xml.NewEncoder(w).Encode(&fakeInitiateResult{
+			Bucket:   f.bucketName,
+			Key:      key,
+			UploadId: uploadID,
+		})
+		return
+	}
+
+	uploadID := r.URL.Query().Get("uploadId")
+	upload, found := f.uploads[uploadID]
+	if !found || upload.key != key {
+		f.writeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		number, err := strconv.ParseInt(r.URL.Query().Get("partNumber"), 10, 64)
+		if err != nil || number < 1 || number > 10000 {
+			f.writeError(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.writeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		upload.parts[number] = data
+		w.Header().Set("ETag", partETag(data))
+	case http.MethodGet:
+		res := &fakeListPartsResult{
+			Bucket:   f.bucketName,
+			Key:      key,
+			UploadId: uploadID,
+		}
+		for number, data := range upload.parts {
+			res.Part = append(res.Part, fakePart{
+				PartNumber: number,
+				ETag:       partETag(data),
+				Size:       int64(len(data)),
+			})
+		}
+		sort.Slice(res.Part, func(i, j int) bool { return res.Part[i].PartNumber < res.Part[j].PartNumber })
+		_ = xml.NewEncoder(w).Encode(res)
+	case http.MethodPost:
+		var req fakeCompleteRequest
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Part) == 0 {
+			f.writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+
+		var data []byte
+		for i, part := range req.Part {
+			if i > 0 && part.PartNumber <= req.Part[i-1].PartNumber {
+				f.writeError(w, http.StatusBadRequest, "InvalidPartOrder")
+				return
+			}
+			content, found := upload.parts[part.PartNumber]
+			if !found || partETag(content) != part.ETag {
+				f.writeError(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			data = append(data, content...)
+		}
+
+		obj := &fakeObject{
+			data:         data,
+			header:       upload.header,
+			lastModified: time.Now(),
+		}
+		f.objects[key] = obj
+		delete(f.uploads, uploadID)
+
+		_ = xml.NewEncoder(w).Encode(&fakeCompleteResult{
+			Bucket: f.bucketName,
+			Key:    key,
+			ETag:   obj.etag(),
+		})
+	case http.MethodDelete:
+		delete(f.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+type fakeListContents struct {
+	Key          string
+	LastModified time.Time
+	Size         int64
+}
+
+type fakeListCommonPrefix struct {
+	Prefix string
+}
+
+type fakeListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	Contents              []fakeListContents
+	CommonPrefixes        []fakeListCommonPrefix
+	NextContinuationToken string `xml:",omitempty"`
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	delimiter := r.URL.Query().Get("delimiter")
+	start := r.URL.Query().Get("continuation-token")
+	maxKeys, err := strconv.Atoi(r.URL.Query().Get("max-keys"))
+	if err != nil || maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	res := &fakeListResult{
+		Name:    f.bucketName,
+		Prefix:  prefix,
+		MaxKeys: maxKeys,
+	}
+
+	var last string
+	for _, key := range keys {
+		item, isPrefix := key, false
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i >= 0 {
+				item, isPrefix = key[:len(prefix)+i+len(delimiter)], true
+			}
+		}
+
+		if item <= start || item == last {
+			continue
+		} else if res.KeyCount >= maxKeys {
+			res.IsTruncated = true
+			res.NextContinuationToken = last
+			break
+		}
+		last = item
+		res.KeyCount++
+
+		if isPrefix {
+			res.CommonPrefixes = append(res.CommonPrefixes, fakeListCommonPrefix{Prefix: item})
+		} else {
+			res.Contents = append(res.Contents, fakeListContents{
+				Key:          key,
+				LastModified: f.objects[key].lastModified,
+				Size:         int64(len(f.objects[key].data)),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	_ = xml.NewEncoder(w).Encode(res)
+}
+
+func withTestServer(t *testing.T, h http.Handler, accessKeyID string, fn func(s3 storage.BlobStore)) {
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials(accessKeyID, "secret", ""),
+		Endpoint:         aws.String(ts.URL),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	s3, err := newS3(toUrl("s3://bucket/prefix"), awss3.New(sess))
+	require.NoError(t, err)
+	fn(s3)
+}
+
+func TestPutGetDelete(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := newFakeS3()
+	withTestServer(t, fake, "AKID", func(s3 storage.BlobStore) {
+		payload := []byte(`{"test": "payload"}`)
+
+		require.NoError(t, s3.Put(ctx, "test/key", func(w io.Writer) error {
+			_, err := w.Write(payload)
+			return err
+		}, storage.PutOptions{
+			ContentType: "application/json",
+		}))
+		require.Contains(t, fake.objects, "prefix/test/key")
+
+		buf := &bytes.Buffer{}
+		require.NoError(t, s3.Get(ctx, "test/key", func(meta *storage.Meta, r io.Reader) error {
+			assert.Equal(t, "application/json", meta.ContentType)
+			assert.Equal(t, int64(0), meta.Offset)
+			assert.Equal(t, int64(len(payload)), meta.Size)
+			_, err := io.Copy(buf, r)
+			return err
+		}, storage.GetOptions{}))
+		require.Equal(t, payload, buf.Bytes())
+
+		require.NoError(t, s3.Delete(ctx, "test/key", storage.DeleteOptions{}))
+
+		err := s3.Get(ctx, "test/key", func(meta *storage.Meta, r io.Reader) error {
+			return nil
+		}, storage.GetOptions{})
+		require.Error(t, err)
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+	})
+}
+
+func TestRange(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		var testPayload = []byte("012345678Xabcdef\n012345678Yabcdef\n012345678Zabcdef\n")
+
+		require.NoError(t, s3.Put(ctx, "3hex", func(w io.Writer) error {
+			_, err := w.Write(testPayload)
+			return err
+		}, storage.PutOptions{
+			ContentType: "hex",
+		}))
+
+		cases := []struct {
+			offset         int64
+			length         int64
+			absoluteOffset int64
+			expect         string
+		}{
+			{-17, 0, 2 * 17, "012345678Zabcdef\n"},
+			{17, 17, 17, "012345678Yabcdef\n"},
+			{0, 17, 0, "012345678Xabcdef\n"},
+			{34, 0, 34, "012345678Zabcdef\n"},
+			{-100, 0, 0, string(testPayload)},
+		}
+
+		for _, c := range cases {
+			buf := &bytes.Buffer{}
+			err := s3.Get(ctx, "3hex", func(meta *storage.Meta, r io.Reader) error {
+				assert.Equal(t, "hex", meta.ContentType)
+				assert.Equal(t, c.absoluteOffset, meta.Offset)
+				assert.Equal(t, int64(17*3), meta.Size)
+				_, err := io.Copy(buf, r)
+				return err
+			}, storage.GetOptions{
+				Offset: c.offset,
+				Length: c.length,
+			})
+			require.NoError(t, err)
+			require.Equal(t, c.expect, buf.String())
+		}
+
+		err := s3.Get(ctx, "3hex", func(meta *storage.Meta, r io.Reader) error {
+			return nil
+		}, storage.GetOptions{
+			Offset: -10,
+			Length: 5,
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestAuthError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTestServer(t, newFakeS3(), "WRONG", func(s3 storage.BlobStore) {
+		err := s3.Put(ctx, "test/key", func(w io.Writer) error {
+			_, err := w.Write([]byte("test string"))
+			return err
+		}, storage.PutOptions{})
+		require.Error(t, err)
+		require.True(t, storage.IsAuthError(err), "%+v", err)
+
+		err = s3.Get(ctx, "test/key", func(meta *storage.Meta, r io.Reader) error {
+			return nil
+		}, storage.GetOptions{})
+		require.Error(t, err)
+		require.True(t, storage.IsAuthError(err), "%+v", err)
+	})
+}
+
+func TestSinkError(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		sinkErr := errors.New("sink failed")
+
+		err := s3.Put(ctx, "test/key", func(w io.Writer) error {
+			if _, err := w.Write([]byte("partial")); err != nil {
+				return err
+			}
+			return sinkErr
+		}, storage.PutOptions{})
+		require.Error(t, err)
+		require.True(t, errors.Is(err, sinkErr), "%+v", err)
+	})
+}
+
+func TestCanceled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		err := s3.Get(ctx, "test/key", func(meta *storage.Meta, r io.Reader) error {
+			return nil
+		}, storage.GetOptions{})
+		require.Error(t, err)
+		require.True(t, storage.IsTimeoutError(err), "%+v", err)
+	})
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		testutils.RunListerTests(t, s3)
+	})
+}
+
+func TestStat(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		testutils.RunStatTests(t, s3)
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		testutils.RunMetadataTests(t, s3)
+	})
+}
+
+func TestMultipartUpload(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		testutils.RunMultipartUploadTests(t, s3)
+	})
+}
+
+func TestMultipartUploadPreconditions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		_, err := s3.(storage.MultipartUploader).InitiateUpload(ctx, "test/key", storage.PutOptions{IfNoneMatch: true})
+		require.Error(t, err)
+	})
+}
+
+func TestCopy(t *testing.T) {
+	t.Parallel()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		testutils.RunCopyTests(t, s3)
+	})
+}
+
+func TestCopyPreconditions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		require.NoError(t, s3.Put(ctx, "test/src", func(w io.Writer) error {
+			_, err := io.WriteString(w, "test string")
+			return err
+		}, storage.PutOptions{}))
+
+		err := storage.Copy(ctx, s3, "test/src", s3, "test/dst", storage.CopyOptions{IfNoneMatch: true})
+		require.Error(t, err)
+
+		err = storage.Copy(ctx, s3, "test/src", s3, "test/dst", storage.CopyOptions{SourceIfMatch: `"0"`})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+	})
+}
+
+func TestDeletePreconditions(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	fake := newFakeS3()
+	withTestServer(t, fake, "AKID", func(s3 storage.BlobStore) {
+		require.NoError(t, s3.Put(ctx, "test/key", func(w io.Writer) error {
+			_, err := io.WriteString(w, "test string")
+			return err
+		}, storage.PutOptions{}))
+
+		meta, err := storage.Stat(ctx, s3, "test/key")
+		require.NoError(t, err)
+
+		err = s3.Delete(ctx, "test/key", storage.DeleteOptions{IfMatch: `"0"`})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+		require.Contains(t, fake.objects, "prefix/test/key")
+
+		require.NoError(t, s3.Delete(ctx, "test/key", storage.DeleteOptions{IfMatch: meta.ETag}))
+		require.NotContains(t, fake.objects, "prefix/test/key")
+
+		err = s3.Delete(ctx, "test/key", storage.DeleteOptions{IfMatch: meta.ETag})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		// Without a precondition, deleting a missing blob succeeds.
+		require.NoError(t, s3.Delete(ctx, "test/key", storage.DeleteOptions{}))
+	})
+}
+
+func TestSignURL(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	withTestServer(t, newFakeS3(), "AKID", func(s3 storage.BlobStore) {
+		signer := s3.(storage.Signer)
+
+		put, err := signer.SignURL(ctx, "test/key", storage.SignOptions{
+			Method:      http.MethodPut,
+			Duration:    time.Hour,
+			ContentType: "text/plain",
+		})
+		require.NoError(t, err)
+
+		u, err := url.Parse(put)
+		require.NoError(t, err)
+		assert.Equal(t, "/bucket/prefix/test/key", u.Path)
+		assert.Equal(t, "3600", u.Query().Get("X-Amz-Expires"))
+		assert.Contains(t, u.Query().Get("X-Amz-SignedHeaders"), "content-type")
+
+		req, err := http.NewRequest(http.MethodPut, put, strings.NewReader("test string"))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "text/plain")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		get, err := signer.SignURL(ctx, "test/key", storage.SignOptions{})
+		require.NoError(t, err)
+
+		resp, err = http.Get(get)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "test string", string(b))
+
+		_, err = signer.SignURL(ctx, "test/key", storage.SignOptions{Method: http.MethodDelete})
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Stat retrieves the metadata of the blob with the given key. If the blob
+// store does not implement Stater, the metadata is retrieved using Get without
+// reading the content of the blob.
+func Stat(ctx context.Context, store BlobStore, key string) (*Meta, error) {
+	if s, ok := store.(Stater); ok {
+		return s.Stat(ctx, key)
+	}
+
+	var meta *Meta
+	err := store.Get(ctx, key, func(m *Meta, _ io.Reader) error {
+		meta = m
+		return nil
+	}, GetOptions{IncludeMetadata: true})
+	if err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -1,13 +1,20 @@
 package testutils
 
 import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
 	"net/url"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/uuid"
 	"github.com/puppetlabs/leg/storage"
 	"github.com/puppetlabs/leg/workdir"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -24,3 +31,621 @@ func NewTempFilesystemBlobStore(t *testing.T) (storage.BlobStore, func() error,
 
 	return fs, wd.Cleanup, wd.Path
 }
+
+// RunListerTests checks the listing behavior of a blob store that implements
+// storage.Lister. The blob store must initially be empty.
+func RunListerTests(t *testing.T, store storage.BlobStore) {
+	lister, ok := store.(storage.Lister)
+	require.True(t, ok, "%T does not implement storage.Lister", store)
+
+	ctx := context.Background()
+
+	blobs := map[string]string{
+		"a-c":   "a-c",
+		"a/1":   "1",
+		"a/2":   "22",
+		"a/b/3": "333",
+		"b":     "bbbb",
+	}
+	for key, content := range blobs {
+		content := content
+		require.NoError(t, store.Put(ctx, key, func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}, storage.PutOptions{
+			ContentType: "text/plain",
+		}))
+	}
+
+	cases := []struct {
+		Name             string
+		Options          storage.ListOptions
+		ExpectedKeys     []string
+		ExpectedPrefixes []string
+	}{
+		{
+			Name:         "All",
+			ExpectedKeys: []string{"a-c", "a/1", "a/2", "a/b/3", "b"},
+		},
+		{
+			Name:         "Prefix",
+			Options:      storage.ListOptions{Prefix: "a/"},
+			ExpectedKeys: []string{"a/1", "a/2", "a/b/3"},
+		},
+		{
+			Name:         "Partial prefix",
+			Options:      storage.ListOptions{Prefix: "a"},
+			ExpectedKeys: []string{"a-c", "a/1", "a/2", "a/b/3"},
+		},
+		{
+			Name:    "Prefix with no matches",
+			Options: storage.ListOptions{Prefix: "z"},
+		},
+		{
+			Name:             "Delimiter",
+			Options:          storage.ListOptions{Delimiter: "/"},
+			ExpectedKeys:     []string{"a-c", "b"},
+			ExpectedPrefixes: []string{"a/"},
+		},
+		{
+			Name:             "Prefix and delimiter",
+			Options:          storage.ListOptions{Prefix: "a/", Delimiter: "/"},
+			ExpectedKeys:     []string{"a/1", "a/2"},
+			ExpectedPrefixes: []string{"a/b/"},
+		},
+		{
+			Name:         "Paginated",
+			Options:      storage.ListOptions{PageSize: 2},
+			ExpectedKeys: []string{"a-c", "a/1", "a/2", "a/b/3", "b"},
+		},
+		{
+			Name:             "Paginated with delimiter",
+			Options:          storage.ListOptions{Delimiter: "/", PageSize: 1},
+			ExpectedKeys:     []string{"a-c", "b"},
+			ExpectedPrefixes: []string{"a/"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var keys, prefixes []string
+
+			opts := c.Options
+			for {
+				page, err := lister.List(ctx, opts)
+				require.NoError(t, err)
+
+				if opts.PageSize > 0 {
+					require.LessOrEqual(t, len(page.Entries)+len(page.Prefixes), opts.PageSize)
+				}
+
+				for _, entry := range page.Entries {
+					keys = append(keys, entry.Key)
+
+					assert.Equal(t, int64(len(blobs[entry.Key])), entry.Meta.Size, "size of %q", entry.Key)
+					assert.False(t, entry.Meta.ModificationTime.IsZero(), "modification time of %q", entry.Key)
+					if entry.Meta.ContentType != "" {
+						assert.Equal(t, "text/plain", entry.Meta.ContentType, "content type of %q", entry.Key)
+					}
+				}
+				prefixes = append(prefixes, page.Prefixes...)
+
+				if page.NextPageToken == "" {
+					break
+				}
+				opts.PageToken = page.NextPageToken
+			}
+
+			assert.Equal(t, c.ExpectedKeys, keys)
+			assert.Equal(t, c.ExpectedPrefixes, prefixes)
+		})
+	}
+}
+
+// RunPreconditionTests checks the behavior of the IfMatch and IfNoneMatch
+// preconditions of a blob store. The blob store must initially be empty.
+func RunPreconditionTests(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+
+	put := func(key, content string, opts storage.PutOptions) error {
+		return store.Put(ctx, key, func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		}, opts)
+	}
+
+	get := func(key string) (string, string) {
+		var etag string
+		var buf bytes.Buffer
+		require.NoError(t, store.Get(ctx, key, func(meta *storage.Meta, r io.Reader) error {
+			etag = meta.ETag
+			_, err := io.Copy(&buf, r)
+			return err
+		}, storage.GetOptions{}))
+		require.NotEmpty(t, etag)
+		return buf.String(), etag
+	}
+
+	t.Run("Create only", func(t *testing.T) {
+		require.NoError(t, put("create", "first", storage.PutOptions{IfNoneMatch: true}))
+
+		err := put("create", "second", storage.PutOptions{IfNoneMatch: true})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		content, _ := get("create")
+		assert.Equal(t, "first", content)
+	})
+
+	t.Run("Update if matching", func(t *testing.T) {
+		require.NoError(t, put("update", "first", storage.PutOptions{}))
+		_, etag1 := get("update")
+
+		require.NoError(t, put("update", "second", storage.PutOptions{IfMatch: etag1}))
+		content, etag2 := get("update")
+		assert.Equal(t, "second", content)
+		assert.NotEqual(t, etag1, etag2)
+
+		err := put("update", "third", storage.PutOptions{IfMatch: etag1})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		content, etag3 := get("update")
+		assert.Equal(t, "second", content)
+		assert.Equal(t, etag2, etag3)
+	})
+
+	t.Run("Update missing blob", func(t *testing.T) {
+		_, etag := get("update")
+
+		err := put("missing", "first", storage.PutOptions{IfMatch: etag})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+	})
+
+	t.Run("Delete if matching", func(t *testing.T) {
+		require.NoError(t, put("delete", "first", storage.PutOptions{}))
+		_, etag1 := get("delete")
+		require.NoError(t, put("delete", "second", storage.PutOptions{}))
+		_, etag2 := get("delete")
+
+		err := store.Delete(ctx, "delete", storage.DeleteOptions{IfMatch: etag1})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		require.NoError(t, store.Delete(ctx, "delete", storage.DeleteOptions{IfMatch: etag2}))
+
+		err = store.Get(ctx, "delete", func(meta *storage.Meta, r io.Reader) error {
+			return nil
+		}, storage.GetOptions{})
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+		err = store.Delete(ctx, "delete", storage.DeleteOptions{IfMatch: etag2})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+	})
+
+	t.Run("Copy if matching", func(t *testing.T) {
+		require.NoError(t, put("copy/src", "first", storage.PutOptions{}))
+		_, srcETag := get("copy/src")
+
+		require.NoError(t, storage.Copy(ctx, store, "copy/src", store, "copy/dst", storage.CopyOptions{IfNoneMatch: true}))
+		_, dstETag := get("copy/dst")
+
+		err := storage.Copy(ctx, store, "copy/src", store, "copy/dst", storage.CopyOptions{IfNoneMatch: true})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		require.NoError(t, put("copy/src", "second", storage.PutOptions{}))
+
+		err = storage.Copy(ctx, store, "copy/src", store, "copy/dst", storage.CopyOptions{SourceIfMatch: srcETag})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+		_, srcETag = get("copy/src")
+		require.NoError(t, storage.Copy(ctx, store, "copy/src", store, "copy/dst", storage.CopyOptions{
+			SourceIfMatch: srcETag,
+			IfMatch:       dstETag,
+		}))
+		content, _ := get("copy/dst")
+		assert.Equal(t, "second", content)
+
+		err = storage.Copy(ctx, store, "copy/src", store, "copy/dst", storage.CopyOptions{IfMatch: dstETag})
+		require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+	})
+
+	if uploader, ok := store.(storage.MultipartUploader); ok {
+		t.Run("Complete upload if matching", func(t *testing.T) {
+			upload := func(opts storage.PutOptions, content string) error {
+				uploadID, err := uploader.InitiateUpload(ctx, "upload", opts)
+				if err != nil {
+					return err
+				}
+
+				part, err := uploader.UploadPart(ctx, "upload", uploadID, 1, func(w io.Writer) error {
+					_, err := io.WriteString(w, content)
+					return err
+				})
+				if err != nil {
+					return err
+				}
+
+				err = uploader.CompleteUpload(ctx, "upload", uploadID, []*storage.Part{part})
+				if err != nil {
+					assert.NoError(t, uploader.AbortUpload(ctx, "upload", uploadID))
+				}
+				return err
+			}
+
+			require.NoError(t, upload(storage.PutOptions{IfNoneMatch: true}, "first"))
+			_, etag1 := get("upload")
+
+			err := upload(storage.PutOptions{IfNoneMatch: true}, "second")
+			require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+			require.NoError(t, put("upload", "second", storage.PutOptions{}))
+
+			err = upload(storage.PutOptions{IfMatch: etag1}, "third")
+			require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+			content, etag2 := get("upload")
+			assert.Equal(t, "second", content)
+
+			require.NoError(t, upload(storage.PutOptions{IfMatch: etag2}, "third"))
+			content, _ = get("upload")
+			assert.Equal(t, "third", content)
+		})
+	}
+}
+
+// RunStatTests checks that the metadata of a blob retrieved using
+// storage.Stat is consistent with the metadata provided by Get, both for the
+// blob store itself and when falling back to Get.
+func RunStatTests(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+
+	content := "test content"
+	require.NoError(t, store.Put(ctx, "stat/key", func(w io.Writer) error {
+		_, err := io.WriteString(w, content)
+		return err
+	}, storage.PutOptions{
+		ContentType: "text/plain",
+	}))
+
+	var expected *storage.Meta
+	require.NoError(t, store.Get(ctx, "stat/key", func(meta *storage.Meta, r io.Reader) error {
+		expected = meta
+		return nil
+	}, storage.GetOptions{IncludeMetadata: true}))
+
+	stores := map[string]storage.BlobStore{
+		"Stater":   store,
+		"Fallback": struct{ storage.BlobStore }{store},
+	}
+	for name, store := range stores {
+		store := store
+		t.Run(name, func(t *testing.T) {
+			meta, err := storage.Stat(ctx, store, "stat/key")
+			require.NoError(t, err)
+
+			assert.Equal(t, "text/plain", meta.ContentType)
+			assert.Equal(t, int64(len(content)), meta.Size)
+			assert.Equal(t, int64(0), meta.Offset)
+			assert.Equal(t, expected.ETag, meta.ETag)
+			assert.False(t, meta.ModificationTime.IsZero())
+			if meta.MD5 != nil {
+				sum := md5.Sum([]byte(content))
+				assert.Equal(t, sum[:], meta.MD5)
+			}
+
+			_, err = storage.Stat(ctx, store, "stat/missing")
+			require.True(t, storage.IsNotFoundError(err), "%+v", err)
+		})
+	}
+}
+
+// RunMetadataTests checks that the content headers and user-defined metadata
+// provided when writing a blob are returned when the blob is read.
+func RunMetadataTests(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+
+	opts := storage.PutOptions{
+		ContentType:        "application/json",
+		ContentEncoding:    "identity",
+		CacheControl:       "max-age=3600",
+		ContentDisposition: `attachment; filename="data.json"`,
+		Metadata: map[string]string{
+			"owner":   "test",
+			"version": "2",
+		},
+	}
+	require.NoError(t, store.Put(ctx, "metadata/key", func(w io.Writer) error {
+		_, err := io.WriteString(w, `{}`)
+		return err
+	}, opts))
+
+	check := func(t *testing.T, meta *storage.Meta) {
+		assert.Equal(t, opts.ContentType, meta.ContentType)
+		assert.Equal(t, opts.ContentEncoding, meta.ContentEncoding)
+		assert.Equal(t, opts.CacheControl, meta.CacheControl)
+		assert.Equal(t, opts.ContentDisposition, meta.ContentDisposition)
+		assert.Equal(t, opts.Metadata, meta.Metadata)
+	}
+
+	t.Run("Get", func(t *testing.T) {
+		require.NoError(t, store.Get(ctx, "metadata/key", func(meta *storage.Meta, r io.Reader) error {
+			check(t, meta)
+			return nil
+		}, storage.GetOptions{IncludeMetadata: true}))
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		meta, err := storage.Stat(ctx, store, "metadata/key")
+		require.NoError(t, err)
+		check(t, meta)
+	})
+
+	t.Run("Overwrite", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, "metadata/key", func(w io.Writer) error {
+			_, err := io.WriteString(w, `{}`)
+			return err
+		}, storage.PutOptions{}))
+
+		meta, err := storage.Stat(ctx, store, "metadata/key")
+		require.NoError(t, err)
+		assert.Empty(t, meta.ContentEncoding)
+		assert.Empty(t, meta.Metadata)
+	})
+}
+
+// RunCopyTests checks the behavior of storage.Copy and storage.Move within a
+// blob store, both using the blob store's own Copier implementation, if any,
+// and by streaming the content of the blobs.
+func RunCopyTests(t *testing.T, store storage.BlobStore) {
+	ctx := context.Background()
+
+	opts := storage.PutOptions{
+		ContentType: "text/plain",
+		Metadata: map[string]string{
+			"owner": "test",
+		},
+	}
+
+	stores := map[string]storage.BlobStore{
+		"Copier":    store,
+		"Streaming": struct{ storage.BlobStore }{store},
+	}
+	for name, store := range stores {
+		store := store
+		prefix := strings.ToLower(name) + "/"
+
+		put := func(key, content string) {
+			require.NoError(t, store.Put(ctx, prefix+key, func(w io.Writer) error {
+				_, err := io.WriteString(w, content)
+				return err
+			}, opts))
+		}
+
+		get := func(key string) (*storage.Meta, string, error) {
+			var meta *storage.Meta
+			var buf bytes.Buffer
+			err := store.Get(ctx, prefix+key, func(m *storage.Meta, r io.Reader) error {
+				meta = m
+				_, err := io.Copy(&buf, r)
+				return err
+			}, storage.GetOptions{IncludeMetadata: true})
+			return meta, buf.String(), err
+		}
+
+		t.Run(name, func(t *testing.T) {
+			t.Run("Copy", func(t *testing.T) {
+				put("copy/src", "test content")
+				require.NoError(t, storage.Copy(ctx, store, prefix+"copy/src", store, prefix+"copy/dst", storage.CopyOptions{}))
+
+				meta, content, err := get("copy/dst")
+				require.NoError(t, err)
+				assert.Equal(t, "test content", content)
+				assert.Equal(t, opts.ContentType, meta.ContentType)
+				assert.Equal(t, opts.Metadata, meta.Metadata)
+
+				_, content, err = get("copy/src")
+				require.NoError(t, err)
+				assert.Equal(t, "test content", content)
+			})
+
+			t.Run("Move", func(t *testing.T) {
+				put("move/src", "test content")
+				require.NoError(t, storage.Move(ctx, store, prefix+"move/src", store, prefix+"move/dst", storage.CopyOptions{}))
+
+				meta, content, err := get("move/dst")
+				require.NoError(t, err)
+				assert.Equal(t, "test content", content)
+				assert.Equal(t, opts.Metadata, meta.Metadata)
+
+				_, _, err = get("move/src")
+				require.True(t, storage.IsNotFoundError(err), "%+v", err)
+			})
+
+			t.Run("Move changed blob", func(t *testing.T) {
+				put("changed/src", "first")
+				src, _, err := get("changed/src")
+				require.NoError(t, err)
+				put("changed/src", "second")
+
+				err = storage.Move(ctx, store, prefix+"changed/src", store, prefix+"changed/dst", storage.CopyOptions{SourceIfMatch: src.ETag})
+				require.True(t, storage.IsPreconditionFailedError(err), "%+v", err)
+
+				_, content, err := get("changed/src")
+				require.NoError(t, err)
+				assert.Equal(t, "second", content)
+			})
+
+			t.Run("Missing blob", func(t *testing.T) {
+				err := storage.Copy(ctx, store, prefix+"missing", store, prefix+"dst", storage.CopyOptions{})
+				require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+				err = storage.Move(ctx, store, prefix+"missing", store, prefix+"dst", storage.CopyOptions{})
+				require.True(t, storage.IsNotFoundError(err), "%+v", err)
+			})
+
+			t.Run("Same blob", func(t *testing.T) {
+				put("same", "test content")
+				require.Error(t, storage.Move(ctx, store, prefix+"same", store, prefix+"same", storage.CopyOptions{}))
+
+				_, content, err := get("same")
+				require.NoError(t, err)
+				assert.Equal(t, "test content", content)
+			})
+		})
+	}
+}
+
+// RunMultipartUploadTests checks the behavior of a blob store that implements
+// storage.MultipartUploader.
+func RunMultipartUploadTests(t *testing.T, store storage.BlobStore) {
+	uploader, ok := store.(storage.MultipartUploader)
+	require.True(t, ok, "%T does not implement storage.MultipartUploader", store)
+
+	ctx := context.Background()
+
+	uploadPart := func(key, uploadID string, number int, content string) (*storage.Part, error) {
+		return uploader.UploadPart(ctx, key, uploadID, number, func(w io.Writer) error {
+			_, err := io.WriteString(w, content)
+			return err
+		})
+	}
+
+	t.Run("Complete", func(t *testing.T) {
+		uploadID, err := uploader.InitiateUpload(ctx, "multipart/complete", storage.PutOptions{
+			ContentType: "text/plain",
+			Metadata:    map[string]string{"owner": "test"},
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, uploadID)
+
+		contents := map[int]string{1: "first ", 2: "second ", 5: "fifth"}
+
+		// Upload the parts out of order and in parallel.
+		var wg sync.WaitGroup
+		for _, number := range []int{5, 2, 1} {
+			number := number
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				part, err := uploadPart("multipart/complete", uploadID, number, contents[number])
+				if assert.NoError(t, err) {
+					assert.Equal(t, number, part.Number)
+					assert.NotEmpty(t, part.ETag)
+					assert.Equal(t, int64(len(contents[number])), part.Size)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Retrying a part replaces it.
+		_, err = uploadPart("multipart/complete", uploadID, 2, "retried ")
+		require.NoError(t, err)
+
+		parts, err := uploader.ListParts(ctx, "multipart/complete", uploadID)
+		require.NoError(t, err)
+		require.Len(t, parts, 3)
+		for i, number := range []int{1, 2, 5} {
+			assert.Equal(t, number, parts[i].Number)
+		}
+		assert.Equal(t, int64(len("retried ")), parts[1].Size)
+
+		// The blob does not exist until the upload is completed.
+		_, err = storage.Stat(ctx, store, "multipart/complete")
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+		require.NoError(t, uploader.CompleteUpload(ctx, "multipart/complete", uploadID, parts))
+
+		var buf bytes.Buffer
+		require.NoError(t, store.Get(ctx, "multipart/complete", func(meta *storage.Meta, r io.Reader) error {
+			assert.Equal(t, "text/plain", meta.ContentType)
+			assert.Equal(t, map[string]string{"owner": "test"}, meta.Metadata)
+			assert.Equal(t, int64(len("first retried fifth")), meta.Size)
+
+			_, err := io.Copy(&buf, r)
+			return err
+		}, storage.GetOptions{IncludeMetadata: true}))
+		assert.Equal(t, "first retried fifth", buf.String())
+
+		_, err = uploader.ListParts(ctx, "multipart/complete", uploadID)
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+	})
+
+	t.Run("Complete with subset of parts", func(t *testing.T) {
+		uploadID, err := uploader.InitiateUpload(ctx, "multipart/subset", storage.PutOptions{})
+		require.NoError(t, err)
+
+		first, err := uploadPart("multipart/subset", uploadID, 1, "first")
+		require.NoError(t, err)
+		_, err = uploadPart("multipart/subset", uploadID, 2, "second")
+		require.NoError(t, err)
+
+		require.NoError(t, uploader.CompleteUpload(ctx, "multipart/subset", uploadID, []*storage.Part{first}))
+
+		var buf bytes.Buffer
+		require.NoError(t, store.Get(ctx, "multipart/subset", func(meta *storage.Meta, r io.Reader) error {
+			_, err := io.Copy(&buf, r)
+			return err
+		}, storage.GetOptions{}))
+		assert.Equal(t, "first", buf.String())
+	})
+
+	t.Run("Invalid parts", func(t *testing.T) {
+		uploadID, err := uploader.InitiateUpload(ctx, "multipart/invalid", storage.PutOptions{})
+		require.NoError(t, err)
+		defer uploader.AbortUpload(ctx, "multipart/invalid", uploadID)
+
+		_, err = uploadPart("multipart/invalid", uploadID, 0, "zero")
+		require.Error(t, err)
+		_, err = uploadPart("multipart/invalid", uploadID, storage.MaxUploadParts+1, "too many")
+		require.Error(t, err)
+
+		first, err := uploadPart("multipart/invalid", uploadID, 1, "first")
+		require.NoError(t, err)
+		second, err := uploadPart("multipart/invalid", uploadID, 2, "second")
+		require.NoError(t, err)
+
+		require.Error(t, uploader.CompleteUpload(ctx, "multipart/invalid", uploadID, nil))
+		require.Error(t, uploader.CompleteUpload(ctx, "multipart/invalid", uploadID, []*storage.Part{second, first}))
+		require.Error(t, uploader.CompleteUpload(ctx, "multipart/invalid", uploadID, []*storage.Part{
+			first,
+			{Number: 2, ETag: "not-an-etag"},
+		}))
+		require.Error(t, uploader.CompleteUpload(ctx, "multipart/invalid", uploadID, []*storage.Part{
+			first,
+			{Number: 3, ETag: second.ETag},
+		}))
+
+		_, err = storage.Stat(ctx, store, "multipart/invalid")
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+	})
+
+	t.Run("Abort", func(t *testing.T) {
+		uploadID, err := uploader.InitiateUpload(ctx, "multipart/abort", storage.PutOptions{})
+		require.NoError(t, err)
+
+		part, err := uploadPart("multipart/abort", uploadID, 1, "first")
+		require.NoError(t, err)
+
+		require.NoError(t, uploader.AbortUpload(ctx, "multipart/abort", uploadID))
+
+		_, err = uploader.ListParts(ctx, "multipart/abort", uploadID)
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+		err = uploader.CompleteUpload(ctx, "multipart/abort", uploadID, []*storage.Part{part})
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+		_, err = storage.Stat(ctx, store, "multipart/abort")
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+	})
+
+	t.Run("Unknown upload", func(t *testing.T) {
+		uploadID, err := uploader.InitiateUpload(ctx, "multipart/unknown", storage.PutOptions{})
+		require.NoError(t, err)
+		defer uploader.AbortUpload(ctx, "multipart/unknown", uploadID)
+
+		_, err = uploadPart("multipart/other", uploadID, 1, "first")
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+
+		_, err = uploader.ListParts(ctx, "multipart/unknown", "0123456789abcdef")
+		require.True(t, storage.IsNotFoundError(err), "%+v", err)
+	})
+}
@@ -0,0 +1,91 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"path"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// TransitClient encrypts and decrypts data using a named key of a Vault
+// transit secrets engine. It can be used as a key provider for envelope
+// encryption.
+type TransitClient struct {
+	client     *vaultapi.Client
+	enginePath string
+	key        string
+}
+
+func (c *TransitClient) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	sec, err := c.write(ctx, c.encryptPath(), map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return nil, err
+	} else if sec == nil {
+		return nil, ErrVaultDataNotFound
+	}
+
+	ciphertext, ok := sec.Data["ciphertext"].(string)
+	if !ok {
+		return nil, ErrVaultDataNotFound
+	}
+
+	return []byte(ciphertext), nil
+}
+
+func (c *TransitClient) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	sec, err := c.write(ctx, c.decryptPath(), map[string]interface{}{
+		"ciphertext": string(ciphertext),
+	})
+	if err != nil {
+		return nil, err
+	} else if sec == nil {
+		return nil, ErrVaultDataNotFound
+	}
+
+	encoded, ok := sec.Data["plaintext"].(string)
+	if !ok {
+		return nil, ErrVaultDataNotFound
+	}
+
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// write writes data to a path using the given context. Unlike WriteWithContext
+// in newer versions of the Vault API, the Logical client of the version we
+// depend on does not accept a context.
+func (c *TransitClient) write(ctx context.Context, p string, data map[string]interface{}) (*vaultapi.Secret, error) {
+	r := c.client.NewRequest(http.MethodPut, "/v1/"+p)
+	if err := r.SetJSONBody(data); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.RawRequestWithContext(ctx, r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return vaultapi.ParseSecret(resp.Body)
+}
+
+func (c *TransitClient) encryptPath() string {
+	return path.Join(c.enginePath, "encrypt", c.key)
+}
+
+func (c *TransitClient) decryptPath() string {
+	return path.Join(c.enginePath, "decrypt", c.key)
+}
+
+func NewTransitClient(delegate *vaultapi.Client, enginePath, key string) *TransitClient {
+	return &TransitClient{
+		client:     delegate,
+		enginePath: enginePath,
+		key:        key,
+	}
+}
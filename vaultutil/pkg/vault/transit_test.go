@@ -0,0 +1,122 @@
+package vault_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	vaultutil "github.com/puppetlabs/leg/vaultutil/pkg/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransit implements the encrypt and decrypt endpoints of a Vault transit
+// secrets engine mounted at transit/. Ciphertexts are the base64-encoded
+// plaintext prefixed with the key name.
+type fakeTransit struct {
+	block chan struct{}
+}
+
+func (ft *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// The server only notices that the client went away once the request body
+	// has been read, so block after decoding it.
+	if ft.block != nil {
+		select {
+		case <-ft.block:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	data := make(map[string]interface{})
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/transit/encrypt/"):
+		key := strings.TrimPrefix(r.URL.Path, "/v1/transit/encrypt/")
+		data["ciphertext"] = "vault:" + key + ":" + req["plaintext"]
+	case strings.HasPrefix(r.URL.Path, "/v1/transit/decrypt/"):
+		key := strings.TrimPrefix(r.URL.Path, "/v1/transit/decrypt/")
+		plaintext := strings.TrimPrefix(req["ciphertext"], "vault:"+key+":")
+		if plaintext == req["ciphertext"] {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"invalid ciphertext"}})
+			return
+		}
+		data["plaintext"] = plaintext
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func withFakeTransit(t *testing.T, ft *fakeTransit, fn func(client *vaultapi.Client)) {
+	srv := httptest.NewServer(ft)
+	defer srv.Close()
+
+	cfg := vaultapi.DefaultConfig()
+	cfg.Address = srv.URL
+	cfg.MaxRetries = 0
+
+	client, err := vaultapi.NewClient(cfg)
+	require.NoError(t, err)
+	client.SetToken("test")
+
+	fn(client)
+}
+
+func TestTransitClient(t *testing.T) {
+	ctx := context.Background()
+
+	withFakeTransit(t, &fakeTransit{}, func(client *vaultapi.Client) {
+		tc := vaultutil.NewTransitClient(client, "transit", "blobs")
+
+		ciphertext, err := tc.Encrypt(ctx, []byte("secret"))
+		require.NoError(t, err)
+		assert.Equal(t, "vault:blobs:"+base64.StdEncoding.EncodeToString([]byte("secret")), string(ciphertext))
+
+		plaintext, err := tc.Decrypt(ctx, ciphertext)
+		require.NoError(t, err)
+		assert.Equal(t, "secret", string(plaintext))
+
+		_, err = vaultutil.NewTransitClient(client, "transit", "other").Decrypt(ctx, ciphertext)
+		require.Error(t, err)
+	})
+}
+
+func TestTransitClientContext(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	withFakeTransit(t, &fakeTransit{block: block}, func(client *vaultapi.Client) {
+		tc := vaultutil.NewTransitClient(client, "transit", "blobs")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		_, err := tc.Encrypt(ctx, []byte("secret"))
+		require.Error(t, err)
+		assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+
+		_, err = tc.Decrypt(ctx, []byte("vault:blobs:c2VjcmV0"))
+		require.Error(t, err)
+	})
+}